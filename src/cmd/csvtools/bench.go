@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"csvtools/src/internal/csvio"
+)
+
+// benchTarget is a converter or command run against the generated files.
+type benchTarget struct {
+	name string
+	// converter is the binary run, to_sqlite or to_xlsx; empty for csvtools commands.
+	converter string
+	// allFiles is set if the target processes every generated file rather
+	// than the first one.
+	allFiles bool
+	// args builds the command line for the generated directory and files;
+	// out is a scratch directory for outputs.
+	args func(dir string, files []string, out string) []string
+}
+
+// benchResult is one row of the bench output.
+type benchResult struct {
+	target     string
+	rows       int
+	bytes      int64
+	seconds    float64
+	rowsPerSec float64
+	maxRSS     int64
+}
+
+var benchHeader = []string{"target", "rows", "bytes", "seconds", "rows_per_sec", "max_rss_bytes"}
+
+// runBench generates synthetic CSV files of a configurable shape, runs every
+// target against them in a separate process and reports rows per second and
+// peak memory as CSV. With -baseline, a previous report is compared against
+// and the command fails if a target got slower than -tolerance allows.
+func runBench(args []string) error {
+	fs := newFlagSet("bench")
+	var d dialect
+	d.register(fs)
+	rows := fs.Int("rows", 100_000, "data rows per generated file")
+	cols := fs.Int("cols", 10, "columns per generated file")
+	files := fs.Int("files", 1, "number of generated files")
+	cellSize := fs.Int("cell-size", 8, "average length of text cells")
+	quoted := fs.Float64("quoted", 0.1, "fraction of text cells containing a delimiter, quote or line break")
+	seed := fs.Uint64("seed", 1, "seed for the generated data, so runs are comparable")
+	runs := fs.Int("runs", 3, "runs per target; the fastest is reported")
+	targets := fs.String("targets", "", "comma separated targets to run (default all available): "+strings.Join(benchTargetNames(), ", "))
+	toSQLite := fs.String("to-sqlite", "", "to_sqlite binary (default: next to csvtools or on PATH)")
+	toXLSX := fs.String("to-xlsx", "", "to_xlsx binary (default: next to csvtools or on PATH)")
+	baseline := fs.String("baseline", "", "previous bench output to compare against")
+	tolerance := fs.Float64("tolerance", 0.1, "allowed drop in rows/sec relative to the baseline")
+	keep := fs.String("keep", "", "generate the files into this directory and keep them")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *rows < 1 || *cols < 1 || *files < 1 || *runs < 1 {
+		return fmt.Errorf("-rows, -cols, -files and -runs must be positive")
+	}
+
+	dir := *keep
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "csvtools-bench-*")
+		if err != nil {
+			return fmt.Errorf("failed to create temp dir: %w", err)
+		}
+		defer func() {
+			_ = os.RemoveAll(tmp)
+		}()
+		dir = tmp
+	}
+	dataDir := filepath.Join(dir, "data")
+	outDir := filepath.Join(dir, "out")
+	for _, sub := range []string{dataDir, outDir} {
+		if err := os.MkdirAll(sub, 0o755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", sub, err)
+		}
+	}
+
+	shape := benchShape{rows: *rows, cols: *cols, cellSize: *cellSize, quoted: *quoted}
+	rng := rand.New(rand.NewPCG(*seed, *seed))
+	var paths []string
+	var size int64
+	for i := range *files {
+		path := filepath.Join(dataDir, fmt.Sprintf("bench_%d.csv", i+1))
+		n, err := generateCSV(path, shape, rng)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		size += n
+	}
+	logger.Info("📦  Generated input", "dir", dataDir, "files", *files, "rows", *rows**files, "bytes", size)
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate csvtools: %w", err)
+	}
+	binaries := map[string]string{
+		"to_sqlite": findConverter(*toSQLite, "to_sqlite", self),
+		"to_xlsx":   findConverter(*toXLSX, "to_xlsx", self),
+	}
+
+	selected := benchTargetNames()
+	explicit := *targets != ""
+	if explicit {
+		selected = strings.Split(*targets, ",")
+	}
+	var results []benchResult
+	for _, name := range selected {
+		target, ok := benchTargetByName(strings.TrimSpace(name))
+		if !ok {
+			return fmt.Errorf("unknown bench target %q", name)
+		}
+		cmd := target.args(dataDir, paths, outDir)
+		if target.converter != "" {
+			bin := binaries[target.converter]
+			if bin == "" {
+				if explicit {
+					return fmt.Errorf("%s binary not found, use -%s", target.converter, strings.ReplaceAll(target.converter, "_", "-"))
+				}
+				logger.Warn("⚠️  Skipping target, binary not found", "target", target.name)
+				continue
+			}
+			cmd[0] = bin
+		} else {
+			cmd = append([]string{self}, cmd...)
+		}
+		rowCount, inputBytes := *rows, fileSize(paths[0])
+		if target.allFiles {
+			rowCount, inputBytes = *rows**files, size
+		}
+		result, err := benchRun(target.name, cmd, *runs)
+		if err != nil {
+			return err
+		}
+		result.rows = rowCount
+		result.bytes = inputBytes
+		result.rowsPerSec = float64(rowCount) / result.seconds
+		logger.Info("⏱️  Benchmarked", "target", result.target, "rows_per_sec", int64(result.rowsPerSec), "max_rss_bytes", result.maxRSS)
+		results = append(results, result)
+	}
+
+	out, err := d.create()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	writer, err := d.writer(out)
+	if err != nil {
+		return err
+	}
+	if err := writer.Write(benchHeader); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	for _, r := range results {
+		err := writer.Write([]string{
+			r.target,
+			strconv.Itoa(r.rows),
+			strconv.FormatInt(r.bytes, 10),
+			strconv.FormatFloat(r.seconds, 'f', 4, 64),
+			strconv.FormatFloat(r.rowsPerSec, 'f', 0, 64),
+			strconv.FormatInt(r.maxRSS, 10),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	if *baseline != "" {
+		return compareBaseline(*baseline, results, *tolerance)
+	}
+	return nil
+}
+
+var benchTargets = []benchTarget{
+	{name: "to_sqlite", converter: "to_sqlite", allFiles: true, args: func(dir string, files []string, out string) []string {
+		return []string{"", "-src", dir, "-dest", out, "-overwrite"}
+	}},
+	{name: "to_sqlite_fast", converter: "to_sqlite", allFiles: true, args: func(dir string, files []string, out string) []string {
+		return []string{"", "-src", dir, "-dest", out, "-overwrite", "-fast"}
+	}},
+	{name: "to_xlsx", converter: "to_xlsx", allFiles: true, args: func(dir string, files []string, out string) []string {
+		return []string{"", "-src", dir, "-dest", out, "-overwrite"}
+	}},
+	{name: "clean", args: func(dir string, files []string, out string) []string {
+		return []string{"clean", "-o", os.DevNull, files[0]}
+	}},
+	{name: "freq", args: func(dir string, files []string, out string) []string {
+		return []string{"freq", "-c", "1,2", "-o", os.DevNull, files[0]}
+	}},
+	{name: "grep", allFiles: true, args: func(dir string, files []string, out string) []string {
+		return append([]string{"grep", "-count", "x"}, files...)
+	}},
+	{name: "transpose", args: func(dir string, files []string, out string) []string {
+		return []string{"transpose", "-o", os.DevNull, files[0]}
+	}},
+}
+
+func benchTargetNames() []string {
+	names := make([]string, len(benchTargets))
+	for i, t := range benchTargets {
+		names[i] = t.name
+	}
+	return names
+}
+
+func benchTargetByName(name string) (benchTarget, bool) {
+	for _, t := range benchTargets {
+		if t.name == name {
+			return t, true
+		}
+	}
+	return benchTarget{}, false
+}
+
+// findConverter returns the converter binary to benchmark: the explicit
+// path, a binary next to csvtools, or one on PATH. It returns "" if none.
+func findConverter(explicit, name, self string) string {
+	if explicit != "" {
+		return explicit
+	}
+	sibling := filepath.Join(filepath.Dir(self), name)
+	if _, err := os.Stat(sibling); err == nil {
+		return sibling
+	}
+	if path, err := exec.LookPath(name); err == nil {
+		return path
+	}
+	return ""
+}
+
+// benchRun runs cmd the given number of times and returns the fastest run.
+func benchRun(name string, cmd []string, runs int) (benchResult, error) {
+	best := benchResult{target: name}
+	for i := range runs {
+		c := exec.Command(cmd[0], cmd[1:]...)
+		c.Stdout = io.Discard
+		var stderr strings.Builder
+		c.Stderr = &stderr
+		start := time.Now()
+		if err := c.Run(); err != nil {
+			return best, fmt.Errorf("bench target %s failed: %w\n%s", name, err, stderr.String())
+		}
+		elapsed := time.Since(start).Seconds()
+		if i == 0 || elapsed < best.seconds {
+			best.seconds = elapsed
+		}
+		best.maxRSS = max(best.maxRSS, maxRSS(c.ProcessState))
+	}
+	return best, nil
+}
+
+// benchShape describes the generated files.
+type benchShape struct {
+	rows, cols int
+	cellSize   int
+	quoted     float64
+}
+
+// generateCSV writes a file with a header and rows of integer, decimal and
+// text columns in turn, and returns its size.
+func generateCSV(path string, shape benchShape, rng *rand.Rand) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	writer := csvio.NewWriter(f, csvio.WriterOptions{})
+	record := make([]string, shape.cols)
+	for c := range record {
+		record[c] = fmt.Sprintf("col_%d", c+1)
+	}
+	if err := writer.Write(record); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	for r := range shape.rows {
+		for c := range record {
+			switch c % 3 {
+			case 0:
+				record[c] = strconv.Itoa(r + 1)
+			case 1:
+				record[c] = strconv.FormatFloat(rng.Float64()*1000, 'f', 2, 64)
+			default:
+				n := 1 + rng.IntN(2*max(shape.cellSize, 1))
+				b := make([]byte, n)
+				for i := range b {
+					b[i] = letters[rng.IntN(len(letters))]
+				}
+				if rng.Float64() < shape.quoted {
+					b[rng.IntN(n)] = ",\"\n"[rng.IntN(3)]
+				}
+				record[c] = string(b)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return 0, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return fileSize(path), nil
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// compareBaseline fails if any target is slower than in the baseline report
+// by more than tolerance.
+func compareBaseline(path string, results []benchResult, tolerance float64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open baseline %s: %w", path, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return fmt.Errorf("failed to read baseline %s: %w", path, err)
+	}
+	before := make(map[string]float64)
+	for _, record := range records[min(1, len(records)):] {
+		if len(record) != len(benchHeader) {
+			continue
+		}
+		if v, err := strconv.ParseFloat(record[4], 64); err == nil {
+			before[record[0]] = v
+		}
+	}
+	var regressed []string
+	for _, r := range results {
+		old, ok := before[r.target]
+		if !ok || old == 0 {
+			continue
+		}
+		change := r.rowsPerSec/old - 1
+		logger.Info("📊  Compared to baseline", "target", r.target, "baseline_rows_per_sec", int64(old),
+			"rows_per_sec", int64(r.rowsPerSec), "change", fmt.Sprintf("%+.1f%%", change*100))
+		if change < -tolerance {
+			regressed = append(regressed, fmt.Sprintf("%s (%+.1f%%)", r.target, change*100))
+		}
+	}
+	if len(regressed) > 0 {
+		return errors.New("performance regression: " + strings.Join(regressed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// cleanOptions selects the cell cleanups applied by runClean.
+type cleanOptions struct {
+	trim          bool
+	collapseSpace bool
+	stripControl  bool
+	fixQuotes     bool
+	joinBroken    bool
+}
+
+// cleanReport counts the cells changed by each cleanup.
+type cleanReport struct {
+	cells         int
+	trimmed       int
+	collapsed     int
+	controlChars  int
+	smartQuotes   int
+	joinedRecords int
+}
+
+var smartQuotes = strings.NewReplacer(
+	"“", `"`, "”", `"`, "„", `"`, "‟", `"`, "«", `"`, "»", `"`,
+	"‘", "'", "’", "'", "‚", "'", "‛", "'", "′", "'", "″", `"`,
+)
+
+// runClean trims cells, collapses internal whitespace, strips control
+// characters and replaces typographic quotes. Input is parsed leniently so
+// stray quotes survive, and records broken in two by a line break inside an
+// unquoted field are joined back when that restores the header width.
+func runClean(args []string) error {
+	fs := newFlagSet("clean")
+	var d dialect
+	d.register(fs)
+	var opts cleanOptions
+	fs.BoolVar(&opts.trim, "trim", true, "trim leading and trailing whitespace")
+	fs.BoolVar(&opts.collapseSpace, "collapse-space", true, "collapse runs of internal whitespace into one space")
+	fs.BoolVar(&opts.stripControl, "strip-control", true, "remove non-printable and control characters")
+	fs.BoolVar(&opts.fixQuotes, "fix-quotes", true, "replace smart quotes with plain ASCII quotes")
+	fs.BoolVar(&opts.joinBroken, "join-broken-rows", true, "join records split by a line break inside an unquoted field")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	name, err := inputArg(fs)
+	if err != nil {
+		return err
+	}
+
+	d.lazyQuotes = true
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	reader, err := d.reader(in, name)
+	if err != nil {
+		return err
+	}
+	out, err := d.create()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	writer, err := d.writer(out)
+	if err != nil {
+		return err
+	}
+
+	var report cleanReport
+	width := -1
+	var pending []string
+	flush := func(record []string) error {
+		for i, cell := range record {
+			record[i] = opts.cleanCell(cell, &report)
+		}
+		return writer.Write(record)
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if width < 0 {
+			width = len(record)
+		}
+		if opts.joinBroken && pending != nil {
+			if len(pending)+len(record)-1 == width {
+				joined := append(pending[:len(pending)-1:len(pending)-1], pending[len(pending)-1]+" "+record[0])
+				record = append(joined, record[1:]...)
+				report.joinedRecords++
+			} else if err := flush(pending); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			pending = nil
+		}
+		if opts.joinBroken && len(record) < width {
+			pending = record
+			continue
+		}
+		if err := flush(record); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	if pending != nil {
+		if err := flush(pending); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	logger.Info("✅  Cleaned cells", "cells", report.cells, "trimmed", report.trimmed,
+		"collapsed", report.collapsed, "control_chars", report.controlChars,
+		"smart_quotes", report.smartQuotes, "joined_records", report.joinedRecords)
+	return nil
+}
+
+// cleanCell applies the enabled cleanups to cell, counting changes in report.
+func (o cleanOptions) cleanCell(cell string, report *cleanReport) string {
+	original := cell
+	if o.fixQuotes {
+		if fixed := smartQuotes.Replace(cell); fixed != cell {
+			cell = fixed
+			report.smartQuotes++
+		}
+	}
+	if o.stripControl {
+		stripped := strings.Map(func(r rune) rune {
+			switch {
+			case r == '\n' || r == '\t':
+				return r
+			case r == '\r':
+				// Stray carriage returns from broken line endings become spaces.
+				return ' '
+			case unicode.IsControl(r) || r == unicode.ReplacementChar ||
+				(unicode.Is(unicode.Cf, r) && r != '\u200d'): // keep zero width joiners used by emoji
+				return -1
+			}
+			return r
+		}, cell)
+		if stripped != cell {
+			cell = stripped
+			report.controlChars++
+		}
+	}
+	if o.trim {
+		if trimmed := strings.TrimSpace(cell); trimmed != cell {
+			cell = trimmed
+			report.trimmed++
+		}
+	}
+	if o.collapseSpace {
+		inner := strings.TrimSpace(cell)
+		if collapsed := strings.Join(strings.Fields(inner), " "); collapsed != inner {
+			cell = leadingSpace(cell) + collapsed + trailingSpace(cell)
+			report.collapsed++
+		}
+	}
+	if cell != original {
+		report.cells++
+	}
+	return cell
+}
+
+func leadingSpace(s string) string {
+	return s[:len(s)-len(strings.TrimLeftFunc(s, unicode.IsSpace))]
+}
+
+func trailingSpace(s string) string {
+	return s[len(strings.TrimRightFunc(s, unicode.IsSpace)):]
+}
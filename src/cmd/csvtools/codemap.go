@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/connector"
+	"csvtools/src/internal/csvio"
+)
+
+// mapStage replaces the codes of a column with their labels, e.g. an ERP's
+// status "01" with "Active". The mapping is a CSV at any source location
+// whose from column (default the first) holds the codes and to column
+// (default the second) the labels; it is loaded once and reused for every
+// input. Original, if set, keeps the code in a column of that name right
+// after the mapped one. Unmapped says what happens to codes the mapping
+// lacks: keep them (the default), empty the cell, put Default in it, or
+// fail. Empty cells are left alone unless the mapping has an empty code.
+type mapStage struct {
+	Column    string `yaml:"column"`
+	CSV       string `yaml:"csv"`
+	Delimiter string `yaml:"delimiter"`
+	From      string `yaml:"from"`
+	To        string `yaml:"to"`
+	Original  string `yaml:"original"`
+	Unmapped  string `yaml:"unmapped"`
+	Default   string `yaml:"default"`
+	// Report is a CSV to list the unmapped codes in, with the number of
+	// rows holding them and where they first turned up.
+	Report string `yaml:"report"`
+
+	loaded   bool
+	labels   map[string]string
+	col      int
+	input    string
+	mapped   int
+	unmapped map[string]*unmappedCode
+	codes    []string
+}
+
+// unmappedCode is a code missing from a mapping.
+type unmappedCode struct {
+	rows  int
+	input string
+	line  int
+}
+
+func (s *mapStage) prepare(header []string) ([]string, error) {
+	if s.Column == "" || s.CSV == "" {
+		return nil, fmt.Errorf("map needs a column and a csv")
+	}
+	switch s.Unmapped {
+	case "":
+		s.Unmapped = "keep"
+		if s.Default != "" {
+			s.Unmapped = "default"
+		}
+	case "keep", "empty", "default", "error":
+	default:
+		return nil, fmt.Errorf("map: unknown unmapped %q (want keep, empty, default or error)", s.Unmapped)
+	}
+	if !s.loaded {
+		if err := s.load(); err != nil {
+			return nil, fmt.Errorf("map: %w", err)
+		}
+		s.loaded = true
+	}
+	var err error
+	if s.col, err = resolveColumn(header, s.Column); err != nil {
+		return nil, fmt.Errorf("map: %w", err)
+	}
+	if s.Original == "" {
+		return header, nil
+	}
+	if _, err := resolveColumn(header, s.Original); err == nil {
+		return nil, fmt.Errorf("map: column %s already exists", s.Original)
+	}
+	return slices.Insert(slices.Clip(header), s.col+1, s.Original), nil
+}
+
+// begin notes the input, for the report.
+func (s *mapStage) begin(in connector.Input) {
+	s.input = in.Name
+}
+
+func (s *mapStage) apply(record []string, line int) ([]string, bool, error) {
+	for len(record) <= s.col {
+		record = append(record, "")
+	}
+	code := record[s.col]
+	if s.Original != "" {
+		record = slices.Insert(record, s.col+1, code)
+	}
+	if label, ok := s.labels[code]; ok {
+		record[s.col] = label
+		s.mapped++
+		return record, true, nil
+	}
+	if code == "" {
+		return record, true, nil
+	}
+	if s.unmapped == nil {
+		s.unmapped = make(map[string]*unmappedCode)
+	}
+	u, seen := s.unmapped[code]
+	if !seen {
+		u = &unmappedCode{input: s.input, line: line}
+		s.unmapped[code] = u
+		s.codes = append(s.codes, code)
+	}
+	u.rows++
+	switch s.Unmapped {
+	case "error":
+		return nil, false, fmt.Errorf("line %d: %s has no label for %q in %s", line, s.Column, code, s.CSV)
+	case "empty":
+		record[s.col] = ""
+	case "default":
+		record[s.col] = s.Default
+	}
+	return record, true, nil
+}
+
+// load reads the mapping into labels.
+func (s *mapStage) load() error {
+	header, rows, err := readReferenceCSV(s.CSV, s.Delimiter)
+	if err != nil {
+		return err
+	}
+	from, to := 0, 1
+	if s.From != "" {
+		if from, err = resolveColumn(header, s.From); err != nil {
+			return fmt.Errorf("mapping: %w", err)
+		}
+	}
+	if s.To != "" {
+		if to, err = resolveColumn(header, s.To); err != nil {
+			return fmt.Errorf("mapping: %w", err)
+		}
+	} else if len(header) < 2 {
+		return fmt.Errorf("mapping %s needs a code and a label column", s.CSV)
+	}
+	s.labels = make(map[string]string, len(rows))
+	for _, row := range rows {
+		code, label := field(row, from), field(row, to)
+		if prev, dup := s.labels[code]; dup && prev != label {
+			return fmt.Errorf("mapping %s gives code %q two labels, %q and %q", s.CSV, code, prev, label)
+		}
+		s.labels[code] = label
+	}
+	logger.Info("📚  Loaded code mapping", "column", s.Column, "codes", len(s.labels))
+	return nil
+}
+
+// finish logs the mapped and unmapped cells.
+func (s *mapStage) finish() {
+	rows := 0
+	for _, u := range s.unmapped {
+		rows += u.rows
+	}
+	logger.Info("🏷️  Mapped codes", "column", s.Column, "mapped", s.mapped, "unmapped", rows)
+	if len(s.codes) > 0 {
+		shown := s.codes[:min(len(s.codes), 10)]
+		logger.Warn("⚠️  Codes without a label", "column", s.Column, "codes", strings.Join(shown, ","), "more", len(s.codes)-len(shown))
+	}
+}
+
+// finishMaps finishes the map stages among stages and writes their
+// reports; stages sharing a report list their codes in one file.
+func finishMaps(stages []stage, policy atomicfile.Policy) error {
+	var reports []string
+	byReport := make(map[string][]*mapStage)
+	for _, s := range stages {
+		if s, ok := s.(*mapStage); ok {
+			s.finish()
+			if s.Report == "" {
+				continue
+			}
+			if _, seen := byReport[s.Report]; !seen {
+				reports = append(reports, s.Report)
+			}
+			byReport[s.Report] = append(byReport[s.Report], s)
+		}
+	}
+	for _, path := range reports {
+		if err := writeMapReport(path, byReport[path], policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeMapReport(path string, stages []*mapStage, policy atomicfile.Policy) error {
+	out, err := atomicfile.Create(path, policy)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	writer := csvio.NewWriter(out, csvio.WriterOptions{})
+	_ = writer.Write([]string{"column", "code", "rows", "input", "line"})
+	for _, s := range stages {
+		for _, code := range s.codes {
+			u := s.unmapped[code]
+			_ = writer.Write([]string{s.Column, code, strconv.Itoa(u.rows), u.input, strconv.Itoa(u.line)})
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return out.Commit()
+}
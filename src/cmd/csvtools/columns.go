@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// resolveColumns turns a comma separated list of column names or 1-based
+// indexes into 0-based indexes into header. An empty spec selects nothing.
+func resolveColumns(header []string, spec string) ([]int, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	var idx []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		i, err := resolveColumn(header, part)
+		if err != nil {
+			return nil, err
+		}
+		idx = append(idx, i)
+	}
+	return idx, nil
+}
+
+// resolveColumn finds a single column by exact name, falling back to a
+// 1-based index when no header has that name.
+func resolveColumn(header []string, name string) (int, error) {
+	for i, h := range header {
+		if h == name {
+			return i, nil
+		}
+	}
+	if n, err := strconv.Atoi(name); err == nil && n >= 1 && n <= len(header) {
+		return n - 1, nil
+	}
+	return 0, fmt.Errorf("unknown column %q", name)
+}
+
+// field returns record[i], or "" when the row is too short.
+func field(record []string, i int) string {
+	if i < len(record) {
+		return record[i]
+	}
+	return ""
+}
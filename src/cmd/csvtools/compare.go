@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"csvtools/src/internal/atomicfile"
+)
+
+// compareTable is a CSV read whole for comparison.
+type compareTable struct {
+	header []string
+	rows   []compareRow
+}
+
+// compareRow is a data row and its 1-based number in its file, header not
+// counted.
+type compareRow struct {
+	n     int
+	cells []string
+}
+
+// difference is a way the actual output differs from the golden file.
+// Kind is one of column-order, missing-column, extra-column, missing-row,
+// extra-row or cell.
+type difference struct {
+	Kind     string `json:"kind"`
+	Row      int    `json:"row,omitempty"`
+	Column   string `json:"column,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+// comparison is the result of comparing an output with its golden file.
+type comparison struct {
+	Golden       string       `json:"golden"`
+	Actual       string       `json:"actual"`
+	Equal        bool         `json:"equal"`
+	GoldenRows   int          `json:"golden_rows"`
+	ActualRows   int          `json:"actual_rows"`
+	Differences  []difference `json:"differences"`
+	Count        int          `json:"count"`
+	Truncated    bool         `json:"truncated"`
+	maxDiffs     int
+	ignoreOrder  bool
+	tolerance    float64
+	timestamps   map[string]bool
+	ignore       map[string]bool
+	ignoreColumn bool
+}
+
+// timestampLayouts are the layouts -timestamps columns are parsed with.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02",
+}
+
+// runCompare compares a CSV output with a golden file of the rows it should
+// hold, for snapshot tests: cells are compared as text, numbers within
+// -tolerance and -timestamps columns as instants, optionally ignoring the
+// order of columns and rows and some columns altogether. It reports the
+// differences as text or JSON and fails if there are any; -update rewrites
+// the golden file instead.
+func runCompare(args []string) error {
+	fs := newFlagSet("compare")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: csvtools compare -golden expected.csv [flags] [actual.csv]")
+		fs.PrintDefaults()
+	}
+	var d dialect
+	d.register(fs)
+	golden := fs.String("golden", "", "golden CSV file holding the expected rows (required)")
+	update := fs.Bool("update", false, "write the actual rows to the golden file instead of comparing")
+	ignoreColumnOrder := fs.Bool("ignore-column-order", false, "match columns by name wherever they are")
+	ignoreRowOrder := fs.Bool("ignore-row-order", false, "compare rows as a multiset rather than in order")
+	tolerance := fs.Float64("tolerance", 0, "treat numbers at most this far apart as equal (0 compares them as text)")
+	timestamps := fs.String("timestamps", "", "comma separated columns compared as instants, whatever their format or time zone")
+	ignore := fs.String("ignore", "", "comma separated columns left out of the comparison, such as load times or generated ids")
+	maxDiffs := fs.Int("max-diffs", 20, "differences reported, 0 for all")
+	format := fs.String("format", "text", "report format: text or json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *golden == "" {
+		return fmt.Errorf("-golden is required")
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("-format must be text or json, got %q", *format)
+	}
+	if *tolerance < 0 || *maxDiffs < 0 {
+		return fmt.Errorf("-tolerance and -max-diffs must not be negative")
+	}
+	name, err := inputArg(fs)
+	if err != nil {
+		return err
+	}
+
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(in)
+	_ = in.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if *update {
+		return updateGolden(*golden, data)
+	}
+	expected, err := readCompareTable(&d, *golden, nil)
+	if err != nil {
+		return err
+	}
+	actual, err := readCompareTable(&d, name, data)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = "-"
+	}
+	c := &comparison{
+		Golden:       *golden,
+		Actual:       name,
+		GoldenRows:   len(expected.rows),
+		ActualRows:   len(actual.rows),
+		Differences:  []difference{},
+		maxDiffs:     *maxDiffs,
+		ignoreOrder:  *ignoreRowOrder,
+		tolerance:    *tolerance,
+		timestamps:   columnSet(*timestamps),
+		ignore:       columnSet(*ignore),
+		ignoreColumn: *ignoreColumnOrder,
+	}
+	c.compare(expected, actual)
+	c.Equal = c.Count == 0
+
+	out, err := d.create()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	if *format == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(c)
+	} else {
+		err = c.writeText(out)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if !c.Equal {
+		return fmt.Errorf("%s differs from %s in %d places", name, *golden, c.Count)
+	}
+	logger.Info("🪞  Output matches golden file", "golden", *golden, "actual", name, "rows", len(actual.rows))
+	return nil
+}
+
+// updateGolden replaces the golden file with data.
+func updateGolden(path string, data []byte) error {
+	out, err := atomicfile.Create(path, atomicfile.Overwrite)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	if _, err := out.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := out.Commit(); err != nil {
+		return err
+	}
+	logger.Info("📸  Updated golden file", "golden", path, "bytes", len(data))
+	return nil
+}
+
+// readCompareTable reads the named CSV, from data if it isn't nil.
+func readCompareTable(d *dialect, name string, data []byte) (*compareTable, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if data == nil {
+		in, err := openInput(name)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = in.Close()
+		}()
+		r = in
+	}
+	reader, err := d.reader(r, name)
+	if err != nil {
+		return nil, err
+	}
+	t := &compareTable{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return t, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if t.header == nil {
+			t.header = slices.Clone(record)
+			continue
+		}
+		t.rows = append(t.rows, compareRow{n: len(t.rows) + 1, cells: slices.Clone(record)})
+	}
+}
+
+// columnSet is the set of names in a comma separated list.
+func columnSet(spec string) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			set[name] = true
+		}
+	}
+	return set
+}
+
+// add records a difference, keeping the first maxDiffs.
+func (c *comparison) add(diff difference) {
+	c.Count++
+	if c.maxDiffs > 0 && len(c.Differences) == c.maxDiffs {
+		c.Truncated = true
+		return
+	}
+	c.Differences = append(c.Differences, diff)
+}
+
+// compare records how actual differs from expected. Columns are matched by
+// name; rows are projected on the columns both have, in the golden file's
+// order, before being compared.
+func (c *comparison) compare(expected, actual *compareTable) {
+	actualIndex := make(map[string]int, len(actual.header))
+	for i, h := range actual.header {
+		if _, ok := actualIndex[h]; !ok {
+			actualIndex[h] = i
+		}
+	}
+	var golden, other []int
+	var columns []string
+	expectedNames := make(map[string]bool, len(expected.header))
+	for i, h := range expected.header {
+		expectedNames[h] = true
+		if c.ignore[h] {
+			continue
+		}
+		j, ok := actualIndex[h]
+		if !ok {
+			c.add(difference{Kind: "missing-column", Column: h})
+			continue
+		}
+		golden, other, columns = append(golden, i), append(other, j), append(columns, h)
+	}
+	for _, h := range actual.header {
+		if !expectedNames[h] && !c.ignore[h] {
+			c.add(difference{Kind: "extra-column", Column: h})
+		}
+	}
+	if !c.ignoreColumn && !slices.IsSorted(other) {
+		c.add(difference{Kind: "column-order", Expected: strings.Join(columns, ","), Actual: strings.Join(sortedBy(columns, other), ",")})
+	}
+
+	project := func(rows []compareRow, idx []int) []compareRow {
+		out := make([]compareRow, len(rows))
+		for i, row := range rows {
+			cells := make([]string, len(idx))
+			for k, j := range idx {
+				cells[k] = field(row.cells, j)
+			}
+			out[i] = compareRow{n: row.n, cells: cells}
+		}
+		return out
+	}
+	want, got := project(expected.rows, golden), project(actual.rows, other)
+	if c.ignoreOrder {
+		c.compareUnordered(columns, want, got)
+		return
+	}
+	for i := range max(len(want), len(got)) {
+		switch {
+		case i >= len(got):
+			c.add(difference{Kind: "missing-row", Row: want[i].n, Expected: strings.Join(want[i].cells, ",")})
+		case i >= len(want):
+			c.add(difference{Kind: "extra-row", Row: got[i].n, Actual: strings.Join(got[i].cells, ",")})
+		default:
+			for k, column := range columns {
+				if c.compareCells(column, want[i].cells[k], got[i].cells[k]) != 0 {
+					c.add(difference{Kind: "cell", Row: got[i].n, Column: column, Expected: want[i].cells[k], Actual: got[i].cells[k]})
+				}
+			}
+		}
+	}
+}
+
+// compareUnordered sorts both sides and walks them together, reporting the
+// golden rows missing from the output and the output rows not in the golden
+// file, each as many times as it is short or over.
+func (c *comparison) compareUnordered(columns []string, want, got []compareRow) {
+	compareRows := func(a, b compareRow) int {
+		for k, column := range columns {
+			if n := c.compareCells(column, a.cells[k], b.cells[k]); n != 0 {
+				return n
+			}
+		}
+		return 0
+	}
+	slices.SortStableFunc(want, compareRows)
+	slices.SortStableFunc(got, compareRows)
+	i, j := 0, 0
+	for i < len(want) || j < len(got) {
+		n := 0
+		switch {
+		case i == len(want):
+			n = 1
+		case j == len(got):
+			n = -1
+		default:
+			n = compareRows(want[i], got[j])
+		}
+		switch {
+		case n == 0:
+			i, j = i+1, j+1
+		case n < 0:
+			c.add(difference{Kind: "missing-row", Row: want[i].n, Expected: strings.Join(want[i].cells, ",")})
+			i++
+		default:
+			c.add(difference{Kind: "extra-row", Row: got[j].n, Actual: strings.Join(got[j].cells, ",")})
+			j++
+		}
+	}
+}
+
+// compareCells orders two cells of a column: as instants if it is a
+// -timestamps column and both parse, as numbers equal within -tolerance if
+// it is set and both parse, else as text.
+func (c *comparison) compareCells(column, a, b string) int {
+	if a == b {
+		return 0
+	}
+	if c.timestamps[column] {
+		if ta, ok := parseTimestamp(a); ok {
+			if tb, ok := parseTimestamp(b); ok {
+				return ta.Compare(tb)
+			}
+		}
+	}
+	if c.tolerance > 0 {
+		x, errA := strconv.ParseFloat(strings.TrimSpace(a), 64)
+		y, errB := strconv.ParseFloat(strings.TrimSpace(b), 64)
+		if errA == nil && errB == nil {
+			if math.Abs(x-y) <= c.tolerance {
+				return 0
+			}
+			return cmp.Compare(x, y)
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func parseTimestamp(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// sortedBy returns names ordered by their positions.
+func sortedBy(names []string, positions []int) []string {
+	order := make([]int, len(names))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int { return cmp.Compare(positions[a], positions[b]) })
+	out := make([]string, len(names))
+	for i, k := range order {
+		out[i] = names[k]
+	}
+	return out
+}
+
+func (c *comparison) writeText(w io.Writer) error {
+	if c.Equal {
+		_, err := fmt.Fprintf(w, "%s matches %s (%d rows)\n", c.Actual, c.Golden, c.ActualRows)
+		return err
+	}
+	fmt.Fprintf(w, "%s differs from %s in %d places (%d rows expected, %d found)\n", c.Actual, c.Golden, c.Count, c.GoldenRows, c.ActualRows)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, diff := range c.Differences {
+		where, what := "", ""
+		switch diff.Kind {
+		case "missing-column", "extra-column":
+			where = diff.Column
+		case "column-order":
+			what = fmt.Sprintf("expected %s, got %s", diff.Expected, diff.Actual)
+		case "missing-row":
+			where, what = fmt.Sprintf("row %d", diff.Row), diff.Expected
+		case "extra-row":
+			where, what = fmt.Sprintf("row %d", diff.Row), diff.Actual
+		case "cell":
+			where, what = fmt.Sprintf("row %d %s", diff.Row, diff.Column), fmt.Sprintf("expected %q, got %q", diff.Expected, diff.Actual)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", diff.Kind, where, what)
+	}
+	if c.Truncated {
+		fmt.Fprintf(tw, "  …\t%d more\t\n", c.Count-len(c.Differences))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// runCompletion prints a completion script for bash, zsh, fish or PowerShell,
+// generated from the command list and each command's flags.
+func runCompletion(args []string) error {
+	fs := newFlagSet("completion")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: csvtools completion bash|zsh|fish|powershell")
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one shell name")
+	}
+	switch fs.Arg(0) {
+	case "bash":
+		return bashCompletion(os.Stdout)
+	case "zsh":
+		return zshCompletion(os.Stdout)
+	case "fish":
+		return fishCompletion(os.Stdout)
+	case "powershell":
+		return powershellCompletion(os.Stdout)
+	}
+	return fmt.Errorf("unknown shell %q (want bash, zsh, fish or powershell)", fs.Arg(0))
+}
+
+// isBoolFlag reports whether f is set without a value, like -v.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// flagNames returns the flags of c as "-name".
+func flagNames(c command) []string {
+	var names []string
+	describe(c).VisitAll(func(f *flag.Flag) {
+		names = append(names, "-"+f.Name)
+	})
+	return names
+}
+
+func commandNames() []string {
+	names := make([]string, len(commands))
+	for i, c := range commands {
+		names[i] = c.name
+	}
+	return names
+}
+
+func bashCompletion(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# bash completion for csvtools\n")
+	b.WriteString("_csvtools() {\n")
+	b.WriteString("    local cur=${COMP_WORDS[COMP_CWORD]} flags=\n")
+	b.WriteString("    if [ \"$COMP_CWORD\" -eq 1 ]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(commandNames(), " "))
+	b.WriteString("        return\n    fi\n")
+	b.WriteString("    case ${COMP_WORDS[1]} in\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "        %s) flags=%q ;;\n", c.name, strings.Join(flagNames(c), " "))
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("    if [[ $cur == -* ]]; then\n")
+	b.WriteString("        COMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n")
+	b.WriteString("    else\n")
+	b.WriteString("        COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	b.WriteString("    fi\n")
+	b.WriteString("}\n")
+	b.WriteString("complete -o filenames -F _csvtools csvtools\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// zshQuote escapes s for a single quoted _arguments or _describe spec.
+func zshQuote(s string) string {
+	return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+func zshCompletion(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("#compdef csvtools\n\n")
+	b.WriteString("_csvtools() {\n")
+	b.WriteString("    local -a commands\n")
+	b.WriteString("    commands=(\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "        '%s:%s'\n", c.name, zshQuote(c.summary))
+	}
+	b.WriteString("    )\n")
+	b.WriteString("    if (( CURRENT == 2 )); then\n")
+	b.WriteString("        _describe 'command' commands\n")
+	b.WriteString("        return\n    fi\n")
+	b.WriteString("    case $words[2] in\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "        %s)\n            _arguments \\\n", c.name)
+		describe(c).VisitAll(func(f *flag.Flag) {
+			spec := fmt.Sprintf("-%s[%s]", f.Name, zshQuote(firstLine(f.Usage)))
+			if !isBoolFlag(f) {
+				spec += ":" + f.Name + ":_files"
+			}
+			fmt.Fprintf(&b, "                '%s' \\\n", spec)
+		})
+		b.WriteString("                '*:file:_files'\n            ;;\n")
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("}\n\n")
+	b.WriteString("compdef _csvtools csvtools\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fishQuote escapes s for a single quoted fish string.
+func fishQuote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s)
+}
+
+func fishCompletion(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# fish completion for csvtools\n")
+	b.WriteString("complete -c csvtools -f -n __fish_use_subcommand\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "complete -c csvtools -f -n __fish_use_subcommand -a %s -d '%s'\n", c.name, fishQuote(c.summary))
+	}
+	for _, c := range commands {
+		describe(c).VisitAll(func(f *flag.Flag) {
+			value := ""
+			if !isBoolFlag(f) {
+				value = " -r"
+			}
+			fmt.Fprintf(&b, "complete -c csvtools -n '__fish_seen_subcommand_from %s' -o %s%s -d '%s'\n",
+				c.name, f.Name, value, fishQuote(firstLine(f.Usage)))
+		})
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func powershellCompletion(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# PowerShell completion for csvtools\n")
+	b.WriteString("Register-ArgumentCompleter -Native -CommandName csvtools -ScriptBlock {\n")
+	b.WriteString("    param($wordToComplete, $commandAst, $cursorPosition)\n")
+	b.WriteString("    $commands = @{\n")
+	for _, c := range commands {
+		quoted := make([]string, 0)
+		for _, name := range flagNames(c) {
+			quoted = append(quoted, "'"+name+"'")
+		}
+		fmt.Fprintf(&b, "        '%s' = @(%s)\n", c.name, strings.Join(quoted, ", "))
+	}
+	b.WriteString("    }\n")
+	b.WriteString("    $elements = $commandAst.CommandElements\n")
+	b.WriteString("    if ($elements.Count -eq 1 -or ($elements.Count -eq 2 -and $wordToComplete)) {\n")
+	b.WriteString("        $candidates = $commands.Keys\n")
+	b.WriteString("    } else {\n")
+	b.WriteString("        $candidates = $commands[$elements[1].ToString()]\n")
+	b.WriteString("    }\n")
+	b.WriteString("    $candidates | Where-Object { $_ -like \"$wordToComplete*\" } | Sort-Object | ForEach-Object {\n")
+	b.WriteString("        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)\n")
+	b.WriteString("    }\n")
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// firstLine returns the first line of a flag usage text.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/columnar"
+	"csvtools/src/internal/connector"
+	"csvtools/src/internal/contact"
+	"csvtools/src/internal/csvio"
+	"csvtools/src/internal/discover"
+	"csvtools/src/internal/headers"
+	"csvtools/src/internal/lineage"
+	"csvtools/src/internal/rowhash"
+	"csvtools/src/internal/tableschema"
+	"csvtools/src/internal/units"
+)
+
+// targets is a flag.Value collecting the repeatable -to flag.
+type targets []string
+
+func (t *targets) String() string {
+	return strings.Join(*t, " ")
+}
+
+func (t *targets) Set(s string) error {
+	*t = append(*t, s)
+	return nil
+}
+
+// runConvert copies every CSV input of a source into one or more sinks, one
+// table per input, e.g. "-from s3://bucket/exports/ -to out.parquet". With
+// several -to flags each input is read once and written to all of them.
+func runConvert(args []string) error {
+	fs := newFlagSet("convert")
+	from := fs.String("from", "-", "source: a file or directory, - for stdin, clipboard, http(s)://, s3://bucket/key, s3://bucket/prefix/ or gsheet://<spreadsheet-id>")
+	var to targets
+	fs.Var(&to, "to", "sink: "+strings.Join(connector.SinkSchemes(), ", ")+"://path, or a path ending in .xlsx, .db, .parquet, .jsonl or .csv; may be repeated")
+	route := fs.String("route", "", "column whose value picks the output of every row, filled into the {value} placeholder of -to, e.g. -to out/{value}.xlsx")
+	maxRoutes := fs.Int("max-routes", connector.DefaultMaxRoutes, "fail when -route finds more values than this")
+	delimiter := fs.String("delimiter", "", "field delimiter of the inputs (default sniffed, or by extension)")
+	lenient := fs.Bool("lenient", false, "recover from malformed records instead of failing")
+	var sniff csvio.SniffFlags
+	sniff.Register(fs)
+	var separator csvio.SeparatorFlags
+	separator.Register(fs)
+	var skip csvio.SkipFlags
+	skip.Register(fs)
+	var asserts csvio.AssertFlags
+	asserts.Register(fs)
+	var parallel csvio.ParallelFlags
+	parallel.Register(fs)
+	infer := fs.Bool("infer", true, "type columns as bool, integer or float from the first batch of rows (default only for sqlite, parquet and xlsx sinks; csv and json keep the input text)")
+	batchSize := fs.Int("batch-size", columnar.DefaultBatchSize, "rows per batch")
+	queueDepth := fs.Int("queue-depth", columnar.DefaultQueueDepth, "batches to read ahead of slow sinks before reading waits; 0 reads in step with writing")
+	maxRecord := int64(csvio.DefaultMaxRecordSize)
+	fs.Func("max-record-size", "fail on a record larger than this, e.g. 512MB; 0 for no limit (default 64MB)", func(s string) (err error) {
+		maxRecord, err = discover.ParseSize(s)
+		return err
+	})
+	var lineageColumns lineage.Columns
+	fs.Var(&lineageColumns, "lineage", "add lineage columns: row_number, source_file, loaded_at or all")
+	var mappings []*mapStage
+	fs.Func("map", "replace the codes of a column with labels from a code,label CSV, e.g. status=status_codes.csv (repeatable)", func(v string) error {
+		column, location, ok := strings.Cut(v, "=")
+		if !ok || strings.TrimSpace(column) == "" || location == "" {
+			return fmt.Errorf("want column=mapping.csv, got %q", v)
+		}
+		mappings = append(mappings, &mapStage{Column: strings.TrimSpace(column), CSV: location})
+		return nil
+	})
+	mapOriginal := fs.String("map-original", "", "keep the codes of -map in a column named after the mapped one plus this suffix, e.g. _code")
+	mapUnmapped := fs.String("map-unmapped", "", "codes -map has no label for: keep (default), empty, default or error; -map-default implies default")
+	mapDefault := fs.String("map-default", "", "label to put in place of the codes -map has no label for")
+	mapReport := fs.String("map-report", "", "CSV to list the codes -map has no label for in")
+	var conversions []stage
+	fs.Func("unit", "convert the numbers of a column between units, as column=from:to or column=from:to:decimals, e.g. size=bytes:MB:1 or temp=F:C (repeatable)", func(v string) error {
+		column, spec, _ := strings.Cut(v, "=")
+		parts := strings.Split(spec, ":")
+		if strings.TrimSpace(column) == "" || len(parts) < 2 || len(parts) > 3 {
+			return fmt.Errorf("want column=from:to[:decimals], got %q", v)
+		}
+		s := &unitStage{Column: strings.TrimSpace(column), From: parts[0], To: parts[1]}
+		if len(parts) == 3 {
+			decimals, err := strconv.Atoi(parts[2])
+			if err != nil || decimals < 0 {
+				return fmt.Errorf("invalid decimals in %q", v)
+			}
+			s.Decimals = &decimals
+		}
+		if _, err := units.New(s.From, s.To); err != nil {
+			return err
+		}
+		conversions = append(conversions, s)
+		return nil
+	})
+	geoColumns := fs.String("geo", "", "check coordinates: a column of \"lat,long\" pairs to split into latitude and longitude, or the latitude and longitude columns as lat,lon")
+	geoOrder := fs.String("geo-order", "lat_lon", "order of the pairs -geo splits: lat_lon or lon_lat")
+	geoInvalid := fs.String("geo-invalid", "keep", "coordinates -geo can't parse or finds out of range: keep, empty or error")
+	geohash := fs.Int("geohash", 0, "add a geohash column of this many characters (1-12) for the -geo coordinates")
+	var normalized []*normalizeStage
+	fs.Func("normalize", "rewrite the emails, phone numbers or IBANs of a column in their normal form, as column=email, column=phone or column=iban (repeatable)", func(v string) error {
+		column, format, ok := strings.Cut(v, "=")
+		if !ok || strings.TrimSpace(column) == "" {
+			return fmt.Errorf("want column=format, got %q", v)
+		}
+		if !slices.Contains(contact.Formats, format) {
+			return fmt.Errorf("unknown format %q in %q (want %s)", format, v, strings.Join(contact.Formats, ", "))
+		}
+		normalized = append(normalized, &normalizeStage{Column: strings.TrimSpace(column), Format: format})
+		return nil
+	})
+	phoneRegion := fs.String("phone-region", "", "ISO country code of the phone numbers -normalize finds without a country code, e.g. DE")
+	normalizeInvalid := fs.String("normalize-invalid", "keep", "cells -normalize finds invalid: keep, empty or error")
+	rowHash := fs.String("row-hash", "", "add a fingerprint column hashing every row with sha256, sha1, md5 or xxhash")
+	rowHashColumns := fs.String("row-hash-columns", "", "comma separated columns -row-hash hashes, in that order (default all)")
+	rowHashColumn := fs.String("row-hash-column", rowhash.Column, "name of the -row-hash column")
+	schemaFile := fs.String("schema", "", "Frictionless table schema or CSVW metadata to type and check the inputs with, instead of CSVW sidecars")
+	emitSchema := fs.String("emit-schema", "", "directory to describe every output table in, as <table>.schema.json, <table>.csv-metadata.json or <table>.jsonschema.json")
+	schemaFormat := fs.String("schema-format", "frictionless", "format of -emit-schema: frictionless, csvw or jsonschema")
+	var columnOrder headers.ColumnOrder
+	columnOrder.Register(fs)
+	var outputFlags atomicfile.Flags
+	outputFlags.Register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("-to is required")
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v: use -from", fs.Args())
+	}
+	var comma rune
+	if *delimiter != "" {
+		var err error
+		if comma, err = discover.ParseDelimiter(*delimiter); err != nil {
+			return err
+		}
+	}
+	policy, err := outputFlags.Policy()
+	if err != nil {
+		return err
+	}
+	if err := columnOrder.Load(); err != nil {
+		return err
+	}
+	if err := sniff.Load(); err != nil {
+		return err
+	}
+	if err := separator.Load(); err != nil {
+		return err
+	}
+	if err := skip.Load(); err != nil {
+		return err
+	}
+	if err := asserts.Load(); err != nil {
+		return err
+	}
+	if err := parallel.Load(); err != nil {
+		return err
+	}
+	if *queueDepth < 0 {
+		return fmt.Errorf("-queue-depth must not be negative, got %d", *queueDepth)
+	}
+
+	// Text sinks get the cells as read unless -infer is given.
+	if !flagGiven(fs, "infer") {
+		*infer = connector.Typed(to)
+	}
+
+	var stages []stage
+	csvOpts := columnar.CSVOptions{BatchSize: *batchSize, Infer: *infer}
+	// Without thresholds the first violation fails the conversion.
+	violations := newViolationLog(validationConfig{})
+	var schema *tableschema.Schema
+	if *schemaFile != "" {
+		if schema, err = readSchema(*schemaFile); err != nil {
+			return err
+		}
+		stages = append(stages, &schemaStage{schema: schema, log: violations})
+		csvOpts.Types = schema.Types()
+	}
+	for _, m := range mappings {
+		m.Unmapped, m.Default, m.Report = *mapUnmapped, *mapDefault, *mapReport
+		if *mapOriginal != "" {
+			m.Original = m.Column + *mapOriginal
+		}
+		stages = append(stages, m)
+	}
+	stages = append(stages, conversions...)
+	if *geoColumns != "" {
+		g := &geoStage{Order: *geoOrder, Invalid: *geoInvalid, Precision: *geohash}
+		if lat, lon, ok := strings.Cut(*geoColumns, ","); ok {
+			g.Lat, g.Lon = strings.TrimSpace(lat), strings.TrimSpace(lon)
+		} else {
+			g.Column = *geoColumns
+		}
+		if *geohash != 0 {
+			g.Geohash = "geohash"
+		}
+		stages = append(stages, g)
+	} else if *geohash != 0 {
+		return fmt.Errorf("-geohash needs -geo")
+	}
+	for _, n := range normalized {
+		n.Region, n.Invalid = *phoneRegion, *normalizeInvalid
+		stages = append(stages, n)
+	}
+	if *rowHash != "" {
+		hash := &hashStage{Column: *rowHashColumn, Algorithm: *rowHash}
+		if *rowHashColumns != "" {
+			hash.Columns = strings.Split(*rowHashColumns, ",")
+		}
+		if _, err := rowhash.New(hash.Algorithm); err != nil {
+			return err
+		}
+		stages = append(stages, hash)
+	} else if *rowHashColumns != "" {
+		return fmt.Errorf("-row-hash-columns needs -row-hash")
+	}
+	if len(lineageColumns) > 0 {
+		stages = append(stages, newLineageStage(lineageColumns))
+	}
+	if columnOrder.Mode != "preserve" {
+		stages = append(stages, &orderStage{order: columnOrder})
+	}
+
+	ctx, stop := signal.NotifyContext(runCtx, os.Interrupt)
+	defer stop()
+	source, err := connector.OpenSource(*from)
+	if err != nil {
+		return err
+	}
+	inputs, err := listInputs(ctx, source)
+	if err != nil {
+		return err
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("no inputs found at %s", *from)
+	}
+	if *route != "" && !strings.Contains(to.String(), connector.Placeholder) {
+		return fmt.Errorf("-route needs a -to with a %s placeholder", connector.Placeholder)
+	}
+	sinks, err := connector.OpenRouted(to, *route, *maxRoutes, policy)
+	if err != nil {
+		return overwriteHint(err)
+	}
+	sinks.Label("RunID", run.RunID)
+	// The schemas of CSVW sidecars, by input, to describe the outputs with.
+	inputSchemas := make(map[string]*tableschema.Schema)
+	if *emitSchema != "" {
+		sink, err := schemaSink(*emitSchema, *schemaFormat, func(table string) *tableschema.Schema {
+			if s := inputSchemas[table]; s != nil {
+				return s
+			}
+			return schema
+		}, policy)
+		if err != nil {
+			_ = sinks.Close()
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	defer func() {
+		_ = sinks.Close()
+	}()
+
+	for _, in := range inputs {
+		readOpts := csvio.Options{Comma: in.Delimiter, Lenient: *lenient, MaxRecordSize: maxRecord, ReuseRecord: true,
+			OnRecover: func(rec csvio.Recovery) {
+				logger.Warn("🩹  Recovered malformed record", "input", in.Name, "line", rec.Line, "reason", rec.Reason)
+			},
+		}
+		sniff.Apply(&readOpts)
+		if in.Converted {
+			readOpts.FixedComma, readOpts.Header = true, csvio.HeaderPresent
+		}
+		separator.Apply(&readOpts)
+		skip.Apply(&readOpts)
+		asserts.Apply(&readOpts, in.Location)
+		parallel.Apply(&readOpts)
+		if readOpts.Sniff {
+			readOpts.OnDialect = dialectLogger(in.Name)
+		}
+		inStages, inOpts := stages, csvOpts
+		if schema == nil {
+			if inStages, inputSchemas[in.Name], err = sidecarMetadata(&in, stages, &readOpts, &inOpts, violations); err != nil {
+				return fmt.Errorf("%s: %w", in.Name, err)
+			}
+		}
+		if comma != 0 && !in.Converted {
+			readOpts.Comma, readOpts.FixedComma = comma, true
+		}
+		if inSchema := inputSchemas[in.Name]; inSchema != nil {
+			sinks.Constrain(in.Name, inSchema)
+		} else if schema != nil {
+			sinks.Constrain(in.Name, schema)
+		}
+		rows, err := pipelineInput(ctx, in, inStages, sinks, readOpts, inOpts, *queueDepth)
+		if err != nil {
+			return overwriteHint(fmt.Errorf("%s: %w", in.Name, err))
+		}
+		logger.Info("📦  Converted input", "input", in.Name, "rows", rows)
+	}
+	if err := commitSinks(ctx, sinks); err != nil {
+		return overwriteHint(err)
+	}
+	logRoutes(sinks)
+	if err := finishMaps(stages, policy); err != nil {
+		return overwriteHint(err)
+	}
+	logger.Info("✅ Conversion done", "to", to.String(), "inputs", len(inputs))
+	return nil
+}
+
+// logRoutes lists the outputs the routed sinks opened.
+func logRoutes(sinks connector.Fanout) {
+	for _, sink := range sinks {
+		if r, ok := sink.(*connector.Router); ok {
+			logger.Info("🔀  Routed rows", "outputs", len(r.Outputs()), "to", strings.Join(r.Outputs(), " "))
+		}
+	}
+}
+
+func overwriteHint(err error) error {
+	if errors.Is(err, atomicfile.ErrExists) {
+		return fmt.Errorf("%w (use -overwrite to replace it)", err)
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"csvtools/src/internal/colcrypt"
+)
+
+// runDecrypt decrypts the cells to_sqlite -encrypt encrypted, e.g. in a table
+// exported with "sqlite3 -csv -header combined.db 'SELECT * FROM users'".
+// The header must carry the column names, which the values are bound to.
+func runDecrypt(args []string) error {
+	fs := newFlagSet("decrypt")
+	var d dialect
+	d.register(fs)
+	columns := fs.String("c", "", "comma separated columns to decrypt (default all)")
+	keyFile := fs.String("key-file", "", "file with the base64 encoded key (default $"+colcrypt.KeyEnv+")")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	name, err := inputArg(fs)
+	if err != nil {
+		return err
+	}
+	key, err := colcrypt.LoadKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	c, err := colcrypt.New(key)
+	if err != nil {
+		return err
+	}
+
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	reader, err := d.reader(in, name)
+	if err != nil {
+		return err
+	}
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header from %s: %w", name, err)
+	}
+	idx, err := resolveColumns(header, *columns)
+	if err != nil {
+		return err
+	}
+	if *columns == "" {
+		for i := range header {
+			idx = append(idx, i)
+		}
+	}
+
+	out, err := d.create()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	writer, err := d.writer(out)
+	if err != nil {
+		return err
+	}
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	decrypted := 0
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		for _, i := range idx {
+			if i >= len(record) {
+				continue
+			}
+			plain, err := c.Decrypt(header[i], record[i])
+			if errors.Is(err, colcrypt.ErrNotEncrypted) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s record %d: %w", name, line, err)
+			}
+			record[i] = plain
+			decrypted++
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	logger.Info("🔓  Decrypted cells", "cells", decrypted)
+	return nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"csvtools/src/internal/connector"
+	"csvtools/src/internal/csvio"
+	"csvtools/src/internal/discover"
+	"csvtools/src/internal/sqlitedb"
+)
+
+// enrichStage left-joins rows against reference data: the row's key column
+// is looked up in the reference's key column, and the reference's columns
+// are appended. Rows without a match get empty cells. The reference is a
+// CSV at any source location, or a table of a SQLite database; it is loaded
+// into memory once and reused for every input.
+type enrichStage struct {
+	CSV       string `yaml:"csv"`
+	Delimiter string `yaml:"delimiter"`
+	SQLite    string `yaml:"sqlite"`
+	Table     string `yaml:"table"`
+	// Key is the column of the rows; RefKey the reference's, default Key.
+	Key     string   `yaml:"key"`
+	RefKey  string   `yaml:"ref_key"`
+	Columns []string `yaml:"columns"`
+	Prefix  string   `yaml:"prefix"`
+
+	loaded  bool
+	lookup  map[string][]string
+	key     int
+	matched int
+	missed  int
+}
+
+func (s *enrichStage) prepare(header []string) ([]string, error) {
+	if s.Key == "" {
+		return nil, fmt.Errorf("enrich needs a key")
+	}
+	if !s.loaded {
+		if err := s.load(); err != nil {
+			return nil, fmt.Errorf("enrich: %w", err)
+		}
+		s.loaded = true
+	}
+	var err error
+	if s.key, err = resolveColumn(header, s.Key); err != nil {
+		return nil, fmt.Errorf("enrich: %w", err)
+	}
+	header = slices.Clip(header)
+	for _, column := range s.Columns {
+		header = append(header, s.Prefix+column)
+	}
+	return header, nil
+}
+
+func (s *enrichStage) apply(record []string, _ int) ([]string, bool, error) {
+	values, ok := s.lookup[field(record, s.key)]
+	if ok {
+		s.matched++
+	} else {
+		s.missed++
+		values = make([]string, len(s.Columns))
+	}
+	return append(record, values...), true, nil
+}
+
+// load reads the reference into lookup, keeping the selected columns.
+func (s *enrichStage) load() error {
+	var header []string
+	var rows [][]string
+	var err error
+	switch {
+	case s.CSV != "" && s.SQLite == "":
+		header, rows, err = readReferenceCSV(s.CSV, s.Delimiter)
+	case s.SQLite != "" && s.CSV == "":
+		if s.Table == "" {
+			return fmt.Errorf("a sqlite reference needs a table")
+		}
+		header, rows, err = readReferenceTable(s.SQLite, s.Table)
+	default:
+		return fmt.Errorf("give one of csv or sqlite as the reference")
+	}
+	if err != nil {
+		return err
+	}
+	refKey := s.RefKey
+	if refKey == "" {
+		refKey = s.Key
+	}
+	key, err := resolveColumn(header, refKey)
+	if err != nil {
+		return fmt.Errorf("reference: %w", err)
+	}
+	if len(s.Columns) == 0 {
+		for i, h := range header {
+			if i != key {
+				s.Columns = append(s.Columns, h)
+			}
+		}
+	}
+	idx := make([]int, len(s.Columns))
+	for i, column := range s.Columns {
+		if idx[i], err = resolveColumn(header, column); err != nil {
+			return fmt.Errorf("reference: %w", err)
+		}
+	}
+	s.lookup = make(map[string][]string, len(rows))
+	for _, row := range rows {
+		k := field(row, key)
+		if _, dup := s.lookup[k]; dup {
+			return fmt.Errorf("reference key %q appears more than once", k)
+		}
+		values := make([]string, len(idx))
+		for i, j := range idx {
+			values[i] = field(row, j)
+		}
+		s.lookup[k] = values
+	}
+	logger.Info("📚  Loaded reference data", "rows", len(rows), "columns", strings.Join(s.Columns, ","))
+	return nil
+}
+
+// readReferenceCSV reads the single CSV at a source location. Without a
+// delimiter, the file's extension decides.
+func readReferenceCSV(location, delimiter string) ([]string, [][]string, error) {
+	ctx := context.Background()
+	var comma rune
+	if delimiter != "" {
+		var err error
+		if comma, err = discover.ParseDelimiter(delimiter); err != nil {
+			return nil, nil, err
+		}
+	}
+	source, err := connector.OpenSource(location)
+	if err != nil {
+		return nil, nil, err
+	}
+	inputs, err := source.Inputs(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(inputs) != 1 {
+		return nil, nil, fmt.Errorf("reference %s must be one file, found %d", location, len(inputs))
+	}
+	rc, err := inputs[0].Open(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	if comma == 0 {
+		comma = inputs[0].Delimiter
+	}
+	reader := csvio.NewReader(rc, csvio.Options{Comma: comma, MaxRecordSize: csvio.DefaultMaxRecordSize})
+	var header []string
+	var rows [][]string
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read reference %s: %w", location, err)
+		}
+		if header == nil {
+			header = record
+			continue
+		}
+		rows = append(rows, record)
+	}
+	if header == nil {
+		return nil, nil, fmt.Errorf("reference %s is empty", location)
+	}
+	return header, rows, nil
+}
+
+// readReferenceTable reads a whole table of a SQLite database, NULLs as "".
+func readReferenceTable(path, table string) ([]string, [][]string, error) {
+	db, err := sqlitedb.Open(path, "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open reference database %s: %w", path, err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	result, err := db.Query("SELECT * FROM " + sqlitedb.Quote(table))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read table %s of %s: %w", table, path, err)
+	}
+	defer func() {
+		_ = result.Close()
+	}()
+	header, err := result.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	var rows [][]string
+	cells := make([]sql.NullString, len(header))
+	dest := make([]any, len(header))
+	for i := range cells {
+		dest[i] = &cells[i]
+	}
+	for result.Next() {
+		if err := result.Scan(dest...); err != nil {
+			return nil, nil, fmt.Errorf("failed to read table %s of %s: %w", table, path, err)
+		}
+		row := make([]string, len(cells))
+		for i, cell := range cells {
+			row[i] = cell.String
+		}
+		rows = append(rows, row)
+	}
+	return header, rows, result.Err()
+}
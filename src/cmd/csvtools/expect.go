@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"csvtools/src/internal/xlsx"
+
+	"gopkg.in/yaml.v3"
+)
+
+// expectationSuite is an expectations file: the checks, in the spirit of
+// Great Expectations, every input has to pass.
+type expectationSuite struct {
+	Expectations []expectation `yaml:"expectations"`
+}
+
+// expectation is one check: row_count on the whole input, or one check of
+// column. Empty cells are only checked by not_null. mostly is the share of
+// the checked cells that must pass, 1 by default.
+type expectation struct {
+	Column   string   `yaml:"column"`
+	RowCount *bounds  `yaml:"row_count"`
+	NotNull  bool     `yaml:"not_null"`
+	Unique   bool     `yaml:"unique"`
+	Between  *bounds  `yaml:"between"`
+	In       []string `yaml:"in"`
+	Match    string   `yaml:"match"`
+	Fresh    string   `yaml:"fresh"`
+	Mostly   *float64 `yaml:"mostly"`
+
+	re     *regexp.Regexp
+	maxAge time.Duration
+}
+
+// bounds is an inclusive range; either end may be open.
+type bounds struct {
+	Min *float64 `yaml:"min"`
+	Max *float64 `yaml:"max"`
+}
+
+func (b bounds) contains(v float64) bool {
+	return (b.Min == nil || v >= *b.Min) && (b.Max == nil || v <= *b.Max)
+}
+
+func (b bounds) String() string {
+	format := func(f *float64) string { return strconv.FormatFloat(*f, 'f', -1, 64) }
+	switch {
+	case b.Min != nil && b.Max != nil:
+		return "between " + format(b.Min) + " and " + format(b.Max)
+	case b.Min != nil:
+		return ">= " + format(b.Min)
+	case b.Max != nil:
+		return "<= " + format(b.Max)
+	}
+	return "any"
+}
+
+// check validates the expectation and returns its description.
+func (e *expectation) check() (string, error) {
+	var kinds []string
+	if e.RowCount != nil {
+		kinds = append(kinds, "row_count "+e.RowCount.String())
+	}
+	if e.NotNull {
+		kinds = append(kinds, "not_null")
+	}
+	if e.Unique {
+		kinds = append(kinds, "unique")
+	}
+	if e.Between != nil {
+		kinds = append(kinds, e.Between.String())
+	}
+	if len(e.In) > 0 {
+		kinds = append(kinds, "in ["+strings.Join(e.In, ", ")+"]")
+	}
+	if e.Match != "" {
+		var err error
+		if e.re, err = regexp.Compile("^(?:" + e.Match + ")$"); err != nil {
+			return "", err
+		}
+		kinds = append(kinds, "match "+e.Match)
+	}
+	if e.Fresh != "" {
+		var err error
+		if e.maxAge, err = parseAge(e.Fresh); err != nil {
+			return "", err
+		}
+		kinds = append(kinds, "fresh within "+e.Fresh)
+	}
+	if len(kinds) != 1 {
+		return "", fmt.Errorf("an expectation needs exactly one of row_count, not_null, unique, between, in, match or fresh")
+	}
+	if (e.RowCount == nil) == (e.Column == "") {
+		return "", fmt.Errorf("%s: row_count takes no column, the other expectations need one", kinds[0])
+	}
+	if e.Mostly != nil {
+		if *e.Mostly < 0 || *e.Mostly > 1 {
+			return "", fmt.Errorf("%s: mostly must be between 0 and 1", kinds[0])
+		}
+		kinds[0] += fmt.Sprintf(" (mostly %g)", *e.Mostly)
+	}
+	return kinds[0], nil
+}
+
+// parseAge parses a Go duration, or a number of days such as "7d".
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q (want e.g. 36h or 7d)", s)
+	}
+	return d, nil
+}
+
+// readSuite reads and checks an expectations file. Unknown keys are errors.
+func readSuite(path string) (*expectationSuite, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read expectations %s: %w", path, err)
+	}
+	var suite expectationSuite
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&suite); err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("failed to parse expectations %s: %w", path, err)
+	}
+	if len(suite.Expectations) == 0 {
+		return nil, nil, fmt.Errorf("expectations %s: no expectations", path)
+	}
+	names := make([]string, len(suite.Expectations))
+	for i := range suite.Expectations {
+		if names[i], err = suite.Expectations[i].check(); err != nil {
+			return nil, nil, fmt.Errorf("expectations %s: expectation %d: %w", path, i+1, err)
+		}
+	}
+	return &suite, names, nil
+}
+
+// expectationResult is the outcome of one expectation on one input.
+type expectationResult struct {
+	Input       string   `json:"input"`
+	Expectation string   `json:"expectation"`
+	Column      string   `json:"column,omitempty"`
+	Passed      bool     `json:"passed"`
+	Observed    string   `json:"observed"`
+	Unexpected  int      `json:"unexpected"`
+	Sample      []string `json:"sample,omitempty"`
+}
+
+// maxSample is the number of distinct unexpected values reported.
+const maxSample = 5
+
+// expectationState accumulates the cells of an expectation's column.
+type expectationState struct {
+	col        int
+	checked    int
+	unexpected int
+	sample     []string
+	seen       map[string]struct{}
+	newest     time.Time
+}
+
+func (s *expectationState) fail(cell string) {
+	s.unexpected++
+	if len(s.sample) < maxSample && !slices.Contains(s.sample, cell) {
+		s.sample = append(s.sample, cell)
+	}
+}
+
+func (e *expectation) observe(s *expectationState, cell string) {
+	if e.NotNull {
+		s.checked++
+		if strings.TrimSpace(cell) == "" {
+			s.unexpected++
+		}
+		return
+	}
+	if cell == "" {
+		return
+	}
+	s.checked++
+	switch {
+	case e.Unique:
+		if _, dup := s.seen[cell]; dup {
+			s.fail(cell)
+		} else {
+			s.seen[cell] = struct{}{}
+		}
+	case e.Between != nil:
+		if v, err := strconv.ParseFloat(strings.TrimSpace(cell), 64); err != nil || !e.Between.contains(v) {
+			s.fail(cell)
+		}
+	case len(e.In) > 0:
+		if !slices.Contains(e.In, cell) {
+			s.fail(cell)
+		}
+	case e.re != nil:
+		if !e.re.MatchString(cell) {
+			s.fail(cell)
+		}
+	case e.Fresh != "":
+		t, ok := xlsx.ParseDate(cell)
+		if !ok {
+			s.fail(cell)
+		} else if t.After(s.newest) {
+			s.newest = t
+		}
+	}
+}
+
+// result judges the expectation once all rows were observed.
+func (e *expectation) result(s *expectationState, rows int, now time.Time) expectationResult {
+	r := expectationResult{Column: e.Column, Unexpected: s.unexpected, Sample: s.sample}
+	switch {
+	case s.col < 0:
+		r.Observed = "column missing"
+	case e.RowCount != nil:
+		r.Observed = strconv.Itoa(rows) + " rows"
+		r.Passed = e.RowCount.contains(float64(rows))
+	case e.Fresh != "":
+		if s.newest.IsZero() {
+			r.Observed = "no dates"
+		} else {
+			r.Observed = "newest " + s.newest.Format(time.RFC3339)
+			r.Passed = now.Sub(s.newest) <= e.maxAge
+		}
+	default:
+		mostly := 1.0
+		if e.Mostly != nil {
+			mostly = *e.Mostly
+		}
+		r.Observed = fmt.Sprintf("%d of %d cells unexpected", s.unexpected, s.checked)
+		r.Passed = float64(s.checked-s.unexpected) >= mostly*float64(s.checked)
+	}
+	return r
+}
+
+// runExpect checks inputs against an expectations suite and reports every
+// expectation as passed or failed. It fails if any expectation failed, so it
+// can gate a pipeline.
+func runExpect(args []string) error {
+	fs := newFlagSet("expect")
+	var d dialect
+	d.register(fs)
+	suitePath := fs.String("suite", "", "YAML expectations file (required)")
+	format := fs.String("format", "csv", "report format: csv or json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *suitePath == "" {
+		return fmt.Errorf("-suite is required")
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("-format must be csv or json, got %q", *format)
+	}
+	suite, names, err := readSuite(*suitePath)
+	if err != nil {
+		return err
+	}
+	inputs, err := expandInputs(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var results []expectationResult
+	d.reuseRecord = true
+	for _, name := range inputs {
+		res, err := evaluateSuite(&d, name, suite, now)
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for i := range res {
+			res[i].Input, res[i].Expectation = name, names[i]
+			if !res[i].Passed {
+				failed++
+			}
+		}
+		logger.Info("🔎  Checked expectations", "input", name, "passed", len(res)-failed, "failed", failed)
+		results = append(results, res...)
+	}
+
+	if err := writeExpectations(&d, *format, results); err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		if !r.Passed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d expectations failed", failed, len(results))
+	}
+	logger.Info("✅ All expectations met", "inputs", len(inputs), "expectations", len(results))
+	return nil
+}
+
+// evaluateSuite reads the input called name once and returns the result of
+// every expectation of suite, in order.
+func evaluateSuite(d *dialect, name string, suite *expectationSuite, now time.Time) ([]expectationResult, error) {
+	in, err := openInput(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	reader, err := d.reader(in, name)
+	if err != nil {
+		return nil, err
+	}
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header from %s: %w", name, err)
+	}
+	states := make([]*expectationState, len(suite.Expectations))
+	for i, e := range suite.Expectations {
+		states[i] = &expectationState{}
+		if e.Unique {
+			states[i].seen = make(map[string]struct{})
+		}
+		if e.Column != "" {
+			if states[i].col, err = resolveColumn(header, e.Column); err != nil {
+				states[i].col = -1
+			}
+		}
+	}
+
+	rows := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		rows++
+		for i := range suite.Expectations {
+			if e := &suite.Expectations[i]; e.Column != "" && states[i].col >= 0 {
+				e.observe(states[i], field(record, states[i].col))
+			}
+		}
+	}
+	results := make([]expectationResult, len(states))
+	for i := range suite.Expectations {
+		results[i] = suite.Expectations[i].result(states[i], rows, now)
+	}
+	return results, nil
+}
+
+// writeExpectations writes the report to -o.
+func writeExpectations(d *dialect, format string, results []expectationResult) error {
+	out, err := d.create()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	if format == "json" {
+		if results == nil {
+			results = []expectationResult{}
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(results); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	}
+	writer, err := d.writer(out)
+	if err != nil {
+		return err
+	}
+	if err := writer.Write([]string{"input", "expectation", "column", "passed", "observed", "unexpected", "sample"}); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	for _, r := range results {
+		row := []string{r.Input, r.Expectation, r.Column, strconv.FormatBool(r.Passed), r.Observed, strconv.Itoa(r.Unexpected), strings.Join(r.Sample, ", ")}
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"csvtools/src/internal/discover"
+	"csvtools/src/internal/grok"
+)
+
+// patterns is a repeatable flag collecting expressions.
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, " ")
+}
+
+func (p *patterns) Set(s string) error {
+	*p = append(*p, s)
+	return nil
+}
+
+// extractor turns lines of text into rows: the first pattern matching a
+// line fills the columns of its fields.
+type extractor struct {
+	patterns []*grok.Pattern
+	columns  []string
+	index    map[string]int
+	// continuation matches lines that belong to the entry before them, e.g.
+	// the lines of a stack trace.
+	continuation  *regexp.Regexp
+	failUnmatched bool
+	maxLine       int
+}
+
+// runExtract applies regular expressions with named groups, which may use
+// grok patterns such as %{IP:client}, to the lines of text files and prints
+// the fields as CSV, e.g. to feed log files to the converters.
+func runExtract(args []string) error {
+	fs := newFlagSet("extract")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: csvtools extract -e pattern [flags] [file|dir ...]")
+		fs.PrintDefaults()
+	}
+	var d dialect
+	d.register(fs)
+	var exprs, libraries patterns
+	fs.Var(&exprs, "e", "regular expression with named groups (?P<name>...) or grok patterns %{NAME:name}; the first one matching a line is used (repeatable, required)")
+	fs.Var(&libraries, "patterns", "file of grok pattern definitions, one \"NAME regexp\" per line (repeatable)")
+	continuation := fs.String("continuation", "", "regexp matching lines that continue the previous entry, e.g. '^\\s' for stack traces")
+	unmatched := fs.String("unmatched", "skip", "lines no pattern matches: skip (counted on stderr) or error")
+	exts := discover.Extensions{{Name: "log"}, {Name: "txt"}}
+	fs.Var(&exts, "ext", "comma separated extensions of the files to read in directories")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if len(exprs) == 0 {
+		fs.Usage()
+		return fmt.Errorf("-e is required")
+	}
+	if *unmatched != "skip" && *unmatched != "error" {
+		return fmt.Errorf("-unmatched must be skip or error, got %q", *unmatched)
+	}
+	library := grok.Library{}
+	for _, path := range libraries {
+		if err := library.Load(path); err != nil {
+			return fmt.Errorf("failed to load patterns: %w", err)
+		}
+	}
+	x := &extractor{index: make(map[string]int), failUnmatched: *unmatched == "error", maxLine: int(d.maxRecord)}
+	for _, expr := range exprs {
+		p, err := library.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", expr, err)
+		}
+		for _, field := range p.Fields() {
+			if _, ok := x.index[field]; !ok {
+				x.index[field] = len(x.columns)
+				x.columns = append(x.columns, field)
+			}
+		}
+		x.patterns = append(x.patterns, p)
+	}
+	if len(x.columns) == 0 {
+		return fmt.Errorf("the patterns have no named groups or fields")
+	}
+	if *continuation != "" {
+		var err error
+		if x.continuation, err = regexp.Compile(*continuation); err != nil {
+			return fmt.Errorf("invalid -continuation: %w", err)
+		}
+	}
+	names, err := expandFiles(fs.Args(), exts)
+	if err != nil {
+		return err
+	}
+
+	out, err := d.create()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	writer, err := d.writer(out)
+	if err != nil {
+		return err
+	}
+	multi := len(names) > 1
+	if err := writer.Write(withFile(multi, "file", x.columns)); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	record := make([]string, len(x.columns))
+	for _, name := range names {
+		matched, skipped, err := x.extractFile(name, func(fields []string) error {
+			return writer.Write(withFile(multi, name, fields))
+		}, record)
+		if err != nil {
+			return err
+		}
+		if skipped > 0 {
+			logger.Warn("🧾  Lines not matched", "file", name, "matched", matched, "skipped", skipped)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// extractFile calls emit with the fields of every entry of the named file a
+// pattern matches, reusing record, and returns the numbers of matched and
+// skipped entries. Blank lines are ignored.
+func (x *extractor) extractFile(name string, emit func([]string) error, record []string) (matched, skipped int, err error) {
+	in, err := openInput(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	scanner := bufio.NewScanner(in)
+	limit := x.maxLine
+	if limit <= 0 {
+		limit = int(^uint(0) >> 1)
+	}
+	scanner.Buffer(make([]byte, 0, 64*1024), limit)
+	var entry strings.Builder
+	line, start := 0, 0
+	flush := func() error {
+		if entry.Len() == 0 {
+			return nil
+		}
+		defer entry.Reset()
+		clear(record)
+		ok := false
+		for _, p := range x.patterns {
+			if ok = p.Match(entry.String(), func(field, value string) {
+				if i := x.index[field]; record[i] == "" {
+					record[i] = value
+				}
+			}); ok {
+				break
+			}
+		}
+		if !ok {
+			if x.failUnmatched {
+				return fmt.Errorf("%s:%d: no pattern matches %q", name, start, truncate(entry.String(), 80))
+			}
+			skipped++
+			return nil
+		}
+		matched++
+		if err := emit(record); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	}
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if x.continuation != nil && entry.Len() > 0 && x.continuation.MatchString(text) {
+			entry.WriteByte('\n')
+			entry.WriteString(text)
+			continue
+		}
+		if err := flush(); err != nil {
+			return matched, skipped, err
+		}
+		if strings.TrimSpace(text) != "" {
+			entry.WriteString(text)
+			start = line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return matched, skipped, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return matched, skipped, flush()
+}
+
+// truncate shortens s to at most n bytes for messages.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// fillRule says how empty cells of one column are filled.
+type fillRule struct {
+	column   string
+	strategy string // const, ffill, mean, median or mode
+	value    string // the constant, or the computed statistic
+}
+
+// fillRules collects repeated -f column=strategy flags.
+type fillRules []fillRule
+
+func (r *fillRules) String() string {
+	parts := make([]string, len(*r))
+	for i, rule := range *r {
+		parts[i] = rule.column + "=" + rule.strategy
+	}
+	return strings.Join(parts, ",")
+}
+
+func (r *fillRules) Set(s string) error {
+	column, spec, ok := strings.Cut(s, "=")
+	if !ok || column == "" {
+		return fmt.Errorf("expected column=strategy, got %q", s)
+	}
+	rule := fillRule{column: column, strategy: spec}
+	if strategy, value, isConst := strings.Cut(spec, ":"); isConst && strategy == "const" {
+		rule.strategy, rule.value = strategy, value
+	}
+	switch rule.strategy {
+	case "const", "ffill", "mean", "median", "mode":
+	default:
+		return fmt.Errorf("unknown fill strategy %q (want const:<value>, ffill, mean, median or mode)", spec)
+	}
+	*r = append(*r, rule)
+	return nil
+}
+
+func (r fillRule) needsStats() bool {
+	return r.strategy == "mean" || r.strategy == "median" || r.strategy == "mode"
+}
+
+// runFill fills empty cells per column with a constant, the previous
+// non-empty value, or a statistic computed over the column. Statistics need
+// a first pass over the data, so stdin is spooled to a temporary file.
+func runFill(args []string) error {
+	fs := newFlagSet("fill")
+	var d dialect
+	d.register(fs)
+	var rules fillRules
+	fs.Var(&rules, "f", "fill rule column=const:<value>|ffill|mean|median|mode (repeatable)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	name, err := inputArg(fs)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return fmt.Errorf("at least one -f rule is required")
+	}
+
+	if slices.ContainsFunc(rules, fillRule.needsStats) && (name == "-" || name == "") {
+		spooled, err := spoolStdin()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = os.Remove(spooled)
+		}()
+		name = spooled
+	}
+
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	reader, err := d.reader(in, name)
+	if err != nil {
+		return err
+	}
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header from %s: %w", name, err)
+	}
+	idx := make([]int, len(rules))
+	for i, rule := range rules {
+		if idx[i], err = resolveColumn(header, rule.column); err != nil {
+			return err
+		}
+	}
+
+	if slices.ContainsFunc(rules, fillRule.needsStats) {
+		if err := computeFillStats(name, d, rules, idx); err != nil {
+			return err
+		}
+	}
+
+	out, err := d.create()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	writer, err := d.writer(out)
+	if err != nil {
+		return err
+	}
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	previous := make([]string, len(rules))
+	filled := make([]int, len(rules))
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		for len(record) < len(header) {
+			record = append(record, "")
+		}
+		for i, rule := range rules {
+			cell := record[idx[i]]
+			if strings.TrimSpace(cell) != "" {
+				previous[i] = cell
+				continue
+			}
+			value := rule.value
+			if rule.strategy == "ffill" {
+				value = previous[i]
+			}
+			if value != "" {
+				record[idx[i]] = value
+				filled[i]++
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	for i, rule := range rules {
+		logger.Info("✅  Filled empty cells", "column", header[idx[i]], "strategy", rule.strategy, "cells", filled[i])
+	}
+	return nil
+}
+
+// computeFillStats reads the input once and stores the mean, median or mode
+// of each statistic column in its rule.
+func computeFillStats(name string, d dialect, rules fillRules, idx []int) error {
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	reader, err := d.reader(in, name)
+	if err != nil {
+		return err
+	}
+	if _, err := reader.Read(); err != nil {
+		return fmt.Errorf("failed to read header from %s: %w", name, err)
+	}
+
+	numbers := make([][]float64, len(rules))
+	counts := make([]map[string]int, len(rules))
+	for i := range rules {
+		counts[i] = make(map[string]int)
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		for i, rule := range rules {
+			cell := strings.TrimSpace(field(record, idx[i]))
+			if cell == "" || !rule.needsStats() {
+				continue
+			}
+			if rule.strategy == "mode" {
+				counts[i][cell]++
+			} else if f, err := strconv.ParseFloat(cell, 64); err == nil {
+				numbers[i] = append(numbers[i], f)
+			}
+		}
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		switch rule.strategy {
+		case "mean":
+			if len(numbers[i]) > 0 {
+				sum := 0.0
+				for _, f := range numbers[i] {
+					sum += f
+				}
+				rule.value = strconv.FormatFloat(sum/float64(len(numbers[i])), 'f', -1, 64)
+			}
+		case "median":
+			if n := len(numbers[i]); n > 0 {
+				slices.Sort(numbers[i])
+				median := numbers[i][n/2]
+				if n%2 == 0 {
+					median = (numbers[i][n/2-1] + numbers[i][n/2]) / 2
+				}
+				rule.value = strconv.FormatFloat(median, 'f', -1, 64)
+			}
+		case "mode":
+			best := 0
+			for value, c := range counts[i] {
+				if c > best || (c == best && value < rule.value) {
+					best, rule.value = c, value
+				}
+			}
+		}
+		if rule.needsStats() && rule.value == "" {
+			logger.Warn("⚠️  No values to compute the fill statistic from", "column", rule.column, "strategy", rule.strategy)
+		}
+	}
+	return nil
+}
+
+// spoolStdin copies stdin into a temporary file so it can be read twice and
+// returns the file name. The caller removes the file.
+func spoolStdin() (string, error) {
+	tmp, err := os.CreateTemp("", "csvtools-stdin-*.csv")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	if _, err := io.Copy(tmp, os.Stdin); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to buffer stdin: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to buffer stdin: %w", err)
+	}
+	return tmp.Name(), nil
+}
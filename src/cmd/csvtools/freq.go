@@ -0,0 +1,210 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// runFreq prints the distinct values of one or more columns with their counts.
+func runFreq(args []string) error {
+	fs := newFlagSet("freq")
+	var d dialect
+	d.register(fs)
+	columns := fs.String("c", "", "comma separated column names or 1-based indexes (required)")
+	top := fs.Int("top", 0, "only print the N most frequent values per column (0 for all)")
+	sortBy := fs.String("sort", "count", "order of the values: count or value")
+	asc := fs.Bool("asc", false, "sort ascending instead of descending")
+	percent := fs.Bool("percent", false, "add a percent column relative to the number of rows")
+	maxDistinct := fs.Int("max-distinct", 1_000_000, "distinct values tracked per column before counts become approximate")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	name, err := inputArg(fs)
+	if err != nil {
+		return err
+	}
+	if *columns == "" {
+		return fmt.Errorf("-c is required")
+	}
+	if *sortBy != "count" && *sortBy != "value" {
+		return fmt.Errorf("-sort must be count or value, got %q", *sortBy)
+	}
+	if *maxDistinct < 1 {
+		return fmt.Errorf("-max-distinct must be positive")
+	}
+
+	d.reuseRecord = true
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	reader, err := d.reader(in, name)
+	if err != nil {
+		return err
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header from %s: %w", name, err)
+	}
+	header = slices.Clone(header)
+	idx, err := resolveColumns(header, *columns)
+	if err != nil {
+		return err
+	}
+	counters := make([]*counter, len(idx))
+	for i := range counters {
+		counters[i] = newCounter(*maxDistinct)
+	}
+
+	rows := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		rows++
+		for i, col := range idx {
+			counters[i].add(field(record, col))
+		}
+	}
+
+	out, err := d.create()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	writer, err := d.writer(out)
+	if err != nil {
+		return err
+	}
+	head := []string{"column", "value", "count"}
+	if *percent {
+		head = append(head, "percent")
+	}
+	if err := writer.Write(head); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	for i, col := range idx {
+		c := counters[i]
+		if c.approximate {
+			logger.Warn("⚠️  Too many distinct values, counts are approximate", "column", header[col], "max-distinct", *maxDistinct)
+		}
+		entries := c.sorted(*sortBy == "value", *asc)
+		if *top > 0 && len(entries) > *top {
+			entries = entries[:*top]
+		}
+		for _, e := range entries {
+			row := []string{header[col], e.value, strconv.Itoa(e.count)}
+			if *percent {
+				row = append(row, strconv.FormatFloat(100*float64(e.count)/float64(max(rows, 1)), 'f', 2, 64))
+			}
+			if err := writer.Write(row); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+type freqEntry struct {
+	value string
+	count int
+	index int // position in the heap
+}
+
+// counter counts values exactly until more than limit distinct values are
+// seen. From then on it keeps only limit entries using the Space-Saving
+// algorithm: a new value replaces the least frequent entry and inherits its
+// count, so the most frequent values and their (over-estimated) counts
+// survive with bounded memory.
+type counter struct {
+	limit       int
+	entries     map[string]*freqEntry
+	heap        freqHeap
+	approximate bool
+}
+
+func newCounter(limit int) *counter {
+	return &counter{limit: limit, entries: make(map[string]*freqEntry)}
+}
+
+func (c *counter) add(value string) {
+	if e, ok := c.entries[value]; ok {
+		e.count++
+		heap.Fix(&c.heap, e.index)
+		return
+	}
+	if len(c.entries) < c.limit {
+		e := &freqEntry{value: strings.Clone(value), count: 1}
+		c.entries[e.value] = e
+		heap.Push(&c.heap, e)
+		return
+	}
+	c.approximate = true
+	e := c.heap[0]
+	delete(c.entries, e.value)
+	e.value = strings.Clone(value)
+	e.count++
+	c.entries[e.value] = e
+	heap.Fix(&c.heap, 0)
+}
+
+func (c *counter) sorted(byValue, asc bool) []freqEntry {
+	out := make([]freqEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		out = append(out, *e)
+	}
+	slices.SortFunc(out, func(a, b freqEntry) int {
+		cmp := a.count - b.count
+		if byValue {
+			cmp = strings.Compare(a.value, b.value)
+		}
+		if !asc {
+			cmp = -cmp
+		}
+		if cmp == 0 {
+			// Ties are listed by value regardless of direction.
+			cmp = strings.Compare(a.value, b.value)
+		}
+		return cmp
+	})
+	return out
+}
+
+// freqHeap is a min-heap of entries by count.
+type freqHeap []*freqEntry
+
+func (h freqHeap) Len() int           { return len(h) }
+func (h freqHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h freqHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *freqHeap) Push(x any) {
+	e := x.(*freqEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *freqHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
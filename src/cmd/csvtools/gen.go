@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// goOptions shapes the Go code generated for inferred tables.
+type goOptions struct {
+	pkg string
+	// tags are the struct tag keys holding the column name, e.g. csv, json
+	// and db.
+	tags []string
+	// gorm adds gorm tags and TableName methods.
+	gorm bool
+	// nulls types nullable columns: pointer makes numbers and booleans
+	// pointers, sql uses the database/sql Null types as sqlc does.
+	nulls     string
+	generator string
+}
+
+// runGen generates code for the inputs from the schema csvtools schema
+// infers. The first argument names the language; only go is supported.
+func runGen(args []string) error {
+	fs := newFlagSet("gen")
+	var d dialect
+	d.register(fs)
+	opts := goOptions{generator: "csvtools gen go"}
+	fs.StringVar(&opts.pkg, "package", "models", "package clause of the generated file")
+	tags := fs.String("tags", "csv,json,db", "comma separated struct tags holding the column name")
+	fs.BoolVar(&opts.gorm, "gorm", false, "add gorm tags, with the column name and not null, and TableName methods")
+	fs.StringVar(&opts.nulls, "nulls", "pointer", "type of nullable columns: pointer, or sql for sql.NullString and the like, as sqlc generates")
+	sample := fs.Int("sample", 0, "infer from the first N rows of every input (0 for all)")
+	target := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		target, args = args[0], args[1:]
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if target != "go" {
+		return fmt.Errorf("expected the language to generate first, go, got %q", target)
+	}
+	if opts.nulls != "pointer" && opts.nulls != "sql" {
+		return fmt.Errorf("-nulls must be pointer or sql, got %q", opts.nulls)
+	}
+	if *sample < 0 {
+		return fmt.Errorf("-sample must not be negative")
+	}
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			opts.tags = append(opts.tags, tag)
+		}
+	}
+	inputs, err := expandInputs(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	d.reuseRecord = true
+	tables := make([]*inferredTable, 0, len(inputs))
+	for _, name := range inputs {
+		table, err := inferTable(&d, name, 0, *sample)
+		if err != nil {
+			return err
+		}
+		tables = append(tables, table)
+	}
+	out, err := d.create()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	if err := writeGo(out, tables, opts); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	logger.Info("🏗️  Generated Go structs", "inputs", len(tables), "package", opts.pkg)
+	return nil
+}
+
+// writeGo writes a struct per table into a Go file.
+func writeGo(w io.Writer, tables []*inferredTable, opts goOptions) error {
+	var b strings.Builder
+	usesSQL := false
+	types := make(map[string]int)
+	for _, t := range tables {
+		name, input := uniqueName(goName(t.Table, "Table"), types), t.Input
+		if input == "-" {
+			input = "stdin"
+		}
+		fmt.Fprintf(&b, "\n// %s is a row of %s.\ntype %s struct {\n", name, input, name)
+		fields := make(map[string]int)
+		for i, c := range t.Columns {
+			typ := goType(c.Type, c.Nullable, opts.nulls)
+			usesSQL = usesSQL || strings.HasPrefix(typ, "sql.")
+			fmt.Fprintf(&b, "\t%s %s %s\n", uniqueName(goName(c.Name, "Column"+strconv.Itoa(i+1)), fields), typ, goTag(c, opts))
+		}
+		b.WriteString("}\n")
+		if opts.gorm {
+			fmt.Fprintf(&b, "\n// TableName names the table of %s for GORM.\nfunc (%s) TableName() string {\n\treturn %s\n}\n", name, name, strconv.Quote(t.Table))
+		}
+	}
+	header := fmt.Sprintf("// Code generated by %s. DO NOT EDIT.\n\npackage %s\n", opts.generator, opts.pkg)
+	if usesSQL {
+		header += "\nimport \"database/sql\"\n"
+	}
+	src, err := format.Source([]byte(header + b.String()))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// goTag returns the struct tag of a column, as a raw string unless the
+// name holds a backquote.
+func goTag(c inferredColumn, opts goOptions) string {
+	name := strconv.Quote(c.Name)
+	parts := make([]string, 0, len(opts.tags)+1)
+	for _, key := range opts.tags {
+		parts = append(parts, key+":"+name)
+	}
+	if opts.gorm {
+		gorm := "column:" + c.Name
+		if !c.Nullable {
+			gorm += ";not null"
+		}
+		parts = append(parts, "gorm:"+strconv.Quote(gorm))
+	}
+	tag := strings.Join(parts, " ")
+	if tag == "" {
+		return ""
+	}
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
+
+// goType returns the Go type of a column of Table Schema type typ.
+func goType(typ string, nullable bool, nulls string) string {
+	var t, null string
+	switch typ {
+	case "integer":
+		t, null = "int64", "sql.NullInt64"
+	case "number":
+		t, null = "float64", "sql.NullFloat64"
+	case "boolean":
+		t, null = "bool", "sql.NullBool"
+	default:
+		t, null = "string", "sql.NullString"
+	}
+	switch {
+	case !nullable:
+		return t
+	case nulls == "sql":
+		return null
+	case t != "string":
+		return "*" + t
+	}
+	return t
+}
+
+// goInitialisms are written in capitals in Go names, as golint asks.
+var goInitialisms = map[string]bool{
+	"api": true, "csv": true, "html": true, "http": true, "id": true, "ip": true, "json": true,
+	"sql": true, "uri": true, "url": true, "uuid": true, "xml": true,
+}
+
+// goName turns a column or file name into an exported Go identifier, e.g.
+// "order id" into OrderID, or fallback if nothing of it is left.
+func goName(name, fallback string) string {
+	var b strings.Builder
+	words := strings.FieldsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	for _, word := range words {
+		if goInitialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	s := b.String()
+	if s == "" {
+		return fallback
+	}
+	if r := []rune(s)[0]; !unicode.IsUpper(r) {
+		// Digits, and letters without case as in 日付, can't start an
+		// exported name.
+		s = "X" + s
+	}
+	return s
+}
+
+// uniqueName returns name, numbered if it was returned for seen before.
+func uniqueName(name string, seen map[string]int) string {
+	seen[name]++
+	if n := seen[name]; n > 1 {
+		return name + strconv.Itoa(n)
+	}
+	return name
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"csvtools/src/internal/geo"
+)
+
+// geoStage checks coordinates and, for maps, splits "lat,long" composites
+// and adds geohashes. With Column, the composite in it is split into new Lat
+// and Lon columns (default latitude and longitude) right after it, read in
+// Order lat_lon (the default) or lon_lat; otherwise Lat and Lon name the
+// columns to check. Geohash, if set, appends a column of that name holding
+// the geohash of every point, Precision (default 9) characters long.
+// Invalid says what happens to coordinates that don't parse or are out of
+// range: keep the cells (the default), empty them, or fail. Empty cells are
+// left alone.
+type geoStage struct {
+	Column    string `yaml:"column"`
+	Order     string `yaml:"order"`
+	Lat       string `yaml:"lat"`
+	Lon       string `yaml:"lon"`
+	Geohash   string `yaml:"geohash"`
+	Precision int    `yaml:"precision"`
+	Invalid   string `yaml:"invalid"`
+
+	col, lat, lon int
+	valid         int
+	invalid       int
+}
+
+func (s *geoStage) prepare(header []string) ([]string, error) {
+	switch s.Invalid {
+	case "":
+		s.Invalid = "keep"
+	case "keep", "empty", "error":
+	default:
+		return nil, fmt.Errorf("geo: unknown invalid %q (want keep, empty or error)", s.Invalid)
+	}
+	switch s.Order {
+	case "", "lat_lon", "lon_lat":
+	default:
+		return nil, fmt.Errorf("geo: unknown order %q (want lat_lon or lon_lat)", s.Order)
+	}
+	if s.Precision == 0 {
+		s.Precision = 9
+	}
+	if s.Precision < 1 || s.Precision > geo.MaxPrecision {
+		return nil, fmt.Errorf("geo: precision must be 1 to %d, got %d", geo.MaxPrecision, s.Precision)
+	}
+	var added []string
+	var err error
+	if s.Column != "" {
+		if s.col, err = resolveColumn(header, s.Column); err != nil {
+			return nil, fmt.Errorf("geo: %w", err)
+		}
+		if s.Lat == "" {
+			s.Lat = "latitude"
+		}
+		if s.Lon == "" {
+			s.Lon = "longitude"
+		}
+		added = append(added, s.Lat, s.Lon)
+		s.lat, s.lon = s.col+1, s.col+2
+	} else {
+		if s.Lat == "" || s.Lon == "" {
+			return nil, fmt.Errorf("geo needs a column to split, or lat and lon columns to check")
+		}
+		if s.lat, err = resolveColumn(header, s.Lat); err != nil {
+			return nil, fmt.Errorf("geo: %w", err)
+		}
+		if s.lon, err = resolveColumn(header, s.Lon); err != nil {
+			return nil, fmt.Errorf("geo: %w", err)
+		}
+	}
+	if s.Geohash != "" {
+		added = append(added, s.Geohash)
+	}
+	for _, name := range added {
+		if _, err := resolveColumn(header, name); err == nil {
+			return nil, fmt.Errorf("geo: column %s already exists", name)
+		}
+	}
+	header = slices.Clip(header)
+	if s.Column != "" {
+		header = slices.Insert(header, s.col+1, s.Lat, s.Lon)
+	}
+	if s.Geohash != "" {
+		header = append(header, s.Geohash)
+	}
+	return header, nil
+}
+
+func (s *geoStage) apply(record []string, line int) ([]string, bool, error) {
+	width := max(s.col, s.lat, s.lon)
+	if s.Column != "" {
+		width = s.col
+	}
+	for len(record) <= width {
+		record = append(record, "")
+	}
+	var lat, lon float64
+	var err error
+	present := true
+	if s.Column != "" {
+		record = slices.Insert(record, s.col+1, "", "")
+		if present = record[s.col] != ""; present {
+			if lat, lon, err = geo.Parse(record[s.col], s.Order == "lon_lat"); err == nil {
+				record[s.lat], record[s.lon] = geo.Format(lat), geo.Format(lon)
+			}
+		}
+	} else if present = record[s.lat] != "" || record[s.lon] != ""; present {
+		lat, lon, err = geo.ParsePair(record[s.lat], record[s.lon])
+	}
+	hash := ""
+	switch {
+	case !present:
+	case err == nil:
+		s.valid++
+		hash = geo.Geohash(lat, lon, s.Precision)
+	default:
+		s.invalid++
+		switch s.Invalid {
+		case "error":
+			return nil, false, fmt.Errorf("line %d: %w", line, err)
+		case "empty":
+			if s.Column != "" {
+				record[s.col] = ""
+			} else {
+				record[s.lat], record[s.lon] = "", ""
+			}
+		}
+	}
+	if s.Geohash != "" {
+		record = append(record, hash)
+	}
+	return record, true, nil
+}
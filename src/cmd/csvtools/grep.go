@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// grepOptions configures how rows are matched by runGrep.
+type grepOptions struct {
+	pattern *regexp.Regexp
+	columns string
+	invert  bool
+}
+
+// runGrep prints the rows with a cell matching a regular expression as CSV,
+// keeping the header. With several inputs a leading "file" column tells the
+// rows apart. -count and -files-with-matches summarize per file instead.
+func runGrep(args []string) error {
+	fs := newFlagSet("grep")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: csvtools grep [flags] pattern [file|dir ...]")
+		fs.PrintDefaults()
+	}
+	var d dialect
+	d.register(fs)
+	var opts grepOptions
+	fs.StringVar(&opts.columns, "c", "", "only search these comma separated columns (names or 1-based indexes)")
+	fs.BoolVar(&opts.invert, "v", false, "select rows without a matching cell")
+	ignoreCase := fs.Bool("i", false, "case insensitive matching")
+	count := fs.Bool("count", false, "print the number of matching rows per file")
+	filesWithMatches := fs.Bool("files-with-matches", false, "print only the names of files with a matching row")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("missing pattern")
+	}
+	expr := fs.Arg(0)
+	if *ignoreCase {
+		expr = "(?i)" + expr
+	}
+	var err error
+	if opts.pattern, err = regexp.Compile(expr); err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	names, err := expandInputs(fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+
+	out, err := d.create()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	writer, err := d.writer(out)
+	if err != nil {
+		return err
+	}
+
+	summary := *count || *filesWithMatches
+	switch {
+	case *count:
+		err = writer.Write([]string{"file", "count"})
+	case *filesWithMatches:
+		err = writer.Write([]string{"file"})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	// Matching rows are copied as they are unless the output dialect
+	// differs, which saves quoting every field again.
+	d.raw = !summary
+	// The header of the first input is written before any match, so that
+	// no matches still give a CSV with a header.
+	wroteHeader := false
+	begin := func(header []string) error {
+		if summary || wroteHeader {
+			return nil
+		}
+		wroteHeader = true
+		return writer.Write(withFile(len(names) > 1, "file", header))
+	}
+	for _, name := range names {
+		emit := func(record []string, raw []byte) error {
+			if summary {
+				return nil
+			}
+			if raw != nil && bytes.IndexByte(raw, '\r') < 0 {
+				return writer.WriteRaw(withFile(len(names) > 1, name, nil), raw)
+			}
+			return writer.Write(withFile(len(names) > 1, name, record))
+		}
+		matches, err := grepFile(name, d, opts, begin, emit, *filesWithMatches)
+		if err != nil {
+			return err
+		}
+		switch {
+		case *count:
+			err = writer.Write([]string{name, strconv.Itoa(matches)})
+		case *filesWithMatches && matches > 0:
+			err = writer.Write([]string{name})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// grepFile calls begin with the header of the named input once its columns
+// are resolved, then emit for each matching row, and returns the number of
+// matches. With firstOnly it stops at the first match.
+func grepFile(name string, d dialect, opts grepOptions, begin func(header []string) error, emit func(record []string, raw []byte) error, firstOnly bool) (int, error) {
+	in, err := openInput(name)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	reader, err := d.reader(in, name)
+	if err != nil {
+		return 0, err
+	}
+	header, err := reader.Read()
+	if err == io.EOF {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read header from %s: %w", name, err)
+	}
+	idx, err := resolveColumns(header, opts.columns)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	if err := begin(header); err != nil {
+		return 0, fmt.Errorf("failed to write output: %w", err)
+	}
+
+	rawReader, copyable := d.copyable(reader)
+	matches := 0
+	for {
+		var record []string
+		var raw []byte
+		if copyable {
+			record, raw, err = rawReader.ReadRaw()
+		} else {
+			record, err = reader.Read()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return matches, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if rowMatches(opts.pattern, record, idx) == opts.invert {
+			continue
+		}
+		matches++
+		if err := emit(record, raw); err != nil {
+			return matches, fmt.Errorf("failed to write output: %w", err)
+		}
+		if firstOnly {
+			break
+		}
+	}
+	return matches, nil
+}
+
+// rowMatches reports whether any searched cell matches. A nil idx searches
+// every cell.
+func rowMatches(re *regexp.Regexp, record []string, idx []int) bool {
+	if idx == nil {
+		for _, cell := range record {
+			if re.MatchString(cell) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, i := range idx {
+		if re.MatchString(field(record, i)) {
+			return true
+		}
+	}
+	return false
+}
+
+// withFile prepends value to record when enabled.
+func withFile(enabled bool, value string, record []string) []string {
+	if !enabled {
+		return record
+	}
+	return append([]string{value}, record...)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"csvtools/src/internal/health"
+)
+
+// runHealthcheck fails unless the heartbeat file written by to_xlsx or
+// to_sqlite (-heartbeat-file) is recent, for use as an exec liveness probe.
+func runHealthcheck(args []string) error {
+	fs := newFlagSet("healthcheck")
+	file := fs.String("file", "", "heartbeat file to check")
+	maxAge := fs.Duration("max-age", health.DefaultMaxAge, "fail if the last heartbeat is older than this")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+	if err := health.Check(*file, *maxAge); err != nil {
+		return err
+	}
+	logger.Info("✅  Healthy", "file", *file)
+	return nil
+}
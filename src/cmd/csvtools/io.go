@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"csvtools/src/internal/clipboard"
+	"csvtools/src/internal/compress"
+	"csvtools/src/internal/csvio"
+	"csvtools/src/internal/discover"
+)
+
+// dialect holds the CSV flags shared by the subcommands, plus reader settings
+// a command may set before calling reader.
+type dialect struct {
+	delimiter string
+	// fixed is set when -delimiter was given, so the input's isn't sniffed.
+	fixed        bool
+	sniff        csvio.SniffFlags
+	separator    csvio.SeparatorFlags
+	skip         csvio.SkipFlags
+	output       string
+	lenient      bool
+	crlf         bool
+	lf           bool
+	finalNewline bool
+	quoting      csvio.Quoting
+	quote        string
+	excelSafe    bool
+	maxRecord    int64
+	compress     compress.Codec
+
+	lazyQuotes  bool
+	reuseRecord bool
+	// raw asks for a reader whose records can be copied out as they are,
+	// see copyable.
+	raw bool
+}
+
+func (d *dialect) register(fs *flag.FlagSet) {
+	d.delimiter = ","
+	fs.Func("delimiter", "field delimiter of the input and output (default \",\", the input's sniffed)", func(s string) error {
+		d.delimiter, d.fixed = s, true
+		return nil
+	})
+	d.sniff.Register(fs)
+	d.separator.Register(fs)
+	d.skip.Register(fs)
+	fs.StringVar(&d.output, "o", "-", "output file, - for stdout or clipboard for the system clipboard")
+	fs.BoolVar(&d.lenient, "lenient", false, "recover from malformed records instead of failing")
+	fs.BoolVar(&d.crlf, "crlf", false, "end output records with CRLF")
+	fs.BoolVar(&d.lf, "lf", false, "end output records with LF (the default)")
+	fs.BoolVar(&d.finalNewline, "final-newline", true, "end the output with a line ending")
+	fs.Var(&d.quoting, "quoting", "which output fields to quote: minimal, all, non-numeric or none")
+	fs.StringVar(&d.quote, "quote", `"`, "quote character of the output")
+	fs.BoolVar(&d.excelSafe, "excel-safe", false, "neutralize output cells a spreadsheet would run as formulas and drop control characters")
+	fs.Var(&d.compress, "compress", "compress the output with gzip or zstd")
+	d.maxRecord = csvio.DefaultMaxRecordSize
+	fs.Func("max-record-size", "fail on a record larger than this, e.g. 512MB; 0 for no limit (default 64MB)", func(s string) (err error) {
+		d.maxRecord, err = discover.ParseSize(s)
+		return err
+	})
+}
+
+func (d *dialect) comma() (rune, error) {
+	r, size := utf8.DecodeRuneInString(d.delimiter)
+	if size == 0 || size != len(d.delimiter) {
+		return 0, fmt.Errorf("delimiter must be a single character, got %q", d.delimiter)
+	}
+	return r, nil
+}
+
+// reader returns a reader over the input called name that accepts ragged
+// rows. In lenient mode every recovery is logged.
+func (d *dialect) reader(r io.Reader, name string) (csvio.Reader, error) {
+	comma, err := d.comma()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.sniff.Load(); err != nil {
+		return nil, err
+	}
+	if err := d.separator.Load(); err != nil {
+		return nil, err
+	}
+	if err := d.skip.Load(); err != nil {
+		return nil, err
+	}
+	opts := csvio.Options{
+		Comma:         comma,
+		FixedComma:    d.fixed,
+		LazyQuotes:    d.lazyQuotes,
+		ReuseRecord:   d.reuseRecord,
+		Raw:           d.raw,
+		Lenient:       d.lenient,
+		MaxRecordSize: d.maxRecord,
+		OnRecover: func(rec csvio.Recovery) {
+			logger.Warn("🩹  Recovered malformed record", "file", name, "line", rec.Line, "reason", rec.Reason)
+		},
+	}
+	d.sniff.Apply(&opts)
+	d.separator.Apply(&opts)
+	d.skip.Apply(&opts)
+	if opts.Sniff {
+		opts.OnDialect = dialectLogger(name)
+	}
+	return csvio.NewReader(r, opts), nil
+}
+
+// copyable returns reader as a RawReader if its records can be written with
+// csvio.Writer.WriteRaw, which is when the output dialect is the input's:
+// same delimiter, '"' quotes, minimal quoting, LF line endings (records
+// with a CR are still written field by field) and a final newline, and the
+// cells aren't made Excel-safe.
+func (d *dialect) copyable(reader csvio.Reader) (csvio.RawReader, bool) {
+	raw, ok := reader.(csvio.RawReader)
+	if !ok {
+		return nil, false
+	}
+	comma, err := d.comma()
+	if err != nil || raw.Dialect().Comma != comma || raw.Dialect().Quote != '"' || d.quote != `"` {
+		return nil, false
+	}
+	if d.quoting != "" && d.quoting != csvio.QuoteMinimal || d.crlf || !d.finalNewline || d.excelSafe {
+		return nil, false
+	}
+	return raw, true
+}
+
+// dialectLogger returns a csvio.Options.OnDialect logging the sniffed
+// dialect of the input called name.
+func dialectLogger(name string) func(csvio.Dialect) {
+	return func(d csvio.Dialect) {
+		logger.Info("👃  Sniffed dialect", "input", name, "dialect", d.String())
+	}
+}
+
+// writer returns a writer over w using the configured delimiter, quoting and line endings.
+// Output to the clipboard is tab separated unless -delimiter is given, so it
+// pastes into the cells of a spreadsheet.
+func (d *dialect) writer(w io.Writer) (*csvio.Writer, error) {
+	comma, err := d.comma()
+	if err != nil {
+		return nil, err
+	}
+	if clipboard.Is(d.output) && !d.fixed {
+		comma = '\t'
+	}
+	if d.crlf && d.lf {
+		return nil, fmt.Errorf("-crlf and -lf are mutually exclusive")
+	}
+	quote, size := utf8.DecodeRuneInString(d.quote)
+	if size == 0 || size != len(d.quote) || quote == comma {
+		return nil, fmt.Errorf("quote must be a single character other than the delimiter, got %q", d.quote)
+	}
+	return csvio.NewWriter(w, csvio.WriterOptions{
+		Comma:          comma,
+		Quote:          quote,
+		Quoting:        d.quoting,
+		CRLF:           d.crlf,
+		NoFinalNewline: !d.finalNewline,
+		ExcelSafe:      d.excelSafe,
+	}), nil
+}
+
+// openInput opens the named file, stdin for "" and "-" or the system
+// clipboard for "clipboard", read at most at -max-throughput.
+func openInput(name string) (io.ReadCloser, error) {
+	if name == "" || name == "-" {
+		return io.NopCloser(limiter.Reader(os.Stdin)), nil
+	}
+	if clipboard.Is(name) {
+		data, err := clipboard.Read(runCtx)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	return readCloser{limiter.Reader(f), f}, nil
+}
+
+// readCloser reads from a Reader wrapping what it closes.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// openOutput creates the named file, or returns stdout for "" and "-" and
+// the system clipboard, written on Close, for "clipboard".
+func openOutput(name string) (io.WriteCloser, error) {
+	if name == "" || name == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	if clipboard.Is(name) {
+		return clipboard.NewWriter(runCtx), nil
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	return f, nil
+}
+
+// create opens the output named by -o, compressed if -compress is set.
+// Closing it also closes the file.
+func (d *dialect) create() (io.WriteCloser, error) {
+	if clipboard.Is(d.output) && d.compress != compress.None {
+		return nil, fmt.Errorf("-compress cannot write to the clipboard")
+	}
+	out, err := openOutput(d.output)
+	if err != nil || d.compress == compress.None {
+		return out, err
+	}
+	zw, err := d.compress.NewWriter(out)
+	if err != nil {
+		_ = out.Close()
+		return nil, err
+	}
+	return compressedOutput{WriteCloser: zw, file: out}, nil
+}
+
+type compressedOutput struct {
+	io.WriteCloser
+	file io.Closer
+}
+
+func (c compressedOutput) Close() error {
+	err := c.WriteCloser.Close()
+	if cerr := c.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// inputArg returns the single optional positional argument naming the input.
+func inputArg(fs *flag.FlagSet) (string, error) {
+	switch fs.NArg() {
+	case 0:
+		return "-", nil
+	case 1:
+		return fs.Arg(0), nil
+	default:
+		return "", fmt.Errorf("expected at most one input file, got %d", fs.NArg())
+	}
+}
+
+// expandInputs replaces directories in names by the .csv files they contain,
+// sorted by name. No names means stdin.
+func expandInputs(names []string) ([]string, error) {
+	return expandFiles(names, nil)
+}
+
+// expandFiles is expandInputs for files with one of exts, or .csv if empty.
+func expandFiles(names []string, exts discover.Extensions) ([]string, error) {
+	if len(names) == 0 {
+		return []string{"-"}, nil
+	}
+	var out []string
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if name == "-" || err != nil || !info.IsDir() {
+			out = append(out, name)
+			continue
+		}
+		files, err := discover.Find(name, discover.Options{
+			Extensions: exts,
+			OnSkip: func(path, reason string) {
+				logger.Warn("⚠️  Skipping path", "path", path, "reason", reason)
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory %s: %w", name, err)
+		}
+		for _, f := range files {
+			out = append(out, f.Path)
+		}
+	}
+	return out, nil
+}
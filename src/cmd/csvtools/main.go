@@ -0,0 +1,218 @@
+// Command csvtools bundles the CSV utilities behind one binary with
+// subcommands, e.g. "csvtools transpose data.csv".
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"csvtools/src/internal/audit"
+	"csvtools/src/internal/envflags"
+	"csvtools/src/internal/exitcode"
+	"csvtools/src/internal/tempdir"
+	"csvtools/src/internal/throttle"
+	"csvtools/src/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// command is a csvtools subcommand. run receives the arguments that follow
+// the subcommand name and parses its own flags.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// auditFlags are the -run-id and -audit-log flags of every command, and run
+// the run they start once the flags are parsed. runCtx carries the span of
+// the run, for the command to trace under, and flushTraces exports the spans.
+var (
+	auditFlags  audit.Flags
+	run         *audit.Run
+	runCtx      = context.Background()
+	runSpan     trace.Span
+	flushTraces = func(context.Context) error { return nil }
+)
+
+// throttleFlags are the -max-throughput and -nice flags of every command,
+// and limiter the limit of the inputs they set.
+var (
+	throttleFlags throttle.Flags
+	limiter       *throttle.Limiter
+)
+
+// tempFlags are the -tmp-dir and -min-free flags of every command, and tmp
+// the temp directory of the run, removed by finish.
+var (
+	tempFlags tempdir.Flags
+	tmp       *tempdir.Dir
+)
+
+var commands = []command{
+	{name: "bench", summary: "measure rows/sec and memory of the converters and commands", run: runBench},
+	{name: "clean", summary: "trim and repair cells", run: runClean},
+	{name: "compare", summary: "compare a CSV output with a golden file, for snapshot tests", run: runCompare},
+	{name: "convert", summary: "copy CSV inputs from any source into any sink", run: runConvert},
+	{name: "decrypt", summary: "decrypt columns encrypted by to_sqlite -encrypt", run: runDecrypt},
+	{name: "expect", summary: "check inputs against an expectations suite", run: runExpect},
+	{name: "extract", summary: "turn log lines into CSV rows with regular expressions or grok patterns", run: runExtract},
+	{name: "fill", summary: "fill empty cells per column", run: runFill},
+	{name: "freq", summary: "count distinct values of columns", run: runFreq},
+	{name: "gen", summary: "generate Go structs with csv, json and db tags for CSV files", run: runGen},
+	{name: "grep", summary: "print rows with cells matching a regular expression", run: runGrep},
+	{name: "once", summary: "serve one-shot conversions of POSTed CSV over HTTP", run: runOnce},
+	{name: "pipeline", summary: "run the stages of a pipeline file over a source into sinks", run: runPipeline},
+	{name: "push", summary: "push output files to an OCI registry as an ORAS artifact", run: runPush},
+	{name: "rename-headers", summary: "normalize and rename the header row", run: runRenameHeaders},
+	{name: "schema", summary: "print the schema inferred for CSV files as text, JSON, SQL or Go", run: runSchema},
+	{name: "transpose", summary: "swap rows and columns of a CSV", run: runTranspose},
+	{name: "tui", summary: "browse, filter and convert CSV files in an interactive terminal UI", run: runTUI},
+	{name: "view", summary: "show the first rows of a CSV as an aligned table", run: runView},
+}
+
+// The commands that describe the other commands refer to the list, so they
+// are added at init time.
+func init() {
+	commands = append(commands,
+		command{name: "completion", summary: "print a shell completion script", run: runCompletion},
+		command{name: "healthcheck", summary: "check the heartbeat of a running converter", run: runHealthcheck},
+		command{name: "man", summary: "generate man pages", run: runMan},
+	)
+	slices.SortFunc(commands, func(a, b command) int { return strings.Compare(a.name, b.name) })
+}
+
+// While describe runs a command, newFlagSet records the command's flag set in
+// described instead of letting it print usage.
+var (
+	describing bool
+	described  *flag.FlagSet
+)
+
+// newFlagSet creates the flag set of a subcommand.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	auditFlags.Register(fs)
+	throttleFlags.Register(fs)
+	tempFlags.Register(fs)
+	if describing {
+		fs.SetOutput(io.Discard)
+		described = fs
+	}
+	return fs
+}
+
+// parseFlags parses the flags of a subcommand. Flags not given on the command
+// line are read from CSVTOOLS_<COMMAND>_<FLAG>, then CSVTOOLS_<FLAG>. Once
+// parsed, the run starts and its ID is added to every log line.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := envflags.Parse(fs, args, envflags.Name(envflags.Prefix, fs.Name())+"_", envflags.Prefix); err != nil {
+		return err
+	}
+	run = auditFlags.Start("csvtools "+fs.Name(), args)
+	logger = logger.With("run_id", run.RunID)
+	var err error
+	if limiter, err = throttleFlags.Apply(); err != nil {
+		logger.Warn("⚠️  Running at normal priority", "error", err)
+	}
+	runCtx, runSpan = tracing.Start(tracing.Parent(context.Background()), "csvtools "+fs.Name(),
+		attribute.String("csvtools.run_id", run.RunID))
+	tmp, err = tempFlags.Open(run.RunID)
+	return err
+}
+
+// flagGiven reports whether the flag name was set, on the command line or
+// from the environment.
+func flagGiven(fs *flag.FlagSet, name string) bool {
+	given := false
+	fs.Visit(func(f *flag.Flag) {
+		given = given || f.Name == name
+	})
+	return given
+}
+
+// finish ends the run, if it started, with code and err.
+func finish(code int, err error) {
+	if err := tmp.Remove(); err != nil {
+		logger.Warn("⚠️  Failed to clean up", "error", err)
+	}
+	if run == nil {
+		return
+	}
+	tracing.End(runSpan, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := flushTraces(ctx); err != nil {
+		logger.Warn("⚠️  Failed to export traces", "error", err)
+	}
+	if err := run.Finish(code, err); err != nil {
+		logger.Warn("⚠️  Failed to write the audit log", "error", err)
+	}
+}
+
+// describe returns the flag set of c, obtained by running it with -h so that
+// completions and man pages always match the real flags.
+func describe(c command) *flag.FlagSet {
+	describing, described = true, nil
+	_ = c.run([]string{"-h"})
+	describing = false
+	if described == nil {
+		return flag.NewFlagSet(c.name, flag.ContinueOnError)
+	}
+	return described
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: csvtools <command> [flags] [file]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	width := 0
+	for _, c := range commands {
+		width = max(width, len(c.name))
+	}
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-*s  %s\n", width, c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun \"csvtools <command> -h\" for the flags of a command.")
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "-help" || os.Args[1] == "help" {
+		usage()
+		os.Exit(exitcode.Usage)
+	}
+	name := os.Args[1]
+	if shutdown, err := tracing.Setup(context.Background(), "csvtools"); err != nil {
+		logger.Warn("⚠️  Tracing disabled", "error", err)
+	} else {
+		flushTraces = shutdown
+	}
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if err := c.run(os.Args[2:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				os.Exit(exitcode.Usage)
+			}
+			logger.Error("🧨  "+name+" failed", "error", err)
+			finish(exitcode.Failure, err)
+			os.Exit(exitcode.Failure)
+		}
+		finish(exitcode.OK, nil)
+		return
+	}
+	logger.Error("🧨  Unknown command", "command", name)
+	usage()
+	os.Exit(exitcode.Usage)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runMan writes roff man pages generated from the command definitions: a
+// csvtools(1) overview and a csvtools-<command>(1) page per command. Without
+// -dir the page of the named command (or the overview) goes to stdout.
+func runMan(args []string) error {
+	fs := newFlagSet("man")
+	dir := fs.String("dir", "", "write all man pages into this directory")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		if fs.NArg() == 0 {
+			return overviewPage(os.Stdout)
+		}
+		for _, c := range commands {
+			if c.name == fs.Arg(0) {
+				return commandPage(os.Stdout, c)
+			}
+		}
+		return fmt.Errorf("unknown command %q", fs.Arg(0))
+	}
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", *dir, err)
+	}
+	if err := writePage(filepath.Join(*dir, "csvtools.1"), overviewPage); err != nil {
+		return err
+	}
+	for _, c := range commands {
+		err := writePage(filepath.Join(*dir, "csvtools-"+c.name+".1"), func(w io.Writer) error {
+			return commandPage(w, c)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	logger.Info("✅  Wrote man pages", "dir", *dir, "pages", len(commands)+1)
+	return nil
+}
+
+func writePage(path string, page func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := page(f); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// roff escapes text for use in a man page.
+func roff(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+func overviewPage(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString(".TH CSVTOOLS 1 \"\" \"csvtools\" \"User Commands\"\n")
+	b.WriteString(".SH NAME\ncsvtools \\- CSV utilities\n")
+	b.WriteString(".SH SYNOPSIS\n.B csvtools\n.I command\n[flags] [file]\n")
+	b.WriteString(".SH DESCRIPTION\nCommands read the file given as argument (or stdin) and write CSV to stdout unless \\fB\\-o\\fR is set.\n")
+	b.WriteString(".SH COMMANDS\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, ".TP\n.B %s\n%s\n", roff(c.name), roff(c.summary))
+	}
+	b.WriteString(".SH SEE ALSO\n")
+	refs := make([]string, len(commands))
+	for i, c := range commands {
+		refs[i] = fmt.Sprintf(".BR csvtools\\-%s (1)", roff(c.name))
+	}
+	b.WriteString(strings.Join(refs, ",\n") + "\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func commandPage(w io.Writer, c command) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH CSVTOOLS\\-%s 1 \"\" \"csvtools\" \"User Commands\"\n", roff(strings.ToUpper(c.name)))
+	fmt.Fprintf(&b, ".SH NAME\ncsvtools\\-%s \\- %s\n", roff(c.name), roff(c.summary))
+	fmt.Fprintf(&b, ".SH SYNOPSIS\n.B csvtools %s\n[flags] [file]\n", roff(c.name))
+	b.WriteString(".SH OPTIONS\n")
+	describe(c).VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(&b, ".TP\n\\fB\\-%s\\fR", roff(f.Name))
+		if !isBoolFlag(f) {
+			name, _ := flag.UnquoteUsage(f)
+			if name == "" {
+				name = "value"
+			}
+			fmt.Fprintf(&b, " \\fI%s\\fR", roff(name))
+		}
+		b.WriteString("\n" + roff(f.Usage))
+		if f.DefValue != "" && f.DefValue != "false" {
+			fmt.Fprintf(&b, " (default %s)", roff(f.DefValue))
+		}
+		b.WriteString("\n")
+	})
+	b.WriteString(".SH SEE ALSO\n.BR csvtools (1)\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
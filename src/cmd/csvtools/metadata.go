@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/clipboard"
+	"csvtools/src/internal/columnar"
+	"csvtools/src/internal/connector"
+	"csvtools/src/internal/csvio"
+	"csvtools/src/internal/csvw"
+	"csvtools/src/internal/jsonschema"
+	"csvtools/src/internal/tableschema"
+)
+
+// readSchema reads a Frictionless table schema or the columns of a single
+// table CSVW metadata document.
+func readSchema(path string) (*tableschema.Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema %s: %w", path, err)
+	}
+	if !csvw.IsMetadata(data) {
+		return tableschema.Read(path)
+	}
+	m, err := csvw.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	table := &m.Table
+	if len(m.Tables) > 0 {
+		if len(m.Tables) > 1 {
+			return nil, fmt.Errorf("CSVW metadata %s describes %d tables: put it next to the CSV files instead", path, len(m.Tables))
+		}
+		table = m.Lookup(m.Tables[0].URL)
+	}
+	schema, err := table.Schema()
+	if err != nil {
+		return nil, fmt.Errorf("CSVW metadata %s: %w", path, err)
+	}
+	return schema, nil
+}
+
+// schemaSink returns the sink describing the output tables in dir, as
+// Frictionless table schemas, CSVW metadata or JSON Schemas. base returns
+// the schema the input of a table was read with.
+func schemaSink(dir, format string, base func(table string) *tableschema.Schema, policy atomicfile.Policy) (connector.Sink, error) {
+	switch format {
+	case "", "frictionless":
+		return tableschema.NewSink(dir, base, policy), nil
+	case "csvw":
+		return csvw.NewSink(dir, base, policy), nil
+	case "jsonschema":
+		return jsonschema.NewSink(dir, base, policy), nil
+	}
+	return nil, fmt.Errorf("unknown schema format %q (want frictionless, csvw or jsonschema)", format)
+}
+
+// sidecarMetadata applies the CSVW metadata found next to a local input, as
+// <file>-metadata.json or csv-metadata.json: the dialect's delimiter and
+// header rows, and the columns, which type and check the input as a schema
+// does. What the metadata gives is not sniffed in opts. It returns the stages
+// to run the input with and the schema of its columns, if any.
+func sidecarMetadata(in *connector.Input, stages []stage, opts *csvio.Options, csvOpts *columnar.CSVOptions, log *violationLog) ([]stage, *tableschema.Schema, error) {
+	if in.Location == "-" || clipboard.Is(in.Location) || strings.Contains(in.Location, "://") {
+		return stages, nil, nil
+	}
+	table, path, err := csvw.Find(in.Location)
+	if err != nil || table == nil {
+		return stages, nil, err
+	}
+	comma, err := table.Dialect.Comma()
+	if err != nil {
+		return nil, nil, fmt.Errorf("CSVW metadata %s: %w", path, err)
+	}
+	if comma != 0 {
+		in.Delimiter = comma
+		opts.Comma, opts.FixedComma = comma, true
+	}
+	skip, headerRows := 0, table.Dialect.HeaderRows()
+	// skipRows leaves a single header row.
+	opts.Header = csvio.HeaderPresent
+	if table.Dialect != nil {
+		skip = table.Dialect.SkipRows
+	}
+	if skip > 0 || headerRows != 1 {
+		var header []byte
+		if headerRows == 0 {
+			// The made up header must split as the rows do.
+			opts.Comma, opts.FixedComma = in.Delimiter, true
+			var buf bytes.Buffer
+			w := csvio.NewWriter(&buf, csvio.WriterOptions{Comma: in.Delimiter})
+			if err := w.Write(table.Names()); err != nil {
+				return nil, nil, err
+			}
+			w.Flush()
+			header = buf.Bytes()
+		}
+		open := in.Open
+		in.Open = func(ctx context.Context) (io.ReadCloser, error) {
+			rc, err := open(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return skipRows(rc, skip, headerRows, header)
+		}
+	}
+	var schema *tableschema.Schema
+	if table.TableSchema != nil {
+		if schema, err = table.Schema(); err != nil {
+			return nil, nil, fmt.Errorf("CSVW metadata %s: %w", path, err)
+		}
+		csvOpts.Types = schema.Types()
+		stages = append([]stage{&schemaStage{schema: schema, log: log}}, stages...)
+		if !slices.Contains(stages, stage(log)) {
+			stages = append(stages, log)
+		}
+	}
+	logger.Info("📇  Applying CSVW metadata", "input", in.Name, "metadata", path)
+	return stages, schema, nil
+}
+
+// skipRows drops the skip lines before the header and all header lines but
+// the first. Without header lines, header is put in their place.
+func skipRows(rc io.ReadCloser, skip, headerRows int, header []byte) (io.ReadCloser, error) {
+	r := bufio.NewReader(rc)
+	drop := func(n int) error {
+		for range n {
+			if _, err := r.ReadBytes('\n'); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := drop(skip); err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	var first []byte
+	if headerRows > 0 {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			_ = rc.Close()
+			return nil, err
+		}
+		first = line
+		if err := drop(headerRows - 1); err != nil {
+			_ = rc.Close()
+			return nil, err
+		}
+	} else {
+		first = header
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(first), r), rc}, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"csvtools/src/internal/contact"
+)
+
+// normalizeStage rewrites the emails, phone numbers or IBANs of a column in
+// their normal form as contact.Normalize gives it: emails with lower case
+// domains, phone numbers in E.164 format and IBANs without blanks. Phone
+// numbers without a country code are taken to be in Region. Invalid says
+// what happens to cells that aren't valid in Format: keep them (the
+// default), empty them, or fail; a validate stage with the same format
+// reports them instead. Empty cells are left alone.
+type normalizeStage struct {
+	Column  string `yaml:"column"`
+	Format  string `yaml:"format"`
+	Region  string `yaml:"region"`
+	Invalid string `yaml:"invalid"`
+
+	col     int
+	changed int
+	invalid int
+}
+
+func (s *normalizeStage) prepare(header []string) ([]string, error) {
+	if s.Column == "" || s.Format == "" {
+		return nil, fmt.Errorf("normalize needs a column and a format")
+	}
+	if !slices.Contains(contact.Formats, s.Format) {
+		return nil, fmt.Errorf("normalize %s: unknown format %q (want %s)", s.Column, s.Format, strings.Join(contact.Formats, ", "))
+	}
+	if err := contact.CheckRegion(s.Region); err != nil {
+		return nil, fmt.Errorf("normalize %s: %w", s.Column, err)
+	}
+	switch s.Invalid {
+	case "":
+		s.Invalid = "keep"
+	case "keep", "empty", "error":
+	default:
+		return nil, fmt.Errorf("normalize %s: unknown invalid %q (want keep, empty or error)", s.Column, s.Invalid)
+	}
+	var err error
+	if s.col, err = resolveColumn(header, s.Column); err != nil {
+		return nil, fmt.Errorf("normalize: %w", err)
+	}
+	return header, nil
+}
+
+func (s *normalizeStage) apply(record []string, line int) ([]string, bool, error) {
+	cell := field(record, s.col)
+	if cell == "" {
+		return record, true, nil
+	}
+	normal, err := contact.Normalize(s.Format, cell, s.Region)
+	switch {
+	case err == nil:
+		if normal != cell {
+			record[s.col] = normal
+			s.changed++
+		}
+	case s.Invalid == "error":
+		return nil, false, fmt.Errorf("line %d: %s: %w", line, s.Column, err)
+	default:
+		s.invalid++
+		if s.Invalid == "empty" {
+			record[s.col] = ""
+		}
+	}
+	return record, true, nil
+}
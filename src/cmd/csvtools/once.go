@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/bundle"
+	"csvtools/src/internal/columnar"
+	"csvtools/src/internal/connector"
+	"csvtools/src/internal/csvio"
+	"csvtools/src/internal/discover"
+)
+
+// onceFormats are the formats once converts to: the sink scheme, the file
+// extension and the content type of the response.
+var onceFormats = map[string]struct{ ext, contentType string }{
+	"xlsx":    {".xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	"sqlite":  {".db", "application/vnd.sqlite3"},
+	"parquet": {".parquet", "application/vnd.apache.parquet"},
+	"json":    {".jsonl", "application/jsonl"},
+	"csv":     {".csv", "text/csv"},
+}
+
+// runOnce serves one-shot conversions over HTTP: the CSV POSTed to / is
+// converted while the client waits and the output comes back as the
+// response body. Nothing outlives a request, so the server can run as a
+// sidecar without storage of its own.
+func runOnce(args []string) error {
+	fs := newFlagSet("once")
+	listen := fs.String("listen", ":8080", "address to listen on")
+	format := fs.String("format", "xlsx", "default output format: xlsx, sqlite, parquet, json or csv; requests pick another with ?format=")
+	infer := fs.Bool("infer", true, "type columns as bool, integer or float from the first batch of rows (default only for xlsx, sqlite and parquet; csv and json keep the input text)")
+	maxBody := int64(256 << 20)
+	fs.Func("max-body", "refuse bodies larger than this, e.g. 1GB (default 256MB)", func(s string) (err error) {
+		maxBody, err = discover.ParseSize(s)
+		return err
+	})
+	requests := fs.Int("requests", 0, "exit after serving this many requests, e.g. 1 for a single conversion (0 for no limit)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if _, ok := onceFormats[*format]; !ok {
+		return fmt.Errorf("-format must be xlsx, sqlite, parquet, json or csv, got %q", *format)
+	}
+	if *requests < 0 {
+		return fmt.Errorf("-requests must not be negative")
+	}
+	// Without -infer, whether to type columns depends on the format.
+	var inferred *bool
+	if flagGiven(fs, "infer") {
+		inferred = infer
+	}
+
+	ctx, stop := signal.NotifyContext(runCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	var served atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{$}", func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+		if err := convertRequest(w, r, *format, inferred); err != nil {
+			status := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			logger.Warn("⚠️  Conversion failed", "remote", r.RemoteAddr, "error", err)
+			http.Error(w, err.Error(), status)
+		}
+		if n := served.Add(1); *requests > 0 && n >= int64(*requests) {
+			stop()
+		}
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok\n")
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(ln)
+	}()
+	logger.Info("🛎️  Serving conversions", "address", ln.Addr().String(), "format", *format)
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	// Conversions under way finish before the server exits.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	logger.Info("✅ Server stopped", "requests", served.Load())
+	return nil
+}
+
+// convertRequest converts the CSV body of r, or every file of a
+// multipart/form-data body as a table of its own, into a temp file and
+// copies it to w. ?name= names the table of a plain body and the download
+// (default data), ?delimiter= sets the field delimiter and ?format= the
+// output format. Formats with a file per table answer several tables, or
+// any with ?bundle=, with a zip or tar archive of the files. infer, unless
+// nil, says whether to type columns instead of the format.
+func convertRequest(w http.ResponseWriter, r *http.Request, defaultFormat string, infer *bool) error {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = defaultFormat
+	}
+	out, ok := onceFormats[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q", format)
+	}
+	name := query.Get("name")
+	if name == "" {
+		name = "data"
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	readOpts := csvio.Options{Comma: ',', MaxRecordSize: csvio.DefaultMaxRecordSize, ReuseRecord: true}
+	if d := query.Get("delimiter"); d != "" {
+		comma, err := discover.ParseDelimiter(d)
+		if err != nil {
+			return err
+		}
+		readOpts.Comma = comma
+	}
+	var parts *multipart.Reader
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		var err error
+		if parts, err = r.MultipartReader(); err != nil {
+			return err
+		}
+	}
+	archive := query.Get("bundle")
+	switch {
+	case archive != "" && (format == "xlsx" || format == "sqlite"):
+		return fmt.Errorf("%s holds every table in one file; bundle is for parquet, json and csv", format)
+	case archive != "" && archive != bundle.Zip && archive != bundle.Tar && archive != bundle.TarGz && archive != bundle.TarZst:
+		return fmt.Errorf("unknown bundle %q (want %s)", archive, bundle.Formats)
+	case archive == "" && parts != nil && format != "xlsx" && format != "sqlite":
+		archive = bundle.Zip
+	}
+	filename, contentType := name+out.ext, out.contentType
+	if archive != "" {
+		filename, contentType = name+bundle.Ext(archive), bundle.ContentType(archive)
+	}
+
+	dir, err := os.MkdirTemp("", "once-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	path := filepath.Join(dir, filename)
+	sink, err := connector.OpenSink(format+"://"+filepath.ToSlash(path), atomicfile.Overwrite)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = sink.Close()
+	}()
+	csvOpts := columnar.CSVOptions{BatchSize: columnar.DefaultBatchSize, Infer: connector.Typed([]string{format + "://"})}
+	if infer != nil {
+		csvOpts.Infer = *infer
+	}
+	convert := func(table string, body io.Reader) (int64, error) {
+		in := connector.Input{Name: table, Location: "-", Delimiter: readOpts.Comma,
+			Open: func(context.Context) (io.ReadCloser, error) { return io.NopCloser(body), nil }}
+		return pipelineInput(r.Context(), in, nil, sink, readOpts, csvOpts, columnar.DefaultQueueDepth)
+	}
+	var rows, tables int64
+	if parts == nil {
+		if rows, err = convert(name, r.Body); err != nil {
+			return err
+		}
+		tables = 1
+	}
+	for parts != nil {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if part.FileName() == "" {
+			continue // a form field, not a file
+		}
+		table := tableName(part.FileName())
+		n, err := convert(table, part)
+		if err != nil {
+			return fmt.Errorf("%s: %w", part.FileName(), err)
+		}
+		rows += n
+		tables++
+	}
+	if tables == 0 {
+		return fmt.Errorf("no CSV files in the form")
+	}
+	if err := sink.Commit(); err != nil {
+		return err
+	}
+	if err := sink.Close(); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	http.ServeContent(w, r, "", time.Time{}, f)
+	logger.Info("📦  Converted request", "remote", r.RemoteAddr, "format", format, "tables", tables, "rows", rows)
+	return nil
+}
@@ -0,0 +1,1043 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/columnar"
+	"csvtools/src/internal/connector"
+	"csvtools/src/internal/contact"
+	"csvtools/src/internal/csvio"
+	"csvtools/src/internal/discover"
+	"csvtools/src/internal/headers"
+	"csvtools/src/internal/lineage"
+	"csvtools/src/internal/rowhash"
+	"csvtools/src/internal/tableschema"
+	"csvtools/src/internal/tracing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"go.opentelemetry.io/otel/attribute"
+	"gopkg.in/yaml.v3"
+)
+
+// pipelineConfig is a pipeline file: one source, stages applied to every row
+// in order, and the sinks every input is written to in the same pass.
+type pipelineConfig struct {
+	Source    string        `yaml:"source"`
+	Delimiter string        `yaml:"delimiter"`
+	Lenient   bool          `yaml:"lenient"`
+	Infer     *bool         `yaml:"infer"`
+	BatchSize int           `yaml:"batch_size"`
+	Stages    []stageConfig `yaml:"stages"`
+	Sinks     []string      `yaml:"sinks"`
+	// Route is the column whose value picks the output of every row, for
+	// sinks with a {value} placeholder; MaxRoutes caps the outputs.
+	Route     string `yaml:"route"`
+	MaxRoutes int    `yaml:"max_routes"`
+
+	Validation validationConfig `yaml:"validation"`
+	violations *violationLog
+
+	// Schema is a table schema descriptor or CSVW metadata the source is
+	// typed and checked with before the stages, instead of CSVW sidecars;
+	// EmitSchema a directory to describe the output tables in, in
+	// SchemaFormat.
+	Schema       string `yaml:"schema"`
+	EmitSchema   string `yaml:"emit_schema"`
+	SchemaFormat string `yaml:"schema_format"`
+	schema       *tableschema.Schema
+
+	// Sniff, on by default, guesses the delimiter and quote of every input;
+	// Quote sets the latter instead. HeaderRow is yes (the default), no or
+	// auto to guess the header row too.
+	Sniff     *bool  `yaml:"sniff"`
+	HeaderRow string `yaml:"header_row"`
+	Quote     string `yaml:"input_quote"`
+	// Separator and SeparatorRegexp split fields instead of the delimiter.
+	Separator       string `yaml:"separator"`
+	SeparatorRegexp string `yaml:"separator_regexp"`
+	// Comment, FooterMatch and FooterRows skip lines that aren't data.
+	Comment     string `yaml:"comment"`
+	FooterMatch string `yaml:"footer_match"`
+	FooterRows  int    `yaml:"footer_rows"`
+	// ExpectColumns fails an input of another width; MinRows, MaxRows and
+	// RowLimits one with too few or too many rows.
+	ExpectColumns int              `yaml:"expect_columns"`
+	MinRows       int              `yaml:"min_rows"`
+	MaxRows       int              `yaml:"max_rows"`
+	RowLimits     []csvio.RowLimit `yaml:"row_limits"`
+	// ParseWorkers parses every input on that many cores; unset is one.
+	ParseWorkers int `yaml:"parse_workers"`
+	// QueueDepth is how many batches are read ahead of slow sinks; 0 reads
+	// in step with writing.
+	QueueDepth *int `yaml:"queue_depth"`
+}
+
+// stageConfig holds exactly one stage.
+type stageConfig struct {
+	Clean     *cleanStage     `yaml:"clean"`
+	Filter    *filterStage    `yaml:"filter"`
+	Derive    *deriveStage    `yaml:"derive"`
+	Validate  *validateStage  `yaml:"validate"`
+	MaxLength *maxLengthStage `yaml:"max_length"`
+	Enrich    *enrichStage    `yaml:"enrich"`
+	Lineage   []string        `yaml:"lineage"`
+	Hash      *hashStage      `yaml:"hash"`
+	Map       *mapStage       `yaml:"map"`
+	Units     *unitStage      `yaml:"units"`
+	Geo       *geoStage       `yaml:"geo"`
+	Normalize *normalizeStage `yaml:"normalize"`
+	Order     *orderStage     `yaml:"order"`
+}
+
+// stage transforms rows. prepare receives the header, checks the stage's
+// columns and returns the header of the rows apply returns. apply returns
+// false to drop a row.
+type stage interface {
+	prepare(header []string) ([]string, error)
+	apply(record []string, line int) ([]string, bool, error)
+}
+
+func (c stageConfig) stage() (stage, error) {
+	var set []stage
+	if c.Clean != nil {
+		set = append(set, c.Clean)
+	}
+	if c.Filter != nil {
+		set = append(set, c.Filter)
+	}
+	if c.Derive != nil {
+		set = append(set, c.Derive)
+	}
+	if c.Validate != nil {
+		set = append(set, c.Validate)
+	}
+	if c.MaxLength != nil {
+		set = append(set, c.MaxLength)
+	}
+	if c.Enrich != nil {
+		set = append(set, c.Enrich)
+	}
+	if c.Lineage != nil {
+		columns, err := lineage.Parse(c.Lineage)
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, newLineageStage(columns))
+	}
+	if c.Hash != nil {
+		set = append(set, c.Hash)
+	}
+	if c.Map != nil {
+		set = append(set, c.Map)
+	}
+	if c.Units != nil {
+		set = append(set, c.Units)
+	}
+	if c.Geo != nil {
+		set = append(set, c.Geo)
+	}
+	if c.Normalize != nil {
+		set = append(set, c.Normalize)
+	}
+	if c.Order != nil {
+		c.Order.order = headers.ColumnOrder{Mode: c.Order.Mode, SchemaFile: c.Order.Schema}
+		if err := c.Order.order.Load(); err != nil {
+			return nil, fmt.Errorf("order: %w", err)
+		}
+		set = append(set, c.Order)
+	}
+	if len(set) != 1 {
+		return nil, fmt.Errorf("a stage needs exactly one of clean, filter, derive, validate, max_length, enrich, lineage, hash, map, units, geo, normalize or order")
+	}
+	return set[0], nil
+}
+
+// cleanStage applies the cleanups of csvtools clean; all are on by default.
+type cleanStage struct {
+	Trim          *bool `yaml:"trim"`
+	CollapseSpace *bool `yaml:"collapse_space"`
+	StripControl  *bool `yaml:"strip_control"`
+	FixQuotes     *bool `yaml:"fix_quotes"`
+
+	opts   cleanOptions
+	report cleanReport
+}
+
+func (s *cleanStage) prepare(header []string) ([]string, error) {
+	on := func(b *bool) bool { return b == nil || *b }
+	s.opts = cleanOptions{trim: on(s.Trim), collapseSpace: on(s.CollapseSpace), stripControl: on(s.StripControl), fixQuotes: on(s.FixQuotes)}
+	return header, nil
+}
+
+func (s *cleanStage) apply(record []string, _ int) ([]string, bool, error) {
+	for i, cell := range record {
+		record[i] = s.opts.cleanCell(cell, &s.report)
+	}
+	return record, true, nil
+}
+
+// filterStage keeps the rows where column (or, without one, any cell)
+// matches the regular expression or equals the value; invert keeps the
+// others instead.
+type filterStage struct {
+	Column string `yaml:"column"`
+	Match  string `yaml:"match"`
+	Equals string `yaml:"equals"`
+	Invert bool   `yaml:"invert"`
+
+	re  *regexp.Regexp
+	idx []int
+}
+
+func (s *filterStage) prepare(header []string) ([]string, error) {
+	if (s.Match == "") == (s.Equals == "") {
+		return nil, fmt.Errorf("filter needs one of match or equals")
+	}
+	if s.Match != "" {
+		var err error
+		if s.re, err = regexp.Compile(s.Match); err != nil {
+			return nil, fmt.Errorf("filter: %w", err)
+		}
+	}
+	s.idx = nil
+	if s.Column == "" {
+		for i := range header {
+			s.idx = append(s.idx, i)
+		}
+		return header, nil
+	}
+	i, err := resolveColumn(header, s.Column)
+	if err != nil {
+		return nil, fmt.Errorf("filter: %w", err)
+	}
+	s.idx = []int{i}
+	return header, nil
+}
+
+func (s *filterStage) apply(record []string, _ int) ([]string, bool, error) {
+	matched := slices.ContainsFunc(s.idx, func(i int) bool {
+		if s.re != nil {
+			return s.re.MatchString(field(record, i))
+		}
+		return field(record, i) == s.Equals
+	})
+	return record, matched != s.Invert, nil
+}
+
+// deriveStage sets column to value, where {name} is replaced by the cell of
+// column name. A new column is appended; an existing one is overwritten.
+type deriveStage struct {
+	Column string `yaml:"column"`
+	Value  string `yaml:"value"`
+
+	target int
+	parts  []string
+	refs   []int
+}
+
+var placeholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+func (s *deriveStage) prepare(header []string) ([]string, error) {
+	if s.Column == "" {
+		return nil, fmt.Errorf("derive needs a column")
+	}
+	s.parts, s.refs = nil, nil
+	last := 0
+	for _, m := range placeholder.FindAllStringSubmatchIndex(s.Value, -1) {
+		i, err := resolveColumn(header, s.Value[m[2]:m[3]])
+		if err != nil {
+			return nil, fmt.Errorf("derive %s: %w", s.Column, err)
+		}
+		s.parts = append(s.parts, s.Value[last:m[0]])
+		s.refs = append(s.refs, i)
+		last = m[1]
+	}
+	s.parts = append(s.parts, s.Value[last:])
+	s.target = slices.Index(header, s.Column)
+	if s.target < 0 {
+		s.target = len(header)
+		header = append(slices.Clip(header), s.Column)
+	}
+	return header, nil
+}
+
+func (s *deriveStage) apply(record []string, _ int) ([]string, bool, error) {
+	var b strings.Builder
+	for i, part := range s.parts {
+		b.WriteString(part)
+		if i < len(s.refs) {
+			b.WriteString(field(record, s.refs[i]))
+		}
+	}
+	for len(record) <= s.target {
+		record = append(record, "")
+	}
+	record[s.target] = b.String()
+	return record, true, nil
+}
+
+// validateStage reports the cells of column that break one of its rules as
+// violations of its severity, error by default; see validationConfig for
+// when they fail the run. Empty cells only break required. Format checks
+// emails, phone numbers or IBANs as contact.Normalize does; phone numbers
+// without a country code are taken to be in Region.
+type validateStage struct {
+	Column   string   `yaml:"column"`
+	Required bool     `yaml:"required"`
+	Type     string   `yaml:"type"`
+	Match    string   `yaml:"match"`
+	Min      *float64 `yaml:"min"`
+	Max      *float64 `yaml:"max"`
+	Values   []string `yaml:"values"`
+	Format   string   `yaml:"format"`
+	Region   string   `yaml:"region"`
+	Severity string   `yaml:"severity"`
+
+	idx  int
+	name string
+	re   *regexp.Regexp
+	log  *violationLog
+}
+
+func (s *validateStage) prepare(header []string) ([]string, error) {
+	var err error
+	if s.idx, err = resolveColumn(header, s.Column); err != nil {
+		return nil, fmt.Errorf("validate: %w", err)
+	}
+	s.name = header[s.idx]
+	switch s.Type {
+	case "", "text", "integer", "number", "bool":
+	default:
+		return nil, fmt.Errorf("validate %s: unknown type %q (want text, integer, number or bool)", s.Column, s.Type)
+	}
+	if s.Format != "" && !slices.Contains(contact.Formats, s.Format) {
+		return nil, fmt.Errorf("validate %s: unknown format %q (want %s)", s.Column, s.Format, strings.Join(contact.Formats, ", "))
+	}
+	if err := contact.CheckRegion(s.Region); err != nil {
+		return nil, fmt.Errorf("validate %s: %w", s.Column, err)
+	}
+	switch s.Severity {
+	case "":
+		s.Severity = connector.SeverityError
+	case connector.SeverityError, connector.SeverityWarning:
+	default:
+		return nil, fmt.Errorf("validate %s: unknown severity %q (want error or warning)", s.Column, s.Severity)
+	}
+	if s.Match != "" {
+		if s.re, err = regexp.Compile("^(?:" + s.Match + ")$"); err != nil {
+			return nil, fmt.Errorf("validate %s: %w", s.Column, err)
+		}
+	}
+	return header, nil
+}
+
+func (s *validateStage) apply(record []string, line int) ([]string, bool, error) {
+	cell := field(record, s.idx)
+	if problem := s.check(cell); problem != "" {
+		err := s.log.add(violation{Line: line, Column: s.name, Value: cell, Severity: s.Severity, Message: problem})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return record, true, nil
+}
+
+// check returns what is wrong with cell, or "".
+func (s *validateStage) check(cell string) string {
+	if cell == "" {
+		if s.Required {
+			return "value is required"
+		}
+		return ""
+	}
+	var err error
+	switch s.Type {
+	case "integer":
+		_, err = strconv.ParseInt(cell, 10, 64)
+	case "number":
+		_, err = strconv.ParseFloat(cell, 64)
+	case "bool":
+		_, err = strconv.ParseBool(strings.ToLower(cell))
+	}
+	if err != nil {
+		return fmt.Sprintf("%q is not %s", cell, s.Type)
+	}
+	if s.Format != "" {
+		if _, err := contact.Normalize(s.Format, cell, s.Region); err != nil {
+			return err.Error()
+		}
+	}
+	if s.re != nil && !s.re.MatchString(cell) {
+		return fmt.Sprintf("%q does not match %s", cell, s.Match)
+	}
+	if len(s.Values) > 0 && !slices.Contains(s.Values, cell) {
+		return fmt.Sprintf("%q is not one of %s", cell, strings.Join(s.Values, ", "))
+	}
+	if s.Min != nil || s.Max != nil {
+		v, err := strconv.ParseFloat(cell, 64)
+		switch {
+		case err != nil:
+			return fmt.Sprintf("%q is not a number", cell)
+		case s.Min != nil && v < *s.Min:
+			return fmt.Sprintf("%s is below %s", cell, strconv.FormatFloat(*s.Min, 'f', -1, 64))
+		case s.Max != nil && v > *s.Max:
+			return fmt.Sprintf("%s is above %s", cell, strconv.FormatFloat(*s.Max, 'f', -1, 64))
+		}
+	}
+	return ""
+}
+
+// maxLengthStage holds the cells of column to length characters, or bytes
+// with unit bytes, for sinks with VARCHAR limits. With action truncate,
+// longer cells are cut and reported as warnings holding the whole value;
+// with action error, the default, they are reported as errors and kept.
+type maxLengthStage struct {
+	Column string `yaml:"column"`
+	Length int    `yaml:"length"`
+	Unit   string `yaml:"unit"`
+	Action string `yaml:"action"`
+
+	idx       int
+	name      string
+	log       *violationLog
+	truncated int
+}
+
+func (s *maxLengthStage) prepare(header []string) ([]string, error) {
+	var err error
+	if s.idx, err = resolveColumn(header, s.Column); err != nil {
+		return nil, fmt.Errorf("max_length: %w", err)
+	}
+	s.name = header[s.idx]
+	if s.Length < 1 {
+		return nil, fmt.Errorf("max_length %s: length must be positive, got %d", s.Column, s.Length)
+	}
+	switch s.Unit {
+	case "":
+		s.Unit = "chars"
+	case "chars", "bytes":
+	default:
+		return nil, fmt.Errorf("max_length %s: unknown unit %q (want chars or bytes)", s.Column, s.Unit)
+	}
+	switch s.Action {
+	case "":
+		s.Action = "error"
+	case "error", "truncate":
+	default:
+		return nil, fmt.Errorf("max_length %s: unknown action %q (want error or truncate)", s.Column, s.Action)
+	}
+	return header, nil
+}
+
+func (s *maxLengthStage) apply(record []string, line int) ([]string, bool, error) {
+	cell := field(record, s.idx)
+	n := len(cell)
+	if s.Unit == "chars" {
+		n = utf8.RuneCountInString(cell)
+	}
+	if n <= s.Length {
+		return record, true, nil
+	}
+	v := violation{Line: line, Column: s.name, Value: cell, Severity: connector.SeverityError,
+		Message: fmt.Sprintf("%d %s long, the limit is %d", n, s.Unit, s.Length)}
+	if s.Action == "truncate" {
+		record[s.idx] = s.truncate(cell)
+		s.truncated++
+		v.Severity = connector.SeverityWarning
+		v.Message = fmt.Sprintf("truncated from %d to %d %s", n, s.Length, s.Unit)
+	}
+	if err := s.log.add(v); err != nil {
+		return nil, false, err
+	}
+	return record, true, nil
+}
+
+// truncate cuts cell to the limit, at a character boundary.
+func (s *maxLengthStage) truncate(cell string) string {
+	if s.Unit == "bytes" {
+		n := s.Length
+		for n > 0 && !utf8.RuneStart(cell[n]) {
+			n--
+		}
+		return cell[:n]
+	}
+	chars := 0
+	for i := range cell {
+		if chars == s.Length {
+			return cell[:i]
+		}
+		chars++
+	}
+	return cell
+}
+
+// inputStage is a stage that needs to know the input it runs over.
+type inputStage interface {
+	begin(in connector.Input)
+}
+
+// lineageStage appends the lineage columns: the row number in the input,
+// which counts the rows earlier stages dropped, the input's location, and
+// the time the run started.
+type lineageStage struct {
+	columns  lineage.Columns
+	loadedAt string
+	file     string
+	width    int
+}
+
+func newLineageStage(columns lineage.Columns) *lineageStage {
+	return &lineageStage{columns: columns, loadedAt: lineage.Timestamp(time.Now())}
+}
+
+func (s *lineageStage) begin(in connector.Input) {
+	s.file = in.Location
+}
+
+func (s *lineageStage) prepare(header []string) ([]string, error) {
+	if name, clash := s.columns.Clash(header); clash {
+		return nil, fmt.Errorf("lineage: the input already has a column %s", name)
+	}
+	s.width = len(header)
+	return append(slices.Clip(header), s.columns...), nil
+}
+
+func (s *lineageStage) apply(record []string, line int) ([]string, bool, error) {
+	// Pad short rows so the lineage cells land in their own columns.
+	for len(record) < s.width {
+		record = append(record, "")
+	}
+	return s.columns.Append(record, s.file, int64(line-1), s.loadedAt), true, nil
+}
+
+// hashStage appends a fingerprint of the row: a stable hash of columns, all
+// of them by default, in column, _row_hash by default, computed with
+// algorithm, sha256 by default.
+type hashStage struct {
+	Column    string   `yaml:"column"`
+	Columns   []string `yaml:"columns"`
+	Algorithm string   `yaml:"algorithm"`
+
+	hasher *rowhash.Hasher
+	idx    []int
+	width  int
+}
+
+func (s *hashStage) prepare(header []string) ([]string, error) {
+	var err error
+	if s.hasher, err = rowhash.New(s.Algorithm); err != nil {
+		return nil, fmt.Errorf("hash: %w", err)
+	}
+	if s.Column == "" {
+		s.Column = rowhash.Column
+	}
+	if slices.ContainsFunc(header, func(h string) bool { return strings.EqualFold(h, s.Column) }) {
+		return nil, fmt.Errorf("hash: the input already has a column %s", s.Column)
+	}
+	s.idx = s.idx[:0]
+	for _, name := range s.Columns {
+		i, err := resolveColumn(header, strings.TrimSpace(name))
+		if err != nil {
+			return nil, fmt.Errorf("hash: %w", err)
+		}
+		s.idx = append(s.idx, i)
+	}
+	if len(s.Columns) == 0 {
+		for i := range header {
+			s.idx = append(s.idx, i)
+		}
+	}
+	s.width = len(header)
+	return append(slices.Clip(header), s.Column), nil
+}
+
+func (s *hashStage) apply(record []string, _ int) ([]string, bool, error) {
+	// Pad short rows so the fingerprint lands in its own column.
+	for len(record) < s.width {
+		record = append(record, "")
+	}
+	return append(record, s.hasher.Sum(record, s.idx)), true, nil
+}
+
+// orderStage reorders the columns as -column-order does: preserve, sorted
+// or as listed in a schema file.
+type orderStage struct {
+	Mode   string `yaml:"mode"`
+	Schema string `yaml:"schema"`
+
+	order headers.ColumnOrder
+	perm  []int
+}
+
+func (s *orderStage) prepare(header []string) ([]string, error) {
+	s.perm = s.order.Permutation(header)
+	return headers.Reorder(header, s.perm), nil
+}
+
+func (s *orderStage) apply(record []string, _ int) ([]string, bool, error) {
+	return headers.Reorder(record, s.perm), true, nil
+}
+
+// stagedReader runs the stages over the records of src. It returns the
+// transformed header first, then the rows the stages keep.
+// Time spent parsing is phase 0 of phases and in stage i phase i+1.
+type stagedReader struct {
+	src    csvio.Reader
+	stages []stage
+	phases *tracing.Phases
+	header bool
+	line   int
+}
+
+func (r *stagedReader) Read() ([]string, error) {
+	for {
+		start := r.phases.Now()
+		record, err := r.src.Read()
+		r.phases.Add(0, start)
+		if err != nil {
+			return nil, err
+		}
+		r.line++
+		if !r.header {
+			r.header = true
+			for _, s := range r.stages {
+				if record, err = s.prepare(record); err != nil {
+					return nil, err
+				}
+			}
+			return record, nil
+		}
+		keep := true
+		for i, s := range r.stages {
+			start := r.phases.Now()
+			record, keep, err = s.apply(record, r.line)
+			r.phases.Add(i+1, start)
+			if err != nil || !keep {
+				break
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			return record, nil
+		}
+	}
+}
+
+func (r *stagedReader) InputOffset() int64 {
+	return r.src.InputOffset()
+}
+
+// readPipeline reads and checks a pipeline file. Unknown keys are errors, so
+// misspelled options don't go unnoticed.
+func readPipeline(path string) (*pipelineConfig, []stage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read pipeline %s: %w", path, err)
+	}
+	var cfg pipelineConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("failed to parse pipeline %s: %w", path, err)
+	}
+	if cfg.Source == "" {
+		return nil, nil, fmt.Errorf("pipeline %s: source is required", path)
+	}
+	if len(cfg.Sinks) == 0 {
+		return nil, nil, fmt.Errorf("pipeline %s: at least one sink is required", path)
+	}
+	if cfg.Route != "" && !slices.ContainsFunc(cfg.Sinks, func(s string) bool { return strings.Contains(s, connector.Placeholder) }) {
+		return nil, nil, fmt.Errorf("pipeline %s: route needs a sink with a %s placeholder", path, connector.Placeholder)
+	}
+	stages := make([]stage, len(cfg.Stages))
+	cfg.violations = newViolationLog(cfg.Validation)
+	validates := false
+	if cfg.Schema != "" {
+		if cfg.schema, err = readSchema(cfg.Schema); err != nil {
+			return nil, nil, fmt.Errorf("pipeline %s: %w", path, err)
+		}
+		stages = slices.Insert(stages, 0, stage(&schemaStage{schema: cfg.schema, log: cfg.violations}))
+		validates = true
+	}
+	offset := len(stages) - len(cfg.Stages)
+	for i, c := range cfg.Stages {
+		if stages[offset+i], err = c.stage(); err != nil {
+			return nil, nil, fmt.Errorf("pipeline %s: stage %d: %w", path, i+1, err)
+		}
+		switch v := stages[offset+i].(type) {
+		case *validateStage:
+			v.log = cfg.violations
+			validates = true
+		case *maxLengthStage:
+			v.log = cfg.violations
+			validates = true
+		}
+	}
+	if validates {
+		stages = append(stages, cfg.violations)
+	}
+	return &cfg, stages, nil
+}
+
+// runPipeline reads every input of a pipeline's source once, runs its rows
+// through the stages and writes them to all sinks.
+func runPipeline(args []string) error {
+	fs := newFlagSet("pipeline")
+	var outputFlags atomicfile.Flags
+	outputFlags.Register(fs)
+	maxRecord := int64(csvio.DefaultMaxRecordSize)
+	fs.Func("max-record-size", "fail on a record larger than this, e.g. 512MB; 0 for no limit (default 64MB)", func(s string) (err error) {
+		maxRecord, err = discover.ParseSize(s)
+		return err
+	})
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected one pipeline file, got %d", fs.NArg())
+	}
+	cfg, stages, err := readPipeline(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	policy, err := outputFlags.Policy()
+	if err != nil {
+		return err
+	}
+	if cfg.Validation.Report != "" {
+		if err := atomicfile.Check(cfg.Validation.Report, policy); err != nil {
+			return overwriteHint(err)
+		}
+	}
+	var comma rune
+	if cfg.Delimiter != "" {
+		if comma, err = discover.ParseDelimiter(cfg.Delimiter); err != nil {
+			return err
+		}
+	}
+	sniff := csvio.SniffFlags{Sniff: cfg.Sniff == nil || *cfg.Sniff, Quote: cfg.Quote}
+	if cfg.HeaderRow != "" {
+		if err := sniff.Header.Set(cfg.HeaderRow); err != nil {
+			return fmt.Errorf("header_row: %w", err)
+		}
+	}
+	if err := sniff.Load(); err != nil {
+		return err
+	}
+	separator := csvio.SeparatorFlags{Separator: cfg.Separator, Pattern: cfg.SeparatorRegexp}
+	if err := separator.Load(); err != nil {
+		return err
+	}
+	skip := csvio.SkipFlags{Comment: cfg.Comment, FooterMatch: cfg.FooterMatch, FooterRows: cfg.FooterRows}
+	if err := skip.Load(); err != nil {
+		return err
+	}
+	asserts := csvio.AssertFlags{ExpectColumns: cfg.ExpectColumns, MinRows: cfg.MinRows, MaxRows: cfg.MaxRows, RowLimits: cfg.RowLimits}
+	if err := asserts.Load(); err != nil {
+		return err
+	}
+	parallel := csvio.ParallelFlags{Workers: max(cfg.ParseWorkers, 1)}
+	depth := columnar.DefaultQueueDepth
+	if cfg.QueueDepth != nil {
+		if depth = *cfg.QueueDepth; depth < 0 {
+			return fmt.Errorf("queue_depth must not be negative, got %d", depth)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(runCtx, os.Interrupt)
+	defer stop()
+	source, err := connector.OpenSource(cfg.Source)
+	if err != nil {
+		return err
+	}
+	inputs, err := listInputs(ctx, source)
+	if err != nil {
+		return err
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("no inputs found at %s", cfg.Source)
+	}
+	sinks, err := connector.OpenRouted(cfg.Sinks, cfg.Route, cmp.Or(cfg.MaxRoutes, connector.DefaultMaxRoutes), policy)
+	if err != nil {
+		return overwriteHint(err)
+	}
+	sinks.Label("RunID", run.RunID)
+	// The schemas of CSVW sidecars, by input, to describe the outputs with.
+	inputSchemas := make(map[string]*tableschema.Schema)
+	if cfg.EmitSchema != "" {
+		sink, err := schemaSink(cfg.EmitSchema, cfg.SchemaFormat, func(table string) *tableschema.Schema {
+			if s := inputSchemas[table]; s != nil {
+				return s
+			}
+			return cfg.schema
+		}, policy)
+		if err != nil {
+			_ = sinks.Close()
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	defer func() {
+		_ = sinks.Close()
+	}()
+
+	// Text sinks get the cells as read unless infer is set.
+	infer := connector.Typed(cfg.Sinks)
+	if cfg.Infer != nil {
+		infer = *cfg.Infer
+	}
+	csvOpts := columnar.CSVOptions{BatchSize: cfg.BatchSize, Infer: infer}
+	if cfg.schema != nil {
+		csvOpts.Types = cfg.schema.Types()
+	}
+	for _, in := range inputs {
+		readOpts := csvio.Options{Comma: in.Delimiter, Lenient: cfg.Lenient, MaxRecordSize: maxRecord, ReuseRecord: true,
+			OnRecover: func(rec csvio.Recovery) {
+				logger.Warn("🩹  Recovered malformed record", "input", in.Name, "line", rec.Line, "reason", rec.Reason)
+			},
+		}
+		sniff.Apply(&readOpts)
+		if in.Converted {
+			readOpts.FixedComma, readOpts.Header = true, csvio.HeaderPresent
+		}
+		separator.Apply(&readOpts)
+		skip.Apply(&readOpts)
+		asserts.Apply(&readOpts, in.Location)
+		parallel.Apply(&readOpts)
+		if readOpts.Sniff {
+			readOpts.OnDialect = dialectLogger(in.Name)
+		}
+		inStages, inOpts := stages, csvOpts
+		if cfg.schema == nil {
+			if inStages, inputSchemas[in.Name], err = sidecarMetadata(&in, stages, &readOpts, &inOpts, cfg.violations); err != nil {
+				return fmt.Errorf("%s: %w", in.Name, err)
+			}
+		}
+		if comma != 0 && !in.Converted {
+			readOpts.Comma, readOpts.FixedComma = comma, true
+		}
+		sinks.Annotate(in.Name, cfg.violations.notesFor(in.Name))
+		if inSchema := inputSchemas[in.Name]; inSchema != nil {
+			sinks.Constrain(in.Name, inSchema)
+		} else if cfg.schema != nil {
+			sinks.Constrain(in.Name, cfg.schema)
+		}
+		rows, err := pipelineInput(ctx, in, inStages, sinks, readOpts, inOpts, depth)
+		if err != nil {
+			// The report tells what failed the run, so it is written anyway.
+			if cfg.violations.failed() {
+				if err := cfg.violations.write(policy); err != nil {
+					logger.Warn("⚠️  Failed to write the violations report", "error", err)
+				}
+			}
+			return overwriteHint(fmt.Errorf("%s: %w", in.Name, err))
+		}
+		logger.Info("📦  Processed input", "input", in.Name, "rows", rows)
+	}
+	if err := commitSinks(ctx, sinks); err != nil {
+		return overwriteHint(err)
+	}
+	logRoutes(sinks)
+	if err := cfg.violations.write(policy); err != nil {
+		return overwriteHint(err)
+	}
+	if len(cfg.violations.list) > 0 || cfg.Validation.Report != "" {
+		logger.Info("🚦  Validated rows", "errors", cfg.violations.errors, "warnings", cfg.violations.warnings, "report", cfg.Validation.Report)
+	}
+	for _, s := range stages {
+		switch s := s.(type) {
+		case *cleanStage:
+			logger.Info("🧹  Cleaned cells", "cells", s.report.cells)
+		case *maxLengthStage:
+			if s.truncated > 0 {
+				logger.Info("✂️  Truncated cells", "column", s.name, "cells", s.truncated, "report", cfg.Validation.Report)
+			}
+		case *enrichStage:
+			logger.Info("🔗  Enriched rows", "key", s.Key, "matched", s.matched, "unmatched", s.missed)
+		case *geoStage:
+			logger.Info("🗺️  Checked coordinates", "valid", s.valid, "invalid", s.invalid)
+		case *unitStage:
+			logger.Info("📏  Converted units", "column", s.Column, "from", s.From, "to", s.To, "cells", s.converted, "invalid", s.invalid)
+		case *normalizeStage:
+			logger.Info("📇  Normalized contact data", "column", s.Column, "format", s.Format, "changed", s.changed, "invalid", s.invalid)
+		}
+	}
+	if err := finishMaps(stages, policy); err != nil {
+		return overwriteHint(err)
+	}
+	logger.Info("✅ Pipeline done", "inputs", len(inputs), "sinks", len(sinks))
+	return nil
+}
+
+// pipelineInput runs one input through the stages into a new table of sink,
+// reading up to depth batches ahead of it.
+func pipelineInput(ctx context.Context, in connector.Input, stages []stage, sink connector.Sink, opts csvio.Options, csvOpts columnar.CSVOptions, depth int) (rows int64, err error) {
+	ctx, span := tracing.Start(ctx, "input", attribute.String("csvtools.input", in.Name))
+	defer func() {
+		span.SetAttributes(attribute.Int64("csvtools.rows", rows))
+		tracing.End(span, err)
+	}()
+	rc, err := in.Open(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	for _, s := range stages {
+		if s, ok := s.(inputStage); ok {
+			s.begin(in)
+		}
+	}
+	names := []string{"parse"}
+	for i, s := range stages {
+		names = append(names, fmt.Sprintf("transform %d %s", i+1, stageName(s)))
+	}
+	phases := tracing.NewPhases(ctx, append(names, "write")...)
+	defer phases.Finish()
+	csvOpts.Types = stageTypes(csvOpts.Types, stages)
+	reader, err := columnar.FromCSV(&stagedReader{src: csvio.NewReader(limiter.Reader(rc), opts), stages: stages, phases: phases}, csvOpts)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	w, err := sink.Table(in.Name, reader.Schema())
+	if err != nil {
+		return 0, err
+	}
+	w = &timedWriter{Writer: w, phases: phases, phase: len(names)}
+	rows, queue, err := columnar.CopyQueued(w, reader, depth)
+	span.SetAttributes(
+		attribute.Int("csvtools.queue.max_depth", queue.MaxDepth),
+		attribute.Int64("csvtools.queue.stalls", queue.Stalls),
+		attribute.Int64("csvtools.queue.stalled_ms", queue.Stalled.Milliseconds()),
+	)
+	if queue.Stalls > 0 {
+		logger.Info("🐢  Sinks held back reading", "input", in.Name, "batches", queue.Batches,
+			"stalls", queue.Stalls, "stalled", queue.Stalled.Round(time.Millisecond), "max_queue", queue.MaxDepth)
+	}
+	if err != nil {
+		return rows, err
+	}
+	return rows, w.Close()
+}
+
+// listInputs lists the inputs of source in a span.
+func listInputs(ctx context.Context, source connector.Source) ([]connector.Input, error) {
+	ctx, span := tracing.Start(ctx, "discover")
+	inputs, err := source.Inputs(ctx)
+	span.SetAttributes(attribute.Int("csvtools.inputs", len(inputs)))
+	tracing.End(span, err)
+	return inputs, err
+}
+
+// commitSinks commits the sinks in a span.
+func commitSinks(ctx context.Context, sinks connector.Fanout) error {
+	_, span := tracing.Start(ctx, "commit", attribute.Int("csvtools.sinks", len(sinks)))
+	err := sinks.Commit()
+	tracing.End(span, err)
+	return err
+}
+
+// timedWriter adds the time spent writing to a phase.
+type timedWriter struct {
+	columnar.Writer
+	phases *tracing.Phases
+	phase  int
+}
+
+func (w *timedWriter) Write(batch arrow.RecordBatch) error {
+	start := w.phases.Now()
+	defer w.phases.Add(w.phase, start)
+	return w.Writer.Write(batch)
+}
+
+// stageTypes returns types plus the types of the columns stages add or
+// rewrite that mustn't be inferred or keep a schema's type: fingerprints are
+// text even when all digits, and so are the labels codes are mapped to;
+// typed columns converted to other units become floats, and geohashes and
+// normalized phone numbers, IBANs and emails are text.
+func stageTypes(types map[string]arrow.DataType, stages []stage) map[string]arrow.DataType {
+	set := func(column string, t arrow.DataType) {
+		types = maps.Clone(types)
+		if types == nil {
+			types = make(map[string]arrow.DataType)
+		}
+		types[column] = t
+	}
+	for _, s := range stages {
+		switch s := s.(type) {
+		case *hashStage:
+			set(cmp.Or(s.Column, rowhash.Column), arrow.BinaryTypes.String)
+		case *mapStage:
+			set(s.Column, arrow.BinaryTypes.String)
+		case *geoStage:
+			if s.Geohash != "" {
+				set(s.Geohash, arrow.BinaryTypes.String)
+			}
+		case *normalizeStage:
+			set(s.Column, arrow.BinaryTypes.String)
+		case *unitStage:
+			if _, typed := types[s.outputColumn()]; typed {
+				set(s.outputColumn(), arrow.PrimitiveTypes.Float64)
+			}
+		}
+	}
+	return types
+}
+
+// stageName names a stage in traces.
+func stageName(s stage) string {
+	switch s.(type) {
+	case *cleanStage:
+		return "clean"
+	case *filterStage:
+		return "filter"
+	case *deriveStage:
+		return "derive"
+	case *validateStage:
+		return "validate"
+	case *maxLengthStage:
+		return "max_length"
+	case *enrichStage:
+		return "enrich"
+	case *lineageStage:
+		return "lineage"
+	case *hashStage:
+		return "hash"
+	case *mapStage:
+		return "map"
+	case *unitStage:
+		return "units"
+	case *geoStage:
+		return "geo"
+	case *normalizeStage:
+		return "normalize"
+	case *orderStage:
+		return "order"
+	case *schemaStage:
+		return "schema"
+	case *violationLog:
+		return "violations"
+	}
+	return "stage"
+}
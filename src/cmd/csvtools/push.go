@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"csvtools/src/internal/oci"
+)
+
+// annotations is a repeatable key=value flag.
+type annotations map[string]string
+
+func (a annotations) String() string {
+	pairs := make([]string, 0, len(a))
+	for k, v := range a {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (a annotations) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("want key=value, got %q", s)
+	}
+	a[key] = value
+	return nil
+}
+
+// runPush pushes output files, such as workbooks, databases and the bundles
+// of to_sqlite -artifact, to an OCI registry as an ORAS artifact with a
+// layer per file. Directories stand for the regular files in them.
+func runPush(args []string) error {
+	fs := newFlagSet("push")
+	to := fs.String("to", "", "artifact to push, registry/repository:tag, e.g. registry.example.com/data/orders:2024-06")
+	source := fs.String("source", "", "URL of the data's source, for the "+oci.AnnotationSource+" annotation")
+	extra := annotations{}
+	fs.Var(extra, "annotation", "manifest annotation key=value (repeatable)")
+	var client oci.Client
+	fs.BoolVar(&client.PlainHTTP, "plain-http", false, "talk to the registry over HTTP, e.g. a local one")
+	fs.StringVar(&client.Username, "registry-user", "", "registry username (default the docker login of the registry)")
+	fs.StringVar(&client.Password, "registry-password", "", "registry password or token (prefer $CSVTOOLS_REGISTRY_PASSWORD)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *to == "" {
+		return fmt.Errorf("-to is required")
+	}
+	ref, err := oci.ParseReference(*to)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("expected files to push")
+	}
+	files, err := pushFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	manifest := map[string]string{
+		oci.AnnotationCreated: time.Now().UTC().Format(time.RFC3339),
+		oci.AnnotationRunID:   run.RunID,
+	}
+	if *source != "" {
+		manifest[oci.AnnotationSource] = *source
+	}
+	for k, v := range extra {
+		manifest[k] = v
+	}
+	digest, err := client.Push(runCtx, ref, files, manifest)
+	if err != nil {
+		return err
+	}
+	logger.Info("📤  Pushed artifact", "ref", ref.String(), "files", len(files), "digest", digest)
+	fmt.Println(ref.Registry + "/" + ref.Repository + "@" + digest)
+	return nil
+}
+
+// pushFiles lists the files to push, those of directories included, and
+// checks that their names, which title the layers, are unique.
+func pushFiles(names []string) ([]string, error) {
+	var files []string
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, name)
+			continue
+		}
+		entries, err := os.ReadDir(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory %s: %w", name, err)
+		}
+		for _, e := range entries {
+			if e.Type().IsRegular() {
+				files = append(files, filepath.Join(name, e.Name()))
+			}
+		}
+	}
+	titles := make(map[string]string)
+	for _, f := range files {
+		title := filepath.Base(f)
+		if other, ok := titles[title]; ok {
+			return nil, fmt.Errorf("%s and %s would both be pulled as %s", other, f, title)
+		}
+		titles[title] = f
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files to push")
+	}
+	return files, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"csvtools/src/internal/headers"
+)
+
+// runRenameHeaders rewrites the header row with the normalizations, rename
+// map and blank/repeated name policy used by the converters, copying the data
+// rows unchanged.
+func runRenameHeaders(args []string) error {
+	fs := newFlagSet("rename-headers")
+	var d dialect
+	d.register(fs)
+	var hf headers.Flags
+	hf.Register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	name, err := inputArg(fs)
+	if err != nil {
+		return err
+	}
+	normalizer, err := hf.Normalizer()
+	if err != nil {
+		return err
+	}
+
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	reader, err := d.reader(in, name)
+	if err != nil {
+		return err
+	}
+	out, err := d.create()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	writer, err := d.writer(out)
+	if err != nil {
+		return err
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header from %s: %w", name, err)
+	}
+	header, err = hf.Policy().Fix(normalizer.Apply(header))
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
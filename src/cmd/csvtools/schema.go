@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"csvtools/src/internal/columnar"
+	"csvtools/src/internal/sqlitedb"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// inferredTable is the schema inferred for one input.
+type inferredTable struct {
+	Input   string           `json:"input"`
+	Table   string           `json:"table"`
+	Rows    int              `json:"rows"`
+	Columns []inferredColumn `json:"columns"`
+}
+
+// inferredColumn is a column of an inferredTable. Type is a Table Schema
+// type: string, integer, number or boolean. A column is nullable if a row
+// leaves it empty or has no cell for it.
+type inferredColumn struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Nullable bool     `json:"nullable"`
+	Examples []string `json:"examples"`
+
+	inference columnar.Inference
+}
+
+// runSchema prints the schema inferred for every input, with the types
+// convert and pipeline would give its columns, as text, JSON, SQLite DDL or
+// Go structs. Directories stand for the .csv files in them. "schema diff"
+// compares two versions of a schema instead.
+func runSchema(args []string) error {
+	if len(args) > 0 && args[0] == "diff" {
+		return runSchemaDiff(args[1:])
+	}
+	fs := newFlagSet("schema")
+	var d dialect
+	d.register(fs)
+	format := fs.String("format", "text", "output format: text, json, sql or go")
+	examples := fs.Int("examples", 3, "distinct example values to show per column")
+	sample := fs.Int("sample", 0, "infer from the first N rows of every input (0 for all)")
+	pkg := fs.String("package", "main", "package clause of -format go")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	switch *format {
+	case "text", "json", "sql", "go":
+	default:
+		return fmt.Errorf("-format must be text, json, sql or go, got %q", *format)
+	}
+	if *examples < 0 || *sample < 0 {
+		return fmt.Errorf("-examples and -sample must not be negative")
+	}
+	inputs, err := expandInputs(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	d.reuseRecord = true
+	tables := make([]*inferredTable, 0, len(inputs))
+	for _, name := range inputs {
+		table, err := inferTable(&d, name, *examples, *sample)
+		if err != nil {
+			return err
+		}
+		logger.Info("🔬  Inferred schema", "input", name, "columns", len(table.Columns), "rows", table.Rows)
+		tables = append(tables, table)
+	}
+
+	out, err := d.create()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(tables)
+	case "sql":
+		err = writeSchemaSQL(out, tables)
+	case "go":
+		err = writeGo(out, tables, goOptions{pkg: *pkg, tags: []string{"csv", "json"}, nulls: "pointer", generator: "csvtools schema"})
+	default:
+		err = writeSchemaText(out, tables)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// inferTable reads the input called name, up to sample rows unless 0, and
+// infers the type of its columns as columnar.Infer does.
+func inferTable(d *dialect, name string, examples, sample int) (*inferredTable, error) {
+	in, err := openInput(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	reader, err := d.reader(in, name)
+	if err != nil {
+		return nil, err
+	}
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s: no header row", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header from %s: %w", name, err)
+	}
+	table := &inferredTable{Input: name, Table: tableName(name), Columns: make([]inferredColumn, len(header))}
+	for i, column := range header {
+		table.Columns[i] = inferredColumn{Name: column, Examples: []string{}}
+	}
+	for sample == 0 || table.Rows < sample {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		table.Rows++
+		for i := range table.Columns {
+			c := &table.Columns[i]
+			cell := field(record, i)
+			if cell == "" {
+				c.Nullable = true
+				continue
+			}
+			c.inference.Add(cell)
+			if len(c.Examples) < examples && !slices.Contains(c.Examples, cell) {
+				c.Examples = append(c.Examples, cell)
+			}
+		}
+	}
+	for i := range table.Columns {
+		table.Columns[i].Type = schemaType(table.Columns[i].inference.Type())
+	}
+	return table, nil
+}
+
+// tableName names the table of an input after its file, as to_sqlite does.
+func tableName(name string) string {
+	if name == "-" {
+		return "stdin"
+	}
+	base := filepath.Base(name)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func schemaType(t arrow.DataType) string {
+	switch t.ID() {
+	case arrow.BOOL:
+		return "boolean"
+	case arrow.INT64:
+		return "integer"
+	case arrow.FLOAT64:
+		return "number"
+	}
+	return "string"
+}
+
+func writeSchemaText(w io.Writer, tables []*inferredTable) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for i, t := range tables {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "%s (%s, %d rows)\n", t.Table, t.Input, t.Rows)
+		for _, c := range t.Columns {
+			null := "not null"
+			if c.Nullable {
+				null = "nullable"
+			}
+			quoted := make([]string, len(c.Examples))
+			for i, e := range c.Examples {
+				quoted[i] = strconv.Quote(e)
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", c.Name, c.Type, null, strings.Join(quoted, ", "))
+		}
+	}
+	return tw.Flush()
+}
+
+// writeSchemaSQL writes a CREATE TABLE statement per table, with the column
+// types the sqlite:// sink gives them.
+func writeSchemaSQL(w io.Writer, tables []*inferredTable) error {
+	for i, t := range tables {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		name := t.Table
+		if sqlitedb.Reserved(name) {
+			name = "_" + name
+		}
+		columns := make([]string, len(t.Columns))
+		for i, c := range t.Columns {
+			columns[i] = "  " + sqlitedb.Quote(c.Name) + " " + sqliteType(c.Type)
+			if !c.Nullable {
+				columns[i] += " NOT NULL"
+			}
+		}
+		if _, err := fmt.Fprintf(w, "CREATE TABLE %s (\n%s\n);\n", sqlitedb.Quote(name), strings.Join(columns, ",\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sqliteType(typ string) string {
+	switch typ {
+	case "integer", "boolean":
+		return "INTEGER"
+	case "number":
+		return "REAL"
+	}
+	return "TEXT"
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// schemaColumn is a column as schema diff compares it: its name, inferred
+// or declared type and whether it may be empty.
+type schemaColumn struct {
+	Name     string
+	Type     string
+	Nullable bool
+}
+
+// columnChange is a difference between two versions of a schema. Breaking
+// changes are those that make rows of the new version fail to load where
+// the old one loaded: removed or renamed columns, types the new values
+// don't fit in and columns becoming nullable.
+type columnChange struct {
+	Column   string `json:"column"`
+	Change   string `json:"change"`
+	Old      string `json:"old,omitempty"`
+	New      string `json:"new,omitempty"`
+	Breaking bool   `json:"breaking"`
+}
+
+// runSchemaDiff compares the columns of two versions of a feed, each a CSV
+// file whose schema is inferred or a stored schema, and reports added,
+// removed, renamed, retyped, moved and newly nullable columns. It fails on
+// breaking changes unless -fail-on says otherwise.
+func runSchemaDiff(args []string) error {
+	fs := newFlagSet("schema diff")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: csvtools schema diff [flags] old new")
+		fmt.Fprintln(fs.Output(), "old and new are CSV files, table schemas, CSVW metadata or the output of schema -format json.")
+		fs.PrintDefaults()
+	}
+	var d dialect
+	d.register(fs)
+	format := fs.String("format", "text", "output format: text, csv or json")
+	sample := fs.Int("sample", 0, "infer from the first N rows of CSV files (0 for all)")
+	failOn := fs.String("fail-on", "breaking", "fail on breaking changes, any change or never")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	switch *format {
+	case "text", "csv", "json":
+	default:
+		return fmt.Errorf("-format must be text, csv or json, got %q", *format)
+	}
+	switch *failOn {
+	case "breaking", "any", "never":
+	default:
+		return fmt.Errorf("-fail-on must be breaking, any or never, got %q", *failOn)
+	}
+	if *sample < 0 {
+		return fmt.Errorf("-sample must not be negative")
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("expected the old and the new version, got %d arguments", fs.NArg())
+	}
+	d.reuseRecord = true
+	oldColumns, err := loadSchemaColumns(&d, fs.Arg(0), *sample)
+	if err != nil {
+		return err
+	}
+	newColumns, err := loadSchemaColumns(&d, fs.Arg(1), *sample)
+	if err != nil {
+		return err
+	}
+	changes := diffColumns(oldColumns, newColumns)
+
+	out, err := d.create()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(changes)
+	case "csv":
+		err = writeChangesCSV(out, changes)
+	default:
+		err = writeChangesText(out, fs.Arg(0), fs.Arg(1), changes)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	breaking := 0
+	for _, c := range changes {
+		if c.Breaking {
+			breaking++
+		}
+	}
+	logger.Info("🧬  Compared schemas", "old", fs.Arg(0), "new", fs.Arg(1), "changes", len(changes), "breaking", breaking)
+	switch {
+	case *failOn == "breaking" && breaking > 0:
+		return fmt.Errorf("%d breaking schema changes", breaking)
+	case *failOn == "any" && len(changes) > 0:
+		return fmt.Errorf("%d schema changes", len(changes))
+	}
+	return nil
+}
+
+// loadSchemaColumns returns the columns of name: those declared by a .json
+// table schema, CSVW metadata or schema -format json output, else those
+// inferred from the CSV file.
+func loadSchemaColumns(d *dialect, name string, sample int) ([]schemaColumn, error) {
+	if !strings.EqualFold(filepath.Ext(name), ".json") {
+		table, err := inferTable(d, name, 0, sample)
+		if err != nil {
+			return nil, err
+		}
+		return inferredColumns(table), nil
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema %s: %w", name, err)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var tables []*inferredTable
+		if err := json.Unmarshal(data, &tables); err != nil {
+			return nil, fmt.Errorf("invalid schema %s: %w", name, err)
+		}
+		if len(tables) != 1 {
+			return nil, fmt.Errorf("%s describes %d tables, want one", name, len(tables))
+		}
+		return inferredColumns(tables[0]), nil
+	}
+	schema, err := readSchema(name)
+	if err != nil {
+		return nil, err
+	}
+	types := schema.Types()
+	columns := make([]schemaColumn, len(schema.Fields))
+	for i, f := range schema.Fields {
+		columns[i] = schemaColumn{Name: f.Name, Type: schemaType(types[f.Name]), Nullable: f.Constraints == nil || !f.Constraints.Required}
+	}
+	return columns, nil
+}
+
+func inferredColumns(table *inferredTable) []schemaColumn {
+	columns := make([]schemaColumn, len(table.Columns))
+	for i, c := range table.Columns {
+		columns[i] = schemaColumn{Name: c.Name, Type: c.Type, Nullable: c.Nullable}
+	}
+	return columns
+}
+
+// diffColumns lists the changes from the old columns to the new ones: for
+// each old column in order, its removal, renaming, retyping or move, then
+// the added columns. A removed and an added column whose names only differ
+// in case, spaces or underscores count as renamed.
+func diffColumns(oldColumns, newColumns []schemaColumn) []columnChange {
+	oldIndex, newIndex := columnIndex(oldColumns), columnIndex(newColumns)
+	// Columns moved relative to the columns both versions have; columns
+	// added or removed in between don't count.
+	var oldOrder, newOrder []string
+	for _, c := range oldColumns {
+		if _, ok := newIndex[c.Name]; ok {
+			oldOrder = append(oldOrder, c.Name)
+		}
+	}
+	for _, c := range newColumns {
+		if _, ok := oldIndex[c.Name]; ok {
+			newOrder = append(newOrder, c.Name)
+		}
+	}
+	renamed := make(map[string]string)
+	for _, o := range oldColumns {
+		if _, ok := newIndex[o.Name]; ok {
+			continue
+		}
+		for _, n := range newColumns {
+			if _, ok := oldIndex[n.Name]; !ok && renamed[n.Name] == "" && looseName(n.Name) == looseName(o.Name) {
+				renamed[n.Name], renamed[o.Name] = o.Name, n.Name
+				break
+			}
+		}
+	}
+
+	changes := []columnChange{}
+	for _, o := range oldColumns {
+		name := o.Name
+		if to, ok := renamed[o.Name]; ok {
+			changes = append(changes, columnChange{Column: o.Name, Change: "renamed", Old: o.Name, New: to, Breaking: true})
+			name = to
+		}
+		j, ok := newIndex[name]
+		if !ok {
+			changes = append(changes, columnChange{Column: o.Name, Change: "removed", Old: o.Type, Breaking: true})
+			continue
+		}
+		n := newColumns[j]
+		if n.Type != o.Type {
+			changes = append(changes, columnChange{Column: n.Name, Change: "retyped", Old: o.Type, New: n.Type, Breaking: !fitsType(n.Type, o.Type)})
+		}
+		if n.Nullable != o.Nullable {
+			changes = append(changes, columnChange{Column: n.Name, Change: "nullable", Old: nullability(o.Nullable), New: nullability(n.Nullable), Breaking: n.Nullable})
+		}
+		if name == o.Name {
+			if from, to := indexOf(oldOrder, name), indexOf(newOrder, name); from != to {
+				changes = append(changes, columnChange{Column: n.Name, Change: "moved", Old: fmt.Sprint(oldIndex[name] + 1), New: fmt.Sprint(j + 1)})
+			}
+		}
+	}
+	for _, n := range newColumns {
+		if _, ok := oldIndex[n.Name]; !ok && renamed[n.Name] == "" {
+			changes = append(changes, columnChange{Column: n.Name, Change: "added", New: n.Type})
+		}
+	}
+	return changes
+}
+
+func columnIndex(columns []schemaColumn) map[string]int {
+	index := make(map[string]int, len(columns))
+	for i, c := range columns {
+		if _, ok := index[c.Name]; !ok {
+			index[c.Name] = i
+		}
+	}
+	return index
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// looseName is name in lower case without spaces, underscores or dashes.
+func looseName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '_' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(name)))
+}
+
+// fitsType reports whether values of type typ load into a column of type
+// column: any into strings and integers into numbers.
+func fitsType(typ, column string) bool {
+	return typ == column || column == "string" || typ == "integer" && column == "number"
+}
+
+func nullability(nullable bool) string {
+	if nullable {
+		return "nullable"
+	}
+	return "not null"
+}
+
+func writeChangesText(w io.Writer, oldName, newName string, changes []columnChange) error {
+	breaking := 0
+	for _, c := range changes {
+		if c.Breaking {
+			breaking++
+		}
+	}
+	if len(changes) == 0 {
+		_, err := fmt.Fprintf(w, "%s -> %s: no changes\n", oldName, newName)
+		return err
+	}
+	fmt.Fprintf(w, "%s -> %s: %d changes, %d breaking\n", oldName, newName, len(changes), breaking)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range changes {
+		what := c.Old + " -> " + c.New
+		switch c.Change {
+		case "added":
+			what = c.New
+		case "removed":
+			what = c.Old
+		case "moved":
+			what = "position " + what
+		}
+		mark := ""
+		if c.Breaking {
+			mark = "breaking"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", c.Change, c.Column, what, mark)
+	}
+	return tw.Flush()
+}
+
+func writeChangesCSV(w io.Writer, changes []columnChange) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"column", "change", "old", "new", "breaking"})
+	for _, c := range changes {
+		_ = cw.Write([]string{c.Column, c.Change, c.Old, c.New, fmt.Sprint(c.Breaking)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+
+	"csvtools/src/internal/csvio"
+)
+
+// runTranspose swaps rows and columns: input column j becomes output row j.
+// Inputs up to -max-cells are transposed in memory; larger ones are spilled
+// to a temporary file and transposed in several passes over it, each pass
+// holding at most -max-cells cells.
+func runTranspose(args []string) error {
+	fs := newFlagSet("transpose")
+	var d dialect
+	d.register(fs)
+	maxCells := fs.Int("max-cells", 10_000_000, "cells held in memory before spilling to a temp file")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	name, err := inputArg(fs)
+	if err != nil {
+		return err
+	}
+	if *maxCells < 1 {
+		return fmt.Errorf("-max-cells must be positive")
+	}
+
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	reader, err := d.reader(in, name)
+	if err != nil {
+		return err
+	}
+	out, err := d.create()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	writer, err := d.writer(out)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]string
+	cells, width := 0, 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		rows = append(rows, record)
+		cells += len(record)
+		width = max(width, len(record))
+		if cells > *maxCells {
+			return transposeSpilled(reader, writer, rows, width, *maxCells)
+		}
+	}
+	if err := writeColumns(writer, rows, 0, width); err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeColumns writes columns [from, to) of rows as output rows, padding
+// short input rows with empty cells.
+func writeColumns(writer *csvio.Writer, rows [][]string, from, to int) error {
+	out := make([]string, len(rows))
+	for j := from; j < to; j++ {
+		for i, row := range rows {
+			out[i] = ""
+			if j < len(row) {
+				out[i] = row[j]
+			}
+		}
+		if err := writer.Write(out); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	return nil
+}
+
+// transposeSpilled copies the rows read so far and the rest of reader into a
+// temporary CSV file in the run's temp directory, then reads it once per
+// batch of columns.
+func transposeSpilled(reader csvio.Reader, writer *csvio.Writer, head [][]string, width, maxCells int) error {
+	tmp, err := os.CreateTemp("", "csvtools-transpose-*.csv")
+	if err != nil {
+		return fmt.Errorf("failed to create spill file: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	spill := csv.NewWriter(tmp)
+	if err := spill.WriteAll(head); err != nil {
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+	rowCount := len(head)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		if err := spill.Write(record); err != nil {
+			return fmt.Errorf("failed to write spill file: %w", err)
+		}
+		rowCount++
+		width = max(width, len(record))
+	}
+	spill.Flush()
+	if err := spill.Error(); err != nil {
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+
+	batch := max(maxCells/max(rowCount, 1), 1)
+	for from := 0; from < width; from += batch {
+		to := min(from+batch, width)
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind spill file: %w", err)
+		}
+		spillReader := csv.NewReader(tmp)
+		spillReader.FieldsPerRecord = -1
+		rows := make([][]string, 0, rowCount)
+		for {
+			record, err := spillReader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read spill file: %w", err)
+			}
+			if len(record) > to {
+				record = record[:to]
+			}
+			if len(record) > from {
+				record = record[from:]
+			} else {
+				record = nil
+			}
+			rows = append(rows, record)
+		}
+		if err := writeColumns(writer, rows, 0, to-from); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"csvtools/src/internal/csvio"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// tuiMode is what keys do in the TUI.
+type tuiMode int
+
+const (
+	browsing tuiMode = iota
+	prompting
+	pickingColumns
+)
+
+// tuiFile is a file the TUI browses, with what the user chose for it.
+type tuiFile struct {
+	name   string
+	hidden map[int]bool
+	filter *regexp.Regexp
+}
+
+// tui is the state of a TUI session, a Bubble Tea model.
+type tui struct {
+	d        dialect
+	files    []*tuiFile
+	selected int
+	// tableFocus is set while keys scroll the table rather than the files.
+	tableFocus bool
+	limit      int
+	maxWidth   int
+	// width and height are the size of the terminal, 0 until told.
+	width, height int
+
+	// The preview of the selected file: its header and first rows.
+	header []string
+	rows   [][]string
+	more   bool
+	// top is the first row shown and left the first column of characters.
+	top, left int
+
+	mode tuiMode
+	// label and input are the prompt being edited, submitted to onEnter.
+	label   string
+	input   []rune
+	onEnter func(string) tea.Cmd
+	// cursor is the column selected while picking columns.
+	cursor int
+	status string
+}
+
+// convertedMsg is the outcome of a conversion running in the background.
+type convertedMsg string
+
+// runTUI browses CSV files in the terminal: it lists the inputs, previews
+// the rows of the selected one, hides columns, filters rows and converts
+// what is shown with csvtools convert. Bubble Tea drives the terminal, the
+// Windows console included.
+func runTUI(args []string) error {
+	fs := newFlagSet("tui")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: csvtools tui [flags] [file|dir ...]")
+		fs.PrintDefaults()
+	}
+	t := &tui{}
+	t.d.register(fs)
+	fs.IntVar(&t.limit, "n", 1000, "rows of a file to load for the preview, 0 for all")
+	fs.IntVar(&t.maxWidth, "max-width", 40, "truncate cells wider than this many characters, 0 for no limit")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if t.limit < 0 || t.maxWidth < 0 || t.maxWidth == 1 {
+		return fmt.Errorf("-n must not be negative and -max-width must be 0 or at least 2")
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	if slices.Contains(args, "-") {
+		return fmt.Errorf("the TUI reads keys from stdin, give files or directories")
+	}
+	names, err := expandInputs(args)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no CSV files found in %s", strings.Join(args, " "))
+	}
+	for _, name := range names {
+		t.files = append(t.files, &tuiFile{name: name, hidden: make(map[int]bool)})
+	}
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return fmt.Errorf("the TUI needs a terminal")
+	}
+	// Log lines would scribble over the screen.
+	defer func(saved *slog.Logger) {
+		logger = saved
+	}(logger)
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.load()
+	if _, err := tea.NewProgram(t, tea.WithAltScreen()).Run(); err != nil {
+		return fmt.Errorf("failed to run the TUI: %w", err)
+	}
+	return nil
+}
+
+func (t *tui) Init() tea.Cmd {
+	return nil
+}
+
+// Update handles keys, resizes and finished conversions.
+func (t *tui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		t.width, t.height = msg.Width, msg.Height
+	case convertedMsg:
+		t.status = string(msg)
+	case tea.KeyMsg:
+		return t, t.key(msg)
+	}
+	return t, nil
+}
+
+func (t *tui) key(msg tea.KeyMsg) tea.Cmd {
+	t.status = ""
+	if msg.Type == tea.KeyCtrlC {
+		return tea.Quit
+	}
+	switch t.mode {
+	case prompting:
+		return t.promptKey(msg)
+	case pickingColumns:
+		t.columnKey(msg.String())
+		return nil
+	default:
+		return t.browseKey(msg.String())
+	}
+}
+
+func (t *tui) browseKey(key string) tea.Cmd {
+	_, height := t.size()
+	page := max(height-4, 1)
+	file := t.files[t.selected]
+	switch key {
+	case "q":
+		return tea.Quit
+	case "tab", "enter":
+		t.tableFocus = !t.tableFocus
+	case "up", "k":
+		t.move(-1)
+	case "down", "j":
+		t.move(1)
+	case "pgup":
+		t.move(-page)
+	case "pgdown":
+		t.move(page)
+	case "home", "g":
+		t.move(-len(t.rows) - len(t.files))
+	case "end", "G":
+		t.move(len(t.rows) + len(t.files))
+	case "left", "h":
+		t.left = max(t.left-8, 0)
+	case "right", "l":
+		t.left += 8
+	case "/":
+		current := ""
+		if file.filter != nil {
+			current = file.filter.String()
+		}
+		t.ask("filter rows (regexp, empty for all): ", current, func(s string) tea.Cmd {
+			if s == "" {
+				file.filter = nil
+				t.load()
+				return nil
+			}
+			re, err := regexp.Compile(s)
+			if err != nil {
+				t.status = "invalid filter: " + err.Error()
+				return nil
+			}
+			file.filter = re
+			t.load()
+			return nil
+		})
+	case "c":
+		if len(t.header) > 0 {
+			t.mode, t.cursor = pickingColumns, 0
+		}
+	case "x":
+		base := strings.TrimSuffix(filepath.Base(file.name), filepath.Ext(file.name))
+		t.ask("convert to (target, then convert flags): ", base+".xlsx", func(s string) tea.Cmd {
+			fields := strings.Fields(s)
+			if len(fields) == 0 {
+				return nil
+			}
+			t.status = "converting " + file.name + " to " + fields[0] + "..."
+			d, hidden, filter := t.d, maps.Clone(file.hidden), file.filter
+			return func() tea.Msg {
+				return convertedMsg(convertView(d, file.name, hidden, filter, fields[0], fields[1:]))
+			}
+		})
+	}
+	return nil
+}
+
+// move moves the selected file, or the table's rows with the table focused,
+// by delta.
+func (t *tui) move(delta int) {
+	if t.tableFocus {
+		t.top = max(min(t.top+delta, len(t.rows)-1), 0)
+		return
+	}
+	selected := max(min(t.selected+delta, len(t.files)-1), 0)
+	if selected != t.selected {
+		t.selected = selected
+		t.load()
+	}
+}
+
+// ask prompts for a line of input, starting with value, and calls onEnter
+// with it unless the user cancels with Escape.
+func (t *tui) ask(label, value string, onEnter func(string) tea.Cmd) {
+	t.mode, t.label, t.input, t.onEnter = prompting, label, []rune(value), onEnter
+}
+
+func (t *tui) promptKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type {
+	case tea.KeyEsc:
+		t.mode = browsing
+	case tea.KeyEnter:
+		t.mode = browsing
+		return t.onEnter(strings.TrimSpace(string(t.input)))
+	case tea.KeyBackspace:
+		if len(t.input) > 0 {
+			t.input = t.input[:len(t.input)-1]
+		}
+	case tea.KeySpace:
+		t.input = append(t.input, ' ')
+	case tea.KeyRunes:
+		for _, r := range msg.Runes {
+			if r >= ' ' {
+				t.input = append(t.input, r)
+			}
+		}
+	}
+	return nil
+}
+
+func (t *tui) columnKey(key string) {
+	file := t.files[t.selected]
+	switch key {
+	case "esc", "enter", "c", "q":
+		t.mode = browsing
+	case "up", "k":
+		t.cursor = max(t.cursor-1, 0)
+	case "down", "j":
+		t.cursor = min(t.cursor+1, len(t.header)-1)
+	case " ":
+		file.hidden[t.cursor] = !file.hidden[t.cursor]
+	case "a":
+		clear(file.hidden)
+	}
+}
+
+// load reads the preview of the selected file.
+func (t *tui) load() {
+	file := t.files[t.selected]
+	var keep func([]string) bool
+	if file.filter != nil {
+		keep = func(record []string) bool { return rowMatches(file.filter, record, nil) }
+	}
+	var err error
+	t.top, t.left = 0, 0
+	t.header, t.rows, t.more, err = readView(&t.d, file.name, "", t.limit, keep)
+	if err != nil {
+		t.header, t.rows, t.more = nil, nil, false
+		t.status = err.Error()
+	}
+}
+
+// visible returns the indexes of the columns of the selected file that
+// aren't hidden.
+func (t *tui) visible() []int {
+	file := t.files[t.selected]
+	var idx []int
+	for i := range t.header {
+		if !file.hidden[i] {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// convertView writes the rows of the named input filter keeps, if it isn't
+// nil, without the hidden columns, to a CSV named after it in the temp
+// directory and runs csvtools convert on it to target with flags. It returns
+// a status line.
+func convertView(d dialect, name string, hidden map[int]bool, filter *regexp.Regexp, target string, flags []string) string {
+	dir, err := os.MkdirTemp(tmp.Path, "tui-*")
+	if err != nil {
+		return err.Error()
+	}
+	csvPath := filepath.Join(dir, strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))+".csv")
+	rows, err := exportView(d, name, hidden, filter, csvPath)
+	if err != nil {
+		return "failed to export " + name + ": " + err.Error()
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err.Error()
+	}
+	args := append([]string{"convert", "-from", csvPath, "-to", target}, flags...)
+	output, err := exec.Command(self, args...).CombinedOutput()
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		return "conversion failed: " + lines[len(lines)-1]
+	}
+	return fmt.Sprintf("converted %d rows of %s to %s", rows, name, target)
+}
+
+// exportView copies the rows of the named input filter keeps, without the
+// hidden columns, to a comma separated file at path and returns their
+// number.
+func exportView(d dialect, name string, hidden map[int]bool, filter *regexp.Regexp, path string) (int, error) {
+	in, err := openInput(name)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	reader, err := d.reader(in, name)
+	if err != nil {
+		return 0, err
+	}
+	header, err := reader.Read()
+	if err == io.EOF {
+		return 0, fmt.Errorf("%s is empty", name)
+	}
+	if err != nil {
+		return 0, err
+	}
+	var idx []int
+	for i := range header {
+		if !hidden[i] {
+			idx = append(idx, i)
+		}
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	writer := csvio.NewWriter(out, csvio.WriterOptions{})
+	project := func(record []string) []string {
+		cells := make([]string, len(idx))
+		for i, j := range idx {
+			cells[i] = field(record, j)
+		}
+		return cells
+	}
+	if err := writer.Write(project(header)); err != nil {
+		return 0, err
+	}
+	rows := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rows, err
+		}
+		if filter != nil && !rowMatches(filter, record, nil) {
+			continue
+		}
+		if err := writer.Write(project(record)); err != nil {
+			return rows, err
+		}
+		rows++
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return rows, err
+	}
+	return rows, out.Close()
+}
+
+// size is the size of the terminal, 80x24 if it can't be told.
+func (t *tui) size() (width, height int) {
+	if t.width <= 0 || t.height <= 0 {
+		return 80, 24
+	}
+	return t.width, t.height
+}
+
+// View renders the screen: a title line, the files on the left, the table
+// or the column picker on the right, and a status, prompt or help line.
+func (t *tui) View() string {
+	width, height := t.size()
+	file := t.files[t.selected]
+	listWidth := min(max(width/4, 12), 40)
+	paneWidth := max(width-listWidth-3, 1)
+	bodyHeight := max(height-2, 1)
+
+	title := fmt.Sprintf(" csvtools tui  %s  (%d/%d)", file.name, t.selected+1, len(t.files))
+	if len(t.rows) > 0 {
+		title += fmt.Sprintf("  rows %d-%d of %d", t.top+1, min(t.top+bodyHeight-2, len(t.rows)), len(t.rows))
+		if t.more {
+			title += "+"
+		}
+	}
+	if file.filter != nil {
+		title += "  filter /" + file.filter.String() + "/"
+	}
+	if hidden := len(t.header) - len(t.visible()); hidden > 0 {
+		title += fmt.Sprintf("  %d columns hidden", hidden)
+	}
+	var screen strings.Builder
+	screen.WriteString("\x1b[7m" + clip(title, 0, width) + "\x1b[0m")
+
+	pane := t.tableLines(paneWidth)
+	if t.mode == pickingColumns {
+		pane = t.columnLines(paneWidth, bodyHeight)
+	}
+	// Keep the selected file in view.
+	first := max(t.selected-bodyHeight+1, 0)
+	for row := range bodyHeight {
+		screen.WriteString("\n")
+		name := ""
+		if i := first + row; i < len(t.files) {
+			name = clip(" "+t.files[i].name, 0, listWidth)
+			if i == t.selected {
+				highlight := "\x1b[7m"
+				if t.tableFocus {
+					highlight = "\x1b[1m"
+				}
+				name = highlight + name + "\x1b[0m"
+			}
+		} else {
+			name = strings.Repeat(" ", listWidth)
+		}
+		screen.WriteString(name + " \x1b[2m│\x1b[0m ")
+		if row < len(pane) {
+			screen.WriteString(pane[row])
+		}
+	}
+
+	screen.WriteString("\n")
+	switch {
+	case t.mode == prompting:
+		screen.WriteString(clip(t.label+string(t.input), 0, width-1) + "\x1b[7m \x1b[0m")
+	case t.status != "":
+		screen.WriteString(clip(t.status, 0, width))
+	case t.mode == pickingColumns:
+		screen.WriteString("\x1b[2m" + clip("↑↓ column  space show/hide  a show all  enter done", 0, width) + "\x1b[0m")
+	default:
+		screen.WriteString("\x1b[2m" + clip("↑↓ move  tab files/table  ←→ scroll  / filter  c columns  x convert  q quit", 0, width) + "\x1b[0m")
+	}
+	return screen.String()
+}
+
+// tableLines renders the header, the rule and the rows from top of the
+// visible columns, scrolled left and clipped to width.
+func (t *tui) tableLines(width int) []string {
+	if len(t.header) == 0 {
+		return nil
+	}
+	idx := t.visible()
+	project := func(record []string) []string {
+		cells := make([]string, len(idx))
+		for i, j := range idx {
+			cells[i] = field(record, j)
+		}
+		return cells
+	}
+	rows := make([][]string, len(t.rows))
+	for i, row := range t.rows {
+		rows[i] = project(row)
+	}
+	// The columns are as wide as in all rows, not just those shown, so they
+	// don't shift while scrolling.
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	newViewTable(project(t.header), rows, unicodeStyle, t.maxWidth).write(w)
+	_ = w.Flush()
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) > 2 {
+		lines = append(lines[:2], lines[2+t.top:]...)
+	}
+	for i, line := range lines {
+		lines[i] = clip(line, t.left, width)
+	}
+	if len(lines) > 0 {
+		lines[0] = "\x1b[1m" + lines[0] + "\x1b[0m"
+	}
+	if len(lines) > 1 {
+		lines[1] = "\x1b[2m" + lines[1] + "\x1b[0m"
+	}
+	return lines
+}
+
+// columnLines renders the column picker, keeping the cursor in view.
+func (t *tui) columnLines(width, height int) []string {
+	file := t.files[t.selected]
+	first := max(t.cursor-height+1, 0)
+	var lines []string
+	for i := first; i < len(t.header) && len(lines) < height; i++ {
+		mark := "[x] "
+		if file.hidden[i] {
+			mark = "[ ] "
+		}
+		line := clip(mark+t.header[i], 0, width)
+		if i == t.cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// clip returns the part of s from display column left that is width
+// columns wide, padded with spaces.
+func clip(s string, left, width int) string {
+	var b strings.Builder
+	col, used := 0, 0
+	for _, r := range s {
+		rw := runeWidth(r)
+		switch {
+		case col >= left && used+rw > width:
+			return b.String() + strings.Repeat(" ", width-used)
+		case col >= left:
+			b.WriteRune(r)
+			used += rw
+		case col+rw > left:
+			// A wide character cut in half by the left edge.
+			b.WriteString(strings.Repeat(" ", col+rw-left))
+			used += col + rw - left
+		}
+		col += rw
+	}
+	return b.String() + strings.Repeat(" ", max(width-used, 0))
+}
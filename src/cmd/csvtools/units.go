@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"csvtools/src/internal/units"
+)
+
+// unitStage converts the numbers of a column from one unit to another, e.g.
+// bytes to MB, cents to currency units or Fahrenheit to Celsius, in place
+// or, with As, into a new column right after it. Decimals rounds the
+// results; unset, they are rounded to 6 decimals without trailing zeros.
+// Invalid says what happens to cells that aren't numbers: keep them (the
+// default), empty them, or fail. Empty cells are left alone.
+type unitStage struct {
+	Column   string `yaml:"column"`
+	From     string `yaml:"from"`
+	To       string `yaml:"to"`
+	As       string `yaml:"as"`
+	Decimals *int   `yaml:"decimals"`
+	Invalid  string `yaml:"invalid"`
+
+	conversion *units.Conversion
+	col        int
+	converted  int
+	invalid    int
+}
+
+func (s *unitStage) prepare(header []string) ([]string, error) {
+	if s.Column == "" || s.From == "" || s.To == "" {
+		return nil, fmt.Errorf("units needs a column, from and to")
+	}
+	switch s.Invalid {
+	case "":
+		s.Invalid = "keep"
+	case "keep", "empty", "error":
+	default:
+		return nil, fmt.Errorf("units: unknown invalid %q (want keep, empty or error)", s.Invalid)
+	}
+	var err error
+	if s.conversion, err = units.New(s.From, s.To); err != nil {
+		return nil, fmt.Errorf("units: %w", err)
+	}
+	if s.Decimals != nil {
+		s.conversion.Decimals = *s.Decimals
+	}
+	if s.col, err = resolveColumn(header, s.Column); err != nil {
+		return nil, fmt.Errorf("units: %w", err)
+	}
+	if s.As == "" {
+		return header, nil
+	}
+	if _, err := resolveColumn(header, s.As); err == nil {
+		return nil, fmt.Errorf("units: column %s already exists", s.As)
+	}
+	return slices.Insert(slices.Clip(header), s.col+1, s.As), nil
+}
+
+func (s *unitStage) apply(record []string, line int) ([]string, bool, error) {
+	for len(record) <= s.col {
+		record = append(record, "")
+	}
+	out := s.col
+	if s.As != "" {
+		out++
+		record = slices.Insert(record, out, record[s.col])
+	}
+	if record[out] == "" {
+		return record, true, nil
+	}
+	value, ok := s.conversion.Cell(record[out])
+	if ok {
+		record[out] = value
+		s.converted++
+		return record, true, nil
+	}
+	s.invalid++
+	switch s.Invalid {
+	case "error":
+		return nil, false, fmt.Errorf("line %d: %s is not a number: %q", line, s.Column, record[out])
+	case "empty":
+		record[out] = ""
+	}
+	return record, true, nil
+}
+
+// outputColumn is the column the stage writes to.
+func (s *unitStage) outputColumn() string {
+	if s.As != "" {
+		return s.As
+	}
+	return s.Column
+}
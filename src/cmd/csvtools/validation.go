@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/connector"
+	"csvtools/src/internal/csvio"
+	"csvtools/src/internal/tableschema"
+)
+
+// validationConfig is the validation section of a pipeline file. Violations
+// of error rules beyond MaxErrors, or of warning rules beyond MaxWarnings,
+// fail the run; without MaxWarnings warnings never do.
+type validationConfig struct {
+	Report      string `yaml:"report"`
+	MaxErrors   int    `yaml:"max_errors"`
+	MaxWarnings *int   `yaml:"max_warnings"`
+}
+
+// violation is a cell that broke a validation rule.
+type violation struct {
+	Input    string `json:"input"`
+	Line     int    `json:"line"`
+	Column   string `json:"column"`
+	Value    string `json:"value"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// violationLog collects the violations of a run. It runs as the last stage,
+// which sees only the rows every stage kept, to find where the violations
+// of a row end up in the output and note them for the sinks.
+type violationLog struct {
+	cfg      validationConfig
+	list     []violation
+	errors   int
+	warnings int
+
+	notes   map[string]*connector.Notes
+	current *connector.Notes
+	input   string
+	header  []string
+	rows    int64
+	pending int // index into list of the first violation not yet placed
+}
+
+func newViolationLog(cfg validationConfig) *violationLog {
+	return &violationLog{cfg: cfg, notes: make(map[string]*connector.Notes)}
+}
+
+// notesFor returns the notes of the table written for input name.
+func (l *violationLog) notesFor(name string) *connector.Notes {
+	if l.notes[name] == nil {
+		l.notes[name] = &connector.Notes{}
+	}
+	return l.notes[name]
+}
+
+// add records a violation and returns an error once there are more than the
+// configuration allows.
+func (l *violationLog) add(v violation) error {
+	v.Input = l.input
+	l.list = append(l.list, v)
+	problem := fmt.Errorf("record %d: column %s: %s", v.Line, v.Column, v.Message)
+	if v.Severity == connector.SeverityWarning {
+		l.warnings++
+		if l.cfg.MaxWarnings != nil && l.warnings > *l.cfg.MaxWarnings {
+			return fmt.Errorf("more than %d validation warnings, the last: %w", *l.cfg.MaxWarnings, problem)
+		}
+		return nil
+	}
+	l.errors++
+	if l.errors > l.cfg.MaxErrors {
+		if l.cfg.MaxErrors == 0 {
+			return problem
+		}
+		return fmt.Errorf("more than %d validation errors, the last: %w", l.cfg.MaxErrors, problem)
+	}
+	return nil
+}
+
+func (l *violationLog) begin(in connector.Input) {
+	l.input = in.Name
+	l.current = l.notesFor(in.Name)
+	l.rows = 0
+	l.pending = len(l.list)
+}
+
+func (l *violationLog) prepare(header []string) ([]string, error) {
+	l.header = slices.Clone(header)
+	return header, nil
+}
+
+// apply places the violations of the row in the output. Violations of rows
+// a later stage dropped are only reported.
+func (l *violationLog) apply(record []string, line int) ([]string, bool, error) {
+	for _, v := range l.list[l.pending:] {
+		if v.Line != line {
+			continue
+		}
+		col := slices.Index(l.header, v.Column)
+		if col < 0 {
+			continue
+		}
+		l.current.Add(connector.Note{Row: l.rows, Column: col, Severity: v.Severity, Text: v.Message})
+	}
+	l.pending = len(l.list)
+	l.rows++
+	return record, true, nil
+}
+
+// failed reports whether the thresholds were exceeded.
+func (l *violationLog) failed() bool {
+	return l.errors > l.cfg.MaxErrors || (l.cfg.MaxWarnings != nil && l.warnings > *l.cfg.MaxWarnings)
+}
+
+// write writes the report, as a JSON array if its name ends in .json and as
+// CSV otherwise.
+func (l *violationLog) write(policy atomicfile.Policy) error {
+	if l.cfg.Report == "" {
+		return nil
+	}
+	out, err := atomicfile.Create(l.cfg.Report, policy)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	if strings.EqualFold(filepath.Ext(l.cfg.Report), ".json") {
+		err = l.writeJSON(out)
+	} else {
+		err = l.writeCSV(out)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", l.cfg.Report, err)
+	}
+	return out.Commit()
+}
+
+func (l *violationLog) writeJSON(w io.Writer) error {
+	list := l.list
+	if list == nil {
+		list = []violation{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(list)
+}
+
+func (l *violationLog) writeCSV(w io.Writer) error {
+	writer := csvio.NewWriter(w, csvio.WriterOptions{})
+	if err := writer.Write([]string{"input", "line", "column", "value", "severity", "message"}); err != nil {
+		return err
+	}
+	for _, v := range l.list {
+		if err := writer.Write([]string{v.Input, strconv.Itoa(v.Line), v.Column, v.Value, v.Severity, v.Message}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// schemaStage checks rows against a table schema descriptor, reporting
+// broken types and constraints as error violations. It rewrites missing
+// values and booleans so the columns can take the schema's types, and
+// empties cells of the wrong type.
+type schemaStage struct {
+	schema *tableschema.Schema
+	log    *violationLog
+
+	header    []string
+	validator *tableschema.Validator
+}
+
+func (s *schemaStage) prepare(header []string) ([]string, error) {
+	var err error
+	if s.validator, err = s.schema.NewValidator(header); err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	s.header = slices.Clone(header)
+	return header, nil
+}
+
+func (s *schemaStage) apply(record []string, line int) ([]string, bool, error) {
+	for _, p := range s.validator.Row(record) {
+		err := s.log.add(violation{Line: line, Column: s.header[p.Column], Value: p.Value, Severity: connector.SeverityError, Message: p.Message})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return record, true, nil
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// viewStyle is how a table is drawn.
+type viewStyle struct {
+	// vertical, horizontal and cross draw the column separators and the
+	// rule under the header.
+	vertical, horizontal, cross string
+	ellipsis                    string
+	// newline stands for line breaks in cells.
+	newline rune
+	// bold and dim start colors, reset ends them; all empty without color.
+	bold, dim, reset string
+}
+
+var (
+	unicodeStyle = viewStyle{vertical: "│", horizontal: "─", cross: "┼", ellipsis: "…", newline: '↵'}
+	asciiStyle   = viewStyle{vertical: "|", horizontal: "-", cross: "+", ellipsis: "~", newline: ' '}
+)
+
+// runView prints the first rows of an input as an aligned table to read in
+// a terminal: numbers are right aligned, wide cells truncated, the header is
+// bold, and on a terminal the table fits its width and goes through a pager.
+func runView(args []string) error {
+	fs := newFlagSet("view")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: csvtools view [flags] [file]")
+		fs.PrintDefaults()
+	}
+	var d dialect
+	d.register(fs)
+	limit := fs.Int("n", 100, "rows to show, 0 for all")
+	columns := fs.String("c", "", "only show these comma separated columns (names or 1-based indexes)")
+	maxWidth := fs.Int("max-width", 40, "truncate cells wider than this many characters, 0 for no limit")
+	color := fs.String("color", "auto", "color the header and rules: auto (on a terminal unless NO_COLOR is set), always or never")
+	pager := fs.Bool("pager", true, "page tables taller than a terminal through $PAGER, or less")
+	ascii := fs.Bool("ascii", false, "draw the table with ASCII characters only")
+	rowNumbers := fs.Bool("row-numbers", false, "add a column numbering the rows")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *limit < 0 || *maxWidth < 0 {
+		return fmt.Errorf("-n and -max-width must not be negative")
+	}
+	if *maxWidth > 0 && *maxWidth < 2 {
+		return fmt.Errorf("-max-width must be at least 2")
+	}
+	name, err := inputArg(fs)
+	if err != nil {
+		return err
+	}
+	style := unicodeStyle
+	if *ascii {
+		style = asciiStyle
+	}
+	terminal := (d.output == "" || d.output == "-") && isTerminal(os.Stdout)
+	switch *color {
+	case "auto":
+		if !terminal || os.Getenv("NO_COLOR") != "" {
+			break
+		}
+		fallthrough
+	case "always":
+		style.bold, style.dim, style.reset = "\x1b[1m", "\x1b[2m", "\x1b[0m"
+	case "never":
+	default:
+		return fmt.Errorf("-color must be auto, always or never, got %q", *color)
+	}
+
+	header, rows, more, err := readView(&d, name, *columns, *limit, nil)
+	if err != nil {
+		return err
+	}
+	if *rowNumbers {
+		header = append([]string{"#"}, header...)
+		for i := range rows {
+			rows[i] = append([]string{strconv.Itoa(i + 1)}, rows[i]...)
+		}
+	}
+	table := newViewTable(header, rows, style, *maxWidth)
+	if terminal {
+		table.fit(viewWidth())
+	}
+
+	out, err := d.create()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	var w io.Writer = out
+	if terminal && *pager {
+		if p, err := startPager(); err == nil {
+			defer p.wait()
+			w = p
+		}
+	}
+	bw := bufio.NewWriter(w)
+	table.write(bw)
+	switch {
+	case more:
+		fmt.Fprintf(bw, "%sfirst %d rows shown, -n 0 for all%s\n", style.dim, len(rows), style.reset)
+	default:
+		fmt.Fprintf(bw, "%s%d rows%s\n", style.dim, len(rows), style.reset)
+	}
+	// A pager the user quits early stops reading, which isn't an error.
+	if err := bw.Flush(); err != nil && !errors.Is(err, syscall.EPIPE) {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// readView reads the header and up to limit rows of the named input, or all
+// rows for a limit of 0, keeping the selected columns and, if keep isn't
+// nil, the rows it keeps. more reports whether rows were left out.
+func readView(d *dialect, name, columns string, limit int, keep func(record []string) bool) (header []string, rows [][]string, more bool, err error) {
+	in, err := openInput(name)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	reader, err := d.reader(in, name)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	header, err = reader.Read()
+	if err == io.EOF {
+		return nil, nil, false, nil
+	}
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to read header from %s: %w", name, err)
+	}
+	idx, err := resolveColumns(header, columns)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("%s: %w", name, err)
+	}
+	project := func(record []string) []string {
+		if idx == nil {
+			return record
+		}
+		out := make([]string, len(idx))
+		for i, j := range idx {
+			out[i] = field(record, j)
+		}
+		return out
+	}
+	header = project(header)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return header, rows, false, nil
+		}
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if keep != nil && !keep(record) {
+			continue
+		}
+		if limit > 0 && len(rows) == limit {
+			return header, rows, true, nil
+		}
+		rows = append(rows, project(record))
+	}
+}
+
+// viewTable is a table laid out for printing.
+type viewTable struct {
+	header  []string
+	rows    [][]string
+	widths  []int
+	numeric []bool
+	style   viewStyle
+}
+
+// newViewTable lays out header and rows, with columns at most maxWidth
+// wide if it isn't 0. Columns whose cells are all numbers or empty are
+// numeric and right aligned.
+func newViewTable(header []string, rows [][]string, style viewStyle, maxWidth int) *viewTable {
+	t := &viewTable{header: header, rows: rows, style: style}
+	n := len(header)
+	for _, row := range rows {
+		n = max(n, len(row))
+	}
+	t.widths = make([]int, n)
+	t.numeric = make([]bool, n)
+	for i := range n {
+		t.widths[i] = displayWidth(style.clean(field(header, i)))
+		t.numeric[i] = len(rows) > 0
+		for _, row := range rows {
+			cell := field(row, i)
+			t.widths[i] = max(t.widths[i], displayWidth(style.clean(cell)))
+			if _, err := strconv.ParseFloat(strings.TrimSpace(cell), 64); err != nil && strings.TrimSpace(cell) != "" {
+				t.numeric[i] = false
+			}
+		}
+		if maxWidth > 0 {
+			t.widths[i] = min(t.widths[i], maxWidth)
+		}
+	}
+	return t
+}
+
+// fit narrows the widest columns until the table fits in total columns, but
+// not below a few characters each. A total of 0 leaves the table as it is.
+func (t *viewTable) fit(total int) {
+	const minWidth = 4
+	if total <= 0 || len(t.widths) == 0 {
+		return
+	}
+	for t.totalWidth() > total {
+		widest := 0
+		for i, w := range t.widths {
+			if w > t.widths[widest] {
+				widest = i
+			}
+		}
+		if t.widths[widest] <= minWidth {
+			return
+		}
+		t.widths[widest]--
+	}
+}
+
+// totalWidth is the width of a line of the table, separators included.
+func (t *viewTable) totalWidth() int {
+	total := 3 * (len(t.widths) - 1)
+	for _, w := range t.widths {
+		total += w
+	}
+	return total
+}
+
+func (t *viewTable) write(w *bufio.Writer) {
+	s := t.style
+	line := func(record []string, bold bool) {
+		for i, width := range t.widths {
+			if i > 0 {
+				w.WriteString(" " + s.dim + s.vertical + s.reset + " ")
+			}
+			cell := s.truncate(s.clean(field(record, i)), width)
+			pad := strings.Repeat(" ", width-displayWidth(cell))
+			if bold {
+				cell = s.bold + cell + s.reset
+			}
+			if t.numeric[i] {
+				w.WriteString(pad + cell)
+			} else if i < len(t.widths)-1 {
+				w.WriteString(cell + pad)
+			} else {
+				w.WriteString(cell)
+			}
+		}
+		w.WriteByte('\n')
+	}
+	if len(t.widths) == 0 {
+		return
+	}
+	line(t.header, true)
+	w.WriteString(s.dim)
+	for i, width := range t.widths {
+		if i > 0 {
+			w.WriteString(s.horizontal + s.cross + s.horizontal)
+		}
+		w.WriteString(strings.Repeat(s.horizontal, width))
+	}
+	w.WriteString(s.reset + "\n")
+	for _, row := range t.rows {
+		line(row, false)
+	}
+}
+
+// clean makes a cell printable on one line: line breaks become the newline
+// mark and other control characters spaces.
+func (s viewStyle) clean(cell string) string {
+	if !strings.ContainsFunc(cell, unicode.IsControl) {
+		return cell
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\r':
+			return -1
+		case r == '\n':
+			return s.newline
+		case unicode.IsControl(r):
+			return ' '
+		}
+		return r
+	}, cell)
+}
+
+// truncate shortens cell to at most n columns, ending it with the ellipsis
+// if anything was cut.
+func (s viewStyle) truncate(cell string, n int) string {
+	if displayWidth(cell) <= n {
+		return cell
+	}
+	var b strings.Builder
+	used := displayWidth(s.ellipsis)
+	for _, r := range cell {
+		rw := runeWidth(r)
+		if used+rw > n {
+			break
+		}
+		b.WriteRune(r)
+		used += rw
+	}
+	return b.String() + s.ellipsis
+}
+
+// displayWidth is the number of terminal columns s takes: East Asian wide
+// characters take two and combining marks none.
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+func runeWidth(r rune) int {
+	switch {
+	case unicode.Is(unicode.Mn, r) || r == '\u200b':
+		return 0
+	case width.LookupRune(r).Kind() == width.EastAsianWide || width.LookupRune(r).Kind() == width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// viewWidth is the width of the terminal: $COLUMNS, else what the terminal
+// reports, else 0.
+func viewWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	width, _ := terminalSize(os.Stdout)
+	return width
+}
+
+// pager writes to a running pager.
+type pager struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+// startPager runs $PAGER on stdout, or "less -FRSX" which quits at once for
+// a table fitting the screen, shows colors and scrolls wide tables sideways.
+func startPager() (*pager, error) {
+	args := strings.Fields(os.Getenv("PAGER"))
+	if len(args) == 0 {
+		args = []string{"less", "-FRSX"}
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &pager{WriteCloser: stdin, cmd: cmd}, nil
+}
+
+// wait closes the pager's input and waits for the user to quit it.
+func (p *pager) wait() {
+	_ = p.Close()
+	_ = p.cmd.Wait()
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// terminalSize is not available on this platform and reports zeros, leaving
+// the width to $COLUMNS.
+func terminalSize(f *os.File) (width, height int) {
+	return 0, 0
+}
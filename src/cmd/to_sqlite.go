@@ -1,20 +1,187 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"csvtools/src/internal/artifact"
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/audit"
+	"csvtools/src/internal/bizkey"
+	"csvtools/src/internal/cdc"
+	"csvtools/src/internal/checkpoint"
+	"csvtools/src/internal/clipboard"
+	"csvtools/src/internal/colcrypt"
+	"csvtools/src/internal/columnar"
+	"csvtools/src/internal/compress"
+	"csvtools/src/internal/csvio"
+	"csvtools/src/internal/ddl"
+	"csvtools/src/internal/dedupe"
+	"csvtools/src/internal/discover"
+	"csvtools/src/internal/envflags"
+	"csvtools/src/internal/exitcode"
+	"csvtools/src/internal/flatjson"
+	"csvtools/src/internal/gsheet"
+	"csvtools/src/internal/headers"
+	"csvtools/src/internal/health"
+	"csvtools/src/internal/lineage"
+	"csvtools/src/internal/naming"
+	"csvtools/src/internal/retry"
+	"csvtools/src/internal/runlock"
+	"csvtools/src/internal/scd2"
+	"csvtools/src/internal/sqlitedb"
+	"csvtools/src/internal/surrogate"
+	"csvtools/src/internal/tempdir"
+	"csvtools/src/internal/throttle"
+	"csvtools/src/internal/tracing"
+	"csvtools/src/internal/version"
+	"csvtools/src/internal/xlsx"
+	"csvtools/src/internal/xmlpath"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// maxBindVariables is SQLite's default SQLITE_MAX_VARIABLE_NUMBER since 3.32.
+	maxBindVariables = 32766
+	// fastBatchRows caps the rows per INSERT with -fast; larger batches gain little.
+	fastBatchRows = 500
 )
 
+// batchInserter inserts rows into a table with multi-row INSERT statements
+// of up to batch rows, binding every cell. Compared to one statement per row
+// this cuts the per-statement overhead, which dominates for narrow tables.
+type batchInserter struct {
+	tx      *sql.Tx
+	table   string
+	columns []string
+	batch   int
+	stmt    *sql.Stmt // prepared for a full batch
+	pending []interface{}
+}
+
+func newBatchInserter(tx *sql.Tx, table string, columns []string, batch int) *batchInserter {
+	return &batchInserter{tx: tx, table: table, columns: columns, batch: max(batch, 1)}
+}
+
+// insertSQL returns an INSERT statement for rows rows.
+func (b *batchInserter) insertSQL(rows int) string {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(b.columns)), ", ") + ")"
+	columns := make([]string, len(b.columns))
+	for i, c := range b.columns {
+		columns[i] = sqlitedb.Quote(c)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+		sqlitedb.Quote(b.table),
+		strings.Join(columns, ", "),
+		strings.TrimSuffix(strings.Repeat(row+", ", rows), ", "),
+	)
+}
+
+// add queues a row and inserts the batch once it is full.
+func (b *batchInserter) add(row []interface{}) error {
+	b.pending = append(b.pending, row...)
+	if len(b.pending) < b.batch*len(b.columns) {
+		return nil
+	}
+	if b.stmt == nil {
+		stmt, err := b.tx.Prepare(b.insertSQL(b.batch))
+		if err != nil {
+			return fmt.Errorf("failed to prepare insert statement for %s: %w", b.table, err)
+		}
+		b.stmt = stmt
+	}
+	if _, err := b.stmt.Exec(b.pending...); err != nil {
+		return fmt.Errorf("failed to insert rows into %s: %w", b.table, err)
+	}
+	b.pending = b.pending[:0]
+	return nil
+}
+
+// flush inserts the rows of an incomplete last batch.
+func (b *batchInserter) flush() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	if _, err := b.tx.Exec(b.insertSQL(len(b.pending)/len(b.columns)), b.pending...); err != nil {
+		return fmt.Errorf("failed to insert rows into %s: %w", b.table, err)
+	}
+	b.pending = b.pending[:0]
+	return nil
+}
+
+func (b *batchInserter) close() {
+	if b.stmt != nil {
+		_ = b.stmt.Close()
+	}
+}
+
+// saveCompressed writes the file at path compressed with codec to dest, atomically.
+func saveCompressed(codec compress.Codec, path, dest string, policy atomicfile.Policy) error {
+	out, err := atomicfile.Create(dest, policy)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	if err := codec.Copy(out, path); err != nil {
+		return err
+	}
+	return out.Commit()
+}
+
+// packageArtifact packages the database at path into dir, named after
+// databaseFilePath and compressed with codec, zstd by default, for
+// publishing.
+func packageArtifact(ctx context.Context, db *sql.DB, path, databaseFilePath, dir string, codec compress.Codec, runID string, sources []artifact.Source, opts loadOptions, policy atomicfile.Policy) error {
+	tables, err := artifact.Describe(ctx, db)
+	if err != nil {
+		return err
+	}
+	if codec == compress.None {
+		codec = compress.Zstd
+	}
+	base := filepath.Base(databaseFilePath)
+	meta := &artifact.Metadata{
+		Name:      strings.TrimSuffix(base, filepath.Ext(base)),
+		RunID:     runID,
+		Tool:      "to_sqlite",
+		Revision:  version.Revision(),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Tables:    tables,
+		Sources:   sources,
+		Lineage:   opts.lineage,
+	}
+	target, err := artifact.Write(dir, path, codec, meta, policy)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Artifact written to %s (sha256 %s).\n", target, meta.SHA256)
+	return nil
+}
+
+// fileSize returns the size of the file at path, or 0 if it can't be told.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
 // sanitizeName cleans a string to be a valid SQL identifier (table or column name).
 // It replaces non-alphanumeric characters with underscores and ensures it starts with a letter or underscore.
 func sanitizeName(name string) string {
@@ -37,182 +204,1334 @@ func sanitizeName(name string) string {
 	return sanitized
 }
 
+// identifier returns the table or column name used for name. Names are kept
+// as they are, only trimmed and with NUL bytes replaced as by sqlitedb.Name,
+// and quoted in the generated SQL; -sanitize-names
+// restricts them to letters, digits and underscores instead. A blank name
+// becomes "unnamed_column".
+func (o loadOptions) identifier(name string) string {
+	if o.sanitize {
+		return sanitizeName(name)
+	}
+	if name = strings.TrimSpace(sqlitedb.Name(name)); name == "" {
+		return "unnamed_column"
+	}
+	return name
+}
+
+// tableName returns the table a file loads into: the manifest's table, or
+// the file name. A name SQLite reserves gets a leading underscore.
+func (o loadOptions) tableName(src discover.File) string {
+	name := src.Name
+	if src.Table != "" {
+		name = src.Table
+	}
+	if name = o.identifier(name); sqlitedb.Reserved(name) {
+		return "_" + name
+	}
+	return name
+}
+
+// tableCollision says what happens when files of a run map to the same
+// table name, e.g. "Sales.csv" and "sales.tsv", or "2024-01.csv" and
+// "2024_01.csv" with -sanitize-names.
+type tableCollision string
+
+const (
+	// collisionMerge loads the files into the one table.
+	collisionMerge tableCollision = "merge"
+	// collisionSuffix keeps the name for the first file and suffixes the
+	// others with "_2", "_3", ...
+	collisionSuffix tableCollision = "suffix"
+	// collisionError fails the run before anything is loaded.
+	collisionError tableCollision = "error"
+)
+
+func (c *tableCollision) String() string {
+	if *c == "" {
+		return string(collisionMerge)
+	}
+	return string(*c)
+}
+
+func (c *tableCollision) Set(s string) error {
+	switch tableCollision(s) {
+	case collisionMerge, collisionSuffix, collisionError:
+		*c = tableCollision(s)
+		return nil
+	}
+	return fmt.Errorf("unknown table collision strategy %q (want merge, suffix or error)", s)
+}
+
+// resolveTables finds files that would load into the same table and applies
+// the strategy, setting Table on the files it renames. Like SQLite it ignores
+// case. Files whose manifest entry names the table are meant to share it and
+// are never renamed; a file whose own name collides with them is.
+func resolveTables(files []discover.File, strategy tableCollision, opts loadOptions) error {
+	owners := make(map[string][]int)
+	var order []string
+	for i, f := range files {
+		key := strings.ToLower(opts.tableName(f))
+		if _, seen := owners[key]; !seen {
+			order = append(order, key)
+		}
+		owners[key] = append(owners[key], i)
+	}
+	used := make(map[string]bool, len(owners))
+	for key := range owners {
+		used[key] = true
+	}
+	for _, key := range order {
+		// Manifest tables claim the name first, then files by discovery order
+		var named, renamed []int
+		for _, i := range owners[key] {
+			if files[i].Table != "" {
+				named = append(named, i)
+			} else {
+				renamed = append(renamed, i)
+			}
+		}
+		if len(named) == 0 {
+			named, renamed = renamed[:1], renamed[1:]
+		}
+		if len(renamed) == 0 {
+			continue
+		}
+		var paths []string
+		for _, i := range slices.Concat(named, renamed) {
+			paths = append(paths, files[i].Path)
+		}
+		name := opts.tableName(files[named[0]])
+		switch strategy {
+		case collisionError:
+			return fmt.Errorf("files %s all load into table %s (use -table-collision suffix or merge)", strings.Join(paths, ", "), name)
+		case collisionSuffix:
+			suffix := 2
+			for _, i := range renamed {
+				for used[strings.ToLower(fmt.Sprintf("%s_%d", name, suffix))] {
+					suffix++
+				}
+				files[i].Table = fmt.Sprintf("%s_%d", name, suffix)
+				used[strings.ToLower(files[i].Table)] = true
+				fmt.Printf("File %s collides with table %s, loading it into %s.\n", files[i].Path, name, files[i].Table)
+			}
+		default:
+			fmt.Printf("Files %s all load into table %s.\n", strings.Join(paths, ", "), name)
+		}
+	}
+	return nil
+}
+
+// loadOptions holds the command line settings that change how a CSV file is loaded.
+type loadOptions struct {
+	// incremental loads only the rows appended since the last checkpoint.
+	incremental bool
+	// headers normalizes header names before they are sanitized into column names.
+	headers headers.Normalizer
+	// headerPolicy handles blank and repeated header names.
+	headerPolicy headers.Policy
+	// columnOrder orders the table columns.
+	columnOrder headers.ColumnOrder
+	// lenient recovers from malformed records instead of failing the file.
+	lenient bool
+	// sniff guesses the delimiter, quote and header row of every file.
+	sniff     csvio.SniffFlags
+	separator csvio.SeparatorFlags
+	skip      csvio.SkipFlags
+	asserts   csvio.AssertFlags
+	parallel  csvio.ParallelFlags
+	// ragged decides what happens to rows whose field count differs from the header.
+	ragged csvio.RaggedPolicy
+	// maxRecordSize fails a file with a record larger than this many bytes; 0 disables it.
+	maxRecordSize int64
+	// limiter caps the bandwidth the files are read with.
+	limiter *throttle.Limiter
+	// encrypt lists the columns, as "column" or "table.column", whose values are encrypted with cipher.
+	encrypt []string
+	cipher  *colcrypt.Cipher
+	// fast inserts many rows per statement, see batchInserter.
+	fast bool
+	// sanitize restricts table and column names to letters, digits and underscores.
+	sanitize bool
+	// dedupe checks the key columns of the tables that have one.
+	dedupe *dedupe.Tracker
+	// lineage lists the audit columns appended to every table; loadedAt is the run's start.
+	lineage  lineage.Columns
+	loadedAt string
+	// surrogate names the generated key column put first in tables, and its kind.
+	surrogate surrogate.Flags
+	// scd2 holds the business keys of the tables kept as history tables, see package scd2.
+	scd2 dedupe.Keys
+	// cdc holds the business keys of the tables reloaded as changesets, see package cdc;
+	// cdcDir receives the changesets and cdcDryRun leaves the tables as they are.
+	cdc       dedupe.Keys
+	cdcDir    string
+	cdcDryRun bool
+	// ddl holds the templates overriding the generated CREATE TABLE statements.
+	ddl ddl.Templates
+	// naming holds -name-template and -name-pattern; namer, if set, names the
+	// tables of the files the manifest doesn't name.
+	naming naming.Flags
+	namer  *naming.Namer
+	// workbooks reads the sheets of .xlsx inputs as CSV files.
+	workbooks xlsx.InputFlags
+	// jsonFiles reads .json and .jsonl inputs as CSV files.
+	jsonFiles flatjson.InputFlags
+	// xmlFiles reads the records of .xml inputs as CSV files.
+	xmlFiles xmlpath.InputFlags
+	// lakeFiles reads Parquet and Arrow inputs as CSV files.
+	lakeFiles columnar.InputFlags
+}
+
+// encrypted reports whether column of table is to be encrypted. Like SQLite, it ignores case.
+func (o loadOptions) encrypted(table, column string) bool {
+	for _, name := range o.encrypt {
+		if strings.EqualFold(name, column) || strings.EqualFold(name, table+"."+column) {
+			return true
+		}
+	}
+	return false
+}
+
+// newCSVReader returns the reader used for a CSV file, logging each recovery in lenient mode.
+// A zero dialect is filled in with the one the file is read with, sniffed or not; a set one,
+// from reading the start of the file, is kept for reading on in it.
+func newCSVReader(r io.Reader, src discover.File, opts loadOptions, dialect *csvio.Dialect) csvio.Reader {
+	filePath := src.Origin()
+	readOpts := csvio.Options{
+		Comma:         src.Delimiter,
+		FixedComma:    src.FixedDelimiter,
+		Lenient:       opts.lenient,
+		MaxRecordSize: opts.maxRecordSize,
+		OnRecover: func(rec csvio.Recovery) {
+			fmt.Printf("Recovered malformed record in %s at line %d: %s\n", filePath, rec.Line, rec.Reason)
+		},
+	}
+	opts.separator.Apply(&readOpts)
+	opts.skip.Apply(&readOpts)
+	opts.asserts.Apply(&readOpts, filePath)
+	opts.parallel.Apply(&readOpts)
+	if dialect.Comma != 0 {
+		dialect.Continue(&readOpts)
+	} else {
+		opts.sniff.Apply(&readOpts)
+		if src.Source != "" {
+			// Extracted and converted files are written with a header row.
+			readOpts.FixedComma, readOpts.Header = true, csvio.HeaderPresent
+		}
+		readOpts.OnDialect = func(d csvio.Dialect) {
+			*dialect = d
+			if readOpts.Sniff {
+				fmt.Printf("Reading %s with %s\n", filePath, d)
+			}
+		}
+	}
+	return csvio.NewReader(opts.limiter.Reader(r), readOpts)
+}
+
+// columns turns a header into the column names of its table, in the order
+// of the records, and returns the permutation putting them in -column-order.
+func (o loadOptions) columns(header []string) ([]string, []int, error) {
+	// Normalize header names and resolve blank or repeated ones
+	names, err := o.headerPolicy.Fix(o.headers.Apply(header))
+	if err != nil {
+		return nil, nil, err
+	}
+	columnNames := make([]string, len(names))
+	for i, h := range names {
+		columnNames[i] = o.identifier(h)
+	}
+	// Sanitizing can map different names to one column ("a b" and "a-b"), and SQLite ignores case
+	if columnNames, err = o.headerPolicy.FixFold(columnNames); err != nil {
+		return nil, nil, err
+	}
+	return columnNames, o.columnOrder.Permutation(columnNames), nil
+}
+
+// createTable returns the statement creating table with columns, all TEXT
+// but the lineage row number and sequential surrogate keys, from its
+// -ddl-template if any.
+func (o loadOptions) createTable(table string, columns []string) (string, error) {
+	types := map[string]string{lineage.RowNumber: "INTEGER", scd2.Current: "INTEGER"}
+	if key := o.surrogate.For(table); key != "" {
+		types[key] = o.surrogate.Kind.SQLType()
+	}
+	return o.ddl.Render(ddl.NewTable(table, columns, types))
+}
+
+// tableColumns returns the columns of table holding rows with columnNames:
+// its surrogate key if it has one, the columns of the rows, the lineage
+// columns and, for history tables, the scd2 columns. None must clash with
+// the columns of the rows.
+func (o loadOptions) tableColumns(table string, columnNames []string) ([]string, error) {
+	if name, clash := o.lineage.Clash(columnNames); clash {
+		return nil, fmt.Errorf("lineage column %s clashes with a column of the file", name)
+	}
+	columns := append(slices.Clip(columnNames), o.lineage...)
+	if o.scd2.For(table) != nil {
+		for _, name := range scd2.Columns {
+			if slices.ContainsFunc(columns, func(c string) bool { return strings.EqualFold(c, name) }) {
+				return nil, fmt.Errorf("history column %s clashes with a column of the file", name)
+			}
+		}
+		columns = append(columns, scd2.Columns...)
+	}
+	key := o.surrogate.For(table)
+	if key == "" {
+		return columns, nil
+	}
+	if slices.ContainsFunc(columns, func(c string) bool { return strings.EqualFold(c, key) }) {
+		return nil, fmt.Errorf("surrogate key %s clashes with a column of the file", key)
+	}
+	return append([]string{key}, columns...), nil
+}
+
+// findFiles lists the files to load from sourceDir and names their tables.
+func findFiles(ctx context.Context, sourceDir string, discovery discover.Options, collision tableCollision, opts loadOptions) ([]discover.File, error) {
+	discovery.OnSkip = func(path, reason string) {
+		fmt.Printf("Skipping %s: %s\n", path, reason)
+	}
+	_, span := tracing.Start(ctx, "discover", attribute.String("csvtools.source", sourceDir))
+	var files []discover.File
+	var err error
+	if gsheet.IsRef(sourceDir) {
+		// Tabs are snapshotted into the run's temp directory.
+		files, err = gsheet.Files(ctx, sourceDir, "")
+	} else if clipboard.Is(sourceDir) {
+		var file discover.File
+		if file, err = clipboard.File(ctx, ""); err == nil {
+			files = []discover.File{file}
+		}
+	} else if files, err = discover.Find(sourceDir, discovery); err != nil {
+		err = fmt.Errorf("failed to read CSV directory: %w", err)
+	}
+	span.SetAttributes(attribute.Int("csvtools.inputs", len(files)))
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+	// Sheets are extracted into the run's temp directory.
+	if files, err = opts.workbooks.Expand(files, ""); err != nil {
+		return nil, err
+	}
+	if files, err = opts.jsonFiles.Expand(files, ""); err != nil {
+		return nil, err
+	}
+	if files, err = opts.xmlFiles.Expand(files, ""); err != nil {
+		return nil, err
+	}
+	if files, err = opts.lakeFiles.Expand(files, ""); err != nil {
+		return nil, err
+	}
+	if opts.namer != nil {
+		if err = nameTables(files, opts); err != nil {
+			return nil, err
+		}
+	}
+	if err = resolveTables(files, collision, opts); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// nameTables names the tables of the files the manifest doesn't name with
+// the -name-template. Files named alike load into one table, as if the
+// manifest named it.
+func nameTables(files []discover.File, opts loadOptions) error {
+	for i, src := range files {
+		if src.Table != "" {
+			continue
+		}
+		name, err := opts.namer.Name(src, func(n int) ([][]string, error) {
+			f, err := os.Open(src.Path)
+			if err != nil {
+				return nil, err
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			return naming.Head(newCSVReader(f, src, opts, &csvio.Dialect{}), n)
+		})
+		if err != nil {
+			return err
+		}
+		files[i].Table = name
+	}
+	return nil
+}
+
+// writeDDL writes the statements a load of files would run to create its
+// tables, and the tables to_sqlite keeps its own records in, to path. Only
+// the header of every file is read.
+func writeDDL(path string, files []discover.File, opts loadOptions, policy atomicfile.Policy) error {
+	var statements []string
+	if opts.incremental {
+		statements = append(statements, checkpoint.TableDDL)
+	}
+	created := make(map[string]bool)
+	for _, src := range files {
+		table := opts.tableName(src)
+		if created[strings.ToLower(table)] {
+			continue // merged into the table of an earlier file
+		}
+		created[strings.ToLower(table)] = true
+		statement, err := tableDDL(src, table, opts)
+		if err != nil {
+			return err
+		}
+		statements = append(statements, statement)
+	}
+	statements = append(statements, audit.TableDDL)
+
+	if err := atomicfile.Check(path, policy); err != nil {
+		return err
+	}
+	out, err := atomicfile.Create(path, policy)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	if _, err := io.WriteString(out, strings.Join(statements, ";\n\n")+";\n"); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return out.Commit()
+}
+
+// tableDDL returns the statement creating table for src, from its header.
+func tableDDL(src discover.File, table string, opts loadOptions) (string, error) {
+	file, err := os.Open(src.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open CSV file %s: %w", src.Path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	var dialect csvio.Dialect
+	header, err := newCSVReader(file, src, opts, &dialect).Read()
+	if err != nil {
+		return "", fmt.Errorf("failed to read header from %s: %w", src.Path, err)
+	}
+	recordColumns, perm, err := opts.columns(header)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", src.Path, err)
+	}
+	columnNames := headers.Reorder(recordColumns, perm)
+	allColumns, err := opts.tableColumns(table, columnNames)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", src.Path, err)
+	}
+	return opts.createTable(table, allColumns)
+}
+
 // processCSVFile reads a CSV file, creates a table in the database, and inserts its data.
-func processCSVFile(db *sql.DB, filePath string) error {
+// All rows of a file are inserted in a single transaction which is rolled back on failure,
+// so the file can safely be processed again. It returns the counts of ragged rows handled.
+func processCSVFile(db *sql.DB, src discover.File, opts loadOptions) (ragged csvio.RaggedRows, err error) {
+	filePath := src.Origin()
 	fmt.Printf("Processing file: %s\n", filePath)
 
 	// Open the CSV file
-	file, err := os.Open(filePath)
+	file, err := os.Open(src.Path)
 	if err != nil {
-		return fmt.Errorf("failed to open CSV file %s: %w", filePath, err)
+		return ragged, fmt.Errorf("failed to open CSV file %s: %w", filePath, err)
 	}
 	defer func(file *os.File) {
 		_ = file.Close()
 	}(file)
 
-	reader := csv.NewReader(file)
-	reader.FieldsPerRecord = -1 // Allow variable number of fields
+	var dialect csvio.Dialect
+	reader := newCSVReader(file, src, opts, &dialect) // Allows a variable number of fields
 
 	// Read the header row
 	header, err := reader.Read()
 	if err != nil {
-		return fmt.Errorf("failed to read header from %s: %w", filePath, err)
+		return ragged, fmt.Errorf("failed to read header from %s: %w", filePath, err)
 	}
 
-	// Sanitize header names for column names
-	sanitizedHeaders := make([]string, len(header))
-	for i, h := range header {
-		sanitizedHeaders[i] = sanitizeName(h)
+	// Turn header names into column names, in -column-order
+	recordColumns, perm, err := opts.columns(header)
+	if err != nil {
+		return ragged, retry.Permanent(fmt.Errorf("%s: %w", filePath, err))
 	}
+	columnNames := headers.Reorder(recordColumns, perm)
+
+	// Determine table name from file name, unless the manifest names the table
+	tableName := opts.tableName(src)
 
-	// Determine table name from file name
-	fileName := filepath.Base(filePath)
-	tableName := sanitizeName(strings.TrimSuffix(fileName, filepath.Ext(fileName)))
-	if tableName == "" {
-		tableName = "default_table" // Fallback if file name is empty or un-sanitizable
+	// Encrypted columns are bound to their column name, see colcrypt.Cipher
+	encrypt := make([]bool, len(columnNames))
+	for i, h := range columnNames {
+		encrypt[i] = opts.encrypted(tableName, h)
 	}
 
-	// Construct CREATE TABLE SQL
-	var columns []string
-	for _, h := range sanitizedHeaders {
-		columns = append(columns, fmt.Sprintf("%s TEXT", h))
+	// A surrogate key precedes the data columns and lineage columns follow
+	// them; neither may clash with them
+	allColumns, err := opts.tableColumns(tableName, columnNames)
+	if err != nil {
+		return ragged, retry.Permanent(fmt.Errorf("%s: %w", filePath, err))
+	}
+	surrogateKey := opts.surrogate.For(tableName)
+	offset := 0
+	if surrogateKey != "" {
+		offset = 1
+	}
+	historyKey := opts.scd2.For(tableName)
+	if historyKey != nil {
+		if err = bizkey.Check(columnNames, historyKey); err != nil {
+			return ragged, retry.Permanent(fmt.Errorf("%s: %w", filePath, err))
+		}
+	}
+	changeKey := opts.cdc.For(tableName)
+	if changeKey != nil {
+		if err = bizkey.Check(columnNames, changeKey); err != nil {
+			return ragged, retry.Permanent(fmt.Errorf("%s: %w", filePath, err))
+		}
+	}
+
+	createTableSQL, err := opts.createTable(tableName, allColumns)
+	if err != nil {
+		return ragged, retry.Permanent(err)
 	}
-	createTableSQL := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", tableName, strings.Join(columns, ", "))
 
 	// Execute CREATE TABLE
 	_, err = db.Exec(createTableSQL)
 	if err != nil {
-		return fmt.Errorf("failed to create table %s: %w", tableName, err)
+		return ragged, fmt.Errorf("failed to create table %s: %w", tableName, err)
 	}
 	fmt.Printf("Table '%s' created or already exists.\n", tableName)
 
-	// Prepare INSERT statement
-	placeholders := make([]string, len(sanitizedHeaders))
-	for i := range sanitizedHeaders {
-		placeholders[i] = "?"
+	// In incremental mode, continue after the last checkpointed record instead of the header
+	var state checkpoint.State
+	reset := false
+	if opts.incremental {
+		reader, state, reset, err = resumeReader(db, file, src, dialect, header, reader.InputOffset(), opts)
+		if err != nil {
+			return ragged, err
+		}
 	}
-	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
-		tableName,
-		strings.Join(sanitizedHeaders, ", "),
-		strings.Join(placeholders, ", "),
-	)
+	dataStart := state.Offset
+
+	// Check the key columns against the rows of earlier files and runs, independent of constraints
+	var keys *dedupe.Check
+	if opts.dedupe != nil {
+		if keys, err = opts.dedupe.File(tableName, filePath, recordColumns); err != nil {
+			return ragged, retry.Permanent(fmt.Errorf("%s: %w", filePath, err))
+		}
+	}
+	if keys != nil {
+		if !keys.Seeded() && !reset {
+			if err = seedKeys(db, tableName, keys, opts); err != nil {
+				return ragged, err
+			}
+		}
+		defer func() {
+			if closeErr := keys.Close(err == nil); err == nil {
+				err = closeErr
+			}
+			if keys.Duplicates > 0 {
+				fmt.Printf("Found %d rows with duplicate keys (%s) in %s.\n", keys.Duplicates, strings.Join(keys.Columns(), ", "), filePath)
+			}
+		}()
+	}
+
+	// The changeset is kept once the transaction committed, so it is closed after it
+	var changes *cdc.Load
+	defer func() {
+		if changes == nil {
+			return
+		}
+		if closeErr := changes.Close(err == nil); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to write the changes of %s: %w", filePath, closeErr)
+		}
+	}()
 
 	// Read and insert data rows
 	tx, err := db.Begin() // Start a transaction for faster inserts
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return ragged, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer func() {
 		if r := recover(); r != nil {
-			err := tx.Rollback()
-			if err != nil {
-				return
-			}
+			_ = tx.Rollback()
 			panic(r) // Re-throw panic after rollback
 		} else if err != nil {
-			err := tx.Rollback()
-			if err != nil {
-				return
-			} // Rollback on error
-		} else {
-			err = tx.Commit() // Commit on success
+			_ = tx.Rollback() // Rollback on error
+		} else if err = tx.Commit(); err != nil { // Commit on success
+			err = fmt.Errorf("failed to commit rows into %s: %w", tableName, err)
 		}
 	}()
 
-	stmt, err := tx.Prepare(insertSQL)
-	if err != nil {
-		return fmt.Errorf("failed to prepare insert statement for %s: %w", tableName, err)
+	if reset {
+		if _, err = tx.Exec("DELETE FROM " + sqlitedb.Quote(tableName)); err != nil {
+			return ragged, fmt.Errorf("failed to clear table %s before reload: %w", tableName, err)
+		}
+	}
+
+	// Sequential keys continue after the largest one of earlier files and runs
+	var keyGen *surrogate.Generator
+	if surrogateKey != "" {
+		var last sql.NullInt64
+		if opts.surrogate.Kind == surrogate.Sequence {
+			query := fmt.Sprintf("SELECT MAX(CAST(%s AS INTEGER)) FROM %s", sqlitedb.Quote(surrogateKey), sqlitedb.Quote(tableName))
+			if err = tx.QueryRow(query).Scan(&last); err != nil {
+				return ragged, fmt.Errorf("failed to read the largest %s of %s: %w", surrogateKey, tableName, err)
+			}
+		}
+		keyGen = opts.surrogate.Kind.Start(last.Int64)
+	}
+
+	// History tables get a new version of changed rows instead of a copy of every row
+	var history *scd2.Load
+	if historyKey != nil {
+		if history, err = scd2.Begin(tx, tableName, columnNames, historyKey, opts.loadedAt); err != nil {
+			return ragged, err
+		}
+	}
+
+	// Changeset tables are brought in line with the file instead of appended to
+	if changeKey != nil {
+		changeOpts := cdc.Options{Key: changeKey, Set: append(slices.Clip(columnNames), opts.lineage...), Apply: !opts.cdcDryRun}
+		if opts.cdcDir != "" {
+			changeOpts.Path = cdc.Path(opts.cdcDir, filePath)
+		}
+		if changes, err = cdc.Begin(tx, tableName, columnNames, changeOpts); err != nil {
+			return ragged, err
+		}
+	}
+	var snapshotCells []string
+	if history != nil || changes != nil {
+		snapshotCells = make([]string, len(columnNames))
 	}
-	defer func(stmt *sql.Stmt) {
-		_ = stmt.Close()
-	}(stmt)
 
+	// Insert one row per statement, or many with -fast
+	rowsPerInsert := 1
+	if opts.fast {
+		rowsPerInsert = min(fastBatchRows, maxBindVariables/max(len(allColumns), 1))
+	}
+	inserter := newBatchInserter(tx, tableName, allColumns, rowsPerInsert)
+	defer inserter.close()
+
+	ragged = csvio.RaggedRows{Policy: opts.ragged, Width: len(columnNames)}
 	insertedRows := 0
+	readRows := int(state.Rows)
+	lineageCells := make([]string, 0, len(opts.lineage))
+	// The inserter copies the arguments of every row, so one slice serves them all.
+	args := make([]interface{}, len(allColumns))
 	for {
 		record, err := reader.Read()
 		if err == io.EOF {
 			break // End of file
 		}
 		if err != nil {
-			return fmt.Errorf("failed to read record from %s: %w", filePath, err)
+			return ragged, fmt.Errorf("failed to read record from %s: %w", filePath, err)
 		}
+		readRows++
+		state.Offset = dataStart + reader.InputOffset()
 
-		// Ensure the record has enough values for the columns
-		if len(record) < len(sanitizedHeaders) {
-			// Pad with empty strings if record has fewer columns than header
-			for i := len(record); i < len(sanitizedHeaders); i++ {
-				record = append(record, "")
+		// Pad, truncate, skip or reject rows that don't match the header width
+		record, keep, err := ragged.Fix(record, readRows)
+		if err != nil {
+			return ragged, retry.Permanent(fmt.Errorf("%s: %w", filePath, err))
+		}
+		if !keep {
+			continue
+		}
+		if keys != nil {
+			if keep, err = keys.Row(record, readRows); err != nil {
+				return ragged, retry.Permanent(fmt.Errorf("%s: %w", filePath, err))
+			}
+			if !keep {
+				continue
 			}
-		} else if len(record) > len(sanitizedHeaders) {
-			// Truncate if record has more columns than header
-			record = record[:len(sanitizedHeaders)]
 		}
 
-		// Convert []string to []interface{} for stmt.Exec
-		args := make([]interface{}, len(record))
-		for i, v := range record {
-			args[i] = v
+		// Convert []string to []interface{} for stmt.Exec; cells missing from short rows are NULL
+		clear(args)
+		for i := range columnNames {
+			j := i
+			if perm != nil {
+				j = perm[i]
+			}
+			if j >= len(record) {
+				continue
+			}
+			v := record[j]
+			args[offset+i] = v
+			if encrypt[i] {
+				if args[offset+i], err = opts.cipher.Encrypt(columnNames[i], v); err != nil {
+					return ragged, fmt.Errorf("failed to encrypt %s.%s: %w", tableName, columnNames[i], err)
+				}
+			}
+		}
+		for i := range snapshotCells {
+			snapshotCells[i], _ = args[offset+i].(string)
+		}
+		if history != nil {
+			insert, err := history.Row(snapshotCells)
+			if err != nil {
+				return ragged, retry.Permanent(fmt.Errorf("%s: %w", filePath, err))
+			}
+			if !insert {
+				continue
+			}
+			copy(args[len(args)-len(scd2.Columns):], history.Values())
+		}
+		lineageCells = opts.lineage.Append(lineageCells[:0], filePath, int64(readRows), opts.loadedAt)
+		for i, v := range lineageCells {
+			args[offset+len(columnNames)+i] = v
+		}
+		if changes != nil {
+			insert, err := changes.Row(snapshotCells, args[offset:offset+len(columnNames)+len(lineageCells)])
+			if err != nil {
+				return ragged, retry.Permanent(fmt.Errorf("%s: %w", filePath, err))
+			}
+			if !insert {
+				continue
+			}
+		}
+		if keyGen != nil {
+			args[0] = keyGen.Next()
 		}
 
-		_, err = stmt.Exec(args...)
-		if err != nil {
-			return fmt.Errorf("failed to insert row into %s: %w", tableName, err)
+		if err = inserter.add(args); err != nil {
+			return ragged, err
 		}
 		insertedRows++
+		state.Rows++
+	}
+	if err = inserter.flush(); err != nil {
+		return ragged, err
+	}
+	if history != nil {
+		if err = history.Finish(); err != nil {
+			return ragged, err
+		}
+		c := history.Counts
+		fmt.Printf("History of %s: %d new, %d changed, %d unchanged, %d closed as missing from %s.\n", tableName, c.New, c.Changed, c.Unchanged, c.Closed, filePath)
+	}
+	if changes != nil {
+		if err = changes.Finish(); err != nil {
+			return ragged, err
+		}
+		c := changes.Counts
+		verb := "Applied"
+		if opts.cdcDryRun {
+			verb = "Found"
+		}
+		fmt.Printf("%s changes to %s: %d inserted, %d updated, %d deleted, %d unchanged.\n", verb, tableName, c.Inserted, c.Updated, c.Deleted, c.Unchanged)
+	}
+
+	if opts.incremental {
+		if err = checkpoint.Save(tx, state); err != nil {
+			return ragged, err
+		}
 	}
 
 	fmt.Printf("Successfully inserted %d rows into table '%s'.\n", insertedRows, tableName)
+	if ragged.Affected() > 0 {
+		fmt.Printf("Ragged rows in %s: %d padded, %d truncated, %d skipped.\n", filePath, ragged.Padded, ragged.Truncated, ragged.Skipped)
+	}
+	return ragged, nil
+}
+
+// seedKeys adds the keys of the rows already in table, loaded by earlier runs, to keys.
+func seedKeys(db *sql.DB, table string, keys *dedupe.Check, opts loadOptions) error {
+	cols := keys.Columns()
+	quoted := make([]string, len(cols))
+	for i, col := range cols {
+		if opts.encrypted(table, col) {
+			fmt.Printf("Key column %s.%s is encrypted, not checking keys against earlier runs.\n", table, col)
+			return nil
+		}
+		quoted[i] = "CAST(" + sqlitedb.Quote(col) + " AS TEXT)"
+	}
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ", "), sqlitedb.Quote(table)))
+	if err != nil {
+		return fmt.Errorf("failed to read keys of %s: %w", table, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	values := make([]sql.NullString, len(cols))
+	dest := make([]any, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	key := make([]string, len(cols))
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("failed to read keys of %s: %w", table, err)
+		}
+		for i, v := range values {
+			key[i] = v.String
+		}
+		keys.Existing(key)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read keys of %s: %w", table, err)
+	}
 	return nil
 }
 
+// resumeReader positions a reader for an incremental load of file, continuing after the
+// last checkpointed record and stopping at the last complete line so that a record still
+// being appended is picked up by the next run. The returned flag reports that rows from
+// earlier runs must be discarded because the file was truncated or its header changed.
+// dialect is the one the header was read with.
+func resumeReader(db *sql.DB, file *os.File, src discover.File, dialect csvio.Dialect, header []string, headerEnd int64, opts loadOptions) (csvio.Reader, checkpoint.State, bool, error) {
+	filePath := src.Path
+	key, err := filepath.Abs(filePath)
+	if err != nil {
+		key = filePath
+	}
+	end, err := checkpoint.CompleteEnd(file)
+	if err != nil {
+		return nil, checkpoint.State{}, false, fmt.Errorf("failed to inspect %s: %w", filePath, err)
+	}
+	state, found, err := checkpoint.Load(db, key)
+	if err != nil {
+		return nil, state, false, err
+	}
+
+	reset := false
+	if found && state.SameHeader(header) && state.Offset >= headerEnd && state.Offset <= end {
+		fmt.Printf("Resuming %s after row %d (byte %d).\n", filePath, state.Rows, state.Offset)
+	} else {
+		if found {
+			fmt.Printf("File %s was truncated or its header changed, reloading it from the start.\n", filePath)
+			reset = true
+		}
+		state.Offset = headerEnd
+		state.Rows = 0
+	}
+	state.Header = header
+
+	reader := newCSVReader(io.NewSectionReader(file, state.Offset, max(end-state.Offset, 0)), src, opts, &dialect)
+	return reader, state, reset, nil
+}
+
+// processWithRetry runs processCSVFile under the retry policy and, when every attempt
+// failed and a quarantine directory is configured, moves the file out of the source directory.
+func processWithRetry(ctx context.Context, db *sql.DB, policy retry.Policy, src discover.File, quarantineDir string, opts loadOptions) (csvio.RaggedRows, error) {
+	filePath := src.Origin()
+	var ragged csvio.RaggedRows
+	ctx, span := tracing.Start(ctx, "load", attribute.String("csvtools.input", filePath), attribute.String("csvtools.table", src.Table))
+	attempts := 0
+	err := policy.Do(ctx, func() error {
+		var err error
+		attempts++
+		ragged, err = processCSVFile(db, src, opts)
+		return err
+	})
+	span.SetAttributes(attribute.Int("csvtools.attempts", attempts))
+	tracing.End(span, err)
+	// The workbook of a sheet holds other sheets, so it stays where it is.
+	if err == nil || quarantineDir == "" || src.Source != "" {
+		return ragged, err
+	}
+	target, qErr := retry.Quarantine(filePath, quarantineDir)
+	if qErr != nil {
+		return ragged, fmt.Errorf("%w (%v)", err, qErr)
+	}
+	fmt.Printf("Quarantined %s to %s\n", filePath, target)
+	return ragged, err
+}
+
 func main() {
+	os.Exit(run())
+}
+
+// run loads the files and returns the process exit code; see package exitcode.
+func run() (code int) {
 	// Get source and destination directories from the flags passed
 	var sourceDir string
 	var destDir string
-	flag.StringVar(&sourceDir, "src", "", "Directory containing CSV files")
+	var quarantineDir string
+	var databaseFilePath string
+	opts := loadOptions{maxRecordSize: csvio.DefaultMaxRecordSize}
+	var headerFlags headers.Flags
+	var discovery discover.Options
+	var outputFlags atomicfile.Flags
+	policy := retry.DefaultPolicy
+	flag.StringVar(&sourceDir, "src", "", "Directory containing CSV files, gsheet://<spreadsheet-id> to read the tabs of a Google Sheets spreadsheet, or clipboard for a table on the system clipboard")
 	flag.StringVar(&destDir, "dest", "", "Directory containing SQLite db")
-	flag.Parse()
+	flag.IntVar(&policy.Attempts, "retries", policy.Attempts, "Attempts per file before giving up on transient failures")
+	flag.DurationVar(&policy.BaseDelay, "retry-delay", policy.BaseDelay, "Initial backoff between attempts, doubled on each retry")
+	flag.DurationVar(&policy.MaxDelay, "retry-max-delay", policy.MaxDelay, "Upper bound for the backoff between attempts")
+	flag.StringVar(&quarantineDir, "quarantine", "", "Directory to move files into after all attempts failed")
+	flag.StringVar(&databaseFilePath, "db", "", "SQLite db file to load into instead of a new timestamped one in dest")
+	flag.BoolVar(&opts.lenient, "lenient", false, "Recover from malformed records instead of failing the file")
+	opts.sniff.Register(flag.CommandLine)
+	opts.separator.Register(flag.CommandLine)
+	opts.skip.Register(flag.CommandLine)
+	opts.asserts.Register(flag.CommandLine)
+	opts.parallel.Register(flag.CommandLine)
+	flag.Var(&opts.ragged, "ragged", "Rows with a field count different from the header: pad, truncate, error or skip")
+	flag.Func("max-record-size", "Fail a file with a record larger than this, e.g. 512MB; 0 for no limit (default 64MB)", func(s string) (err error) {
+		opts.maxRecordSize, err = discover.ParseSize(s)
+		return err
+	})
+	var codec compress.Codec
+	flag.Var(&codec, "compress", "Also write the database compressed with gzip or zstd; a new database is then only kept compressed")
+	var optimize, readOnly bool
+	var pageSize int
+	flag.BoolVar(&optimize, "optimize", false, "After the load, run ANALYZE and VACUUM so the database is compact and its queries well planned")
+	flag.IntVar(&pageSize, "page-size", 0, "Rebuild the database with pages of this many bytes, a power of two from 512 to 65536; implies -optimize")
+	var artifactDir string
+	flag.StringVar(&artifactDir, "artifact", "", "Also package the database into this directory as a compressed, checksummed, read-only artifact with a metadata JSON; implies -optimize")
+	flag.BoolVar(&readOnly, "read-only", false, "Ship a new database read-only, for analysts to query; implies -optimize")
+	var encryptKeyFile string
+	var passphrase, passphraseFile string
+	flag.StringVar(&passphrase, "passphrase", "", "Write an SQLCipher database encrypted with this passphrase (prefer $CSVTOOLS_PASSPHRASE)")
+	flag.StringVar(&passphraseFile, "passphrase-file", "", "File holding the SQLCipher passphrase")
+	flag.Func("encrypt", "Comma separated columns (or table.column) to encrypt with AES-256-GCM", func(s string) error {
+		for _, name := range strings.Split(s, ",") {
+			opts.encrypt = append(opts.encrypt, strings.TrimSpace(name))
+		}
+		return nil
+	})
+	flag.StringVar(&encryptKeyFile, "encrypt-key-file", "", "File with the base64 encoded 32 byte key for -encrypt (default $"+colcrypt.KeyEnv+")")
+	flag.BoolVar(&opts.fast, "fast", false, "Bulk load: insert many rows per statement and, for a new database, skip journaling and fsync")
+	flag.Var(&opts.lineage, "lineage", "Add lineage columns to every table: row_number, source_file, loaded_at or all")
+	opts.surrogate.Register(flag.CommandLine)
+	flag.Var(&opts.cdc, "cdc", "Reload tables as changesets keyed on these columns, inserting, updating and deleting rows to match the file, e.g. id or orders:order_id for one table (repeatable)")
+	flag.StringVar(&opts.cdcDir, "cdc-dir", "", "Directory to write the changes of every -cdc file to, as <file>.changes.csv")
+	flag.BoolVar(&opts.cdcDryRun, "cdc-dry-run", false, "Compute and write the -cdc changes without applying them")
+	flag.Var(&opts.scd2, "scd2", "Keep tables as SCD2 history tables keyed on these business key columns, e.g. id or customers:customer_id,region for one table (repeatable)")
+	var keyTracker dedupe.Tracker
+	flag.Var(&keyTracker.Keys, "key", "Key columns to check for duplicates while loading, e.g. id or orders:order_id,line_no for one table (repeatable)")
+	flag.Var(&keyTracker.Policy, "duplicates", "Rows repeating a -key: report (load them), skip or error")
+	flag.StringVar(&keyTracker.Dir, "duplicates-dir", "", "Directory to write the rows repeating a -key to, as <file>.duplicates.csv")
+	var ddlOnly bool
+	flag.Var(&opts.ddl, "ddl-template", "Template file replacing the generated CREATE TABLE statements, or table=file for one table (repeatable)")
+	flag.BoolVar(&ddlOnly, "ddl-only", false, "Write the CREATE TABLE statements the load would run to a .sql file named like the database, without loading anything")
+	flag.BoolVar(&opts.incremental, "incremental", false, "Only load rows appended since the previous run (requires -db)")
+	flag.BoolVar(&opts.sanitize, "sanitize-names", false, "Restrict table and column names to letters, digits and underscores instead of quoting them")
+	opts.naming.Register(flag.CommandLine, "table")
+	var collision tableCollision
+	flag.Var(&collision, "table-collision", "Files that sanitize to the same table name: merge, suffix or error")
+	headerFlags.Register(flag.CommandLine)
+	opts.columnOrder.Register(flag.CommandLine)
+	discovery.Register(flag.CommandLine)
+	opts.workbooks.Register(flag.CommandLine)
+	opts.jsonFiles.Register(flag.CommandLine)
+	opts.xmlFiles.Register(flag.CommandLine)
+	opts.lakeFiles.Register(flag.CommandLine)
+	outputFlags.Register(flag.CommandLine)
+	var heartbeat health.Heartbeat
+	flag.StringVar(&heartbeat.Path, "heartbeat-file", "", "File to touch after every loaded file, for csvtools healthcheck")
+	var auditFlags audit.Flags
+	auditFlags.Register(flag.CommandLine)
+	var throttleFlags throttle.Flags
+	throttleFlags.Register(flag.CommandLine)
+	var lockFlags runlock.Flags
+	lockFlags.Register(flag.CommandLine)
+	var tempFlags tempdir.Flags
+	tempFlags.Register(flag.CommandLine)
+	if err := envflags.Parse(flag.CommandLine, os.Args[1:], envflags.Prefix); err != nil {
+		fmt.Printf("Error in environment: %v\n", err)
+		return exitcode.Usage
+	}
+	auditRun := auditFlags.Start("to_sqlite", os.Args[1:])
+	fmt.Printf("Run %s\n", auditRun.RunID)
+	flushTraces, err := tracing.Setup(context.Background(), "to_sqlite")
+	if err != nil {
+		fmt.Printf("Warning: tracing disabled: %v\n", err)
+		flushTraces = func(context.Context) error { return nil }
+	}
+	if opts.limiter, err = throttleFlags.Apply(); err != nil {
+		fmt.Printf("Warning: running at normal priority: %v\n", err)
+	}
+	runCtx, runSpan := tracing.Start(tracing.Parent(context.Background()), "to_sqlite", attribute.String("csvtools.run_id", auditRun.RunID))
+	defer func() {
+		runSpan.SetAttributes(attribute.Int("csvtools.exit_code", code))
+		tracing.End(runSpan, nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := flushTraces(ctx); err != nil {
+			fmt.Printf("Warning: failed to export traces: %v\n", err)
+		}
+	}()
+	defer func() {
+		if code == exitcode.OK || code == exitcode.Partial {
+			auditRun.Output = databaseFilePath
+		}
+		if err := auditRun.Finish(code, nil); err != nil {
+			fmt.Printf("Warning: failed to write the audit log: %v\n", err)
+		}
+	}()
 
-	if sourceDir == "" || destDir == "" {
+	opts.loadedAt = lineage.Timestamp(time.Now())
+	if len(keyTracker.Keys) > 0 {
+		opts.dedupe = &keyTracker
+	}
+	policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+		fmt.Printf("Attempt %d failed: %v; retrying in %s\n", attempt, err, delay.Round(time.Millisecond))
+	}
+	// Stop between files on SIGINT/SIGTERM; a new database is then discarded.
+	ctx, stop := signal.NotifyContext(runCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if (sourceDir == "" && discovery.Manifest == "") || (destDir == "" && databaseFilePath == "") {
 		fmt.Println("sourceDir and destDir are required")
-		os.Exit(1)
+		return exitcode.Usage
+	}
+	if opts.incremental && opts.workbooks.Enabled {
+		fmt.Println("-incremental cannot be combined with -xlsx: workbooks are loaded whole")
+		return exitcode.Usage
+	}
+	if opts.incremental && opts.jsonFiles.Enabled {
+		fmt.Println("-incremental cannot be combined with -json: JSON files are loaded whole")
+		return exitcode.Usage
+	}
+	if opts.incremental && opts.xmlFiles.Enabled {
+		fmt.Println("-incremental cannot be combined with -xml: XML files are loaded whole")
+		return exitcode.Usage
+	}
+	if opts.incremental && opts.lakeFiles.Enabled {
+		fmt.Println("-incremental cannot be combined with -parquet: Parquet and Arrow files are loaded whole")
+		return exitcode.Usage
+	}
+	if opts.incremental && gsheet.IsRef(sourceDir) {
+		fmt.Println("-incremental cannot be combined with a gsheet:// source: spreadsheets are loaded whole")
+		return exitcode.Usage
+	}
+	if opts.incremental && clipboard.Is(sourceDir) {
+		fmt.Println("-incremental cannot be combined with -src clipboard: the clipboard is loaded whole")
+		return exitcode.Usage
+	}
+	if len(opts.cdc) == 0 && (opts.cdcDir != "" || opts.cdcDryRun) {
+		fmt.Println("-cdc-dir and -cdc-dry-run need -cdc")
+		return exitcode.Usage
+	}
+	if len(opts.cdc) > 0 && (len(opts.scd2) > 0 || opts.incremental || len(keyTracker.Keys) > 0 || len(opts.encrypt) > 0) {
+		fmt.Println("-cdc cannot be combined with -scd2, -incremental, -key or -encrypt: changesets compare whole snapshots with tables holding one row per key")
+		return exitcode.Usage
+	}
+	if len(opts.scd2) > 0 && opts.incremental {
+		fmt.Println("-scd2 cannot be combined with -incremental: history tables are loaded from whole snapshots")
+		return exitcode.Usage
+	}
+	if len(opts.scd2) > 0 && len(keyTracker.Keys) > 0 {
+		fmt.Println("-scd2 cannot be combined with -key: history tables hold several versions of every key")
+		return exitcode.Usage
+	}
+	if len(opts.scd2) > 0 && len(opts.encrypt) > 0 {
+		fmt.Println("-scd2 cannot be combined with -encrypt: encrypted cells can't be compared between snapshots")
+		return exitcode.Usage
+	}
+	if clipboard.Is(destDir) {
+		fmt.Println("A database can't be put on the clipboard, use csvtools convert -to clipboard for a table")
+		return exitcode.Usage
+	}
+	opts.workbooks.Apply(&discovery)
+	opts.jsonFiles.Apply(&discovery)
+	opts.xmlFiles.Apply(&discovery)
+	opts.lakeFiles.Apply(&discovery)
+	if opts.incremental && databaseFilePath == "" {
+		fmt.Println("-incremental requires -db so that runs share one database")
+		return exitcode.Usage
+	}
+	if opts.headers, err = headerFlags.Normalizer(); err != nil {
+		fmt.Printf("Error in header options: %v\n", err)
+		return exitcode.Usage
+	}
+	opts.headerPolicy = headerFlags.Policy()
+	if err = opts.columnOrder.Load(); err != nil {
+		fmt.Printf("Error in column order: %v\n", err)
+		return exitcode.Usage
+	}
+	if err = opts.sniff.Load(); err == nil {
+		err = opts.separator.Load()
+	}
+	if err == nil {
+		err = opts.skip.Load()
+	}
+	if err == nil {
+		err = opts.asserts.Load()
+	}
+	if err == nil {
+		err = opts.parallel.Load()
+	}
+	if err != nil {
+		fmt.Printf("Error in dialect options: %v\n", err)
+		return exitcode.Usage
+	}
+	if opts.namer, err = opts.naming.Namer(); err != nil {
+		fmt.Printf("Error in naming options: %v\n", err)
+		return exitcode.Usage
+	}
+	if passphraseFile != "" {
+		data, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			fmt.Printf("Error reading passphrase: %v\n", err)
+			return exitcode.Usage
+		}
+		passphrase = strings.TrimRight(string(data), "\r\n")
+	}
+	if passphrase != "" && !sqlitedb.Encryption() {
+		fmt.Printf("Error: %v\n", sqlitedb.ErrNoCipher)
+		return exitcode.Usage
+	}
+	if pageSize != 0 && !sqlitedb.ValidPageSize(pageSize) {
+		fmt.Printf("-page-size must be a power of two from 512 to 65536, got %d\n", pageSize)
+		return exitcode.Usage
+	}
+	if pageSize != 0 && passphrase != "" {
+		fmt.Println("-page-size cannot change the page size of an encrypted database")
+		return exitcode.Usage
+	}
+	if readOnly && databaseFilePath != "" {
+		fmt.Println("-read-only needs a new database; a -db database is loaded into again by the next run")
+		return exitcode.Usage
+	}
+	optimize = optimize || pageSize != 0 || readOnly || artifactDir != ""
+	if len(opts.encrypt) > 0 {
+		key, err := colcrypt.LoadKey(encryptKeyFile)
+		if err == nil {
+			opts.cipher, err = colcrypt.New(key)
+		}
+		if err != nil {
+			fmt.Printf("Error in encryption options: %v\n", err)
+			return exitcode.Usage
+		}
+	}
+	existing, err := outputFlags.Policy()
+	if err != nil {
+		fmt.Printf("Error in output options: %v\n", err)
+		return exitcode.Usage
+	}
+	lockPath := filepath.Join(destDir, runlock.Name)
+	if databaseFilePath != "" {
+		lockPath = databaseFilePath + ".lock"
+	}
+	// SQLite spills big sorts and indexes, and workbook sheets are
+	// extracted, to the temp directory.
+	tmp, err := tempFlags.Open(auditRun.RunID)
+	if err == nil {
+		err = tempFlags.Check(filepath.Dir(lockPath))
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitcode.Failure
+	}
+	defer func() {
+		if err := tmp.Remove(); err != nil {
+			fmt.Printf("Warning: failed to clean up: %v\n", err)
+		}
+	}()
+	if ddlOnly {
+		files, err := findFiles(ctx, sourceDir, discovery, collision, opts)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return exitcode.Failure
+		}
+		if databaseFilePath == "" {
+			databaseFilePath = filepath.Join(destDir, fmt.Sprintf("%d", time.Now().Unix())+"_combined.db")
+		}
+		databaseFilePath = strings.TrimSuffix(databaseFilePath, filepath.Ext(databaseFilePath)) + ".sql"
+		if err = writeDDL(databaseFilePath, files, opts, existing); err != nil {
+			if errors.Is(err, atomicfile.ErrExists) && existing == atomicfile.NoClobber {
+				fmt.Printf("%s already exists, not overwriting.\n", databaseFilePath)
+				return exitcode.OK
+			}
+			fmt.Printf("Error: %v\n", err)
+			return exitcode.Failure
+		}
+		fmt.Printf("Wrote the statements creating the tables of %d files to %s.\n", len(files), databaseFilePath)
+		return exitcode.OK
+	}
+	// Runs into the same database, or the same destination, take turns.
+	lock, err := runlock.Acquire(lockPath, auditRun.RunID, lockFlags.Wait)
+	if errors.Is(err, runlock.ErrLocked) {
+		fmt.Printf("Error: %v; use -wait to wait for it\n", err)
+		return exitcode.Busy
+	} else if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitcode.Failure
+	}
+	defer func() {
+		_ = lock.Release()
+	}()
+	var output *atomicfile.File
+	if databaseFilePath == "" {
+		timestamp := fmt.Sprintf("%d", time.Now().Unix())
+		databaseFilePath = filepath.Join(destDir, timestamp+"_combined.db")
+		if err = atomicfile.Check(databaseFilePath+codec.Ext(), existing); err != nil {
+			if errors.Is(err, atomicfile.ErrExists) && existing == atomicfile.NoClobber {
+				fmt.Printf("Database %s already exists, not overwriting.\n", databaseFilePath)
+				return exitcode.OK
+			}
+			fmt.Printf("Error creating database: %v\n", err)
+			return exitcode.Failure
+		}
+		// A new database is built under a temp name and only renamed once every file is loaded.
+		if output, err = atomicfile.Create(databaseFilePath, existing); err != nil {
+			fmt.Printf("Error creating database: %v\n", err)
+			return exitcode.Failure
+		}
+		defer func() {
+			_ = output.Close()
+		}()
+	}
+	openPath := databaseFilePath
+	if output != nil {
+		openPath = output.Name()
+	} else if err = os.MkdirAll(filepath.Dir(databaseFilePath), 0o755); err != nil {
+		fmt.Printf("Error creating database directory: %v\n", err)
+		return exitcode.Failure
 	}
-	timestamp := fmt.Sprintf("%d", time.Now().Unix())
-	databaseFilePath := fmt.Sprintf("%s/%s_%s.db", destDir, timestamp, "combined")
 
 	// Open (or create) the SQLite database
-	db, err := sql.Open("sqlite3", databaseFilePath)
+	db, err := sqlitedb.Open(openPath, passphrase)
 	if err != nil {
 		fmt.Printf("Error opening database: %v\n", err)
-		return
+		return exitcode.Failure
 	}
 	defer func(db *sql.DB) {
 		_ = db.Close()
 	}(db)
 
 	// Ping the database to ensure connection is established
-	if err = db.Ping(); err != nil {
+	if err = policy.Do(ctx, db.Ping); err != nil {
 		fmt.Printf("Error connecting to database: %v\n", err)
-		return
+		return exitcode.Failure
 	}
 	fmt.Printf("Successfully connected to SQLite database: %s\n", databaseFilePath)
 
-	// Read all CSV files in the specified directory
-	files, err := os.ReadDir(sourceDir)
+	if opts.fast && output != nil {
+		// The new database is a temp file discarded on failure, so durability
+		// only matters once it is complete; Commit syncs it before the rename.
+		// The pragmas are per connection, so keep to one.
+		db.SetMaxOpenConns(1)
+		if _, err = db.Exec("PRAGMA journal_mode = OFF; PRAGMA synchronous = OFF"); err != nil {
+			fmt.Printf("Error configuring database for -fast: %v\n", err)
+			return exitcode.Failure
+		}
+	}
+
+	if opts.incremental {
+		if err = checkpoint.EnsureTable(db); err != nil {
+			fmt.Printf("Error preparing checkpoints: %v\n", err)
+			return exitcode.Failure
+		}
+	}
+
+	files, err := findFiles(ctx, sourceDir, discovery, collision, opts)
 	if err != nil {
-		fmt.Printf("Error reading CSV directory: %v\n", err)
-		return
+		fmt.Printf("Error: %v\n", err)
+		return exitcode.Failure
 	}
 
-	for _, fileInfo := range files {
-		if !fileInfo.IsDir() && strings.HasSuffix(fileInfo.Name(), ".csv") {
-			filePath := filepath.Join(sourceDir, fileInfo.Name())
-			err := processCSVFile(db, filePath)
-			if err != nil {
-				fmt.Printf("Error processing %s: %v\n", filePath, err)
+	var raggedTotal csvio.RaggedRows
+	var sources []artifact.Source
+	failed := 0
+	for _, src := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		ragged, err := processWithRetry(ctx, db, policy, src, quarantineDir, opts)
+		if errors.Is(err, csvio.ErrRowCount) {
+			// A suspicious row count says the export is broken, not the file.
+			fmt.Printf("Error processing %s: %v\nAborting, no database written.\n", src.Path, err)
+			return exitcode.Failure
+		}
+		if err != nil {
+			fmt.Printf("Error processing %s: %v\n", src.Path, err)
+			failed++
+		}
+		sources = append(sources, artifact.Source{Path: src.Origin(), Table: opts.tableName(src), Loaded: err == nil})
+		raggedTotal.Add(ragged)
+		if err := heartbeat.Beat(); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+	if ctx.Err() != nil {
+		fmt.Println("Interrupted, stopping.")
+		return exitcode.Interrupted
+	}
+
+	fmt.Printf("\nRagged rows: %d padded, %d truncated, %d skipped.\n", raggedTotal.Padded, raggedTotal.Truncated, raggedTotal.Skipped)
+
+	outcome := exitcode.OK
+	if failed > 0 {
+		outcome = exitcode.Partial
+	}
+	if err = auditRun.Save(db, len(files), failed, outcome); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitcode.Failure
+	}
+
+	if optimize {
+		_, span := tracing.Start(ctx, "optimize")
+		before := fileSize(openPath)
+		err = sqlitedb.Optimize(ctx, db, pageSize)
+		tracing.End(span, err)
+		if err != nil {
+			fmt.Printf("Error optimizing database: %v\n", err)
+			return exitcode.Failure
+		}
+		fmt.Printf("Optimized database: %s, from %s.\n", tempdir.FormatSize(fileSize(openPath)), tempdir.FormatSize(before))
+	}
+	if artifactDir != "" {
+		// The optimized database is whole in its file, so it is packaged
+		// from there while still open.
+		if err = packageArtifact(ctx, db, openPath, databaseFilePath, artifactDir, codec, auditRun.RunID, sources, opts, existing); err != nil {
+			fmt.Printf("Error packaging database: %v\n", err)
+			return exitcode.Failure
+		}
+	}
+
+	_, span := tracing.Start(ctx, "save", attribute.String("csvtools.output", databaseFilePath))
+	defer func() {
+		tracing.End(span, err)
+	}()
+	if output != nil {
+		if err = db.Close(); err == nil {
+			if codec == compress.None {
+				err = output.Commit()
+			} else {
+				databaseFilePath += codec.Ext()
+				err = saveCompressed(codec, output.Name(), databaseFilePath, existing)
 			}
 		}
+		if errors.Is(err, atomicfile.ErrExists) && existing == atomicfile.NoClobber {
+			fmt.Printf("Database %s already exists, not overwriting.\n", databaseFilePath)
+			return exitcode.OK
+		}
+		if err != nil {
+			fmt.Printf("Error saving database: %v\n", err)
+			return exitcode.Failure
+		}
 	}
 
+	if output == nil && codec != compress.None {
+		// A -db database stays in place for the next run; ship a compressed snapshot of it.
+		if err = db.Close(); err == nil {
+			err = saveCompressed(codec, databaseFilePath, databaseFilePath+codec.Ext(), atomicfile.Overwrite)
+		}
+		if err != nil {
+			fmt.Printf("Error compressing database: %v\n", err)
+			return exitcode.Failure
+		}
+		databaseFilePath += codec.Ext()
+	}
+	if codec != compress.None {
+		fmt.Printf("Compressed database written to %s\n", databaseFilePath)
+	}
+	if readOnly {
+		if err = os.Chmod(databaseFilePath, 0o444); err != nil {
+			fmt.Printf("Error making database read-only: %v\n", err)
+			return exitcode.Failure
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("\n%d of %d CSV files failed.\n", failed, len(files))
+		return exitcode.Partial
+	}
 	fmt.Println("\nAll CSV files processed. You can now inspect the database.")
+	return exitcode.OK
 }
@@ -0,0 +1,152 @@
+// These tests are run with the file they test, as src/cmd holds two
+// programs: go test src/cmd/to_sqlite.go src/cmd/to_sqlite_test.go
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"csvtools/src/internal/sqlitedb"
+)
+
+// hostileHeaders are header values of untrusted uploads. "a\x00b" and "ab"
+// must load into different columns.
+var hostileHeaders = []string{`"); DROP TABLE victim--`, `a"b`, "x; DELETE FROM victim;", "-- comment", "/* open", "日付", "Größe (kg)", "a\x00b", "ab"}
+
+// memoryDB opens an in-memory database on a single connection, as every
+// connection to :memory: has a database of its own.
+func memoryDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	db, err := sqlitedb.Open(":memory:", "")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	tb.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+// TestHostileHeaders runs the generated CREATE TABLE and INSERT statements
+// for a table and columns named after hostile headers, one row per
+// statement and batched as with -fast, and checks that the table survives
+// and the names round-trip exactly, NUL bytes replaced.
+func TestHostileHeaders(t *testing.T) {
+	for _, batch := range []int{1, 2} {
+		t.Run(fmt.Sprintf("batch=%d", batch), func(t *testing.T) {
+			db := memoryDB(t)
+			if _, err := db.Exec(`CREATE TABLE victim (id INTEGER); INSERT INTO victim VALUES (1)`); err != nil {
+				t.Fatal(err)
+			}
+			var opts loadOptions
+			table := opts.identifier(`"); DROP TABLE victim--`)
+			columns := make([]string, len(hostileHeaders))
+			for i, h := range hostileHeaders {
+				columns[i] = opts.identifier(h)
+			}
+			create, err := opts.createTable(table, columns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec(create); err != nil {
+				t.Fatalf("%s: %v", create, err)
+			}
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			inserter := newBatchInserter(tx, table, columns, batch)
+			row := make([]interface{}, len(columns))
+			for i, c := range columns {
+				row[i] = c
+			}
+			for range 3 {
+				if err := inserter.add(row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := inserter.flush(); err != nil {
+				t.Fatal(err)
+			}
+			inserter.close()
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+
+			var rows int
+			if err := db.QueryRow(`SELECT count(*) FROM victim`).Scan(&rows); err != nil || rows != 1 {
+				t.Errorf("victim has %d rows (%v), want 1", rows, err)
+			}
+			if err := db.QueryRow(`SELECT count(*) FROM ` + sqlitedb.Quote(table)).Scan(&rows); err != nil || rows != 3 {
+				t.Errorf("table %q has %d rows (%v), want 3", table, rows, err)
+			}
+			for i, h := range hostileHeaders {
+				var name string
+				if err := db.QueryRow(`SELECT name FROM pragma_table_info(?) WHERE cid = ?`, table, i).Scan(&name); err != nil {
+					t.Fatalf("column %d of %q: %v", i, table, err)
+				}
+				if want := sqlitedb.Name(h); name != want {
+					t.Errorf("column %d = %q, want %q", i, name, want)
+				}
+				var value string
+				query := "SELECT " + sqlitedb.Quote(h) + " FROM " + sqlitedb.Quote(table) + " LIMIT 1"
+				if err := db.QueryRow(query).Scan(&value); err != nil || value != columns[i] {
+					t.Errorf("%s = %q (%v), want %q", query, value, err, columns[i])
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkInsert loads rows into a table one per statement and batched as
+// with -fast.
+func BenchmarkInsert(b *testing.B) {
+	const rows = 10000
+	columns := []string{"id", "name", "amount", "date", "note"}
+	for _, bench := range []struct {
+		name  string
+		batch int
+	}{
+		{"per_row", 1},
+		{"fast", min(fastBatchRows, maxBindVariables/len(columns))},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			db := memoryDB(b)
+			var opts loadOptions
+			create, err := opts.createTable("bench", columns)
+			if err != nil {
+				b.Fatal(err)
+			}
+			row := make([]interface{}, len(columns))
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := db.Exec(`DROP TABLE IF EXISTS bench; ` + create); err != nil {
+					b.Fatal(err)
+				}
+				tx, err := db.Begin()
+				if err != nil {
+					b.Fatal(err)
+				}
+				inserter := newBatchInserter(tx, "bench", columns, bench.batch)
+				for i := range rows {
+					row[0], row[1], row[2], row[3], row[4] = strconv.Itoa(i), "customer", "12.50", "2024-01-31", "a note"
+					if err := inserter.add(row); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := inserter.flush(); err != nil {
+					b.Fatal(err)
+				}
+				inserter.close()
+				if err := tx.Commit(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,14 +1,43 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/audit"
+	"csvtools/src/internal/clipboard"
+	"csvtools/src/internal/columnar"
+	"csvtools/src/internal/compress"
+	"csvtools/src/internal/csvio"
+	"csvtools/src/internal/discover"
+	"csvtools/src/internal/envflags"
+	"csvtools/src/internal/exitcode"
+	"csvtools/src/internal/flatjson"
+	"csvtools/src/internal/gsheet"
+	"csvtools/src/internal/headers"
+	"csvtools/src/internal/health"
+	"csvtools/src/internal/naming"
+	"csvtools/src/internal/retry"
+	"csvtools/src/internal/runlock"
+	"csvtools/src/internal/tempdir"
+	"csvtools/src/internal/throttle"
+	"csvtools/src/internal/tracing"
+	"csvtools/src/internal/version"
+	"csvtools/src/internal/xlsx"
+	"csvtools/src/internal/xmlpath"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/xuri/excelize/v2"
-	"io/ioutil"
+	"go.opentelemetry.io/otel/attribute"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -16,26 +45,268 @@ func main() {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	var srcDir string
 	var destDir string
-	flag.StringVar(&srcDir, "src", "unknown", "source directory for csv files")
+	var quarantineDir string
+	var headerFlags headers.Flags
+	opts := sheetOptions{maxRecordSize: csvio.DefaultMaxRecordSize, direction: "ltr"}
+	var discovery discover.Options
+	var outputFlags atomicfile.Flags
+	policy := retry.DefaultPolicy
+	flag.StringVar(&srcDir, "src", "unknown", "source directory for csv files, gsheet://<spreadsheet-id> to read the tabs of a Google Sheets spreadsheet, or clipboard for a table on the system clipboard")
 	flag.StringVar(&destDir, "dest", "unknown", "destination directory for xlsx file")
+	flag.IntVar(&policy.Attempts, "retries", policy.Attempts, "attempts per file before giving up on transient failures")
+	flag.DurationVar(&policy.BaseDelay, "retry-delay", policy.BaseDelay, "initial backoff between attempts, doubled on each retry")
+	flag.DurationVar(&policy.MaxDelay, "retry-max-delay", policy.MaxDelay, "upper bound for the backoff between attempts")
+	flag.StringVar(&quarantineDir, "quarantine", "", "directory to move csv files into after all attempts failed")
+	flag.BoolVar(&opts.lenient, "lenient", false, "recover from malformed records instead of failing the file")
+	opts.sniff.Register(flag.CommandLine)
+	opts.separator.Register(flag.CommandLine)
+	opts.skip.Register(flag.CommandLine)
+	opts.asserts.Register(flag.CommandLine)
+	opts.parallel.Register(flag.CommandLine)
+	flag.Func("max-record-size", "fail a file with a record larger than this, e.g. 512MB; 0 for no limit (default 64MB)", func(s string) (err error) {
+		opts.maxRecordSize, err = discover.ParseSize(s)
+		return err
+	})
+	flag.Var(&opts.formats, "format", "number formats per column, e.g. \"amount:#,##0.00;date:yyyy-mm-dd\" (repeatable)")
+	flag.Var(&opts.totals, "totals", "append totals rows for numeric columns: comma separated sum, avg, count, min, max")
+	flag.BoolVar(&opts.totalsFormulas, "totals-formulas", false, "write totals as live SUBTOTAL formulas and numeric cells as numbers")
+	flag.Func("totals-columns", "comma separated columns to total (default every numeric column but key-like ones such as id or customer_id)", func(s string) error {
+		opts.totalsColumns = strings.Split(s, ",")
+		return nil
+	})
+	var notesPath string
+	flag.StringVar(&notesPath, "notes", "", "csv sidecar of sheet,target,comment rows attaching notes to columns or cells")
+	flag.StringVar(&opts.noteAuthor, "note-author", "csvtools", "author shown on notes added with -notes")
+	flag.Var(&opts.direction, "direction", "sheet layout: ltr, rtl, or auto for right-to-left when the header is mostly Arabic, Hebrew, ...")
+	flag.Var(&opts.ragged, "ragged", "rows with a field count different from the header: pad, truncate, error or skip")
+	headerFlags.Register(flag.CommandLine)
+	opts.columnOrder.Register(flag.CommandLine)
+	discovery.Register(flag.CommandLine)
+	var workbooks xlsx.InputFlags
+	workbooks.Register(flag.CommandLine)
+	var jsonFiles flatjson.InputFlags
+	jsonFiles.Register(flag.CommandLine)
+	var xmlFiles xmlpath.InputFlags
+	xmlFiles.Register(flag.CommandLine)
+	var lakeFiles columnar.InputFlags
+	lakeFiles.Register(flag.CommandLine)
+	outputFlags.Register(flag.CommandLine)
+	var codec compress.Codec
+	flag.Var(&codec, "compress", "compress the xlsx file with gzip or zstd, e.g. for upload to an object store")
+	var props xlsx.Properties
+	props.Register(flag.CommandLine)
+	var auditFlags audit.Flags
+	auditFlags.Register(flag.CommandLine)
+	var throttleFlags throttle.Flags
+	throttleFlags.Register(flag.CommandLine)
+	var lockFlags runlock.Flags
+	lockFlags.Register(flag.CommandLine)
+	var tempFlags tempdir.Flags
+	tempFlags.Register(flag.CommandLine)
+	var nameFlags naming.Flags
+	nameFlags.Register(flag.CommandLine, "sheet")
+	var heartbeat health.Heartbeat
+	flag.StringVar(&heartbeat.Path, "heartbeat-file", "", "file to touch after every written sheet, for csvtools healthcheck")
 
-	flag.Parse()
+	if err := envflags.Parse(flag.CommandLine, os.Args[1:], envflags.Prefix); err != nil {
+		logger.Error("🧨  Invalid environment", "error", err)
+		os.Exit(exitcode.Usage)
+	}
+	run := auditFlags.Start("to_xlsx", os.Args[1:])
+	logger = logger.With("run_id", run.RunID)
+	flushTraces, err := tracing.Setup(context.Background(), "to_xlsx")
+	if err != nil {
+		logger.Warn("⚠️  Tracing disabled", "error", err)
+		flushTraces = func(context.Context) error { return nil }
+	}
+	if opts.limiter, err = throttleFlags.Apply(); err != nil {
+		logger.Warn("⚠️  Running at normal priority", "error", err)
+	}
+	runCtx, runSpan := tracing.Start(tracing.Parent(context.Background()), "to_xlsx", attribute.String("csvtools.run_id", run.RunID))
+	// tmp is the temp directory of the run, once created.
+	var tmp *tempdir.Dir
+	// exit ends the run with code, recording it in the trace and the audit log.
+	// os.Exit skips deferred calls, so the temp directory is removed here.
+	exit := func(code int) {
+		if err := tmp.Remove(); err != nil {
+			logger.Warn("⚠️  Failed to clean up", "error", err)
+		}
+		runSpan.SetAttributes(attribute.Int("csvtools.exit_code", code))
+		tracing.End(runSpan, nil)
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := flushTraces(flushCtx); err != nil {
+			logger.Warn("⚠️  Failed to export traces", "error", err)
+		}
+		cancel()
+		if err := run.Finish(code, nil); err != nil {
+			logger.Warn("⚠️  Failed to write the audit log", "error", err)
+		}
+		os.Exit(code)
+	}
 
-	if srcDir == "unknown" || destDir == "unknown" {
+	policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+		logger.Warn("🔁  Retrying after failure", "attempt", attempt, "delay", delay.Round(time.Millisecond), "error", err)
+	}
+	// Stop between sheets on SIGINT/SIGTERM; nothing is written then.
+	ctx, stop := signal.NotifyContext(runCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if (srcDir == "unknown" && discovery.Manifest == "") || destDir == "unknown" {
 		logger.Error("🧨  src and dst are required")
-		os.Exit(1)
+		exit(exitcode.Usage)
+	}
+	if clipboard.Is(destDir) {
+		logger.Error("🧨  A workbook can't be put on the clipboard, use csvtools convert -to clipboard for a table")
+		exit(exitcode.Usage)
 	}
 
 	logger.Info("ℹ️ Using srcDir and destDir", "srcDir", srcDir, "destDir", destDir)
 
-	fileMetadata, err := getFileNames(srcDir)
+	if opts.headers, err = headerFlags.Normalizer(); err != nil {
+		logger.Error("🧨  Invalid header options", "error", err)
+		exit(exitcode.Usage)
+	}
+	opts.headerPolicy = headerFlags.Policy()
+	if err = opts.columnOrder.Load(); err != nil {
+		logger.Error("🧨  Invalid column order", "error", err)
+		exit(exitcode.Usage)
+	}
+	if err = opts.sniff.Load(); err == nil {
+		err = opts.separator.Load()
+	}
+	if err == nil {
+		err = opts.skip.Load()
+	}
+	if err == nil {
+		err = opts.asserts.Load()
+	}
+	if err == nil {
+		err = opts.parallel.Load()
+	}
+	if err != nil {
+		logger.Error("🧨  Invalid dialect options", "error", err)
+		exit(exitcode.Usage)
+	}
+	namer, err := nameFlags.Namer()
+	if err != nil {
+		logger.Error("🧨  Invalid naming options", "error", err)
+		exit(exitcode.Usage)
+	}
+	if notesPath != "" {
+		if opts.notes, err = xlsx.LoadNotes(notesPath); err != nil {
+			logger.Error("🧨  Invalid notes", "error", err)
+			exit(exitcode.Usage)
+		}
+	}
+
+	existing, err := outputFlags.Policy()
+	if err != nil {
+		logger.Error("🧨  Invalid output options", "error", err)
+		exit(exitcode.Usage)
+	}
+	currDt := fmt.Sprintf("%d", time.Now().Unix())
+	xlsxFileSavePath := filepath.Join(destDir, "output_"+currDt+".xlsx"+codec.Ext())
+	run.Output = xlsxFileSavePath
+	if err := atomicfile.Check(xlsxFileSavePath, existing); err != nil {
+		if errors.Is(err, atomicfile.ErrExists) && existing == atomicfile.NoClobber {
+			logger.Info("⏭️  Output file exists, not overwriting", "file", xlsxFileSavePath)
+			exit(exitcode.OK)
+		}
+		logger.Error("🧨  Cannot write output file", "error", err)
+		exit(exitcode.Failure)
+	}
+	// Runs into the same destination take turns.
+	lock, err := runlock.Acquire(filepath.Join(destDir, runlock.Name), run.RunID, lockFlags.Wait)
+	if errors.Is(err, runlock.ErrLocked) {
+		logger.Error("🔒  Destination busy", "error", err, "hint", "use -wait to wait for it")
+		exit(exitcode.Busy)
+	} else if err != nil {
+		logger.Error("🧨  Cannot lock destination", "error", err)
+		exit(exitcode.Failure)
+	}
+	defer func() {
+		_ = lock.Release()
+	}()
+	// Streamed sheets spill to the temp directory before the workbook is saved.
+	if tmp, err = tempFlags.Open(run.RunID); err == nil {
+		err = tempFlags.Check(destDir)
+	}
+	if errors.Is(err, tempdir.ErrLowSpace) {
+		logger.Error("💾  Low on disk space", "error", err)
+		exit(exitcode.Failure)
+	} else if err != nil {
+		logger.Error("🧨  Cannot create temp directory", "error", err)
+		exit(exitcode.Failure)
+	}
+
+	opts.onRecover = func(path string, rec csvio.Recovery) {
+		logger.Warn("🩹  Recovered malformed record", "file", path, "line", rec.Line, "reason", rec.Reason)
+	}
+	// A -format column only has to be in some of the sheets.
+	formatted := make(map[string]bool)
+	opts.onFormats = func(sheet string, missing []string) {
+		for _, name := range missing {
+			logger.Warn("⚠️  Format column not in sheet", "sheet", sheet, "column", name)
+		}
+		for _, name := range opts.formats.Names() {
+			if !slices.Contains(missing, name) {
+				formatted[name] = true
+			}
+		}
+	}
+	opts.onDialect = func(path string, d csvio.Dialect) {
+		logger.Info("👃  Sniffed dialect", "file", path, "dialect", d.String())
+	}
+	discovery.OnSkip = func(path, reason string) {
+		logger.Warn("⚠️  Skipping path", "path", path, "reason", reason)
+	}
+	workbooks.Apply(&discovery)
+	jsonFiles.Apply(&discovery)
+	xmlFiles.Apply(&discovery)
+	lakeFiles.Apply(&discovery)
+	_, span := tracing.Start(ctx, "discover", attribute.String("csvtools.source", srcDir))
+	var fileMetadata []discover.File
+	if gsheet.IsRef(srcDir) {
+		fileMetadata, err = gsheet.Files(ctx, srcDir, tmp.Path)
+	} else if clipboard.Is(srcDir) {
+		var file discover.File
+		if file, err = clipboard.File(ctx, tmp.Path); err == nil {
+			fileMetadata = []discover.File{file}
+		}
+	} else {
+		fileMetadata, err = discover.Find(srcDir, discovery)
+	}
+	span.SetAttributes(attribute.Int("csvtools.inputs", len(fileMetadata)))
+	tracing.End(span, err)
 	if err != nil {
 		logger.Error("🧨  Failed to get names of CSV files", "error", err)
-		os.Exit(1)
+		exit(exitcode.Failure)
+	}
+	if fileMetadata, err = workbooks.Expand(fileMetadata, tmp.Path); err != nil {
+		logger.Error("🧨  Failed to read workbook", "error", err)
+		exit(exitcode.Failure)
+	}
+	if fileMetadata, err = jsonFiles.Expand(fileMetadata, tmp.Path); err != nil {
+		logger.Error("🧨  Failed to read JSON file", "error", err)
+		exit(exitcode.Failure)
+	}
+	if fileMetadata, err = xmlFiles.Expand(fileMetadata, tmp.Path); err != nil {
+		logger.Error("🧨  Failed to read XML file", "error", err)
+		exit(exitcode.Failure)
+	}
+	if fileMetadata, err = lakeFiles.Expand(fileMetadata, tmp.Path); err != nil {
+		logger.Error("🧨  Failed to read Parquet or Arrow file", "error", err)
+		exit(exitcode.Failure)
 	}
 	if len(fileMetadata) == 0 {
 		logger.Error("🧨  No CSV files found")
-		os.Exit(1)
+		exit(exitcode.Failure)
+	}
+	if namer != nil {
+		if err := nameSheets(fileMetadata, namer, opts); err != nil {
+			logger.Error("🧨  Failed to name sheets", "error", err)
+			exit(exitcode.Failure)
+		}
 	}
 
 	xlsxFile := excelize.NewFile()
@@ -46,82 +317,324 @@ func main() {
 		}
 	}()
 
+	var raggedTotal csvio.RaggedRows
+	var sheetNames xlsx.SheetNames
 	for _, fileMetadatum := range fileMetadata {
-		sheetName := fileMetadatum.NameWithoutExt
-		logger.Info("🔍  Reading file", "file", fileMetadatum.FullPath)
+		if ctx.Err() != nil {
+			logger.Warn("🛑  Interrupted, no xlsx file written")
+			exit(exitcode.Interrupted)
+		}
+		sheetName := fileMetadatum.Name
+		if fileMetadatum.Sheet != "" {
+			sheetName = fileMetadatum.Sheet
+		}
+		sheetName = sheetNames.Name(sheetName)
+		logger.Info("🔍  Reading file", "file", fileMetadatum.Origin())
 		logger.Info("✏️  Writing to sheet", "sheet", sheetName)
-		_, err := xlsxFile.NewSheet(sheetName)
-		if err != nil {
-			logger.Error("🧨  Failed to create sheet", "sheet", sheetName, "error", err)
-			os.Exit(1)
+		var ragged csvio.RaggedRows
+		sheetCtx, span := tracing.Start(ctx, "sheet",
+			attribute.String("csvtools.input", fileMetadatum.Origin()), attribute.String("csvtools.sheet", sheetName))
+		err := policy.Do(sheetCtx, func() error {
+			var err error
+			ragged, err = writeSheet(xlsxFile, sheetName, fileMetadatum, opts)
+			return err
+		})
+		tracing.End(span, err)
+		if err != nil && ctx.Err() != nil {
+			logger.Warn("🛑  Interrupted, no xlsx file written")
+			exit(exitcode.Interrupted)
 		}
-		csvFile, err := os.Open(fileMetadatum.FullPath)
 		if err != nil {
-			logger.Error("🧨  Failed to open csvFile", "file", fileMetadatum.FullPath, "error", err)
-			os.Exit(1)
-		}
-
-		rowIdx := 1
-		scanner := bufio.NewScanner(csvFile)
-		for scanner.Scan() {
-			line := scanner.Text()
-			cells := strings.Split(line, ",")
-			cellIdx := 1
-			for _, cell := range cells {
-				cellRef, _ := excelize.CoordinatesToCellName(cellIdx, rowIdx)
-				if err := xlsxFile.SetCellStr(sheetName, cellRef, cell); err != nil {
-					logger.Error("🧨  Failed to set cell value", "error", err)
-					os.Exit(1)
+			logger.Error("🧨  Failed to write sheet", "sheet", sheetName, "file", fileMetadatum.Origin(), "error", err)
+			// The workbook of a sheet holds other sheets, so it stays where it is.
+			if quarantineDir != "" && fileMetadatum.Source == "" {
+				if target, qErr := retry.Quarantine(fileMetadatum.Path, quarantineDir); qErr != nil {
+					logger.Error("🧨  Failed to quarantine file", "file", fileMetadatum.Path, "error", qErr)
+				} else {
+					logger.Warn("🚧  Quarantined file", "file", fileMetadatum.Path, "target", target)
 				}
-				cellIdx++
 			}
-			rowIdx++
-		}
-		if err := scanner.Err(); err != nil {
-			logger.Error("🧨  Error reading csvFile", "file", fileMetadatum.FullPath, "error", err)
-			os.Exit(1)
+			exit(exitcode.Failure)
 		}
-		err = csvFile.Close()
-		if err != nil {
-			logger.Error("🧨  Failed to close csvFile", "file", fileMetadatum.FullPath, "error", err)
-			os.Exit(1)
+		if ragged.Affected() > 0 {
+			logger.Warn("📐  Ragged rows", "sheet", sheetName, "padded", ragged.Padded, "truncated", ragged.Truncated, "skipped", ragged.Skipped)
 		}
+		raggedTotal.Add(ragged)
 		logger.Info("✅  Successfully written sheet", "sheet", sheetName)
+		if err := heartbeat.Beat(); err != nil {
+			logger.Warn("⚠️  Failed to write heartbeat", "error", err)
+		}
 	}
+	for _, name := range opts.formats.Names() {
+		if !formatted[name] {
+			logger.Error("🧨  Format column not in any sheet", "column", name)
+			exit(exitcode.Usage)
+		}
+	}
+	logger.Info("📐  Ragged rows in all sheets", "padded", raggedTotal.Padded, "truncated", raggedTotal.Truncated, "skipped", raggedTotal.Skipped)
 
-	_ = xlsxFile.DeleteSheet("Sheet1")
+	if !sheetNames.Taken("Sheet1") {
+		_ = xlsxFile.DeleteSheet("Sheet1")
+	}
 
-	currDt := fmt.Sprintf("%d", time.Now().Unix())
-	xlsxFileSavePath := destDir + "/output_" + currDt + ".xlsx"
-	err = xlsxFile.SaveAs(xlsxFileSavePath)
+	source := map[string]string{"CsvtoolsCommit": version.Revision(), "RunID": run.RunID}
+	if discovery.Manifest != "" {
+		source["Manifest"], _ = filepath.Abs(discovery.Manifest)
+	} else if gsheet.IsRef(srcDir) {
+		source["Spreadsheet"] = srcDir
+	} else if !clipboard.Is(srcDir) {
+		source["SourceDirectory"], _ = filepath.Abs(srcDir)
+	}
+	for name, value := range source {
+		if _, set := props.Custom[name]; !set {
+			_ = props.Custom.Set(name + "=" + value)
+		}
+	}
+	if err := props.Apply(xlsxFile); err != nil {
+		logger.Error("🧨  Failed to set workbook properties", "error", err)
+		exit(exitcode.Failure)
+	}
+
+	// Write to a temp file and rename it so nothing watching destDir picks up a partial file.
+	_, span = tracing.Start(ctx, "save", attribute.String("csvtools.output", xlsxFileSavePath))
+	out, err := atomicfile.Create(xlsxFileSavePath, existing)
 	if err != nil {
 		logger.Error("🧨  Failed to save xlsx file", "error", err)
-		os.Exit(1)
+		exit(exitcode.Failure)
+	}
+	zw, err := codec.NewWriter(out)
+	if err == nil {
+		err = xlsxFile.Write(zw)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = out.Commit()
+	}
+	tracing.End(span, err)
+	if err != nil {
+		_ = out.Close()
+		if errors.Is(err, atomicfile.ErrExists) && existing == atomicfile.NoClobber {
+			logger.Info("⏭️  Output file exists, not overwriting", "file", xlsxFileSavePath)
+			exit(exitcode.OK)
+		}
+		logger.Error("🧨  Failed to save xlsx file", "error", err)
+		exit(exitcode.Failure)
 	}
 	logger.Info("✅ Excel file created", "file", xlsxFileSavePath)
+	exit(exitcode.OK)
 }
 
-type FileMetadata struct {
-	NameWithoutExt string
-	FullPath       string
+// sheetOptions holds the command line settings that change how a csv file becomes a sheet.
+type sheetOptions struct {
+	headers       headers.Normalizer
+	headerPolicy  headers.Policy
+	columnOrder   headers.ColumnOrder
+	ragged        csvio.RaggedPolicy
+	lenient       bool
+	maxRecordSize int64
+	onRecover     func(path string, rec csvio.Recovery)
+	// limiter caps the bandwidth the files are read with.
+	limiter *throttle.Limiter
+	// sniff guesses the dialect of every file; onDialect reports it.
+	sniff     csvio.SniffFlags
+	separator csvio.SeparatorFlags
+	skip      csvio.SkipFlags
+	asserts   csvio.AssertFlags
+	parallel  csvio.ParallelFlags
+	onDialect func(path string, d csvio.Dialect)
+	// totals appends a row per aggregate below the data; totalsFormulas makes them live formulas.
+	totals         xlsx.Aggregates
+	totalsFormulas bool
+	totalsColumns  []string
+	// formats are the number formats per column; onFormats reports the
+	// columns they name that a sheet lacks.
+	formats   xlsx.Formats
+	onFormats func(sheet string, missing []string)
+	// notes are attached to header or data cells once the sheet is written.
+	notes      []xlsx.Note
+	noteAuthor string
+	// direction lays sheets out left to right or right to left.
+	direction xlsx.Direction
 }
 
-func getFileNames(directory string) ([]FileMetadata, error) {
-	files, err := ioutil.ReadDir(directory)
+// readOptions returns how the csv file src is read.
+func readOptions(src discover.File, opts sheetOptions) csvio.Options {
+	path := src.Origin()
+	readOpts := csvio.Options{
+		Comma:         src.Delimiter,
+		FixedComma:    src.FixedDelimiter,
+		Lenient:       opts.lenient,
+		MaxRecordSize: opts.maxRecordSize,
+		OnRecover: func(rec csvio.Recovery) {
+			opts.onRecover(path, rec)
+		},
+	}
+	opts.sniff.Apply(&readOpts)
+	if src.Source != "" {
+		// Extracted and converted files are written with a header row.
+		readOpts.FixedComma, readOpts.Header = true, csvio.HeaderPresent
+	}
+	opts.separator.Apply(&readOpts)
+	opts.skip.Apply(&readOpts)
+	opts.asserts.Apply(&readOpts, path)
+	opts.parallel.Apply(&readOpts)
+	if readOpts.Sniff {
+		readOpts.OnDialect = func(d csvio.Dialect) {
+			opts.onDialect(path, d)
+		}
+	}
+	return readOpts
+}
+
+// nameSheets names the sheets of the files the manifest doesn't name with
+// the -name-template, reading the start of a file for templates using its
+// cells.
+func nameSheets(files []discover.File, namer *naming.Namer, opts sheetOptions) error {
+	for i, src := range files {
+		if src.Sheet != "" {
+			continue
+		}
+		name, err := namer.Name(src, func(n int) ([][]string, error) {
+			f, err := os.Open(src.Path)
+			if err != nil {
+				return nil, err
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			readOpts := readOptions(src, opts)
+			readOpts.OnDialect = nil
+			return naming.Head(csvio.NewReader(f, readOpts), n)
+		})
+		if err != nil {
+			return err
+		}
+		files[i].Sheet = name
+	}
+	return nil
+}
+
+// writeSheet copies the csv file src into sheetName and returns the counts of ragged rows
+// handled. The sheet is recreated on every call so that a retried attempt does not leave
+// cells behind from a previous one.
+func writeSheet(xlsxFile *excelize.File, sheetName string, src discover.File, opts sheetOptions) (ragged csvio.RaggedRows, err error) {
+	path := src.Origin()
+	if idx, _ := xlsxFile.GetSheetIndex(sheetName); idx != -1 {
+		if err := xlsxFile.DeleteSheet(sheetName); err != nil {
+			return ragged, fmt.Errorf("failed to reset sheet %s: %w", sheetName, err)
+		}
+	}
+	if _, err := xlsxFile.NewSheet(sheetName); err != nil {
+		return ragged, retry.Permanent(fmt.Errorf("failed to create sheet %s: %w", sheetName, err))
+	}
+	csvFile, err := os.Open(src.Path)
 	if err != nil {
-		return nil, err
-	}
-	var csvFiles []FileMetadata
-	for _, file := range files {
-		if !file.IsDir() {
-			name := file.Name()
-			if len(name) > 4 && name[len(name)-4:] == ".csv" {
-				csvFiles = append(csvFiles, FileMetadata{
-					NameWithoutExt: name[:len(name)-4],
-					FullPath:       directory + "/" + name,
-				})
+		return ragged, fmt.Errorf("failed to open csvFile %s: %w", path, err)
+	}
+	defer func() {
+		_ = csvFile.Close()
+	}()
+
+	ragged.Policy = opts.ragged
+	reader := csvio.NewReader(opts.limiter.Reader(csvFile), readOptions(src, opts))
+	totals := xlsx.Totals{Aggregates: opts.totals, Formulas: opts.totalsFormulas, Columns: opts.totalsColumns}
+	var columns map[int]*xlsx.Column
+	var header, columnNames []string
+	var perm []int
+	rowIdx := 1
+	for dataRow := 0; ; dataRow++ {
+		cells, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ragged, fmt.Errorf("error reading csvFile %s: %w", path, err)
+		}
+		if rowIdx == 1 {
+			if cells, err = opts.headerPolicy.Fix(opts.headers.Apply(cells)); err != nil {
+				return ragged, retry.Permanent(fmt.Errorf("%s: %w", path, err))
+			}
+			perm = opts.columnOrder.Permutation(cells)
+			cells = headers.Reorder(cells, perm)
+			ragged.Width = len(cells)
+			header = cells
+			totals.Header = header
+			var missing []string
+			if columns, missing, err = opts.formats.Columns(xlsxFile, cells); err != nil {
+				return ragged, retry.Permanent(fmt.Errorf("%s: %w", path, err))
 			}
+			if opts.onFormats != nil {
+				opts.onFormats(sheetName, missing)
+			}
+			totals.NumFmt = make(map[int]string, len(columns))
+			for i, c := range columns {
+				if !c.Date {
+					totals.NumFmt[i] = c.Format
+				}
+			}
+		} else {
+			var keep bool
+			if cells, keep, err = ragged.Fix(cells, dataRow); err != nil {
+				return ragged, retry.Permanent(fmt.Errorf("%s: %w", path, err))
+			}
+			if !keep {
+				continue
+			}
+			if perm != nil {
+				cells = headers.Reorder(cells, perm)
+			}
+		}
+		if rowIdx > 1 && totals.Enabled() {
+			totals.Observe(cells)
+		}
+		// Column letters are worked out once, not for every cell.
+		for len(columnNames) < len(cells) {
+			name, _ := excelize.ColumnNumberToName(len(columnNames) + 1)
+			columnNames = append(columnNames, name)
+		}
+		row := strconv.Itoa(rowIdx)
+		for i, cell := range cells {
+			cellRef := columnNames[i] + row
+			var column *xlsx.Column
+			if rowIdx > 1 {
+				column = columns[i]
+			}
+			if err := setCell(xlsxFile, sheetName, cellRef, cell, column, rowIdx > 1 && totals.Formulas); err != nil {
+				return ragged, retry.Permanent(fmt.Errorf("failed to set cell value: %w", err))
+			}
+		}
+		rowIdx++
+	}
+	if err := totals.Write(xlsxFile, sheetName, 2, rowIdx-1); err != nil {
+		return ragged, retry.Permanent(fmt.Errorf("failed to write totals of sheet %s: %w", sheetName, err))
+	}
+	if err := xlsx.AddNotes(xlsxFile, sheetName, header, opts.notes, opts.noteAuthor); err != nil {
+		return ragged, retry.Permanent(fmt.Errorf("%s: %w", path, err))
+	}
+	if err := opts.direction.Apply(xlsxFile, sheetName, header); err != nil {
+		return ragged, retry.Permanent(fmt.Errorf("failed to set layout of sheet %s: %w", sheetName, err))
+	}
+	return ragged, nil
+}
+
+// setCell writes cell as text, or as a number if numbers is set and the text
+// is plainly numeric, so that formulas can compute with it. Cells of a column
+// with a number format are converted and styled when they parse.
+func setCell(xlsxFile *excelize.File, sheetName, cellRef, cell string, column *xlsx.Column, numbers bool) error {
+	if column != nil {
+		if value, ok := column.Value(cell); ok {
+			if err := xlsxFile.SetCellValue(sheetName, cellRef, value); err != nil {
+				return err
+			}
+			return xlsxFile.SetCellStyle(sheetName, cellRef, cellRef, column.Style)
+		}
+	}
+	if numbers {
+		if f, ok := xlsx.Number(cell); ok {
+			return xlsxFile.SetCellFloat(sheetName, cellRef, f, -1, 64)
 		}
 	}
-	return csvFiles, nil
+	return xlsxFile.SetCellStr(sheetName, cellRef, cell)
 }
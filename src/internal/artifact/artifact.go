@@ -0,0 +1,225 @@
+// Package artifact packages a database as an immutable artifact, ready to
+// publish to an artifact registry: the database compressed, a checksum file
+// and a metadata document describing its tables and where they came from.
+// All three files are read-only.
+package artifact
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/compress"
+	"csvtools/src/internal/sqlitedb"
+)
+
+// Metadata is the document written next to an artifact as <name>.json.
+type Metadata struct {
+	Name      string `json:"name"`
+	RunID     string `json:"run_id"`
+	Tool      string `json:"tool"`
+	Revision  string `json:"revision"`
+	CreatedAt string `json:"created_at"`
+	// File is the artifact's file name, Size its size and SHA256 its checksum.
+	File        string `json:"file"`
+	Compression string `json:"compression"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	// Database is the uncompressed database.
+	Database Checksum `json:"database"`
+	Tables   []Table  `json:"tables"`
+	Sources  []Source `json:"sources"`
+	// Lineage lists the lineage columns of every table.
+	Lineage []string `json:"lineage_columns"`
+}
+
+// Checksum is the size and SHA-256 of a file.
+type Checksum struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Table is a table of the database.
+type Table struct {
+	Name    string   `json:"name"`
+	Rows    int64    `json:"rows"`
+	Columns []Column `json:"columns"`
+}
+
+// Column is a column of a Table, with its declared type.
+type Column struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	NotNull bool   `json:"not_null"`
+}
+
+// Source is an input file of the load and the table it went into. Failed
+// sources are listed with Loaded false.
+type Source struct {
+	Path   string `json:"path"`
+	Table  string `json:"table"`
+	Loaded bool   `json:"loaded"`
+}
+
+// Describe lists the tables of db, with their columns and row counts.
+func Describe(ctx context.Context, db *sql.DB) ([]Table, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	var tables []Table
+	for rows.Next() {
+		var t Table
+		if err := rows.Scan(&t.Name); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range tables {
+		t := &tables[i]
+		if err := db.QueryRowContext(ctx, "SELECT count(*) FROM "+sqlitedb.Quote(t.Name)).Scan(&t.Rows); err != nil {
+			return nil, fmt.Errorf("failed to count the rows of %s: %w", t.Name, err)
+		}
+		if t.Columns, err = columns(ctx, db, t.Name); err != nil {
+			return nil, err
+		}
+	}
+	return tables, nil
+}
+
+func columns(ctx context.Context, db *sql.DB, table string) ([]Column, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name, type, \"notnull\" FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the columns of %s: %w", table, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var columns []Column
+	for rows.Next() {
+		var c Column
+		if err := rows.Scan(&c.Name, &c.Type, &c.NotNull); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// Write packages the database at path into dir as <meta.Name>.db plus the
+// codec's extension, with a .sha256 file in the format of sha256sum and
+// <meta.Name>.json, filling in the file fields of meta. It returns the path
+// of the artifact.
+func Write(dir, path string, codec compress.Codec, meta *Metadata, policy atomicfile.Policy) (string, error) {
+	var err error
+	if meta.Database, err = checksum(path); err != nil {
+		return "", err
+	}
+	meta.File = meta.Name + ".db" + codec.Ext()
+	meta.Compression = string(codec)
+	if meta.Compression == "" {
+		meta.Compression = "none"
+	}
+	if meta.Tables == nil {
+		meta.Tables = []Table{}
+	}
+	if meta.Sources == nil {
+		meta.Sources = []Source{}
+	}
+	if meta.Lineage == nil {
+		meta.Lineage = []string{}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+	target := filepath.Join(dir, meta.File)
+	files := []string{target, target + ".sha256", filepath.Join(dir, meta.Name+".json")}
+	for _, f := range files {
+		if err := atomicfile.Check(f, policy); err != nil {
+			return "", err
+		}
+	}
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	err = writeFile(target, policy, func(w io.Writer) error {
+		return codec.Copy(io.MultiWriter(w, hash, counter), path)
+	})
+	if err != nil {
+		return "", err
+	}
+	meta.Size, meta.SHA256 = counter.n, hex.EncodeToString(hash.Sum(nil))
+	err = writeFile(files[1], policy, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "%s  %s\n", meta.SHA256, meta.File)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	err = writeFile(files[2], policy, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(meta)
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		if err := os.Chmod(f, 0o444); err != nil {
+			return "", fmt.Errorf("failed to make %s read-only: %w", f, err)
+		}
+	}
+	return target, nil
+}
+
+func writeFile(path string, policy atomicfile.Policy, write func(w io.Writer) error) error {
+	f, err := atomicfile.Create(path, policy)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if err := write(f); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Commit()
+}
+
+func checksum(path string) (Checksum, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Checksum{}, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	hash := sha256.New()
+	n, err := io.Copy(hash, f)
+	if err != nil {
+		return Checksum{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return Checksum{Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,186 @@
+// Package atomicfile writes output files under a temporary name and renames
+// them into place once complete, so nobody watching the destination ever sees
+// a half-written file under its final name.
+package atomicfile
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Policy says what happens when the final path already exists.
+type Policy int
+
+const (
+	// Fail refuses to replace an existing file.
+	Fail Policy = iota
+	// Overwrite replaces an existing file.
+	Overwrite
+	// NoClobber keeps an existing file and discards the new output.
+	NoClobber
+)
+
+// ErrExists is returned when the final path exists and the policy is not Overwrite.
+var ErrExists = errors.New("output file already exists")
+
+// maxName is the longest file name the usual filesystems take: 255 bytes on
+// Linux and macOS, 255 UTF-16 units on NTFS. nameLength measures names in
+// the unit of the platform.
+const maxName = 255
+
+// tempSuffix is the part os.CreateTemp adds to the name of the temp file,
+// its random digits included.
+const tempSuffix = len(".tmp-") + 10
+
+// checkName fails for a final path whose file name is too long, which would
+// only fail on Commit, after all the work.
+func checkName(path string) error {
+	if n := nameLength(filepath.Base(path)); n > maxName {
+		return fmt.Errorf("file name of %s is %d %s long, the limit is %d", path, n, nameUnit, maxName)
+	}
+	return nil
+}
+
+// Flags binds -overwrite and -no-clobber.
+type Flags struct {
+	overwrite bool
+	noClobber bool
+}
+
+// Register adds -overwrite and -no-clobber to fs.
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.overwrite, "overwrite", false, "replace the output file if it already exists")
+	fs.BoolVar(&f.noClobber, "no-clobber", false, "keep an existing output file and skip writing")
+}
+
+// Policy returns the policy chosen on the command line; without either flag
+// an existing output file is an error.
+func (f *Flags) Policy() (Policy, error) {
+	switch {
+	case f.overwrite && f.noClobber:
+		return Fail, errors.New("-overwrite and -no-clobber are mutually exclusive")
+	case f.overwrite:
+		return Overwrite, nil
+	case f.noClobber:
+		return NoClobber, nil
+	}
+	return Fail, nil
+}
+
+// Check returns ErrExists if path exists and policy does not allow replacing
+// it. Callers use it to bail out before doing the work; Commit checks again.
+func Check(path string, policy Policy) error {
+	if err := checkName(path); err != nil {
+		return err
+	}
+	if policy == Overwrite {
+		return nil
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%w: %s", ErrExists, path)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// File is an output file being written under a temporary name in the
+// directory of its final path. Commit renames it into place; Close without
+// Commit removes it.
+type File struct {
+	*os.File
+	path      string
+	policy    Policy
+	committed bool
+}
+
+// Create creates a temporary file next to path, creating the directory and
+// its parents if needed. policy applies when path exists at Commit. The
+// temp file is named after path, cut short when the name would be too long.
+func Create(path string, policy Policy) (*File, error) {
+	if err := checkName(path); err != nil {
+		return nil, err
+	}
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	base = cutName(base, maxName-tempSuffix)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, base+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file for %s: %w", path, err)
+	}
+	return &File{File: f, path: path, policy: policy}, nil
+}
+
+// Path is the final path of the file.
+func (f *File) Path() string {
+	return f.path
+}
+
+// Commit flushes the file to disk, closes it and renames it to its final
+// path. Unless the policy is Overwrite, an existing file is left alone, the
+// temp file is removed and the error wraps ErrExists.
+func (f *File) Commit() error {
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to sync %s: %w", f.Name(), err)
+	}
+	if err := f.File.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("failed to close %s: %w", f.Name(), err)
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("failed to set permissions of %s: %w", f.Name(), err)
+	}
+	if err := f.place(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	f.committed = true
+	return nil
+}
+
+func (f *File) place() error {
+	if f.policy == Overwrite {
+		if err := os.Rename(f.Name(), f.path); err != nil {
+			return fmt.Errorf("failed to move %s into place: %w", f.path, err)
+		}
+		return nil
+	}
+	// A hard link fails if the target exists, so no concurrent writer is clobbered.
+	err := os.Link(f.Name(), f.path)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%w: %s", ErrExists, f.path)
+	}
+	if err != nil {
+		// Some filesystems have no hard links; fall back to check and rename.
+		if err := Check(f.path, f.policy); err != nil {
+			return err
+		}
+		if err := os.Rename(f.Name(), f.path); err != nil {
+			return fmt.Errorf("failed to move %s into place: %w", f.path, err)
+		}
+		return nil
+	}
+	_ = os.Remove(f.Name())
+	return nil
+}
+
+// Close discards the temporary file unless it was committed. It is safe to
+// call after Commit, so it can be deferred.
+func (f *File) Close() error {
+	if f.committed {
+		return nil
+	}
+	_ = f.File.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package atomicfile
+
+import "strings"
+
+// nameUnit is what nameLength counts.
+const nameUnit = "bytes"
+
+// nameLength returns the length of a file name in bytes.
+func nameLength(name string) int {
+	return len(name)
+}
+
+// cutName cuts name to at most n bytes without splitting a character.
+func cutName(name string, n int) string {
+	if len(name) <= n {
+		return name
+	}
+	return strings.ToValidUTF8(name[:n], "")
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package atomicfile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNameLengthBytes(t *testing.T) {
+	if got := nameLength("日付.csv"); got != 10 {
+		t.Errorf("nameLength = %d, want 10", got)
+	}
+	if err := checkName(strings.Repeat("表", 85) + ".csv"); err == nil {
+		t.Error("checkName of a 259 byte name succeeded")
+	}
+	if got := cutName("ab日付", 4); got != "ab" {
+		t.Errorf("cutName = %q, want ab", got)
+	}
+}
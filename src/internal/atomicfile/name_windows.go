@@ -0,0 +1,36 @@
+//go:build windows
+
+package atomicfile
+
+// nameUnit is what nameLength counts.
+const nameUnit = "UTF-16 units"
+
+// nameLength returns the length of a file name in UTF-16 units, as NTFS
+// counts it: a CJK character is one unit though three bytes in UTF-8, and
+// characters outside the BMP, such as emoji, are two.
+func nameLength(name string) int {
+	n := 0
+	for _, r := range name {
+		n += runeUnits(r)
+	}
+	return n
+}
+
+// cutName cuts name to at most n UTF-16 units without splitting a character.
+func cutName(name string, n int) string {
+	units := 0
+	for i, r := range name {
+		if units += runeUnits(r); units > n {
+			return name[:i]
+		}
+	}
+	return name
+}
+
+// runeUnits returns the UTF-16 units of r.
+func runeUnits(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,67 @@
+//go:build windows
+
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNameLengthUTF16(t *testing.T) {
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"plain.csv", 9},
+		{"日付.csv", 6},
+		{"📦.csv", 6},
+		{strings.Repeat("表", 255), 255},
+	}
+	for _, tt := range tests {
+		if got := nameLength(tt.name); got != tt.want {
+			t.Errorf("nameLength(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestLongCJKName writes a file whose name is 255 UTF-16 units but 765
+// bytes, which NTFS takes.
+func TestLongCJKName(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, strings.Repeat("表", 251)+".csv")
+	if err := Check(path, Fail); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	f, err := Create(path, Fail)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if _, err := f.Write([]byte("a,b\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Check(filepath.Join(dir, strings.Repeat("表", 252)+".csv"), Fail); err == nil {
+		t.Error("Check of a 256 unit name succeeded")
+	}
+}
+
+func TestCutNameKeepsSurrogatePairs(t *testing.T) {
+	name := strings.Repeat("a", 9) + "📦"
+	if got := cutName(name, 10); got != strings.Repeat("a", 9) {
+		t.Errorf("cutName(%q, 10) = %q", name, got)
+	}
+	if got := cutName(name, 11); got != name {
+		t.Errorf("cutName(%q, 11) = %q", name, got)
+	}
+}
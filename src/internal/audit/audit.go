@@ -0,0 +1,151 @@
+// Package audit identifies every run with a unique ID and records who ran
+// what, when and with which outcome, in a JSON lines file or syslog, for
+// compliance traceability.
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"time"
+
+	"csvtools/src/internal/exitcode"
+)
+
+// NewRunID returns a random (version 4) UUID.
+func NewRunID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Record is one audit log entry.
+type Record struct {
+	RunID    string    `json:"run_id"`
+	Tool     string    `json:"tool"`
+	User     string    `json:"user"`
+	Host     string    `json:"host"`
+	Args     []string  `json:"args"`
+	Started  time.Time `json:"started_at"`
+	Finished time.Time `json:"finished_at"`
+	// Outcome is ok, partial, usage, busy, failed or interrupted, after
+	// the exit code.
+	Outcome  string `json:"outcome"`
+	ExitCode int    `json:"exit_code"`
+	Output   string `json:"output,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Flags binds -run-id and -audit-log.
+type Flags struct {
+	RunID string
+	Log   string
+}
+
+// Register adds the flags to fs.
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.RunID, "run-id", "", "ID of this run, in logs, metadata and the audit log (default a random UUID)")
+	fs.StringVar(&f.Log, "audit-log", "", "append an audit record of the run to this JSON lines file, or to syslog with \"syslog\"")
+}
+
+// Run is a run being audited.
+type Run struct {
+	Record
+	log string
+}
+
+// Start starts the run of tool called with args. It assigns the run ID
+// unless -run-id gave one.
+func (f *Flags) Start(tool string, args []string) *Run {
+	if f.RunID == "" {
+		f.RunID = NewRunID()
+	}
+	r := &Run{Record: Record{RunID: f.RunID, Tool: tool, Args: Redact(args), Started: time.Now().UTC()}, log: f.Log}
+	if u, err := user.Current(); err == nil {
+		r.User = u.Username
+	}
+	r.Host, _ = os.Hostname()
+	return r
+}
+
+// Finish writes the audit record of the run ending with exit code code and,
+// on failure, err. Without -audit-log it does nothing.
+func (r *Run) Finish(code int, err error) error {
+	if r.log == "" {
+		return nil
+	}
+	r.Finished = time.Now().UTC()
+	r.ExitCode = code
+	r.Outcome = Outcome(code)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	line, err := json.Marshal(r.Record)
+	if err != nil {
+		return err
+	}
+	if r.log == "syslog" {
+		return writeSyslog(r.Tool, line)
+	}
+	f, err := os.OpenFile(r.log, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	// One write per record, so that concurrent runs don't interleave.
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return f.Close()
+}
+
+// Outcome names an exit code.
+func Outcome(code int) string {
+	switch code {
+	case exitcode.OK:
+		return "ok"
+	case exitcode.Partial:
+		return "partial"
+	case exitcode.Usage:
+		return "usage"
+	case exitcode.Busy:
+		return "busy"
+	case exitcode.Interrupted:
+		return "interrupted"
+	}
+	return "failed"
+}
+
+// secret matches the names of flags whose values must not be logged.
+var secret = regexp.MustCompile(`(?i)(passphrase|password|secret|token)$`)
+
+// Redact returns args with the values of secret flags, such as -passphrase,
+// replaced by "REDACTED".
+func Redact(args []string) []string {
+	out := make([]string, len(args))
+	copy(out, args)
+	for i := 0; i < len(out); i++ {
+		arg := out[i]
+		if !strings.HasPrefix(arg, "-") || arg == "--" {
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !secret.MatchString(name) {
+			continue
+		}
+		if hasValue {
+			out[i] = arg[:strings.Index(arg, "=")+1] + "REDACTED"
+		} else if i+1 < len(out) {
+			out[i+1] = "REDACTED"
+			i++
+		}
+	}
+	return out
+}
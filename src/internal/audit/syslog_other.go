@@ -0,0 +1,10 @@
+//go:build !unix
+
+package audit
+
+import "errors"
+
+// writeSyslog fails: there is no syslog on this platform.
+func writeSyslog(tool string, line []byte) error {
+	return errors.New("syslog is not available on this platform, use an audit log file")
+}
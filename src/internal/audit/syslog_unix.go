@@ -0,0 +1,20 @@
+//go:build unix
+
+package audit
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+// writeSyslog sends line to the local syslog daemon, tagged with tool.
+func writeSyslog(tool string, line []byte) error {
+	w, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_USER, tool)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	defer func() {
+		_ = w.Close()
+	}()
+	return w.Notice(string(line))
+}
@@ -0,0 +1,40 @@
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Table is the name of the table recording the runs that loaded a database.
+const Table = "_csvtools_runs"
+
+// TableDDL creates the runs table unless it exists.
+const TableDDL = `CREATE TABLE IF NOT EXISTS ` + Table + ` (
+	run_id TEXT PRIMARY KEY,
+	tool TEXT NOT NULL,
+	user TEXT NOT NULL,
+	host TEXT NOT NULL,
+	started_at TEXT NOT NULL,
+	finished_at TEXT NOT NULL,
+	files INTEGER NOT NULL,
+	failed INTEGER NOT NULL,
+	outcome TEXT NOT NULL
+)`
+
+// Save records the run in the runs table of db, creating the table if
+// needed. files and failed count the files the run loaded and failed to
+// load, and code is the exit code the run is about to end with.
+func (r *Run) Save(db *sql.DB, files, failed, code int) error {
+	_, err := db.Exec(TableDDL)
+	if err != nil {
+		return fmt.Errorf("failed to create runs table: %w", err)
+	}
+	_, err = db.Exec(`INSERT OR REPLACE INTO `+Table+` (run_id, tool, user, host, started_at, finished_at, files, failed, outcome)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.RunID, r.Tool, r.User, r.Host, r.Started.Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339), files, failed, Outcome(code))
+	if err != nil {
+		return fmt.Errorf("failed to record run %s: %w", r.RunID, err)
+	}
+	return nil
+}
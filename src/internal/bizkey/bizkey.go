@@ -0,0 +1,56 @@
+// Package bizkey finds the business key of rows: the columns that identify a
+// row across snapshots, matched against the file's columns ignoring case like
+// SQLite. The history (scd2) and changeset (cdc) loads key their rows on it.
+package bizkey
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Key reads the business key of rows. It is not safe for concurrent use.
+type Key struct {
+	idx []int
+	buf []string
+}
+
+// New returns the Key of rows whose columns are columns, keyed on the key
+// columns.
+func New(columns, key []string) (*Key, error) {
+	idx := make([]int, len(key))
+	for k, name := range key {
+		if idx[k] = indexFold(columns, name); idx[k] < 0 {
+			return nil, fmt.Errorf("business key column %s is not in the file", name)
+		}
+	}
+	return &Key{idx: idx, buf: make([]string, 0, len(idx))}, nil
+}
+
+// Check reports a business key column missing from columns.
+func Check(columns, key []string) error {
+	_, err := New(columns, key)
+	return err
+}
+
+// Of returns the map key of the business key of cells.
+func (k *Key) Of(cells []string) string {
+	k.buf = k.buf[:0]
+	for _, i := range k.idx {
+		k.buf = append(k.buf, cells[i])
+	}
+	return strings.Join(k.buf, "\x00")
+}
+
+// String returns the cells of the last key Of read, for messages.
+func (k *Key) String() string {
+	return strings.Join(k.buf, ", ")
+}
+
+func indexFold(names []string, name string) int {
+	for i, n := range names {
+		if strings.EqualFold(n, name) {
+			return i
+		}
+	}
+	return -1
+}
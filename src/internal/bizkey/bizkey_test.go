@@ -0,0 +1,26 @@
+package bizkey
+
+import "testing"
+
+func TestKey(t *testing.T) {
+	k, err := New([]string{"ID", "Region", "amount"}, []string{"region", "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := k.Of([]string{"1", "north", "9.5"}); got != "north\x001" {
+		t.Errorf("Of = %q, want %q", got, "north\x001")
+	}
+	if got := k.String(); got != "north, 1" {
+		t.Errorf("String = %q, want %q", got, "north, 1")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if err := Check([]string{"id"}, []string{"ID"}); err != nil {
+		t.Errorf("Check = %v, want nil", err)
+	}
+	err := Check([]string{"id"}, []string{"id", "region"})
+	if err == nil || err.Error() != "business key column region is not in the file" {
+		t.Errorf("Check = %v, want region missing", err)
+	}
+}
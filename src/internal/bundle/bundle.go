@@ -0,0 +1,170 @@
+// Package bundle packs the files of a multi-file output, such as a Parquet
+// file per table, into a single zip or tar archive, so it can be shipped or
+// downloaded as one.
+package bundle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"csvtools/src/internal/compress"
+)
+
+// Formats of archives. Tar archives may be compressed with the codecs of
+// -compress.
+const (
+	Zip    = "zip"
+	Tar    = "tar"
+	TarGz  = "tgz"
+	TarZst = "tzst"
+)
+
+// Formats lists the formats, for messages.
+const Formats = "zip, tar, tgz or tzst"
+
+// Format returns the format of an archive at path after its extension,
+// .zip, .tar, .tar.gz, .tgz, .tar.zst or .tzst, or "" for other paths.
+func Format(path string) string {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return Zip
+	case strings.HasSuffix(lower, ".tar"):
+		return Tar
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return TarGz
+	case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tzst"):
+		return TarZst
+	}
+	return ""
+}
+
+// Ext returns the file extension of format, including the dot.
+func Ext(format string) string {
+	switch format {
+	case TarGz:
+		return ".tar.gz"
+	case TarZst:
+		return ".tar.zst"
+	}
+	return "." + format
+}
+
+// ContentType returns the media type of archives of format.
+func ContentType(format string) string {
+	switch format {
+	case Zip:
+		return "application/zip"
+	case TarGz:
+		return "application/gzip"
+	case TarZst:
+		return "application/zstd"
+	}
+	return "application/x-tar"
+}
+
+// Write writes the files at paths into an archive of format, each under its
+// base name.
+func Write(w io.Writer, format string, paths []string) error {
+	switch format {
+	case Zip:
+		zw := zip.NewWriter(w)
+		for _, path := range paths {
+			if err := addZip(zw, path); err != nil {
+				return err
+			}
+		}
+		return zw.Close()
+	case Tar:
+		return writeTar(w, paths)
+	case TarGz, TarZst:
+		codec := compress.Gzip
+		if format == TarZst {
+			codec = compress.Zstd
+		}
+		zw, err := codec.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		if err := writeTar(zw, paths); err != nil {
+			_ = zw.Close()
+			return err
+		}
+		return zw.Close()
+	}
+	return fmt.Errorf("unknown archive format %q (want %s)", format, Formats)
+}
+
+func addZip(zw *zip.Writer, path string) error {
+	f, info, err := open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Method = zip.Deflate
+	entry, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(entry, f); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", path, err)
+	}
+	return nil
+}
+
+func writeTar(w io.Writer, paths []string) error {
+	tw := tar.NewWriter(w)
+	for _, path := range paths {
+		if err := addTar(tw, path); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func addTar(tw *tar.Writer, path string) error {
+	f, info, err := open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.Base(path)
+	header.Mode = 0o644
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", path, err)
+	}
+	return nil
+}
+
+func open(path string) (*os.File, os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	return f, info, nil
+}
@@ -0,0 +1,264 @@
+// Package cdc reloads snapshots into tables as changesets: comparing a
+// snapshot with the table on business keys, it inserts the new rows, updates
+// the changed ones in place and deletes the missing ones, and writes the
+// changes out for downstream systems to consume as deltas.
+package cdc
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/bizkey"
+	"csvtools/src/internal/csvio"
+	"csvtools/src/internal/rowhash"
+	"csvtools/src/internal/sqlitedb"
+)
+
+// The operations of a changeset.
+const (
+	Insert = "insert"
+	Update = "update"
+	Delete = "delete"
+)
+
+// Counts are the changes of a snapshot.
+type Counts struct {
+	Inserted, Updated, Deleted, Unchanged int
+}
+
+// row is a row of the table before the load.
+type row struct {
+	rowid int64
+	sum   string
+	seen  bool
+}
+
+// Options configure a Load.
+type Options struct {
+	// Key holds the business key columns.
+	Key []string
+	// Set holds the columns an update sets, in the order of the values
+	// passed to Row: the columns of the snapshot and any derived ones.
+	Set []string
+	// Apply changes the table; otherwise the changes are only written.
+	Apply bool
+	// Path, when set, receives the changeset as CSV: an _op column, an
+	// _changed column listing the columns an update changed, then the
+	// columns of the snapshot, holding the new cells of inserts and updates
+	// and the old cells of deletes.
+	Path string
+}
+
+// Load applies one snapshot to a table.
+type Load struct {
+	tx      *sql.Tx
+	table   string
+	columns []string
+	opts    Options
+	key     *bizkey.Key
+	all     []int
+	hasher  *rowhash.Hasher
+	rows    map[string]*row
+	out     *atomicfile.File
+	writer  *csvio.Writer
+	Counts  Counts
+}
+
+// Path returns where the changeset of the file source goes in dir:
+// <dir>/<file>.changes.csv.
+func Path(dir, source string) string {
+	name := strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	return filepath.Join(dir, name+".changes.csv")
+}
+
+// Begin starts loading a snapshot whose columns are columns into table,
+// reading the key and a hash of the cells of every row of the table. Keys
+// must be unique in the table.
+func Begin(tx *sql.Tx, table string, columns []string, opts Options) (*Load, error) {
+	l := &Load{tx: tx, table: table, columns: columns, opts: opts, rows: make(map[string]*row)}
+	var err error
+	if l.key, err = bizkey.New(columns, opts.Key); err != nil {
+		return nil, err
+	}
+	for i := range columns {
+		l.all = append(l.all, i)
+	}
+	if l.hasher, err = rowhash.New("sha256"); err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(fmt.Sprintf("SELECT rowid, %s FROM %s", l.selectList(), sqlitedb.Quote(table)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the rows of %s: %w", table, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	cells := make([]string, len(columns))
+	values, dest := scanTargets(len(columns))
+	for rows.Next() {
+		r := &row{}
+		dest[0] = &r.rowid
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to read the rows of %s: %w", table, err)
+		}
+		for i, v := range values {
+			cells[i] = v.String
+		}
+		r.sum = l.hasher.Sum(cells, l.all)
+		k := l.key.Of(cells)
+		if _, dup := l.rows[k]; dup {
+			return nil, fmt.Errorf("business key %s appears more than once in table %s, changesets need unique keys", l.key, table)
+		}
+		l.rows[k] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the rows of %s: %w", table, err)
+	}
+	if opts.Path != "" {
+		if l.out, err = atomicfile.Create(opts.Path, atomicfile.Overwrite); err != nil {
+			return nil, err
+		}
+		l.writer = csvio.NewWriter(l.out, csvio.WriterOptions{})
+		if err := l.writer.Write(append([]string{"_op", "_changed"}, columns...)); err != nil {
+			_ = l.out.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Row takes a row of the snapshot, its cells in the order of the columns,
+// and the values an update sets, and reports whether the row is to be
+// inserted. Changed rows are updated here. A key repeated within the
+// snapshot is an error.
+func (l *Load) Row(cells []string, set []any) (bool, error) {
+	k := l.key.Of(cells)
+	sum := l.hasher.Sum(cells, l.all)
+	r, ok := l.rows[k]
+	switch {
+	case ok && r.seen:
+		return false, fmt.Errorf("business key %s appears more than once in the snapshot", l.key)
+	case !ok:
+		l.rows[k] = &row{rowid: -1, seen: true}
+		l.Counts.Inserted++
+		return l.opts.Apply, l.write(Insert, nil, cells)
+	}
+	r.seen = true
+	if r.sum == sum {
+		l.Counts.Unchanged++
+		return false, nil
+	}
+	old, err := l.read(r.rowid)
+	if err != nil {
+		return false, err
+	}
+	var changed []string
+	for i, c := range l.columns {
+		if old[i] != cells[i] {
+			changed = append(changed, c)
+		}
+	}
+	if l.opts.Apply {
+		assignments := make([]string, len(l.opts.Set))
+		for i, c := range l.opts.Set {
+			assignments[i] = sqlitedb.Quote(c) + " = ?"
+		}
+		query := fmt.Sprintf("UPDATE %s SET %s WHERE rowid = ?", sqlitedb.Quote(l.table), strings.Join(assignments, ", "))
+		if _, err := l.tx.Exec(query, append(slices.Clip(set), r.rowid)...); err != nil {
+			return false, fmt.Errorf("failed to update a row of %s: %w", l.table, err)
+		}
+	}
+	l.Counts.Updated++
+	return false, l.write(Update, changed, cells)
+}
+
+// Finish deletes the rows whose key the snapshot lacked, writing them to
+// the changeset in table order.
+func (l *Load) Finish() error {
+	var missing []int64
+	for _, r := range l.rows {
+		if !r.seen {
+			missing = append(missing, r.rowid)
+		}
+	}
+	slices.Sort(missing)
+	for _, rowid := range missing {
+		old, err := l.read(rowid)
+		if err != nil {
+			return err
+		}
+		if l.opts.Apply {
+			if _, err := l.tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE rowid = ?", sqlitedb.Quote(l.table)), rowid); err != nil {
+				return fmt.Errorf("failed to delete a row of %s: %w", l.table, err)
+			}
+		}
+		l.Counts.Deleted++
+		if err := l.write(Delete, nil, old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close finishes the changeset, keeping it if the load committed and
+// removing it otherwise.
+func (l *Load) Close(committed bool) error {
+	if l.out == nil {
+		return nil
+	}
+	l.writer.Flush()
+	if err := l.writer.Error(); err != nil || !committed {
+		_ = l.out.Close()
+		return err
+	}
+	return l.out.Commit()
+}
+
+func (l *Load) write(op string, changed, cells []string) error {
+	if l.writer == nil {
+		return nil
+	}
+	if err := l.writer.Write(append([]string{op, strings.Join(changed, ",")}, cells...)); err != nil {
+		return fmt.Errorf("failed to write the changes of %s: %w", l.table, err)
+	}
+	return nil
+}
+
+// read returns the cells of the row of the table with rowid.
+func (l *Load) read(rowid int64) ([]string, error) {
+	values, dest := scanTargets(len(l.columns))
+	var id int64
+	dest[0] = &id
+	query := fmt.Sprintf("SELECT rowid, %s FROM %s WHERE rowid = ?", l.selectList(), sqlitedb.Quote(l.table))
+	if err := l.tx.QueryRow(query, rowid).Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to read a row of %s: %w", l.table, err)
+	}
+	cells := make([]string, len(values))
+	for i, v := range values {
+		cells[i] = v.String
+	}
+	return cells, nil
+}
+
+func (l *Load) selectList() string {
+	quoted := make([]string, len(l.columns))
+	for i, c := range l.columns {
+		quoted[i] = "CAST(" + sqlitedb.Quote(c) + " AS TEXT)"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// scanTargets returns the values of a row of n columns and the scan
+// destinations of the row, with the first left for the rowid.
+func scanTargets(n int) ([]sql.NullString, []any) {
+	values := make([]sql.NullString, n)
+	dest := make([]any, n+1)
+	for i := range values {
+		dest[i+1] = &values[i]
+	}
+	return values, dest
+}
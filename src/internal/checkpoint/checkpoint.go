@@ -0,0 +1,118 @@
+// Package checkpoint remembers how far into an append-only CSV file a
+// database load has progressed, so later runs only insert the new rows.
+//
+// Checkpoints live in a table inside the target database and are written in
+// the same transaction as the rows they describe, which keeps the offset and
+// the loaded data consistent even when a run is interrupted.
+package checkpoint
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Table is the name of the bookkeeping table created in the target database.
+const Table = "_csvtools_checkpoints"
+
+// State is the progress recorded for one source file.
+type State struct {
+	// File is the source path the checkpoint belongs to.
+	File string
+	// Header is the header row seen when the checkpoint was written; a
+	// different header means the file was replaced and must be reloaded.
+	Header []string
+	// Offset is the byte offset just past the last loaded record.
+	Offset int64
+	// Rows is the number of data rows loaded so far.
+	Rows int64
+}
+
+// TableDDL creates the checkpoint table unless it exists.
+const TableDDL = `CREATE TABLE IF NOT EXISTS ` + Table + ` (
+	file TEXT PRIMARY KEY,
+	header TEXT NOT NULL,
+	byte_offset INTEGER NOT NULL,
+	row_count INTEGER NOT NULL,
+	updated_at TEXT NOT NULL
+)`
+
+// EnsureTable creates the checkpoint table when it does not exist yet.
+func EnsureTable(db *sql.DB) error {
+	_, err := db.Exec(TableDDL)
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint table: %w", err)
+	}
+	return nil
+}
+
+// Load returns the stored state for file. The boolean is false when the file
+// has never been loaded.
+func Load(db *sql.DB, file string) (State, bool, error) {
+	state := State{File: file}
+	var header string
+	err := db.QueryRow(`SELECT header, byte_offset, row_count FROM `+Table+` WHERE file = ?`, file).
+		Scan(&header, &state.Offset, &state.Rows)
+	if errors.Is(err, sql.ErrNoRows) {
+		return state, false, nil
+	}
+	if err != nil {
+		return state, false, fmt.Errorf("failed to load checkpoint for %s: %w", file, err)
+	}
+	state.Header = strings.Split(header, "\x1f")
+	return state, true, nil
+}
+
+// Save records state inside tx.
+func Save(tx *sql.Tx, state State) error {
+	_, err := tx.Exec(`INSERT INTO `+Table+` (file, header, byte_offset, row_count, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(file) DO UPDATE SET header = excluded.header, byte_offset = excluded.byte_offset,
+			row_count = excluded.row_count, updated_at = excluded.updated_at`,
+		state.File, strings.Join(state.Header, "\x1f"), state.Offset, state.Rows, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint for %s: %w", state.File, err)
+	}
+	return nil
+}
+
+// SameHeader reports whether the checkpoint was taken against header.
+func (s State) SameHeader(header []string) bool {
+	if len(s.Header) != len(header) {
+		return false
+	}
+	for i := range header {
+		if s.Header[i] != header[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// CompleteEnd returns the offset just past the last newline in f, so that a
+// record still being appended by a writer is left for the next run.
+func CompleteEnd(f *os.File) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	const chunk = 64 * 1024
+	buf := make([]byte, chunk)
+	for end := info.Size(); end > 0; {
+		start := max(end-chunk, 0)
+		n, err := f.ReadAt(buf[:end-start], start)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
@@ -0,0 +1,181 @@
+// Package clipboard reads and writes the system clipboard as text, so a
+// table copied from a web page or a spreadsheet can be used as an input and
+// a result pasted back. It runs the platform's clipboard tools: pbpaste and
+// pbcopy on macOS, PowerShell on Windows, and wl-paste and wl-copy, xclip or
+// xsel elsewhere. CSVTOOLS_CLIPBOARD_PASTE and CSVTOOLS_CLIPBOARD_COPY
+// override the commands, e.g. for WSL or a terminal multiplexer.
+package clipboard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"csvtools/src/internal/discover"
+)
+
+// Name is the input or output name that stands for the clipboard.
+const Name = "clipboard"
+
+// Is reports whether name stands for the clipboard.
+func Is(name string) bool {
+	return name == Name
+}
+
+// tool is a command reading the clipboard to stdout or writing stdin to it.
+type tool []string
+
+// candidates returns the commands to try in order for pasting or copying.
+func candidates(paste bool) []tool {
+	env := "CSVTOOLS_CLIPBOARD_COPY"
+	if paste {
+		env = "CSVTOOLS_CLIPBOARD_PASTE"
+	}
+	if cmd := strings.Fields(os.Getenv(env)); len(cmd) > 0 {
+		return []tool{cmd}
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		if paste {
+			return []tool{{"pbpaste"}}
+		}
+		return []tool{{"pbcopy"}}
+	case "windows":
+		// PowerShell speaks UTF-16 to the clipboard and UTF-8 to us.
+		if paste {
+			return []tool{{"powershell", "-NoProfile", "-Command", "[Console]::OutputEncoding=[Text.Encoding]::UTF8; Get-Clipboard -Raw"}}
+		}
+		return []tool{{"powershell", "-NoProfile", "-Command", "[Console]::InputEncoding=[Text.Encoding]::UTF8; Set-Clipboard -Value ([Console]::In.ReadToEnd())"}}
+	}
+	var tools []tool
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if paste {
+			tools = append(tools, tool{"wl-paste", "--no-newline"})
+		} else {
+			tools = append(tools, tool{"wl-copy"})
+		}
+	}
+	if paste {
+		return append(tools, tool{"xclip", "-selection", "clipboard", "-out"}, tool{"xsel", "--clipboard", "--output"})
+	}
+	return append(tools, tool{"xclip", "-selection", "clipboard", "-in"}, tool{"xsel", "--clipboard", "--input"})
+}
+
+// run runs the first of tools that is installed.
+func run(ctx context.Context, tools []tool, stdin []byte) ([]byte, error) {
+	var names []string
+	for _, t := range tools {
+		path, err := exec.LookPath(t[0])
+		if err != nil {
+			names = append(names, t[0])
+			continue
+		}
+		cmd := exec.CommandContext(ctx, path, t[1:]...)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if stdin != nil {
+			cmd.Stdin = bytes.NewReader(stdin)
+		}
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("%s: %w: %s", t[0], err, msg)
+			}
+			return nil, fmt.Errorf("%s: %w", t[0], err)
+		}
+		return stdout.Bytes(), nil
+	}
+	return nil, fmt.Errorf("no clipboard tool found (tried %s)", strings.Join(names, ", "))
+}
+
+// Read returns the text on the clipboard.
+func Read(ctx context.Context) ([]byte, error) {
+	data, err := run(ctx, candidates(true), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the clipboard: %w", err)
+	}
+	return data, nil
+}
+
+// Write puts data on the clipboard.
+func Write(ctx context.Context, data []byte) error {
+	if data == nil {
+		data = []byte{}
+	}
+	if _, err := run(ctx, candidates(false), data); err != nil {
+		return fmt.Errorf("failed to write the clipboard: %w", err)
+	}
+	return nil
+}
+
+// Delimiter guesses the delimiter of a table on the clipboard: spreadsheets
+// and web pages copy cells separated by tabs, anything else is taken to be
+// comma separated.
+func Delimiter(data []byte) rune {
+	first, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.ContainsRune(first, '\t') {
+		return '\t'
+	}
+	return ','
+}
+
+// ErrEmpty is returned by File when the clipboard holds no text.
+var ErrEmpty = errors.New("the clipboard is empty")
+
+// File snapshots the clipboard into a file in dir, named "clipboard" and
+// with Source set to Name, whose delimiter is told by Delimiter.
+func File(ctx context.Context, dir string) (discover.File, error) {
+	data, err := Read(ctx)
+	if err != nil {
+		return discover.File{}, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return discover.File{}, ErrEmpty
+	}
+	f, err := os.CreateTemp(dir, "clipboard-*.csv")
+	if err != nil {
+		return discover.File{}, err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return discover.File{}, err
+	}
+	return discover.File{
+		Path:           f.Name(),
+		Name:           Name,
+		Ext:            "csv",
+		Delimiter:      Delimiter(data),
+		FixedDelimiter: true,
+		Size:           int64(len(data)),
+		ModTime:        time.Now(),
+		Source:         Name,
+	}, nil
+}
+
+// Writer collects what is written to it and puts it on the clipboard when
+// closed.
+type Writer struct {
+	ctx context.Context
+	buf bytes.Buffer
+}
+
+// NewWriter returns a Writer copying to the clipboard on Close.
+func NewWriter(ctx context.Context) *Writer {
+	return &Writer{ctx: ctx}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *Writer) Close() error {
+	return Write(w.ctx, w.buf.Bytes())
+}
@@ -0,0 +1,98 @@
+// Package colcrypt encrypts single cell values with AES-256-GCM, so that a
+// database can be shared while some of its columns stay protected.
+package colcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Prefix marks encrypted values; it is followed by the base64 encoded nonce
+// and ciphertext.
+const Prefix = "enc:v1:"
+
+// KeyEnv is the environment variable holding the base64 encoded key when no
+// key file is given.
+const KeyEnv = "CSVTOOLS_ENCRYPTION_KEY"
+
+// ErrNotEncrypted is returned by Decrypt for values without Prefix.
+var ErrNotEncrypted = errors.New("value is not encrypted")
+
+// LoadKey reads a base64 encoded 32 byte key from file, e.g. a secret
+// mounted by a KMS or secrets manager, or from KeyEnv if file is empty.
+func LoadKey(file string) ([]byte, error) {
+	encoded, source := os.Getenv(KeyEnv), KeyEnv
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file %s: %w", file, err)
+		}
+		encoded, source = string(data), file
+	}
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, fmt.Errorf("no encryption key: set %s or give a key file", KeyEnv)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("key in %s is not base64: %w", source, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key in %s has %d bytes, want 32", source, len(key))
+	}
+	return key, nil
+}
+
+// Cipher encrypts and decrypts cell values. The column name is bound to
+// every value as additional data, so values can't be moved between columns.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// New returns a Cipher for a 32 byte key.
+func New(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt returns value encrypted for column with a random nonce.
+func (c *Cipher) Encrypt(column, value string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(value)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(value), []byte(column))
+	return Prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt. It fails with ErrNotEncrypted for values without
+// Prefix, and if the key or column don't match.
+func (c *Cipher) Decrypt(column, value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, Prefix)
+	if !ok {
+		return "", ErrNotEncrypted
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, ciphertext, []byte(column))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value of column %s: wrong key or column", column)
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,237 @@
+// Package columnar is the intermediate representation of the pipeline:
+// data flows from readers through transforms to writers as Arrow record
+// batches, i.e. a schema plus one typed column vector per field for every
+// chunk of rows. Format adapters only convert between their format and
+// batches; type inference and transforms work on whole columns.
+package columnar
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// DefaultBatchSize is the number of rows per batch.
+const DefaultBatchSize = 8192
+
+// Reader yields record batches of one schema. Next returns io.EOF after the
+// last batch. The caller releases every batch it gets.
+type Reader interface {
+	Schema() *arrow.Schema
+	Next() (arrow.RecordBatch, error)
+	Close() error
+}
+
+// Writer consumes record batches. Close flushes the output; it does not
+// close an io.Writer the Writer was created with.
+type Writer interface {
+	Write(arrow.RecordBatch) error
+	Close() error
+}
+
+// Copy writes every batch of r to w and returns the number of rows. It does
+// not close either.
+func Copy(w Writer, r Reader) (int64, error) {
+	var rows int64
+	for {
+		batch, err := r.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return rows, nil
+			}
+			return rows, err
+		}
+		rows += batch.NumRows()
+		err = w.Write(batch)
+		batch.Release()
+		if err != nil {
+			return rows, err
+		}
+	}
+}
+
+// Tee returns a Writer that writes every batch to all of writers, so one
+// pass over the input feeds several outputs. Close closes them all.
+func Tee(writers ...Writer) Writer {
+	return tee(writers)
+}
+
+type tee []Writer
+
+func (t tee) Write(batch arrow.RecordBatch) error {
+	for _, w := range t {
+		if err := w.Write(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t tee) Close() error {
+	var errs []error
+	for _, w := range t {
+		errs = append(errs, w.Close())
+	}
+	return errors.Join(errs...)
+}
+
+var (
+	intPattern   = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)$`)
+	floatPattern = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+)
+
+// Infer returns the narrowest type all non-empty values parse as: bool
+// (true/false), int64, float64, or else string. Numbers with leading zeros,
+// like "007", are codes and stay strings. A column without values is string.
+func Infer(values []string) arrow.DataType {
+	var in Inference
+	for _, v := range values {
+		in.Add(v)
+	}
+	return in.Type()
+}
+
+// Inference is Infer over values seen one at a time, for columns too long
+// to hold. Its zero value has seen no values.
+type Inference struct {
+	notBool, notInt, notFloat, seen bool
+}
+
+// Add takes v into account.
+func (in *Inference) Add(v string) {
+	if v == "" || in.notBool && in.notFloat {
+		return
+	}
+	in.seen = true
+	in.notBool = in.notBool || !(strings.EqualFold(v, "true") || strings.EqualFold(v, "false"))
+	in.notInt = in.notInt || !intPattern.MatchString(v)
+	in.notFloat = in.notFloat || !floatPattern.MatchString(v)
+}
+
+// Type returns the type of the values added so far.
+func (in *Inference) Type() arrow.DataType {
+	switch {
+	case !in.seen:
+		return arrow.BinaryTypes.String
+	case !in.notBool:
+		return arrow.FixedWidthTypes.Boolean
+	case !in.notInt:
+		return arrow.PrimitiveTypes.Int64
+	case !in.notFloat:
+		return arrow.PrimitiveTypes.Float64
+	}
+	return arrow.BinaryTypes.String
+}
+
+// Build returns a batch holding rows, given as text cells, converted to the
+// types of schema. Missing cells are null, and so are empty cells of
+// non-string columns; a cell that does not parse as its column's type is an
+// error.
+func Build(schema *arrow.Schema, rows [][]string) (arrow.RecordBatch, error) {
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	for i, field := range schema.Fields() {
+		if err := appendColumn(b.Field(i), field, i, rows); err != nil {
+			return nil, err
+		}
+	}
+	return b.NewRecordBatch(), nil
+}
+
+// Take returns a batch of the rows of batch at rows, in that order.
+func Take(batch arrow.RecordBatch, rows []int) (arrow.RecordBatch, error) {
+	b := array.NewRecordBuilder(memory.DefaultAllocator, batch.Schema())
+	defer b.Release()
+	for i, col := range batch.Columns() {
+		fb := b.Field(i)
+		for _, row := range rows {
+			if col.IsNull(row) {
+				fb.AppendNull()
+				continue
+			}
+			if err := fb.AppendValueFromString(col.ValueStr(row)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.NewRecordBatch(), nil
+}
+
+func appendColumn(fb array.Builder, field arrow.Field, i int, rows [][]string) error {
+	for n, row := range rows {
+		if i >= len(row) {
+			fb.AppendNull()
+			continue
+		}
+		cell := row[i]
+		if cell == "" && field.Type.ID() != arrow.STRING {
+			fb.AppendNull()
+			continue
+		}
+		var err error
+		switch b := fb.(type) {
+		case *array.StringBuilder:
+			b.Append(cell)
+		case *array.Int64Builder:
+			var v int64
+			if v, err = strconv.ParseInt(cell, 10, 64); err == nil {
+				b.Append(v)
+			}
+		case *array.Float64Builder:
+			var v float64
+			if v, err = strconv.ParseFloat(cell, 64); err == nil {
+				b.Append(v)
+			}
+		case *array.BooleanBuilder:
+			var v bool
+			if v, err = strconv.ParseBool(strings.ToLower(cell)); err == nil {
+				b.Append(v)
+			}
+		default:
+			return &TypeError{Column: field.Name, Type: field.Type, Value: cell, Row: n + 1}
+		}
+		if err != nil {
+			return &TypeError{Column: field.Name, Type: field.Type, Value: cell, Row: n + 1}
+		}
+	}
+	return nil
+}
+
+// TypeError reports a cell that does not parse as the type of its column.
+// Row is the 1-based row of the cell, among the rows given to Build or the
+// data rows read by a CSV Reader.
+type TypeError struct {
+	Column string
+	Type   arrow.DataType
+	Value  string
+	Row    int
+}
+
+func (e *TypeError) Error() string {
+	return "column " + e.Column + ", row " + strconv.Itoa(e.Row) + ": " + strconv.Quote(e.Value) + " is not " + e.Type.String()
+}
+
+// Format returns cell i of a column as text, "" for null. Floats use the
+// shortest representation that round-trips.
+func Format(col arrow.Array, i int) string {
+	if col.IsNull(i) {
+		return ""
+	}
+	switch c := col.(type) {
+	case *array.String:
+		return c.Value(i)
+	case *array.Int64:
+		return strconv.FormatInt(c.Value(i), 10)
+	case *array.Float64:
+		return strconv.FormatFloat(c.Value(i), 'f', -1, 64)
+	case *array.Boolean:
+		return strconv.FormatBool(c.Value(i))
+	}
+	return col.ValueStr(i)
+}
@@ -0,0 +1,165 @@
+package columnar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"csvtools/src/internal/csvio"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// CSVOptions configures FromCSV.
+type CSVOptions struct {
+	// BatchSize is the number of rows per batch; 0 means DefaultBatchSize.
+	BatchSize int
+	// Infer types the columns from the values of the first batch, see Infer;
+	// a later cell not of its column's type fails Next with a TypeError
+	// naming its row. Otherwise every column is a string, which never fails.
+	Infer bool
+	// Types fixes the type of the columns it names, e.g. from a table
+	// schema, whether or not the others are inferred.
+	Types map[string]arrow.DataType
+}
+
+// csvReader reads batches from CSV records whose first record is the header.
+type csvReader struct {
+	src     csvio.Reader
+	size    int
+	schema  *arrow.Schema
+	pending [][]string
+	done    bool
+	// rows counts the data rows of the batches returned so far.
+	rows int
+	// inferred holds the columns typed from the first batch.
+	inferred map[string]bool
+}
+
+// FromCSV returns a Reader over src. Rows shorter than the header get null
+// cells; longer rows are cut to the header width.
+func FromCSV(src csvio.Reader, opts CSVOptions) (Reader, error) {
+	header, err := src.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("no header row")
+		}
+		return nil, err
+	}
+	header = append([]string(nil), header...)
+	r := &csvReader{src: src, size: opts.BatchSize, inferred: make(map[string]bool)}
+	if r.size <= 0 {
+		r.size = DefaultBatchSize
+	}
+	if r.pending, err = r.read(); err != nil {
+		return nil, err
+	}
+	fields := make([]arrow.Field, len(header))
+	values := make([]string, len(r.pending))
+	for i, name := range header {
+		fields[i] = arrow.Field{Name: name, Type: arrow.BinaryTypes.String, Nullable: true}
+		if t, ok := opts.Types[name]; ok {
+			fields[i].Type = t
+		} else if opts.Infer {
+			for n, row := range r.pending {
+				values[n] = ""
+				if i < len(row) {
+					values[n] = row[i]
+				}
+			}
+			fields[i].Type = Infer(values)
+			r.inferred[name] = fields[i].Type.ID() != arrow.STRING
+		}
+	}
+	r.schema = arrow.NewSchema(fields, nil)
+	return r, nil
+}
+
+// read returns up to size records.
+func (r *csvReader) read() ([][]string, error) {
+	var rows [][]string
+	for len(rows) < r.size && !r.done {
+		record, err := r.src.Read()
+		if errors.Is(err, io.EOF) {
+			r.done = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, append([]string(nil), record...))
+	}
+	return rows, nil
+}
+
+func (r *csvReader) Schema() *arrow.Schema {
+	return r.schema
+}
+
+func (r *csvReader) Next() (arrow.RecordBatch, error) {
+	rows := r.pending
+	r.pending = nil
+	if rows == nil {
+		var err error
+		if rows, err = r.read(); err != nil {
+			return nil, err
+		}
+	}
+	if len(rows) == 0 {
+		return nil, io.EOF
+	}
+	batch, err := Build(r.schema, rows)
+	var typeErr *TypeError
+	if errors.As(err, &typeErr) {
+		typeErr.Row += r.rows
+		if r.inferred[typeErr.Column] {
+			return nil, fmt.Errorf("%w (typed from the first %d rows; -infer=false or a -schema keeps it as text)", err, r.size)
+		}
+	}
+	r.rows += len(rows)
+	return batch, err
+}
+
+func (r *csvReader) Close() error {
+	return nil
+}
+
+// csvWriter writes batches as CSV with a header row.
+type csvWriter struct {
+	w      *csvio.Writer
+	header bool
+	record []string
+}
+
+// NewCSVWriter returns a Writer formatting cells with Format into w.
+func NewCSVWriter(w *csvio.Writer) Writer {
+	return &csvWriter{w: w}
+}
+
+func (c *csvWriter) Write(batch arrow.RecordBatch) error {
+	if !c.header {
+		c.header = true
+		names := make([]string, batch.NumCols())
+		for i, field := range batch.Schema().Fields() {
+			names[i] = field.Name
+		}
+		if err := c.w.Write(names); err != nil {
+			return err
+		}
+		c.record = make([]string, batch.NumCols())
+	}
+	for row := range int(batch.NumRows()) {
+		for col := range c.record {
+			c.record[col] = Format(batch.Column(col), row)
+		}
+		if err := c.w.Write(c.record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,68 @@
+package columnar
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"csvtools/src/internal/csvio"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// TestFromCSVLaterBatch reads a column inferred as integers from the first
+// batch whose later rows hold a value that isn't one.
+func TestFromCSVLaterBatch(t *testing.T) {
+	var input strings.Builder
+	input.WriteString("id,v\n")
+	for i := range 150 {
+		input.WriteString(strconv.Itoa(i) + "," + strconv.Itoa(i*2) + "\n")
+	}
+	input.WriteString("150,N/A\n")
+	r, err := FromCSV(csvio.NewReader(strings.NewReader(input.String()), csvio.Options{}), CSVOptions{BatchSize: 100, Infer: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Schema().Field(1).Type.ID() != arrow.INT64 {
+		t.Fatalf("v is %s, want int64", r.Schema().Field(1).Type)
+	}
+	batch, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch.Release()
+	_, err = r.Next()
+	var typeErr *TypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("second batch: %v, want a TypeError", err)
+	}
+	if typeErr.Column != "v" || typeErr.Row != 151 || typeErr.Value != "N/A" {
+		t.Errorf("TypeError = %+v, want column v, row 151, value N/A", typeErr)
+	}
+	if !strings.Contains(err.Error(), "-infer=false") {
+		t.Errorf("error %q doesn't point to -infer=false", err)
+	}
+
+	// Without inference the same input reads to the end.
+	r, err = FromCSV(csvio.NewReader(strings.NewReader(input.String()), csvio.Options{}), CSVOptions{BatchSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := 0
+	for {
+		batch, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows += int(batch.NumRows())
+		batch.Release()
+	}
+	if rows != 151 {
+		t.Errorf("read %d rows, want 151", rows)
+	}
+}
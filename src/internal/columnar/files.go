@@ -0,0 +1,161 @@
+package columnar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"csvtools/src/internal/csvio"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// FileExtensions are the extensions of the columnar files OpenFile reads:
+// Parquet, and Arrow IPC files (also known as Feather v2) or streams.
+var FileExtensions = []string{"parquet", "arrow", "feather", "ipc", "arrows"}
+
+// IsFile reports whether name has one of FileExtensions.
+func IsFile(name string) bool {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	for _, e := range FileExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// arrowMagic starts (and ends) an Arrow IPC file; streams have no magic.
+var arrowMagic = []byte("ARROW1")
+
+// File is what OpenFile reads from, e.g. an *os.File.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+}
+
+// OpenFile returns a Reader for the Parquet or Arrow file r, told apart by
+// name's extension. Parquet is read in batches of batchSize rows; Arrow in
+// the batches it was written in, whether it is an IPC file or a stream.
+func OpenFile(r File, name string, batchSize int) (Reader, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if strings.EqualFold(path.Ext(name), ".parquet") {
+		pf, err := file.NewParquetReader(r)
+		if err != nil {
+			return nil, err
+		}
+		fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{BatchSize: int64(batchSize)}, memory.DefaultAllocator)
+		if err != nil {
+			_ = pf.Close()
+			return nil, err
+		}
+		rr, err := fr.GetRecordReader(context.Background(), nil, nil)
+		if err != nil {
+			_ = pf.Close()
+			return nil, err
+		}
+		return &recordReader{rr: rr, close: pf.Close}, nil
+	}
+	magic := make([]byte, len(arrowMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.Equal(magic, arrowMagic) {
+		fr, err := ipc.NewFileReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return &ipcFileReader{fr: fr}, nil
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	rr, err := ipc.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not an Arrow IPC file or stream: %w", err)
+	}
+	return &recordReader{rr: rr, close: func() error { return nil }}, nil
+}
+
+// recordReader adapts an Arrow record reader.
+type recordReader struct {
+	rr    array.RecordReader
+	close func() error
+}
+
+func (r *recordReader) Schema() *arrow.Schema {
+	return r.rr.Schema()
+}
+
+func (r *recordReader) Next() (arrow.RecordBatch, error) {
+	if !r.rr.Next() {
+		if err := r.rr.Err(); err != nil && err != io.EOF {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	batch := r.rr.RecordBatch()
+	batch.Retain()
+	return batch, nil
+}
+
+func (r *recordReader) Close() error {
+	r.rr.Release()
+	return r.close()
+}
+
+// ipcFileReader reads the batches of an Arrow IPC file in order.
+type ipcFileReader struct {
+	fr   *ipc.FileReader
+	next int
+}
+
+func (r *ipcFileReader) Schema() *arrow.Schema {
+	return r.fr.Schema()
+}
+
+func (r *ipcFileReader) Next() (arrow.RecordBatch, error) {
+	if r.next >= r.fr.NumRecords() {
+		return nil, io.EOF
+	}
+	batch, err := r.fr.RecordBatchAt(r.next)
+	if err != nil {
+		return nil, err
+	}
+	r.next++
+	return batch, nil
+}
+
+func (r *ipcFileReader) Close() error {
+	return r.fr.Close()
+}
+
+// WriteCSV writes every batch of r to w as CSV, formatted as by Format,
+// with a header row even if there are no rows.
+func WriteCSV(w io.Writer, r Reader) error {
+	cw := &csvWriter{w: csvio.NewWriter(w, csvio.WriterOptions{})}
+	if _, err := Copy(cw, r); err != nil {
+		return err
+	}
+	if !cw.header {
+		names := make([]string, r.Schema().NumFields())
+		for i, field := range r.Schema().Fields() {
+			names[i] = field.Name
+		}
+		if err := cw.w.Write(names); err != nil {
+			return err
+		}
+	}
+	return cw.Close()
+}
@@ -0,0 +1,97 @@
+package columnar
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"csvtools/src/internal/discover"
+)
+
+// InputFlags binds -parquet, which reads Parquet and Arrow files as inputs
+// besides CSV files.
+type InputFlags struct {
+	Enabled bool
+}
+
+// Register adds the flag to fs.
+func (f *InputFlags) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.Enabled, "parquet", false, "also read .parquet files and Arrow IPC files and streams (.arrow, .feather, .ipc, .arrows)")
+}
+
+// Apply adds FileExtensions to the files discovery picks up.
+func (f *InputFlags) Apply(discovery *discover.Options) {
+	if !f.Enabled {
+		return
+	}
+	exts := discovery.Extensions
+	if len(exts) == 0 {
+		exts = discover.DefaultExtensions
+	}
+	exts = slices.Clone(exts)
+	for _, name := range FileExtensions {
+		if !slices.ContainsFunc(exts, func(e discover.Extension) bool { return e.Name == name }) {
+			exts = append(exts, discover.Extension{Name: name, Delimiter: ','})
+		}
+	}
+	discovery.Extensions = exts
+}
+
+// Expand replaces the Parquet and Arrow files among files with their rows
+// converted to CSV in dir. The converted files keep the original Path in
+// Source. Other files are kept as they are.
+func (f *InputFlags) Expand(files []discover.File, dir string) ([]discover.File, error) {
+	if !f.Enabled {
+		return files, nil
+	}
+	out := make([]discover.File, len(files))
+	for i, file := range files {
+		out[i] = file
+		if !slices.Contains(FileExtensions, file.Ext) {
+			continue
+		}
+		converted, err := convert(file, dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.Path, err)
+		}
+		out[i] = converted
+	}
+	return out, nil
+}
+
+func convert(file discover.File, dir string) (discover.File, error) {
+	in, err := os.Open(file.Path)
+	if err != nil {
+		return file, err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	r, err := OpenFile(in, file.Path, 0)
+	if err != nil {
+		return file, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	csvFile, err := os.CreateTemp(dir, file.Ext+"-*.csv")
+	if err != nil {
+		return file, err
+	}
+	err = WriteCSV(csvFile, r)
+	if cerr := csvFile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return file, err
+	}
+	converted := file
+	converted.Path, converted.Ext = csvFile.Name(), "csv"
+	converted.Delimiter, converted.FixedDelimiter = ',', true
+	converted.Source = file.Path
+	if info, err := os.Stat(csvFile.Name()); err == nil {
+		converted.Size = info.Size()
+	}
+	return converted, nil
+}
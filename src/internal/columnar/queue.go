@@ -0,0 +1,87 @@
+package columnar
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// DefaultQueueDepth is how many batches CopyQueued reads ahead of the writer.
+const DefaultQueueDepth = 4
+
+// QueueStats describes how a queue between a reader and a writer filled up.
+type QueueStats struct {
+	Batches int64
+	// MaxDepth is the most batches that waited for the writer at once.
+	MaxDepth int
+	// Stalls counts the batches the reader waited to queue as the queue was
+	// full, for Stalled in total.
+	Stalls  int64
+	Stalled time.Duration
+}
+
+// CopyQueued is Copy with w writing on another goroutine, so that reading
+// and transforming the next batches overlaps a slow writer. At most depth
+// batches wait in between: once they do, the reader blocks until the writer
+// takes one, so a sink slower than the input holds reading back instead of
+// batches piling up in memory. A depth of 0 is Copy. It returns once w is
+// done with every batch; it does not close either.
+func CopyQueued(w Writer, r Reader, depth int) (rows int64, stats QueueStats, err error) {
+	if depth <= 0 {
+		rows, err = Copy(w, r)
+		return rows, stats, err
+	}
+	queue := make(chan arrow.RecordBatch, depth)
+	failed := make(chan struct{})
+	done := make(chan struct{})
+	var writeErr error
+	go func() {
+		defer close(done)
+		for batch := range queue {
+			if writeErr == nil {
+				if writeErr = w.Write(batch); writeErr != nil {
+					close(failed)
+				}
+			}
+			batch.Release()
+		}
+	}()
+	defer func() {
+		close(queue)
+		<-done
+		if writeErr != nil {
+			err = writeErr
+		}
+	}()
+	for {
+		batch, err := r.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return rows, stats, nil
+			}
+			return rows, stats, err
+		}
+		rows += batch.NumRows()
+		stats.Batches++
+		select {
+		case queue <- batch:
+		default:
+			start := time.Now()
+			select {
+			case queue <- batch:
+			case <-failed:
+				batch.Release()
+			}
+			stats.Stalls++
+			stats.Stalled += time.Since(start)
+		}
+		stats.MaxDepth = max(stats.MaxDepth, len(queue))
+		select {
+		case <-failed:
+			return rows, stats, nil
+		default:
+		}
+	}
+}
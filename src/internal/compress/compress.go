@@ -0,0 +1,89 @@
+// Package compress compresses output artifacts with gzip or zstd.
+package compress
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec is a flag.Value for "-compress gzip|zstd"; the zero value leaves
+// output uncompressed.
+type Codec string
+
+const (
+	None Codec = ""
+	Gzip Codec = "gzip"
+	Zstd Codec = "zstd"
+)
+
+func (c *Codec) String() string {
+	return string(*c)
+}
+
+func (c *Codec) Set(s string) error {
+	switch Codec(strings.ToLower(s)) {
+	case None, "none":
+		*c = None
+	case Gzip, "gz":
+		*c = Gzip
+	case Zstd, "zst":
+		*c = Zstd
+	default:
+		return fmt.Errorf("unknown compression %q (want gzip or zstd)", s)
+	}
+	return nil
+}
+
+// Ext returns the file extension of the codec, including the dot.
+func (c Codec) Ext() string {
+	switch c {
+	case Gzip:
+		return ".gz"
+	case Zstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// NewWriter returns a writer compressing into w. Closing it flushes the
+// compressed stream but does not close w.
+func (c Codec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	}
+	return nopCloser{w}, nil
+}
+
+// Copy writes the file at path compressed into w.
+func (c Codec) Copy(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	zw, err := c.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, f); err != nil {
+		_ = zw.Close()
+		return fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+	return zw.Close()
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
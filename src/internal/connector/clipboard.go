@@ -0,0 +1,64 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/clipboard"
+	"csvtools/src/internal/columnar"
+	"csvtools/src/internal/csvio"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+func init() {
+	RegisterSource(clipboard.Name, func(Location) (Source, error) { return clipboardSource{}, nil })
+	RegisterSink(clipboard.Name, func(Location, atomicfile.Policy) (Sink, error) { return &clipboardSink{}, nil })
+}
+
+// clipboardSource reads one input called "clipboard" from the system
+// clipboard, tab separated if copied from a spreadsheet or web page.
+type clipboardSource struct{}
+
+func (clipboardSource) Inputs(ctx context.Context) ([]Input, error) {
+	data, err := clipboard.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, clipboard.ErrEmpty
+	}
+	return []Input{{
+		Name:      clipboard.Name,
+		Location:  clipboard.Name,
+		Delimiter: clipboard.Delimiter(data),
+		Open: func(context.Context) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		},
+	}}, nil
+}
+
+// clipboardSink puts one table on the system clipboard on commit, tab
+// separated so it pastes into the cells of a spreadsheet.
+type clipboardSink struct {
+	buf    bytes.Buffer
+	tables int
+}
+
+func (s *clipboardSink) Table(name string, _ *arrow.Schema) (columnar.Writer, error) {
+	if s.tables++; s.tables > 1 {
+		return nil, fmt.Errorf("the clipboard holds one table, can't add %s", name)
+	}
+	return columnar.NewCSVWriter(csvio.NewWriter(&s.buf, csvio.WriterOptions{Comma: '\t'})), nil
+}
+
+func (s *clipboardSink) Commit() error {
+	return clipboard.Write(context.Background(), s.buf.Bytes())
+}
+
+func (s *clipboardSink) Close() error {
+	return nil
+}
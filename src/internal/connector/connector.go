@@ -0,0 +1,317 @@
+// Package connector decouples where data comes from and where it goes. A
+// Source yields CSV inputs from a location such as a directory, a URL or an
+// S3 prefix; a Sink turns columnar batches into tables of a format such as
+// xlsx, SQLite, Parquet or JSON. Both are looked up by URL scheme in a
+// registry, so any source can be combined with any sink:
+//
+//	csvtools convert -from s3://bucket/exports/ -to parquet://out/
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/clipboard"
+	"csvtools/src/internal/columnar"
+	"csvtools/src/internal/flatjson"
+	"csvtools/src/internal/tableschema"
+	"csvtools/src/internal/xmlpath"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// Input is one CSV input of a source.
+type Input struct {
+	// Name is the input's name without extension, used for table and sheet names.
+	Name string
+	// Location is the input's path or URL, e.g. for lineage columns.
+	Location string
+	// Delimiter is the field delimiter implied by the input's extension.
+	Delimiter rune
+	// Converted is set for inputs converted to CSV on the way, e.g. from
+	// JSON: comma separated with a header row, so not to be sniffed.
+	Converted bool
+	// Open returns the input's content. Callers close it.
+	Open func(ctx context.Context) (io.ReadCloser, error)
+}
+
+// Source lists the inputs at a location.
+type Source interface {
+	Inputs(ctx context.Context) ([]Input, error)
+}
+
+// Sink writes tables to a destination. Tables are written one after the
+// other: the writer of a table is closed before the next table is started,
+// and a writer left open after an error is discarded. Commit makes the
+// output visible; Close without Commit discards whatever the sink can
+// discard, and is safe to call after Commit.
+type Sink interface {
+	Table(name string, schema *arrow.Schema) (columnar.Writer, error)
+	Commit() error
+	Close() error
+}
+
+// Constrainer is implemented by sinks that can enforce the rules a table was
+// validated with, e.g. a database as CHECK constraints. Constrain must be
+// called before Table for the schema to apply to that table.
+type Constrainer interface {
+	Constrain(table string, schema *tableschema.Schema)
+}
+
+// Location is a parsed source or sink URL: "scheme://path?query". Paths
+// without a scheme are local paths and "-" is stdin or stdout.
+type Location struct {
+	Scheme string
+	// Path is everything between "://" and "?", e.g. "bucket/key" for S3.
+	Path  string
+	Query url.Values
+	// Raw is the location as given.
+	Raw string
+}
+
+// Parse splits raw into scheme, path and query. Only a scheme of letters,
+// digits, "+", "-" and "." counts, so Windows paths like C:\data aren't
+// mistaken for one.
+func Parse(raw string) (Location, error) {
+	loc := Location{Raw: raw, Path: raw, Query: url.Values{}}
+	scheme, rest, ok := strings.Cut(raw, "://")
+	if !ok || !validScheme(scheme) {
+		return loc, nil
+	}
+	loc.Scheme, loc.Path = strings.ToLower(scheme), rest
+	if path, query, ok := strings.Cut(rest, "?"); ok {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return loc, fmt.Errorf("invalid query in %s: %w", raw, err)
+		}
+		loc.Path, loc.Query = path, values
+	}
+	return loc, nil
+}
+
+func validScheme(s string) bool {
+	if len(s) < 2 {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("+-.", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// SourceFunc opens a source at a location.
+type SourceFunc func(loc Location) (Source, error)
+
+// SinkFunc opens a sink at a location. policy applies to output files that
+// already exist.
+type SinkFunc func(loc Location, policy atomicfile.Policy) (Sink, error)
+
+var (
+	sources = map[string]SourceFunc{}
+	sinks   = map[string]SinkFunc{}
+	// sinkExtensions map file extensions to sink schemes for locations
+	// without a scheme.
+	sinkExtensions = map[string]string{}
+)
+
+// RegisterSource makes a source available under scheme.
+func RegisterSource(scheme string, open SourceFunc) {
+	sources[scheme] = open
+}
+
+// RegisterSink makes a sink available under scheme, and for locations
+// without a scheme that end in one of extensions.
+func RegisterSink(scheme string, open SinkFunc, extensions ...string) {
+	sinks[scheme] = open
+	for _, ext := range extensions {
+		sinkExtensions[ext] = scheme
+	}
+}
+
+// SourceSchemes and SinkSchemes list the registered schemes, sorted.
+func SourceSchemes() []string {
+	return sortedKeys(sources)
+}
+
+func SinkSchemes() []string {
+	return sortedKeys(sinks)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// OpenSource opens the source at raw. Without a scheme, "-" is stdin,
+// "clipboard" the system clipboard and anything else a local file or
+// directory.
+func OpenSource(raw string) (Source, error) {
+	loc, err := Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case loc.Scheme != "":
+	case raw == "-":
+		loc.Scheme = "stdin"
+	case clipboard.Is(raw):
+		loc.Scheme = clipboard.Name
+	default:
+		loc.Scheme = "file"
+	}
+	open, ok := sources[loc.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q in %s (want one of %s)", loc.Scheme, raw, strings.Join(SourceSchemes(), ", "))
+	}
+	jsonOpts := flatjson.Options{Separator: loc.Query.Get("flatten"), Arrays: loc.Query.Get("arrays")}
+	if err := jsonOpts.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", raw, err)
+	}
+	xmlOpts := xmlpath.Options{Record: loc.Query.Get("record")}
+	if err := xmlOpts.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", raw, err)
+	}
+	for _, f := range loc.Query["field"] {
+		field, err := xmlpath.ParseField(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", raw, err)
+		}
+		xmlOpts.Fields = append(xmlOpts.Fields, field)
+	}
+	source, err := open(loc)
+	if err != nil {
+		return nil, err
+	}
+	return convertedSource{Source: source, json: jsonOpts, xml: xmlOpts}, nil
+}
+
+// OpenSink opens the sink at raw. Without a scheme the sink is chosen by
+// the file extension, e.g. out.parquet or out.db, or is the system
+// clipboard for "clipboard".
+func OpenSink(raw string, policy atomicfile.Policy) (Sink, error) {
+	loc, err := parseSink(raw)
+	if err != nil {
+		return nil, err
+	}
+	open, ok := sinks[loc.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unknown sink %q in %s (want one of %s)", loc.Scheme, raw, strings.Join(SinkSchemes(), ", "))
+	}
+	return open(loc, policy)
+}
+
+// parseSink parses raw, telling the scheme of locations without one by the
+// file extension.
+func parseSink(raw string) (Location, error) {
+	loc, err := Parse(raw)
+	if err != nil {
+		return loc, err
+	}
+	if loc.Scheme == "" && clipboard.Is(raw) {
+		loc.Scheme = clipboard.Name
+	}
+	if loc.Scheme == "" {
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(loc.Path), "."))
+		if loc.Scheme = sinkExtensions[ext]; loc.Scheme == "" {
+			return loc, fmt.Errorf("can't tell the output format of %s: give a scheme such as parquet://", raw)
+		}
+	}
+	return loc, nil
+}
+
+// textSinks are the sinks writing values as text, to which typing columns
+// only does harm: 1.50 would be written as 1.5 and 007 as 7.
+var textSinks = map[string]bool{"csv": true, "json": true, clipboard.Name: true}
+
+// Typed reports whether any of the sinks at raws stores typed values, as a
+// database, Parquet or a workbook do, and so wants columns typed.
+func Typed(raws []string) bool {
+	for _, raw := range raws {
+		loc, err := parseSink(raw)
+		if err != nil || !textSinks[loc.Scheme] {
+			return true
+		}
+	}
+	return false
+}
+
+// Fanout is a Sink writing every table to all of its sinks, so one pass over
+// the inputs produces e.g. a workbook, a database and Parquet files.
+type Fanout []Sink
+
+// OpenSinks opens a Fanout over the sinks at raws. Existing outputs are
+// detected here, before any input is read, except for the outputs of
+// Routers, which are opened as their values turn up.
+func OpenSinks(raws []string, policy atomicfile.Policy) (Fanout, error) {
+	return OpenRouted(raws, "", DefaultMaxRoutes, policy)
+}
+
+func (f Fanout) Table(name string, schema *arrow.Schema) (columnar.Writer, error) {
+	writers := make([]columnar.Writer, len(f))
+	for i, sink := range f {
+		var err error
+		if writers[i], err = sink.Table(name, schema); err != nil {
+			return nil, err
+		}
+	}
+	return columnar.Tee(writers...), nil
+}
+
+// Commit commits the sinks in order. If one fails, the ones before it have
+// been written and the ones after it are discarded by Close.
+func (f Fanout) Commit() error {
+	for _, sink := range f {
+		if err := sink.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Annotate passes notes to the sinks that are Annotators.
+func (f Fanout) Annotate(table string, notes *Notes) {
+	for _, sink := range f {
+		if a, ok := sink.(Annotator); ok {
+			a.Annotate(table, notes)
+		}
+	}
+}
+
+// Constrain passes the schema of a table to the sinks that are Constrainers.
+func (f Fanout) Constrain(table string, schema *tableschema.Schema) {
+	for _, sink := range f {
+		if c, ok := sink.(Constrainer); ok {
+			c.Constrain(table, schema)
+		}
+	}
+}
+
+// Label passes a property of the output to the sinks that are Labelers.
+func (f Fanout) Label(name, value string) {
+	for _, sink := range f {
+		if l, ok := sink.(Labeler); ok {
+			l.Label(name, value)
+		}
+	}
+}
+
+func (f Fanout) Close() error {
+	var errs []error
+	for _, sink := range f {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,120 @@
+package connector
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"csvtools/src/internal/columnar"
+	"csvtools/src/internal/flatjson"
+	"csvtools/src/internal/xmlpath"
+)
+
+// convertedSource converts the inputs of a source that are JSON, XML,
+// Parquet or Arrow, by extension, to CSV. For JSON, ?flatten= joins nested keys (default ".")
+// and ?arrays= is json, index or join; for XML, ?record= is the path of the
+// record elements and every ?field=name=path a column.
+type convertedSource struct {
+	Source
+	json flatjson.Options
+	xml  xmlpath.Options
+}
+
+func (s convertedSource) Inputs(ctx context.Context) ([]Input, error) {
+	inputs, err := s.Source.Inputs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, in := range inputs {
+		location, _, _ := strings.Cut(in.Location, "?")
+		var convert func(io.Writer, *os.File) error
+		switch {
+		case flatjson.IsJSON(location):
+			convert = func(w io.Writer, f *os.File) error { return s.json.WriteCSV(w, f) }
+		case strings.EqualFold(path.Ext(location), ".xml"):
+			convert = func(w io.Writer, f *os.File) error { return s.xml.WriteCSV(w, f) }
+		case columnar.IsFile(location):
+			convert = func(w io.Writer, f *os.File) error {
+				r, err := columnar.OpenFile(f, location, 0)
+				if err != nil {
+					return err
+				}
+				defer func() {
+					_ = r.Close()
+				}()
+				return columnar.WriteCSV(w, r)
+			}
+		default:
+			continue
+		}
+		inputs[i].Delimiter, inputs[i].Converted = ',', true
+		inputs[i].Open = converted(in.Open, convert)
+	}
+	return inputs, nil
+}
+
+// converted converts what open returns with convert as it is read. Inputs
+// that aren't local files are spooled to a temp file first, as they may be
+// read twice.
+func converted(open func(context.Context) (io.ReadCloser, error), convert func(io.Writer, *os.File) error) func(context.Context) (io.ReadCloser, error) {
+	return func(ctx context.Context) (io.ReadCloser, error) {
+		rc, err := open(ctx)
+		if err != nil {
+			return nil, err
+		}
+		f, ok := rc.(*os.File)
+		if !ok {
+			if f, err = spool(rc); err != nil {
+				return nil, err
+			}
+		}
+		pr, pw := io.Pipe()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			pw.CloseWithError(convert(pw, f))
+		}()
+		return &convertedReader{PipeReader: pr, done: done, file: f, remove: !ok}, nil
+	}
+}
+
+// spool copies rc into a temp file and closes it.
+func spool(rc io.ReadCloser) (*os.File, error) {
+	defer func() {
+		_ = rc.Close()
+	}()
+	f, err := os.CreateTemp("", "input-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(f, rc); err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// convertedReader reads the converted CSV; Close stops the conversion and
+// closes the input, removing it if it was spooled.
+type convertedReader struct {
+	*io.PipeReader
+	done   chan struct{}
+	file   *os.File
+	remove bool
+}
+
+func (r *convertedReader) Close() error {
+	_ = r.PipeReader.Close()
+	<-r.done
+	err := r.file.Close()
+	if r.remove {
+		_ = os.Remove(r.file.Name())
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"csvtools/src/internal/gsheet"
+)
+
+func init() {
+	RegisterSource("gsheet", openGSheet)
+}
+
+// gsheetSource reads the tabs of a Google Sheets spreadsheet, every visible
+// one or those listed in ?tabs=; each input is named after its tab.
+type gsheetSource struct {
+	ref    gsheet.Ref
+	client *gsheet.Client
+}
+
+func openGSheet(loc Location) (Source, error) {
+	ref, err := gsheet.ParseRef(loc.Raw)
+	if err != nil {
+		return nil, err
+	}
+	return &gsheetSource{ref: ref, client: gsheet.NewClient(ref)}, nil
+}
+
+func (s *gsheetSource) Inputs(ctx context.Context) ([]Input, error) {
+	all, err := s.client.Tabs(ctx, s.ref.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spreadsheet %s: %w", s.ref.ID, err)
+	}
+	tabs, err := s.ref.Selected(all)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]Input, len(tabs))
+	for i, tab := range tabs {
+		inputs[i] = Input{Name: tab.Title, Location: s.ref.Location(tab.Title), Delimiter: ',', Open: s.open(tab.Title)}
+	}
+	return inputs, nil
+}
+
+func (s *gsheetSource) open(tab string) func(context.Context) (io.ReadCloser, error) {
+	return func(ctx context.Context) (io.ReadCloser, error) {
+		rows, err := s.client.Values(ctx, s.ref.ID, tab)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", s.ref.Location(tab), err)
+		}
+		var buf bytes.Buffer
+		if err := gsheet.WriteCSV(&buf, rows); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(&buf), nil
+	}
+}
@@ -0,0 +1,53 @@
+package connector
+
+// Severities of a Note.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Note marks a cell of a table with a problem found in it, such as a failed
+// validation rule. Row counts the data rows of the table from 0 and Column
+// is the index of the column in its schema.
+type Note struct {
+	Row      int64
+	Column   int
+	Severity string
+	Text     string
+}
+
+// Notes collects the notes of one table. It may grow while the table is
+// written, as long as the notes of a row are added before the row reaches
+// the sink's writer.
+type Notes struct {
+	rows map[int64][]Note
+}
+
+// Add adds a note.
+func (n *Notes) Add(note Note) {
+	if n.rows == nil {
+		n.rows = make(map[int64][]Note)
+	}
+	n.rows[note.Row] = append(n.rows[note.Row], note)
+}
+
+// Row returns the notes of data row row.
+func (n *Notes) Row(row int64) []Note {
+	if n == nil {
+		return nil
+	}
+	return n.rows[row]
+}
+
+// Annotator is implemented by sinks that can show notes next to the data,
+// e.g. a workbook filling and commenting the cells. Annotate must be called
+// before Table for the notes to apply to that table.
+type Annotator interface {
+	Annotate(table string, notes *Notes)
+}
+
+// Labeler is implemented by sinks that can carry properties of the whole
+// output, e.g. a workbook in its custom document properties.
+type Labeler interface {
+	Label(name, value string)
+}
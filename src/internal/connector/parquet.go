@@ -0,0 +1,63 @@
+package connector
+
+import (
+	"io"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/columnar"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+func init() {
+	RegisterSink("parquet", openParquet, "parquet")
+}
+
+// parquetSink writes a Snappy compressed Parquet file per table. The column
+// types are those of the batches, so inferred numbers stay numbers.
+type parquetSink struct {
+	files *fileTables
+}
+
+func openParquet(loc Location, policy atomicfile.Policy) (Sink, error) {
+	return &parquetSink{files: newFileTables(loc, policy, "parquet")}, nil
+}
+
+func (s *parquetSink) Table(name string, schema *arrow.Schema) (columnar.Writer, error) {
+	f, err := s.files.create(name)
+	if err != nil {
+		return nil, err
+	}
+	// The parquet writer closes a writer that is an io.Closer, which would
+	// discard the temp file before Commit.
+	fw, err := pqarrow.NewFileWriter(schema, struct{ io.Writer }{f},
+		parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Snappy)),
+		pqarrow.DefaultWriterProps())
+	if err != nil {
+		return nil, err
+	}
+	return parquetWriter{fw}, nil
+}
+
+func (s *parquetSink) Commit() error {
+	return s.files.commit()
+}
+
+func (s *parquetSink) Close() error {
+	return s.files.close()
+}
+
+type parquetWriter struct {
+	fw *pqarrow.FileWriter
+}
+
+func (p parquetWriter) Write(batch arrow.RecordBatch) error {
+	return p.fw.WriteBuffered(batch)
+}
+
+func (p parquetWriter) Close() error {
+	return p.fw.Close()
+}
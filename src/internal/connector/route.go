@@ -0,0 +1,254 @@
+package connector
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/columnar"
+	"csvtools/src/internal/tableschema"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// Placeholder marks where the value of the routing column goes in the
+// location of a Router, e.g. "out/{value}.xlsx" or "s3://bucket/{value}/".
+const Placeholder = "{value}"
+
+// DefaultMaxRoutes is the number of outputs a Router opens at most, so
+// routing on a column such as an ID by mistake fails early instead of
+// writing a file per row.
+const DefaultMaxRoutes = 1000
+
+// Router is a Sink writing every row to the output of the value of a column,
+// e.g. a workbook per customer out of one combined export. The output of a
+// value is opened the first time the value turns up, at the location
+// template with Placeholder replaced by the value made safe for paths; an
+// empty value becomes "_empty". Tables only reach the outputs of the values
+// they hold. Notes aren't passed on, as rows are numbered per output.
+type Router struct {
+	template string
+	column   string
+	max      int
+	policy   atomicfile.Policy
+	// sinks are the outputs by path value, opened in the order of values.
+	sinks  map[string]Sink
+	values map[string]string
+	order  []string
+	labels [][2]string
+	schema map[string]*tableschema.Schema
+}
+
+// NewRouter returns a Router routing rows by column to the sinks at
+// template, which holds Placeholder. It opens at most max outputs.
+func NewRouter(template, column string, max int, policy atomicfile.Policy) (*Router, error) {
+	if !strings.Contains(template, Placeholder) {
+		return nil, fmt.Errorf("%s has no %s placeholder to route rows by", template, Placeholder)
+	}
+	if column == "" {
+		return nil, fmt.Errorf("%s routes rows by value but no column to route by was given", template)
+	}
+	return &Router{template: template, column: column, max: max, policy: policy,
+		sinks: make(map[string]Sink), values: make(map[string]string), schema: make(map[string]*tableschema.Schema)}, nil
+}
+
+// OpenRouted opens a Fanout like OpenSinks, except that locations holding
+// Placeholder become Routers on column.
+func OpenRouted(raws []string, column string, max int, policy atomicfile.Policy) (Fanout, error) {
+	var sinks Fanout
+	for _, raw := range raws {
+		var sink Sink
+		var err error
+		if strings.Contains(raw, Placeholder) {
+			sink, err = NewRouter(raw, column, max, policy)
+		} else {
+			sink, err = OpenSink(raw, policy)
+		}
+		if err != nil {
+			_ = sinks.Close()
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// Outputs returns the locations opened so far, in the order their values
+// turned up.
+func (r *Router) Outputs() []string {
+	outputs := make([]string, len(r.order))
+	for i, v := range r.order {
+		outputs[i] = strings.ReplaceAll(r.template, Placeholder, v)
+	}
+	return outputs
+}
+
+// PathValue returns value as it goes into a routed location: letters,
+// digits, "-", "_" and "." are kept and anything else becomes "_".
+func PathValue(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "_empty"
+	}
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_.", r) {
+			return r
+		}
+		return '_'
+	}, value)
+	if strings.Trim(value, ".") == "" {
+		return strings.Repeat("_", len(value))
+	}
+	return value
+}
+
+// sink returns the output of value, opening it if needed.
+func (r *Router) sink(value string) (Sink, error) {
+	key := PathValue(value)
+	if sink, ok := r.sinks[key]; ok {
+		if r.values[key] != value {
+			return nil, fmt.Errorf("values %q and %q of %s both route to %s", r.values[key], value, r.column, strings.ReplaceAll(r.template, Placeholder, key))
+		}
+		return sink, nil
+	}
+	if len(r.order) >= r.max {
+		return nil, fmt.Errorf("%s has more than %d values to route by", r.column, r.max)
+	}
+	sink, err := OpenSink(strings.ReplaceAll(r.template, Placeholder, key), r.policy)
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range r.labels {
+		if l, ok := sink.(Labeler); ok {
+			l.Label(label[0], label[1])
+		}
+	}
+	r.sinks[key], r.values[key] = sink, value
+	r.order = append(r.order, key)
+	return sink, nil
+}
+
+func (r *Router) Table(name string, schema *arrow.Schema) (columnar.Writer, error) {
+	col := slices.IndexFunc(schema.Fields(), func(f arrow.Field) bool { return f.Name == r.column })
+	if col < 0 {
+		col = slices.IndexFunc(schema.Fields(), func(f arrow.Field) bool { return strings.EqualFold(f.Name, r.column) })
+	}
+	if col < 0 {
+		return nil, fmt.Errorf("table %s has no column %s to route rows by", name, r.column)
+	}
+	return &routeWriter{router: r, name: name, schema: schema, col: col, writers: make(map[string]columnar.Writer)}, nil
+}
+
+// Constrain keeps the schema of a table for the outputs that get it.
+func (r *Router) Constrain(table string, schema *tableschema.Schema) {
+	r.schema[table] = schema
+}
+
+// Label passes a property to every output, including those opened later.
+func (r *Router) Label(name, value string) {
+	r.labels = append(r.labels, [2]string{name, value})
+	for _, key := range r.order {
+		if l, ok := r.sinks[key].(Labeler); ok {
+			l.Label(name, value)
+		}
+	}
+}
+
+// Commit commits the outputs in the order their values turned up.
+func (r *Router) Commit() error {
+	for _, key := range r.order {
+		if err := r.sinks[key].Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Router) Close() error {
+	var errs []error
+	for _, key := range r.order {
+		errs = append(errs, r.sinks[key].Close())
+	}
+	return errors.Join(errs...)
+}
+
+// routeWriter splits the batches of a table by the value of the routing
+// column, keeping the order of rows within every output.
+type routeWriter struct {
+	router  *Router
+	name    string
+	schema  *arrow.Schema
+	col     int
+	writers map[string]columnar.Writer
+	order   []string
+}
+
+func (w *routeWriter) Write(batch arrow.RecordBatch) error {
+	rows := make(map[string][]int)
+	var values []string
+	col := batch.Column(w.col)
+	for i := range int(batch.NumRows()) {
+		v := columnar.Format(col, i)
+		if _, ok := rows[v]; !ok {
+			values = append(values, v)
+		}
+		rows[v] = append(rows[v], i)
+	}
+	for _, v := range values {
+		out, err := w.writer(v)
+		if err != nil {
+			return err
+		}
+		if len(values) == 1 {
+			if err := out.Write(batch); err != nil {
+				return err
+			}
+			continue
+		}
+		part, err := columnar.Take(batch, rows[v])
+		if err != nil {
+			return err
+		}
+		err = out.Write(part)
+		part.Release()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writer returns the writer of the table in the output of value, starting
+// it if needed.
+func (w *routeWriter) writer(value string) (columnar.Writer, error) {
+	if out, ok := w.writers[value]; ok {
+		return out, nil
+	}
+	sink, err := w.router.sink(value)
+	if err != nil {
+		return nil, err
+	}
+	if schema := w.router.schema[w.name]; schema != nil {
+		if c, ok := sink.(Constrainer); ok {
+			c.Constrain(w.name, schema)
+		}
+	}
+	out, err := sink.Table(w.name, w.schema)
+	if err != nil {
+		return nil, err
+	}
+	w.writers[value] = out
+	w.order = append(w.order, value)
+	return out, nil
+}
+
+func (w *routeWriter) Close() error {
+	var errs []error
+	for _, v := range w.order {
+		errs = append(errs, w.writers[v].Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,101 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"csvtools/src/internal/discover"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func init() {
+	RegisterSource("s3", openS3)
+}
+
+// s3Source reads s3://bucket/key, or every object under s3://bucket/prefix/
+// matching ?ext=. Credentials and region come from the usual AWS
+// environment variables and config files; ?region= and ?endpoint= override
+// them, the latter for S3 compatible stores such as MinIO.
+type s3Source struct {
+	bucket, key string
+	exts        discover.Extensions
+	region      string
+	endpoint    string
+}
+
+func openS3(loc Location) (Source, error) {
+	bucket, key, _ := strings.Cut(loc.Path, "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("%s: missing bucket", loc.Raw)
+	}
+	exts, err := extensions(loc)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Source{bucket: bucket, key: key, exts: exts, region: loc.Query.Get("region"), endpoint: loc.Query.Get("endpoint")}, nil
+}
+
+func (s *s3Source) client(ctx context.Context) (*s3.Client, error) {
+	var opts []func(*config.LoadOptions) error
+	if s.region != "" {
+		opts = append(opts, config.WithRegion(s.region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if s.endpoint != "" {
+			o.BaseEndpoint = aws.String(s.endpoint)
+			o.UsePathStyle = true
+		}
+	}), nil
+}
+
+func (s *s3Source) Inputs(ctx context.Context) ([]Input, error) {
+	client, err := s.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.key != "" && !strings.HasSuffix(s.key, "/") {
+		name, delimiter := nameOf(path.Base(s.key), s.exts)
+		return []Input{{Name: name, Location: s.location(s.key), Delimiter: delimiter, Open: s.open(client, s.key)}}, nil
+	}
+	var inputs []Input
+	pages := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: aws.String(s.bucket), Prefix: aws.String(s.key)})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list s3://%s/%s: %w", s.bucket, s.key, err)
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			if _, ok := s.exts.Lookup(path.Base(key)); !ok {
+				continue
+			}
+			name, delimiter := nameOf(path.Base(key), s.exts)
+			inputs = append(inputs, Input{Name: name, Location: s.location(key), Delimiter: delimiter, Open: s.open(client, key)})
+		}
+	}
+	return inputs, nil
+}
+
+func (s *s3Source) location(key string) string {
+	return "s3://" + s.bucket + "/" + key
+}
+
+func (s *s3Source) open(client *s3.Client, key string) func(context.Context) (io.ReadCloser, error) {
+	return func(ctx context.Context) (io.ReadCloser, error) {
+		obj, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get s3://%s/%s: %w", s.bucket, key, err)
+		}
+		return obj.Body, nil
+	}
+}
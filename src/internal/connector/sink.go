@@ -0,0 +1,239 @@
+package connector
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/bundle"
+	"csvtools/src/internal/columnar"
+	"csvtools/src/internal/csvio"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+)
+
+func init() {
+	RegisterSink("json", openJSON, "json", "jsonl", "ndjson")
+	RegisterSink("csv", openCSV, "csv")
+}
+
+// fileTables maps tables to output files. A location ending in one of exts
+// is a single file holding one table; a location ending in .zip, .tar,
+// .tar.gz, .tgz, .tar.zst or .tzst is an archive of a <table>.<exts[0]> file per table,
+// written on commit; anything else is a directory with a <table>.<exts[0]>
+// file per table.
+type fileTables struct {
+	path   string
+	ext    string
+	single bool
+	// bundle is the archive format, and staging the directory the files
+	// wait in until the archive is written.
+	bundle  string
+	staging string
+	policy  atomicfile.Policy
+	files   []*atomicfile.File
+}
+
+func newFileTables(loc Location, policy atomicfile.Policy, exts ...string) *fileTables {
+	path := filepath.FromSlash(loc.Path)
+	t := &fileTables{path: path, ext: exts[0], policy: policy, bundle: bundle.Format(path)}
+	for _, ext := range exts {
+		t.single = t.single || strings.EqualFold(filepath.Ext(path), "."+ext)
+	}
+	return t
+}
+
+// create starts the file of table name.
+func (t *fileTables) create(name string) (*atomicfile.File, error) {
+	path, policy := t.path, t.policy
+	switch {
+	case t.single:
+		if len(t.files) > 0 {
+			return nil, fmt.Errorf("%s holds one table; give a directory to write several", t.path)
+		}
+	case t.bundle != "":
+		if t.staging == "" {
+			if err := atomicfile.Check(t.path, t.policy); err != nil {
+				return nil, err
+			}
+			var err error
+			if t.staging, err = os.MkdirTemp("", "bundle-"); err != nil {
+				return nil, err
+			}
+		}
+		name = strings.NewReplacer("/", "_", `\`, "_").Replace(name)
+		// A table of the same name as an earlier one is refused rather than
+		// replacing it in the archive.
+		path, policy = filepath.Join(t.staging, name+"."+t.ext), atomicfile.NoClobber
+	default:
+		name = strings.NewReplacer("/", "_", `\`, "_").Replace(name)
+		path = filepath.Join(t.path, name+"."+t.ext)
+	}
+	if err := atomicfile.Check(path, policy); err != nil {
+		return nil, err
+	}
+	f, err := atomicfile.Create(path, policy)
+	if err != nil {
+		return nil, err
+	}
+	t.files = append(t.files, f)
+	return f, nil
+}
+
+func (t *fileTables) commit() error {
+	for _, f := range t.files {
+		if err := f.Commit(); err != nil {
+			return err
+		}
+	}
+	if t.bundle == "" || len(t.files) == 0 {
+		return nil
+	}
+	paths := make([]string, len(t.files))
+	for i, f := range t.files {
+		paths[i] = f.Path()
+	}
+	out, err := atomicfile.Create(t.path, t.policy)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	if err := bundle.Write(out, t.bundle, paths); err != nil {
+		return fmt.Errorf("failed to write %s: %w", t.path, err)
+	}
+	return out.Commit()
+}
+
+func (t *fileTables) close() error {
+	var errs []error
+	for _, f := range t.files {
+		errs = append(errs, f.Close())
+	}
+	if t.staging != "" {
+		errs = append(errs, os.RemoveAll(t.staging))
+	}
+	return errors.Join(errs...)
+}
+
+// jsonSink writes JSON Lines, one object per row with the columns in schema
+// order. Numbers and booleans keep their type and null cells are null.
+// "json://-" writes every table to stdout.
+type jsonSink struct {
+	files  *fileTables
+	stdout bool
+}
+
+func openJSON(loc Location, policy atomicfile.Policy) (Sink, error) {
+	return &jsonSink{files: newFileTables(loc, policy, "jsonl", "json", "ndjson"), stdout: loc.Path == "-"}, nil
+}
+
+func (s *jsonSink) Table(name string, schema *arrow.Schema) (columnar.Writer, error) {
+	var out io.Writer = os.Stdout
+	if !s.stdout {
+		f, err := s.files.create(name)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+	keys := make([][]byte, schema.NumFields())
+	for i, field := range schema.Fields() {
+		keys[i], _ = json.Marshal(field.Name)
+	}
+	return &jsonWriter{w: bufio.NewWriter(out), keys: keys}, nil
+}
+
+func (s *jsonSink) Commit() error {
+	return s.files.commit()
+}
+
+func (s *jsonSink) Close() error {
+	return s.files.close()
+}
+
+type jsonWriter struct {
+	w    *bufio.Writer
+	keys [][]byte
+	buf  []byte
+}
+
+func (j *jsonWriter) Write(batch arrow.RecordBatch) error {
+	for row := range int(batch.NumRows()) {
+		j.buf = append(j.buf[:0], '{')
+		for i, key := range j.keys {
+			if i > 0 {
+				j.buf = append(j.buf, ',')
+			}
+			j.buf = append(append(j.buf, key...), ':')
+			j.buf = appendJSON(j.buf, batch.Column(i), row)
+		}
+		j.buf = append(j.buf, '}', '\n')
+		if _, err := j.w.Write(j.buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *jsonWriter) Close() error {
+	return j.w.Flush()
+}
+
+func appendJSON(buf []byte, col arrow.Array, i int) []byte {
+	if col.IsNull(i) {
+		return append(buf, "null"...)
+	}
+	switch c := col.(type) {
+	case *array.Int64:
+		return strconv.AppendInt(buf, c.Value(i), 10)
+	case *array.Float64:
+		return strconv.AppendFloat(buf, c.Value(i), 'g', -1, 64)
+	case *array.Boolean:
+		return strconv.AppendBool(buf, c.Value(i))
+	}
+	quoted, _ := json.Marshal(columnar.Format(col, i))
+	return append(buf, quoted...)
+}
+
+// csvSink writes a comma separated file with a header row per table.
+// "csv://-" writes every table to stdout; ?excel_safe=true neutralizes
+// cells a spreadsheet would run as formulas, see csvio.ExcelSafe.
+type csvSink struct {
+	files     *fileTables
+	stdout    bool
+	excelSafe bool
+}
+
+func openCSV(loc Location, policy atomicfile.Policy) (Sink, error) {
+	return &csvSink{files: newFileTables(loc, policy, "csv"), stdout: loc.Path == "-", excelSafe: loc.Query.Get("excel_safe") == "true"}, nil
+}
+
+func (s *csvSink) Table(name string, _ *arrow.Schema) (columnar.Writer, error) {
+	var out io.Writer = os.Stdout
+	if !s.stdout {
+		f, err := s.files.create(name)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+	return columnar.NewCSVWriter(csvio.NewWriter(out, csvio.WriterOptions{ExcelSafe: s.excelSafe})), nil
+}
+
+func (s *csvSink) Commit() error {
+	return s.files.commit()
+}
+
+func (s *csvSink) Close() error {
+	return s.files.close()
+}
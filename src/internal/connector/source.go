@@ -0,0 +1,144 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"csvtools/src/internal/discover"
+)
+
+func init() {
+	RegisterSource("file", openLocal)
+	RegisterSource("stdin", func(Location) (Source, error) { return stdinSource{}, nil })
+	RegisterSource("http", openHTTP)
+	RegisterSource("https", openHTTP)
+}
+
+// extensions returns the extensions given as ?ext=csv,tsv, or the defaults.
+func extensions(loc Location) (discover.Extensions, error) {
+	if loc.Query.Get("ext") == "" {
+		return discover.DefaultExtensions, nil
+	}
+	var exts discover.Extensions
+	if err := exts.Set(loc.Query.Get("ext")); err != nil {
+		return nil, fmt.Errorf("%s: %w", loc.Raw, err)
+	}
+	return exts, nil
+}
+
+// nameOf returns the input name and delimiter of a file name. Names that
+// match none of exts still get a delimiter by their extension.
+func nameOf(name string, exts discover.Extensions) (string, rune) {
+	ext, ok := exts.Lookup(name)
+	if !ok {
+		ext.Name = strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+		ext.Delimiter = ','
+		if d, known := discover.DefaultDelimiters[ext.Name]; known {
+			ext.Delimiter = d
+		}
+	}
+	return strings.TrimSuffix(name[:len(name)-len(ext.Name)], "."), ext.Delimiter
+}
+
+// localSource reads a file, or the files in a directory picked up as the
+// converters do; ?ext=csv,tsv and ?recursive=true select them.
+type localSource struct {
+	path      string
+	exts      discover.Extensions
+	recursive bool
+}
+
+func openLocal(loc Location) (Source, error) {
+	exts, err := extensions(loc)
+	if err != nil {
+		return nil, err
+	}
+	return &localSource{path: filepath.FromSlash(loc.Path), exts: exts, recursive: loc.Query.Get("recursive") == "true"}, nil
+}
+
+func (s *localSource) Inputs(context.Context) ([]Input, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		name, delimiter := nameOf(filepath.Base(s.path), s.exts)
+		return []Input{{Name: name, Location: s.path, Delimiter: delimiter, Open: openFile(s.path)}}, nil
+	}
+	files, err := discover.Find(s.path, discover.Options{Extensions: s.exts, Recursive: s.recursive, Order: discover.Order{Key: "name"}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", s.path, err)
+	}
+	inputs := make([]Input, len(files))
+	for i, f := range files {
+		inputs[i] = Input{Name: f.Name, Location: f.Path, Delimiter: f.Delimiter, Open: openFile(f.Path)}
+	}
+	return inputs, nil
+}
+
+func openFile(path string) func(context.Context) (io.ReadCloser, error) {
+	return func(context.Context) (io.ReadCloser, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		return f, nil
+	}
+}
+
+// stdinSource reads one comma separated input called "stdin".
+type stdinSource struct{}
+
+func (stdinSource) Inputs(context.Context) ([]Input, error) {
+	return []Input{{
+		Name:      "stdin",
+		Location:  "-",
+		Delimiter: ',',
+		Open: func(context.Context) (io.ReadCloser, error) {
+			return io.NopCloser(os.Stdin), nil
+		},
+	}}, nil
+}
+
+// httpSource downloads one file with GET. It is named after the last path
+// segment of the URL.
+type httpSource struct {
+	url string
+}
+
+func openHTTP(loc Location) (Source, error) {
+	return &httpSource{url: loc.Raw}, nil
+}
+
+func (s *httpSource) Inputs(context.Context) ([]Input, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	name, delimiter := nameOf(path.Base(req.URL.Path), discover.DefaultExtensions)
+	if name == "" || name == "/" || name == "." {
+		name = req.URL.Hostname()
+	}
+	return []Input{{
+		Name:      name,
+		Location:  s.url,
+		Delimiter: delimiter,
+		Open: func(ctx context.Context) (io.ReadCloser, error) {
+			resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+			if err != nil {
+				return nil, fmt.Errorf("failed to download %s: %w", s.url, err)
+			}
+			if resp.StatusCode != http.StatusOK {
+				_ = resp.Body.Close()
+				return nil, fmt.Errorf("failed to download %s: %s", s.url, resp.Status)
+			}
+			return resp.Body, nil
+		},
+	}}, nil
+}
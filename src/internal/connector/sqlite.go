@@ -0,0 +1,256 @@
+package connector
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/columnar"
+	"csvtools/src/internal/sqlitedb"
+	"csvtools/src/internal/tableschema"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+)
+
+func init() {
+	RegisterSink("sqlite", openSQLite, "db", "sqlite", "sqlite3")
+}
+
+// sqliteSink writes a table per input into a database, which is created if
+// needed. Like to_sqlite -db it appends to tables that exist. Each table is
+// loaded in one transaction, so a failed table leaves no rows behind. Table
+// and column names are kept as they are; ?sanitize=true cleans them as
+// to_sqlite -sanitize-names does. ?strict=true creates STRICT tables, so
+// SQLite rejects values that don't fit the column types, and ?checks=true
+// turns the constraints of the table schema a table was validated with into
+// column constraints, so the database keeps enforcing them.
+type sqliteSink struct {
+	db       *sql.DB
+	last     *sqliteWriter
+	sanitize bool
+	strict   bool
+	checks   bool
+	schemas  map[string]*tableschema.Schema
+}
+
+func openSQLite(loc Location, _ atomicfile.Policy) (Sink, error) {
+	db, err := sqlitedb.Open(filepath.FromSlash(loc.Path), "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", loc.Path, err)
+	}
+	return &sqliteSink{db: db, sanitize: loc.Query.Get("sanitize") == "true", strict: loc.Query.Get("strict") == "true",
+		checks: loc.Query.Get("checks") == "true", schemas: make(map[string]*tableschema.Schema)}, nil
+}
+
+func (s *sqliteSink) Constrain(table string, schema *tableschema.Schema) {
+	s.schemas[table] = schema
+}
+
+var nonIdentifier = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// identifier names tables and columns the way to_sqlite does.
+func (s *sqliteSink) identifier(name string) string {
+	if s.sanitize {
+		name = nonIdentifier.ReplaceAllString(name, "_")
+		if name != "" && name[0] >= '0' && name[0] <= '9' {
+			name = "_" + name
+		}
+		name = strings.Trim(name, "_")
+	}
+	if name = strings.TrimSpace(sqlitedb.Name(name)); name == "" {
+		name = "column"
+	}
+	return name
+}
+
+func sqlType(t arrow.DataType) string {
+	switch t.ID() {
+	case arrow.INT64, arrow.BOOL:
+		return "INTEGER"
+	case arrow.FLOAT64:
+		return "REAL"
+	}
+	return "TEXT"
+}
+
+// columnConstraints returns the constraints of column, quoted as name, that
+// enforce the rules of its field in schema: required, unique,
+// length, range and enum. Patterns are left out, as SQLite has no regular
+// expressions of its own; ranges of strings only apply to ISO dates and
+// times, which compare as text. Booleans are kept to 0 and 1.
+func columnConstraints(name string, column arrow.Field, schema *tableschema.Schema) string {
+	t := column.Type
+	var b strings.Builder
+	if t.ID() == arrow.BOOL {
+		fmt.Fprintf(&b, " CHECK (%s IN (0, 1))", name)
+	}
+	if schema == nil {
+		return b.String()
+	}
+	field := schema.Field(column.Name)
+	if field == nil || field.Constraints == nil {
+		return b.String()
+	}
+	c := field.Constraints
+	if c.Required {
+		b.WriteString(" NOT NULL")
+	}
+	if c.Unique {
+		b.WriteString(" UNIQUE")
+	}
+	if c.MinLength != nil {
+		fmt.Fprintf(&b, " CHECK (length(%s) >= %d)", name, *c.MinLength)
+	}
+	if c.MaxLength != nil {
+		fmt.Fprintf(&b, " CHECK (length(%s) <= %d)", name, *c.MaxLength)
+	}
+	ordered := field.Format == "" || field.Format == "default"
+	for _, bound := range []struct {
+		op    string
+		value any
+	}{{">=", c.Minimum}, {"<=", c.Maximum}} {
+		switch v := bound.value.(type) {
+		case float64:
+			fmt.Fprintf(&b, " CHECK (%s %s %s)", name, bound.op, strconv.FormatFloat(v, 'g', -1, 64))
+		case string:
+			if ordered && (field.Type == "date" || field.Type == "time" || field.Type == "datetime") {
+				fmt.Fprintf(&b, " CHECK (%s %s %s)", name, bound.op, sqlString(v))
+			}
+		}
+	}
+	if len(c.Enum) > 0 {
+		values := make([]string, len(c.Enum))
+		for i, v := range c.Enum {
+			values[i] = sqlLiteral(t, v)
+		}
+		fmt.Fprintf(&b, " CHECK (%s IN (%s))", name, strings.Join(values, ", "))
+	}
+	return b.String()
+}
+
+// sqlLiteral returns the cell v as a literal of a column of type t.
+func sqlLiteral(t arrow.DataType, v string) string {
+	switch t.ID() {
+	case arrow.INT64:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return strconv.FormatInt(n, 10)
+		}
+	case arrow.FLOAT64:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+	case arrow.BOOL:
+		if b, err := strconv.ParseBool(v); err == nil {
+			if b {
+				return "1"
+			}
+			return "0"
+		}
+	}
+	return sqlString(v)
+}
+
+func sqlString(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+}
+
+func (s *sqliteSink) Table(name string, schema *arrow.Schema) (columnar.Writer, error) {
+	table := s.identifier(name)
+	if sqlitedb.Reserved(table) {
+		table = "_" + table
+	}
+	table = sqlitedb.Quote(table)
+	columns := make([]string, schema.NumFields())
+	names := make([]string, schema.NumFields())
+	seen := make(map[string]string, schema.NumFields())
+	for i, field := range schema.Fields() {
+		// SQLite ignores case in column names.
+		column := s.identifier(field.Name)
+		if other, ok := seen[strings.ToLower(column)]; ok {
+			return nil, fmt.Errorf("columns %q and %q of %s both load into column %s", other, field.Name, name, column)
+		}
+		seen[strings.ToLower(column)] = field.Name
+		names[i] = sqlitedb.Quote(column)
+		columns[i] = names[i] + " " + sqlType(field.Type)
+		if s.checks {
+			columns[i] += columnConstraints(names[i], field, s.schemas[name])
+		}
+	}
+	options := ""
+	if s.strict {
+		options = " STRICT"
+	}
+	if _, err := s.db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)%s", table, strings.Join(columns, ", "), options)); err != nil {
+		return nil, fmt.Errorf("failed to create table %s: %w", table, err)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(names, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")))
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("failed to prepare insert into %s: %w", table, err)
+	}
+	s.last = &sqliteWriter{tx: tx, stmt: stmt, row: make([]any, len(names))}
+	return s.last, nil
+}
+
+func (s *sqliteSink) Commit() error {
+	return nil
+}
+
+// Close rolls back a table whose writer was not closed.
+func (s *sqliteSink) Close() error {
+	if s.last != nil && !s.last.done {
+		_ = s.last.stmt.Close()
+		_ = s.last.tx.Rollback()
+	}
+	return s.db.Close()
+}
+
+type sqliteWriter struct {
+	tx   *sql.Tx
+	stmt *sql.Stmt
+	row  []any
+	done bool
+}
+
+func (w *sqliteWriter) Write(batch arrow.RecordBatch) error {
+	for row := range int(batch.NumRows()) {
+		for i := range w.row {
+			w.row[i] = sqlValue(batch.Column(i), row)
+		}
+		if _, err := w.stmt.Exec(w.row...); err != nil {
+			return fmt.Errorf("failed to insert row: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *sqliteWriter) Close() error {
+	w.done = true
+	_ = w.stmt.Close()
+	return w.tx.Commit()
+}
+
+func sqlValue(col arrow.Array, i int) any {
+	if col.IsNull(i) {
+		return nil
+	}
+	switch c := col.(type) {
+	case *array.Int64:
+		return c.Value(i)
+	case *array.Float64:
+		return c.Value(i)
+	case *array.Boolean:
+		return c.Value(i)
+	}
+	return columnar.Format(col, i)
+}
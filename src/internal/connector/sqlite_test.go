@@ -0,0 +1,114 @@
+package connector
+
+import (
+	"testing"
+
+	"csvtools/src/internal/columnar"
+	"csvtools/src/internal/sqlitedb"
+	"csvtools/src/internal/tableschema"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// TestSQLiteHostileNames loads a table and columns named after hostile
+// headers and checks that the table survives with exactly those names, NUL
+// bytes replaced.
+func TestSQLiteHostileNames(t *testing.T) {
+	db, err := sqlitedb.Open(":memory:", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: has a database of its own.
+	db.SetMaxOpenConns(1)
+	sink := &sqliteSink{db: db, schemas: make(map[string]*tableschema.Schema)}
+	defer func() {
+		_ = sink.Close()
+	}()
+	if _, err := db.Exec(`CREATE TABLE victim (id INTEGER); INSERT INTO victim VALUES (1)`); err != nil {
+		t.Fatal(err)
+	}
+
+	table := `"); DROP TABLE victim--`
+	columns := []string{`"); DROP TABLE victim--`, `a"b`, "x; DELETE FROM victim;", "-- comment", "日付", "Größe (kg)", "a\x00b", "ab"}
+	fields := make([]arrow.Field, len(columns))
+	row := make([]string, len(columns))
+	for i, name := range columns {
+		fields[i] = arrow.Field{Name: name, Type: arrow.BinaryTypes.String, Nullable: true}
+		row[i] = name
+	}
+	schema := arrow.NewSchema(fields, nil)
+	batch, err := columnar.Build(schema, [][]string{row})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer batch.Release()
+	w, err := sink.Table(table, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows int
+	if err := db.QueryRow(`SELECT count(*) FROM victim`).Scan(&rows); err != nil || rows != 1 {
+		t.Errorf("victim has %d rows (%v), want 1", rows, err)
+	}
+	if err := db.QueryRow(`SELECT count(*) FROM ` + sqlitedb.Quote(table)).Scan(&rows); err != nil || rows != 1 {
+		t.Errorf("table %q has %d rows (%v), want 1", table, rows, err)
+	}
+	result, err := db.Query(`SELECT name FROM pragma_table_info(?) ORDER BY cid`, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = result.Close()
+	}()
+	var got []string
+	for result.Next() {
+		var name string
+		if err := result.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, name)
+	}
+	if len(got) != len(columns) {
+		t.Fatalf("columns = %q, want %q", got, columns)
+	}
+	for i := range columns {
+		if want := sqlitedb.Name(columns[i]); got[i] != want {
+			t.Errorf("column %d = %q, want %q", i, got[i], want)
+		}
+	}
+	for _, name := range columns {
+		var value string
+		query := "SELECT " + sqlitedb.Quote(name) + " FROM " + sqlitedb.Quote(table)
+		if err := db.QueryRow(query).Scan(&value); err != nil || value != name {
+			t.Errorf("%s = %q (%v), want %q", query, value, err, name)
+		}
+	}
+}
+
+// TestSQLiteClashingNames checks that columns loading into one column of
+// the table are an error rather than one overwriting the other.
+func TestSQLiteClashingNames(t *testing.T) {
+	db, err := sqlitedb.Open(":memory:", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	sink := &sqliteSink{db: db, schemas: make(map[string]*tableschema.Schema)}
+	defer func() {
+		_ = sink.Close()
+	}()
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "a\x00b", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "A" + sqlitedb.NULReplacement + "B", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	if _, err := sink.Table("t", schema); err == nil {
+		t.Error("Table with clashing columns succeeded")
+	}
+}
@@ -0,0 +1,209 @@
+package connector
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/columnar"
+	"csvtools/src/internal/xlsx"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/xuri/excelize/v2"
+)
+
+func init() {
+	RegisterSink("xlsx", openXLSX, "xlsx")
+}
+
+// xlsxSink writes one workbook with a sheet per table. Numbers and booleans
+// are written as such, so they need no conversion in Excel. Cells with notes
+// are filled red for errors and yellow for warnings, with the notes as a
+// comment.
+type xlsxSink struct {
+	path   string
+	policy atomicfile.Policy
+	file   *excelize.File
+	names  xlsx.SheetNames
+	notes  map[string]*Notes
+	styles map[string]int
+	labels map[string]string
+}
+
+func openXLSX(loc Location, policy atomicfile.Policy) (Sink, error) {
+	path := filepath.FromSlash(loc.Path)
+	if err := atomicfile.Check(path, policy); err != nil {
+		return nil, err
+	}
+	return &xlsxSink{path: path, policy: policy, file: excelize.NewFile(), notes: make(map[string]*Notes)}, nil
+}
+
+func (s *xlsxSink) Annotate(table string, notes *Notes) {
+	s.notes[table] = notes
+}
+
+func (s *xlsxSink) Label(name, value string) {
+	if s.labels == nil {
+		s.labels = make(map[string]string)
+	}
+	s.labels[name] = value
+}
+
+// noteStyles creates the fills of annotated cells.
+func (s *xlsxSink) noteStyles() (map[string]int, error) {
+	if s.styles != nil {
+		return s.styles, nil
+	}
+	styles := make(map[string]int)
+	for severity, color := range map[string]string{SeverityError: "FFC7CE", SeverityWarning: "FFEB9C"} {
+		id, err := s.file.NewStyle(&excelize.Style{Fill: excelize.Fill{Type: "pattern", Color: []string{color}, Pattern: 1}})
+		if err != nil {
+			return nil, err
+		}
+		styles[severity] = id
+	}
+	s.styles = styles
+	return styles, nil
+}
+
+func (s *xlsxSink) Table(name string, schema *arrow.Schema) (columnar.Writer, error) {
+	sheet := s.names.Name(name)
+	if _, err := s.file.NewSheet(sheet); err != nil {
+		return nil, fmt.Errorf("failed to create sheet %s: %w", sheet, err)
+	}
+	sw, err := s.file.NewStreamWriter(sheet)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]any, schema.NumFields())
+	for i, field := range schema.Fields() {
+		header[i] = field.Name
+	}
+	if err := sw.SetRow("A1", header); err != nil {
+		return nil, err
+	}
+	w := &xlsxWriter{file: s.file, sw: sw, sheet: sheet, row: 2, cells: make([]any, schema.NumFields()), notes: s.notes[name]}
+	if w.notes != nil {
+		if w.styles, err = s.noteStyles(); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (s *xlsxSink) Commit() error {
+	if !s.names.Taken("Sheet1") {
+		_ = s.file.DeleteSheet("Sheet1")
+	}
+	for _, name := range slices.Sorted(maps.Keys(s.labels)) {
+		if err := s.file.SetCustomProps(excelize.CustomProperty{Name: name, Value: s.labels[name]}); err != nil {
+			return fmt.Errorf("failed to set custom property %s: %w", name, err)
+		}
+	}
+	out, err := atomicfile.Create(s.path, s.policy)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	if err := s.file.Write(out); err != nil {
+		return fmt.Errorf("failed to write %s: %w", s.path, err)
+	}
+	return out.Commit()
+}
+
+func (s *xlsxSink) Close() error {
+	return s.file.Close()
+}
+
+type xlsxWriter struct {
+	file     *excelize.File
+	sw       *excelize.StreamWriter
+	sheet    string
+	row      int
+	cells    []any
+	notes    *Notes
+	styles   map[string]int
+	comments []excelize.Comment
+}
+
+func (x *xlsxWriter) Write(batch arrow.RecordBatch) error {
+	for row := range int(batch.NumRows()) {
+		if x.row > excelize.TotalRows {
+			return fmt.Errorf("sheet %s: more than %d rows", x.sheet, excelize.TotalRows)
+		}
+		for i := range x.cells {
+			x.cells[i] = cellValue(batch.Column(i), row)
+		}
+		x.annotate()
+		cell, _ := excelize.CoordinatesToCellName(1, x.row)
+		if err := x.sw.SetRow(cell, x.cells); err != nil {
+			return err
+		}
+		x.row++
+	}
+	return nil
+}
+
+// annotate fills the cells of the current row that have notes, an error
+// winning over a warning, and queues the notes as comments.
+func (x *xlsxWriter) annotate() {
+	notes := x.notes.Row(int64(x.row - 2))
+	if len(notes) == 0 {
+		return
+	}
+	texts := make(map[int]string)
+	for _, note := range notes {
+		if note.Column < 0 || note.Column >= len(x.cells) {
+			continue
+		}
+		cell, isCell := x.cells[note.Column].(excelize.Cell)
+		if !isCell {
+			cell = excelize.Cell{Value: x.cells[note.Column]}
+		}
+		if !isCell || note.Severity == SeverityError {
+			cell.StyleID = x.styles[note.Severity]
+		}
+		x.cells[note.Column] = cell
+		if texts[note.Column] != "" {
+			texts[note.Column] += "\n"
+		}
+		texts[note.Column] += note.Severity + ": " + note.Text
+	}
+	for _, col := range slices.Sorted(maps.Keys(texts)) {
+		name, _ := excelize.CoordinatesToCellName(col+1, x.row)
+		x.comments = append(x.comments, excelize.Comment{Cell: name, Author: "csvtools", Paragraph: []excelize.RichTextRun{{Text: texts[col]}}})
+	}
+}
+
+func (x *xlsxWriter) Close() error {
+	if err := x.sw.Flush(); err != nil {
+		return err
+	}
+	// Comments live outside the sheet data, so they can follow the stream.
+	for _, comment := range x.comments {
+		if err := x.file.AddComment(x.sheet, comment); err != nil {
+			return fmt.Errorf("failed to comment %s!%s: %w", x.sheet, comment.Cell, err)
+		}
+	}
+	return nil
+}
+
+func cellValue(col arrow.Array, i int) any {
+	if col.IsNull(i) {
+		return nil
+	}
+	switch c := col.(type) {
+	case *array.Int64:
+		return c.Value(i)
+	case *array.Float64:
+		return c.Value(i)
+	case *array.Boolean:
+		return c.Value(i)
+	}
+	return columnar.Format(col, i)
+}
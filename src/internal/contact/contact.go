@@ -0,0 +1,224 @@
+// Package contact checks and normalizes the contact data most CSVs carry:
+// email addresses, phone numbers in E.164 format and IBANs.
+package contact
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Formats are the formats Normalize knows.
+var Formats = []string{"email", "phone", "iban"}
+
+// Normalize returns value in its normal form in format, one of Formats, or
+// why it is not valid. region is the ISO country code numbers without a
+// country code are in, for phone numbers.
+func Normalize(format, value, region string) (string, error) {
+	switch format {
+	case "email":
+		return Email(value)
+	case "phone":
+		return Phone(value, region)
+	case "iban":
+		return IBAN(value)
+	}
+	return "", fmt.Errorf("unknown format %q (want %s)", format, strings.Join(Formats, ", "))
+}
+
+// Email checks the syntax of an address, as in user@example.com, and
+// returns it trimmed, without "mailto:" or angle brackets, and with the
+// domain in lower case. The local part must be a dot-atom and the domain a
+// name of at least two ASCII labels ending in a top level domain; quoted
+// local parts, IP address literals and internationalized names in Unicode
+// are not accepted.
+func Email(value string) (string, error) {
+	s := strings.TrimSpace(value)
+	if len(s) >= 7 && strings.EqualFold(s[:7], "mailto:") {
+		s = s[7:]
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "<"), ">")
+	local, domain, ok := strings.Cut(s, "@")
+	switch {
+	case !ok:
+		return "", fmt.Errorf("%q has no @", value)
+	case strings.Contains(domain, "@"):
+		return "", fmt.Errorf("%q has more than one @", value)
+	case len(s) > 254:
+		return "", fmt.Errorf("%q is longer than 254 characters", value)
+	case local == "" || len(local) > 64:
+		return "", fmt.Errorf("%q needs a user part of 1 to 64 characters", value)
+	case strings.HasPrefix(local, ".") || strings.HasSuffix(local, ".") || strings.Contains(local, ".."):
+		return "", fmt.Errorf("%q has misplaced dots before the @", value)
+	}
+	for _, r := range local {
+		if !(isAlnum(r) || r == '.' || strings.ContainsRune("!#$%&'*+/=?^_`{|}~-", r)) {
+			return "", fmt.Errorf("%q has %q before the @", value, r)
+		}
+	}
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("%q needs a domain such as example.com", value)
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return "", fmt.Errorf("%q has an invalid domain", value)
+		}
+		for _, r := range label {
+			if !isAlnum(r) && r != '-' {
+				return "", fmt.Errorf("%q has %q in its domain", value, r)
+			}
+		}
+	}
+	tld := labels[len(labels)-1]
+	if len(tld) < 2 || (!strings.HasPrefix(tld, "xn--") && strings.ContainsAny(tld, "0123456789-")) {
+		return "", fmt.Errorf("%q has an invalid top level domain", value)
+	}
+	return local + "@" + domain, nil
+}
+
+func isAlnum(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+// callingCodes are the country calling codes of regions, and trunkless the
+// regions whose national numbers keep their leading 0.
+var (
+	callingCodes = map[string]string{
+		"US": "1", "CA": "1", "GB": "44", "IE": "353", "DE": "49", "AT": "43", "CH": "41",
+		"LI": "423", "FR": "33", "BE": "32", "NL": "31", "LU": "352", "ES": "34", "PT": "351",
+		"IT": "39", "MT": "356", "CY": "357", "GR": "30", "DK": "45", "SE": "46", "NO": "47",
+		"FI": "358", "IS": "354", "EE": "372", "LV": "371", "LT": "370", "PL": "48", "CZ": "420",
+		"SK": "421", "HU": "36", "SI": "386", "HR": "385", "RO": "40", "BG": "359", "RS": "381",
+		"UA": "380", "TR": "90", "IL": "972", "AE": "971", "SA": "966", "EG": "20", "ZA": "27",
+		"NG": "234", "KE": "254", "IN": "91", "PK": "92", "CN": "86", "HK": "852", "TW": "886",
+		"JP": "81", "KR": "82", "SG": "65", "MY": "60", "TH": "66", "ID": "62", "PH": "63",
+		"VN": "84", "AU": "61", "NZ": "64", "BR": "55", "AR": "54", "CL": "56", "CO": "57",
+		"PE": "51", "MX": "52", "RU": "7",
+	}
+	trunkless = map[string]bool{"IT": true, "SM": true, "VA": true}
+)
+
+// CheckRegion reports a region Phone doesn't know.
+func CheckRegion(region string) error {
+	if region == "" {
+		return nil
+	}
+	if _, ok := callingCodes[strings.ToUpper(region)]; !ok {
+		return fmt.Errorf("unknown phone region %q, give the ISO country code of a supported region, e.g. DE", region)
+	}
+	return nil
+}
+
+// Phone returns a phone number in E.164 format, "+" and up to 15 digits,
+// e.g. +493012345678. Blanks, dashes, dots, slashes and parentheses are
+// dropped, as is a "(0)" after the country code; "00" starts an
+// international number like "+". Numbers without either are national ones
+// of region: its trunk prefix 0 (1 in North America) is dropped and its
+// calling code put in front. Numbers with extensions or letters are invalid.
+func Phone(value, region string) (string, error) {
+	s := strings.TrimSpace(value)
+	s = strings.Replace(s, "(0)", "", 1)
+	var digits strings.Builder
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+		case strings.ContainsRune(" -./()\u00a0", r):
+		default:
+			return "", fmt.Errorf("%q is not a phone number", value)
+		}
+	}
+	number := digits.String()
+	switch {
+	case strings.HasPrefix(s, "+"):
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	default:
+		if region == "" {
+			return "", fmt.Errorf("%q has no country code", value)
+		}
+		region = strings.ToUpper(region)
+		code, ok := callingCodes[region]
+		if !ok {
+			return "", CheckRegion(region)
+		}
+		switch {
+		case code == "1" && len(number) == 11 && number[0] == '1':
+			number = number[1:]
+		case !trunkless[region] && strings.HasPrefix(number, "0"):
+			number = number[1:]
+		}
+		if code == "1" && len(number) != 10 {
+			return "", fmt.Errorf("%q is not a 10 digit North American number", value)
+		}
+		number = code + number
+	}
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", fmt.Errorf("%q is not a valid international number", value)
+	}
+	return "+" + number, nil
+}
+
+// ibanLengths are the IBAN lengths of the countries of the IBAN registry.
+// IBANs of other countries are only held to 15 to 34 characters.
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16, "BG": 22, "BH": 22,
+	"BR": 29, "BY": 28, "CH": 21, "CR": 22, "CY": 28, "CZ": 24, "DE": 22, "DK": 18, "DO": 28,
+	"EE": 20, "EG": 29, "ES": 24, "FI": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23,
+	"GL": 18, "GR": 27, "GT": 28, "HR": 21, "HU": 28, "IE": 22, "IL": 23, "IQ": 23, "IS": 26,
+	"IT": 27, "JO": 30, "KW": 30, "KZ": 20, "LB": 28, "LC": 32, "LI": 21, "LT": 20, "LU": 20,
+	"LV": 21, "MC": 27, "MD": 24, "ME": 22, "MK": 19, "MR": 27, "MT": 31, "MU": 30, "NL": 18,
+	"NO": 15, "PK": 24, "PL": 28, "PS": 29, "PT": 25, "QA": 29, "RO": 24, "RS": 22, "SA": 24,
+	"SC": 31, "SE": 24, "SI": 19, "SK": 24, "SM": 27, "ST": 25, "SV": 28, "TL": 23, "TN": 24,
+	"TR": 26, "UA": 29, "VA": 22, "VG": 24, "XK": 20,
+}
+
+var errChecksum = errors.New("checksum")
+
+// IBAN checks an IBAN's country, length and ISO 7064 mod 97 checksum and
+// returns it in electronic format: upper case without blanks, dashes or an
+// "IBAN" prefix.
+func IBAN(value string) (string, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSpace(strings.TrimPrefix(s, "IBAN"))
+	s = strings.NewReplacer(" ", "", "-", "", "\u00a0", "").Replace(s)
+	if len(s) < 15 || len(s) > 34 {
+		return "", fmt.Errorf("%q is not 15 to 34 characters long", value)
+	}
+	country := s[:2]
+	if country[0] < 'A' || country[0] > 'Z' || country[1] < 'A' || country[1] > 'Z' || s[2] < '0' || s[2] > '9' || s[3] < '0' || s[3] > '9' {
+		return "", fmt.Errorf("%q does not start with a country code and check digits", value)
+	}
+	if n, ok := ibanLengths[country]; ok && len(s) != n {
+		return "", fmt.Errorf("%q is not %d characters long, as IBANs of %s are", value, n, country)
+	}
+	if err := mod97(s[4:] + s[:4]); err != nil {
+		if errors.Is(err, errChecksum) {
+			return "", fmt.Errorf("%q has a wrong checksum", value)
+		}
+		return "", fmt.Errorf("%q %w", value, err)
+	}
+	return s, nil
+}
+
+// mod97 checks that s, letters counting as 10 to 35, is 1 modulo 97.
+func mod97(s string) error {
+	rem := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			rem = (rem*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			rem = (rem*100 + int(r-'A') + 10) % 97
+		default:
+			return fmt.Errorf("has %q, which IBANs don't", r)
+		}
+	}
+	if rem != 1 {
+		return errChecksum
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package csvio
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrColumnCount is returned when a record doesn't have
+// Options.ExpectColumns fields.
+var ErrColumnCount = errors.New("unexpected number of columns")
+
+// ErrRowCount is returned when an input has fewer rows than Options.MinRows
+// or more than Options.MaxRows.
+var ErrRowCount = errors.New("unexpected number of rows")
+
+// widthReader fails on the first record without the expected number of
+// fields, so that a truncated export doesn't quietly become a narrow table.
+type widthReader struct {
+	Reader
+	want    int
+	records int
+}
+
+func (w *widthReader) Read() ([]string, error) {
+	record, err := w.Reader.Read()
+	if err != nil {
+		return record, err
+	}
+	w.records++
+	if len(record) != w.want {
+		if w.records == 1 {
+			return nil, fmt.Errorf("%w: header has %d columns, expected %d", ErrColumnCount, len(record), w.want)
+		}
+		return nil, fmt.Errorf("%w: row %d has %d fields, expected %d", ErrColumnCount, w.records-1, len(record), w.want)
+	}
+	return record, nil
+}
+
+// countReader fails once an input has more than max data rows, and at its
+// end if it has fewer than min.
+type countReader struct {
+	Reader
+	min, max int
+	records  int // the header included
+}
+
+func (c *countReader) Read() ([]string, error) {
+	record, err := c.Reader.Read()
+	if errors.Is(err, io.EOF) && c.records-1 < c.min {
+		return nil, fmt.Errorf("%w: %d rows, expected at least %d", ErrRowCount, max(c.records-1, 0), c.min)
+	}
+	if err != nil {
+		return record, err
+	}
+	c.records++
+	if c.max > 0 && c.records-1 > c.max {
+		return nil, fmt.Errorf("%w: more than %d rows", ErrRowCount, c.max)
+	}
+	return record, nil
+}
+
+// RowLimit bounds the number of data rows of the inputs whose file name
+// matches Pattern, a path.Match pattern. Zero is no bound.
+type RowLimit struct {
+	Pattern string `yaml:"pattern"`
+	Min     int    `yaml:"min"`
+	Max     int    `yaml:"max"`
+}
+
+// RowLimits is a flag.Value of pattern=min:max limits, e.g.
+// "sales_*.csv=1000:" or "*_delta.csv=:50000".
+type RowLimits []RowLimit
+
+func (r *RowLimits) String() string {
+	var parts []string
+	for _, l := range *r {
+		part := l.Pattern + "="
+		if l.Min > 0 {
+			part += strconv.Itoa(l.Min)
+		}
+		part += ":"
+		if l.Max > 0 {
+			part += strconv.Itoa(l.Max)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (r *RowLimits) Set(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		pattern, bounds, ok := strings.Cut(strings.TrimSpace(part), "=")
+		lo, hi, ok2 := strings.Cut(bounds, ":")
+		if !ok || !ok2 || pattern == "" {
+			return fmt.Errorf("want pattern=min:max, got %q", part)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		limit := RowLimit{Pattern: pattern}
+		for _, b := range []struct {
+			s string
+			n *int
+		}{{lo, &limit.Min}, {hi, &limit.Max}} {
+			if b.s == "" {
+				continue
+			}
+			n, err := strconv.Atoi(b.s)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid row count %q in %q", b.s, part)
+			}
+			*b.n = n
+		}
+		*r = append(*r, limit)
+	}
+	return nil
+}
+
+// AssertFlags binds -expect-columns, -min-rows, -max-rows and -row-limits,
+// which check the shape of the inputs.
+type AssertFlags struct {
+	ExpectColumns int
+	MinRows       int
+	MaxRows       int
+	RowLimits     RowLimits
+}
+
+// Register adds the flags to fs.
+func (f *AssertFlags) Register(fs *flag.FlagSet) {
+	fs.IntVar(&f.ExpectColumns, "expect-columns", 0, "fail an input whose header or rows don't have exactly this many columns; overrides -ragged")
+	fs.IntVar(&f.MinRows, "min-rows", 0, "fail an input with fewer data rows than this")
+	fs.IntVar(&f.MaxRows, "max-rows", 0, "fail an input with more data rows than this; 0 for no limit")
+	fs.Var(&f.RowLimits, "row-limits", "min and max data rows by file name pattern instead, e.g. \"sales_*.csv=1000:,*_delta.csv=:50000\" (repeatable)")
+}
+
+// Load checks the flags.
+func (f *AssertFlags) Load() error {
+	if f.ExpectColumns < 0 {
+		return fmt.Errorf("-expect-columns must not be negative, got %d", f.ExpectColumns)
+	}
+	for _, l := range append(RowLimits{{Min: f.MinRows, Max: f.MaxRows}}, f.RowLimits...) {
+		if l.Min < 0 || l.Max < 0 {
+			return fmt.Errorf("row counts must not be negative, got %d and %d", l.Min, l.Max)
+		}
+		if l.Max > 0 && l.Min > l.Max {
+			return fmt.Errorf("at least %d rows and at most %d can't both hold", l.Min, l.Max)
+		}
+	}
+	return nil
+}
+
+// Apply copies the flags into opts for the input at location, a path or
+// URL. The first row limit whose pattern matches its file name replaces
+// -min-rows and -max-rows.
+func (f *AssertFlags) Apply(opts *Options, location string) {
+	opts.ExpectColumns = f.ExpectColumns
+	opts.MinRows, opts.MaxRows = f.MinRows, f.MaxRows
+	name := path.Base(filepath.ToSlash(location))
+	for _, l := range f.RowLimits {
+		if ok, _ := path.Match(l.Pattern, name); ok {
+			opts.MinRows, opts.MaxRows = l.Min, l.Max
+			break
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package csvio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// benchRows are the rows of the inputs the benchmarks read and write: a
+// narrow table of ids, names, amounts, dates and free text, some of it
+// quoted.
+const benchRows = 20000
+
+func benchRecords() [][]string {
+	records := make([][]string, 0, benchRows+1)
+	records = append(records, []string{"id", "name", "amount", "date", "note"})
+	for i := range benchRows {
+		records = append(records, []string{
+			strconv.Itoa(i),
+			fmt.Sprintf("customer %d", i%997),
+			strconv.FormatFloat(float64(i)*1.25, 'f', 2, 64),
+			fmt.Sprintf("2024-%02d-%02d", i%12+1, i%28+1),
+			fmt.Sprintf("note, with \"quotes\" %d", i),
+		})
+	}
+	return records
+}
+
+func benchInput(b *testing.B) []byte {
+	b.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WriterOptions{})
+	if err := w.WriteAll(benchRecords()); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func benchmarkRead(b *testing.B, opts Options) {
+	input := benchInput(b)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for b.Loop() {
+		r := NewReader(bytes.NewReader(input), opts)
+		rows := 0
+		for {
+			_, err := r.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+			rows++
+		}
+		if rows != benchRows+1 {
+			b.Fatalf("read %d records, want %d", rows, benchRows+1)
+		}
+	}
+}
+
+func BenchmarkReader(b *testing.B) {
+	b.Run("sequential", func(b *testing.B) {
+		benchmarkRead(b, Options{ReuseRecord: true})
+	})
+	b.Run("parallel", func(b *testing.B) {
+		benchmarkRead(b, Options{ReuseRecord: true, Workers: max(runtime.NumCPU(), 2)})
+	})
+	b.Run("lenient", func(b *testing.B) {
+		benchmarkRead(b, Options{ReuseRecord: true, Lenient: true})
+	})
+}
+
+func BenchmarkWriter(b *testing.B) {
+	records := benchRecords()
+	for _, opts := range []struct {
+		name string
+		opts WriterOptions
+	}{
+		{"minimal", WriterOptions{}},
+		{"all", WriterOptions{Quoting: QuoteAll}},
+		{"excel_safe", WriterOptions{ExcelSafe: true}},
+	} {
+		b.Run(opts.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				w := NewWriter(io.Discard, opts.opts)
+				if err := w.WriteAll(records); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
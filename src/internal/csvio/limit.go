@@ -0,0 +1,52 @@
+package csvio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrRecordTooLarge is returned when a record exceeds Options.MaxRecordSize.
+var ErrRecordTooLarge = errors.New("record too large")
+
+// sizeLimit sits below the read buffer and refuses to read further once the
+// current record has grown past max bytes, so that memory stays bounded even
+// if no record ever ends.
+type sizeLimit struct {
+	r    io.Reader
+	max  int64 // includes the read buffer, which may hold the next records
+	read int64 // bytes handed out so far
+	base int64 // input offset of the end of the last record
+}
+
+func (s *sizeLimit) Read(p []byte) (int, error) {
+	if s.read-s.base > s.max {
+		return 0, ErrRecordTooLarge
+	}
+	n, err := s.r.Read(p)
+	s.read += int64(n)
+	return n, err
+}
+
+// limitedReader enforces the exact record size after every record.
+type limitedReader struct {
+	Reader
+	limit *sizeLimit
+	max   int64
+}
+
+func (l *limitedReader) Read() ([]string, error) {
+	record, err := l.Reader.Read()
+	if errors.Is(err, ErrRecordTooLarge) {
+		return nil, fmt.Errorf("%w: record starting at byte %d exceeds %d bytes", ErrRecordTooLarge, l.limit.base, l.max)
+	}
+	if err != nil {
+		return record, err
+	}
+	end := l.Reader.InputOffset()
+	if size := end - l.limit.base; size > l.max {
+		return nil, fmt.Errorf("%w: record starting at byte %d is %d bytes, limit is %d", ErrRecordTooLarge, l.limit.base, size, l.max)
+	}
+	l.limit.base = end
+	return record, nil
+}
@@ -0,0 +1,240 @@
+package csvio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// parallelChunkSize is how much input a worker parses at a time.
+const parallelChunkSize = 4 << 20
+
+// chunkBuffers recycles the buffers of parsed chunks: the records own copies
+// of their fields, so that a buffer is free once its chunk is parsed, and a
+// big input would otherwise allocate and collect one per chunk.
+var chunkBuffers = sync.Pool{New: func() any { return new([]byte) }}
+
+// chunkBuffer returns an empty buffer with room for n bytes.
+func chunkBuffer(n int) *[]byte {
+	buf := chunkBuffers.Get().(*[]byte)
+	*buf = slices.Grow((*buf)[:0], n)
+	return buf
+}
+
+// chunk is a run of whole records of the input, parsed by a worker.
+type chunk struct {
+	data   []byte
+	buf    *[]byte // holds data, recycled once parsed
+	offset int64   // input offset of data
+	line   int     // input lines before data
+	err    error   // of reading the input, after data
+	done   chan parsed
+}
+
+type parsed struct {
+	records [][]string
+	ends    []int64 // input offset past every record
+	err     error
+}
+
+// parallelReader parses the input on several goroutines. A splitter cuts the
+// input into chunks at line breaks outside quoted fields, which only needs
+// to count quotes, workers parse the chunks with encoding/csv and Read
+// returns the records in input order. This takes strict RFC 4180 quoting:
+// with LazyQuotes a bare quote would throw the count off.
+type parallelReader struct {
+	chunks  chan *chunk // in input order, at most workers ahead
+	current parsed
+	next    int
+	offset  int64
+	err     error
+	stop    chan struct{}
+}
+
+func newParallelReader(in *bufio.Reader, opts Options) *parallelReader {
+	p := &parallelReader{chunks: make(chan *chunk, opts.Workers), stop: make(chan struct{})}
+	work := make(chan *chunk, opts.Workers)
+	maxPending := int64(0)
+	if opts.MaxRecordSize > 0 {
+		maxPending = opts.MaxRecordSize + parallelChunkSize
+	}
+	go split(in, maxPending, p.chunks, work, p.stop)
+	for range opts.Workers {
+		go parseChunks(work, opts.Comma)
+	}
+	// The goroutines only share the channels with p, so that a reader
+	// dropped before the end of its input stops them once collected.
+	runtime.AddCleanup(p, func(stop chan struct{}) { close(stop) }, p.stop)
+	return p
+}
+
+func (p *parallelReader) InputOffset() int64 { return p.offset }
+
+func (p *parallelReader) Read() ([]string, error) {
+	for p.next == len(p.current.records) {
+		if p.current.err != nil {
+			p.err, p.current.err = p.current.err, nil
+		}
+		if p.err != nil {
+			return nil, p.err
+		}
+		c, ok := <-p.chunks
+		if !ok {
+			p.err = io.EOF
+			continue
+		}
+		p.current, p.next = <-c.done, 0
+		if p.current.err == nil {
+			p.current.err = c.err
+		}
+	}
+	record := p.current.records[p.next]
+	p.offset = p.current.ends[p.next]
+	p.current.records[p.next] = nil
+	p.next++
+	return record, nil
+}
+
+// split cuts in into chunks, queueing each both in order for Read and for
+// the workers. A record longer than maxPending, unless 0, fails with
+// ErrRecordTooLarge.
+func split(in *bufio.Reader, maxPending int64, ordered, work chan<- *chunk, stop <-chan struct{}) {
+	defer close(ordered)
+	defer close(work)
+	var (
+		buf     = chunkBuffer(parallelChunkSize)
+		pending = *buf
+		offset  int64
+		line    int
+		quoted  bool
+		scanned int // bytes of pending whose quotes are counted
+		cut     int // end of the last line break outside quotes in pending
+	)
+	send := func(c *chunk) bool {
+		c.done = make(chan parsed, 1)
+		select {
+		case ordered <- c:
+		case <-stop:
+			return false
+		}
+		select {
+		case work <- c:
+		case <-stop:
+			return false
+		}
+		return true
+	}
+	for {
+		pending = slices.Grow(pending, parallelChunkSize)
+		n, err := io.ReadFull(in, pending[len(pending):len(pending)+parallelChunkSize])
+		pending = pending[:len(pending)+n]
+		for i := scanned; i < len(pending); i++ {
+			switch pending[i] {
+			case '"':
+				quoted = !quoted
+			case '\n':
+				if !quoted {
+					cut = i + 1
+				}
+			}
+		}
+		scanned = len(pending)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// The rest is the last record.
+			send(&chunk{data: pending, buf: buf, offset: offset, line: line})
+			return
+		}
+		if err != nil {
+			// Only the whole records before err are returned.
+			send(&chunk{data: pending[:cut], buf: buf, offset: offset, line: line, err: err})
+			return
+		}
+		if cut == 0 {
+			if maxPending > 0 && int64(len(pending)) > maxPending {
+				send(&chunk{offset: offset, line: line,
+					err: fmt.Errorf("%w: record starting at byte %d exceeds %d bytes", ErrRecordTooLarge, offset, maxPending-parallelChunkSize)})
+				return
+			}
+			continue
+		}
+		// The rest moves to a new buffer, as the worker recycles this one.
+		data := pending[:cut]
+		next := chunkBuffer(len(pending) - cut + parallelChunkSize)
+		*next = append(*next, pending[cut:]...)
+		lines := bytes.Count(data, []byte{'\n'})
+		if !send(&chunk{data: data, buf: buf, offset: offset, line: line}) {
+			return
+		}
+		offset += int64(cut)
+		line += lines
+		buf, pending = next, *next
+		scanned -= cut
+		cut = 0
+	}
+}
+
+// parseChunks parses the chunks of work.
+func parseChunks(work <-chan *chunk, comma rune) {
+	for c := range work {
+		var p parsed
+		reader := csv.NewReader(bytes.NewReader(c.data))
+		reader.Comma = comma
+		reader.FieldsPerRecord = -1
+		for {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				var parseErr *csv.ParseError
+				if errors.As(err, &parseErr) {
+					parseErr.StartLine += c.line
+					parseErr.Line += c.line
+				}
+				p.err = err
+				break
+			}
+			p.records = append(p.records, record)
+			p.ends = append(p.ends, c.offset+reader.InputOffset())
+		}
+		if c.buf != nil {
+			*c.buf = c.data[:0]
+			chunkBuffers.Put(c.buf)
+		}
+		c.done <- p
+	}
+}
+
+// ParallelFlags binds -parse-workers, which parses every input on several
+// cores.
+type ParallelFlags struct {
+	Workers int
+}
+
+// Register adds the flag to fs.
+func (f *ParallelFlags) Register(fs *flag.FlagSet) {
+	fs.IntVar(&f.Workers, "parse-workers", 1, "parse every input on this many cores, in chunks, for single huge files; 0 for all of them")
+}
+
+// Load checks the flag.
+func (f *ParallelFlags) Load() error {
+	if f.Workers < 0 {
+		return fmt.Errorf("-parse-workers must not be negative, got %d", f.Workers)
+	}
+	if f.Workers == 0 {
+		f.Workers = runtime.NumCPU()
+	}
+	return nil
+}
+
+// Apply copies the flag into opts.
+func (f *ParallelFlags) Apply(opts *Options) {
+	opts.Workers = f.Workers
+}
@@ -0,0 +1,93 @@
+package csvio
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RaggedPolicy says what to do with rows whose field count differs from the header.
+type RaggedPolicy string
+
+const (
+	// RaggedPad pads short rows with empty cells and truncates long rows to
+	// the header width.
+	RaggedPad RaggedPolicy = "pad"
+	// RaggedTruncate truncates long rows and leaves short rows short.
+	RaggedTruncate RaggedPolicy = "truncate"
+	// RaggedError fails on the first ragged row.
+	RaggedError RaggedPolicy = "error"
+	// RaggedSkip drops ragged rows.
+	RaggedSkip RaggedPolicy = "skip"
+)
+
+// ErrRaggedRow is returned by RaggedRows.Fix under RaggedError.
+var ErrRaggedRow = errors.New("ragged row")
+
+// String implements flag.Value.
+func (p *RaggedPolicy) String() string {
+	if *p == "" {
+		return string(RaggedPad)
+	}
+	return string(*p)
+}
+
+// Set implements flag.Value.
+func (p *RaggedPolicy) Set(s string) error {
+	switch RaggedPolicy(s) {
+	case RaggedPad, RaggedTruncate, RaggedError, RaggedSkip:
+		*p = RaggedPolicy(s)
+		return nil
+	}
+	return fmt.Errorf("unknown ragged row policy %q (want pad, truncate, error or skip)", s)
+}
+
+// RaggedRows applies a policy to the rows of one file and counts the rows it
+// changed. The zero Policy behaves like RaggedPad.
+type RaggedRows struct {
+	Policy RaggedPolicy
+	// Width is the expected field count, normally the header length.
+	Width int
+
+	Padded    int
+	Truncated int
+	Skipped   int
+}
+
+// Fix returns record shaped according to the policy. keep is false when the
+// row must be dropped. row is the 1-based data row number used in errors.
+func (r *RaggedRows) Fix(record []string, row int) (out []string, keep bool, err error) {
+	if len(record) == r.Width {
+		return record, true, nil
+	}
+	switch r.Policy {
+	case RaggedError:
+		return nil, false, fmt.Errorf("%w: data row %d has %d fields, header has %d", ErrRaggedRow, row, len(record), r.Width)
+	case RaggedSkip:
+		r.Skipped++
+		return nil, false, nil
+	}
+	if len(record) > r.Width {
+		r.Truncated++
+		return record[:r.Width], true, nil
+	}
+	if r.Policy == RaggedTruncate {
+		return record, true, nil
+	}
+	r.Padded++
+	for len(record) < r.Width {
+		record = append(record, "")
+	}
+	return record, true, nil
+}
+
+// Affected is the number of rows that were padded, truncated or skipped.
+func (r *RaggedRows) Affected() int {
+	return r.Padded + r.Truncated + r.Skipped
+}
+
+// Add accumulates the counts of other into r.
+func (r *RaggedRows) Add(other RaggedRows) {
+	r.Padded += other.Padded
+	r.Truncated += other.Truncated
+	r.Skipped += other.Skipped
+}
@@ -0,0 +1,98 @@
+package csvio
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// RawReader is implemented by the readers of Options.Raw. ReadRaw returns
+// the next record along with its bytes in the input, line break included
+// unless it is the last line, so that a command writing CSV in the same
+// dialect can copy it instead of quoting every field again. raw is only
+// valid until the next call.
+type RawReader interface {
+	Reader
+	ReadRaw() (record []string, raw []byte, err error)
+	// Dialect is the dialect the input is read with.
+	Dialect() Dialect
+}
+
+// recorder keeps what is read through it from input offset base on, for
+// rawReader to slice records from. Once off, it keeps nothing.
+type recorder struct {
+	r    io.Reader
+	buf  []byte
+	base int64
+	off  bool
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if !r.off {
+		r.buf = append(r.buf, p[:n]...)
+	}
+	return n, err
+}
+
+// drop forgets the input before offset.
+func (r *recorder) drop(offset int64) {
+	n := int(offset - r.base)
+	r.base = offset
+	if n >= len(r.buf)/2 {
+		r.buf = append(r.buf[:0], r.buf[n:]...)
+	} else {
+		r.buf = r.buf[n:]
+	}
+}
+
+// rawReader is a csv.Reader that also returns the bytes of the records.
+type rawReader struct {
+	csv     *csv.Reader
+	rec     *recorder
+	dialect Dialect
+	limit   *sizeLimit
+	max     int64
+	offset  int64
+}
+
+// rawable reports whether opts read input as it is, which Options.Raw
+// needs.
+func rawable(opts Options) bool {
+	return opts.Separator == "" && opts.SplitPattern == nil && !opts.Lenient && opts.Workers <= 1 &&
+		len(opts.Comments) == 0 && opts.Footer == nil && opts.FooterRows == 0 && opts.Header != HeaderAbsent &&
+		opts.ExpectColumns == 0 && opts.MinRows == 0 && opts.MaxRows == 0
+}
+
+func (r *rawReader) Dialect() Dialect { return r.dialect }
+
+func (r *rawReader) InputOffset() int64 { return r.offset }
+
+func (r *rawReader) Read() ([]string, error) {
+	record, _, err := r.ReadRaw()
+	return record, err
+}
+
+func (r *rawReader) ReadRaw() ([]string, []byte, error) {
+	record, err := r.csv.Read()
+	if errors.Is(err, ErrRecordTooLarge) {
+		return nil, nil, fmt.Errorf("%w: record starting at byte %d exceeds %d bytes", ErrRecordTooLarge, r.offset, r.max)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	end := r.csv.InputOffset()
+	if r.limit != nil {
+		if size := end - r.offset; size > r.max {
+			return nil, nil, fmt.Errorf("%w: record starting at byte %d is %d bytes, limit is %d", ErrRecordTooLarge, r.offset, size, r.max)
+		}
+		r.limit.base = end
+	}
+	r.rec.drop(r.offset)
+	raw := r.rec.buf[:end-r.offset]
+	r.offset = end
+	// encoding/csv skips blank lines before a record.
+	return record, bytes.TrimLeft(raw, "\r\n"), nil
+}
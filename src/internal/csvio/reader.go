@@ -0,0 +1,394 @@
+// Package csvio provides the CSV readers shared by the converters and the
+// csvtools commands.
+package csvio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Reader is the subset of *csv.Reader the tools rely on.
+type Reader interface {
+	// Read returns the next record or io.EOF.
+	Read() ([]string, error)
+	// InputOffset returns the byte offset just past the last record read.
+	InputOffset() int64
+}
+
+// Recovery describes a spot where a lenient reader repaired malformed input.
+type Recovery struct {
+	// Line is the 1-based input line where the damaged record starts.
+	Line int
+	// Reason says what was wrong and how it was handled.
+	Reason string
+}
+
+// Options configures NewReader.
+type Options struct {
+	// Comma is the field delimiter; zero means ','.
+	Comma rune
+	// Separator, when set, separates fields instead of Comma, for
+	// separators of several characters such as "||". SplitPattern splits
+	// lines into fields at its matches instead; quotes are then only
+	// stripped from fields wrapped in them. Neither is sniffed.
+	Separator    string
+	SplitPattern *regexp.Regexp
+	// LazyQuotes allows quotes in unquoted fields, as in csv.Reader.
+	LazyQuotes bool
+	// ReuseRecord lets Read reuse the returned slice, as in csv.Reader.
+	ReuseRecord bool
+	// Lenient recovers from malformed records instead of failing: a quoted
+	// field that is never closed is re-read as a plain line and parsing
+	// resumes on the next line. Ragged rows are always accepted.
+	Lenient bool
+	// MaxRecordLines bounds how many lines a quoted field may span in
+	// lenient mode before the reader gives up on it and re-synchronizes.
+	// Zero means DefaultMaxRecordLines.
+	MaxRecordLines int
+	// OnRecover, when set, is called for every repair made in lenient mode.
+	OnRecover func(Recovery)
+	// MaxRecordSize is the largest record in bytes the reader accepts before
+	// failing with ErrRecordTooLarge; zero means no limit. Records of any
+	// length are read otherwise, so this guards memory against runaway input
+	// such as an unterminated quote in a huge file.
+	MaxRecordSize int64
+	// BufferSize is the read buffer size; zero means DefaultBufferSize.
+	BufferSize int
+
+	// Quote is the quote character, an ASCII one; zero means '"'.
+	Quote rune
+	// Header says whether the input has a header row. Without one, Read
+	// returns a header naming the columns column_1, column_2, and so on.
+	Header Presence
+	// Sniff guesses what isn't given from the first SniffSize bytes of the
+	// input, see Sniff: the delimiter unless FixedComma is set, in which
+	// case Comma is only a hint, the quote unless Quote is set and the
+	// header row if Header is HeaderGuess.
+	Sniff      bool
+	FixedComma bool
+	// SniffSize is how much input Sniff looks at; zero means
+	// DefaultSniffSize. It is capped by BufferSize.
+	SniffSize int
+	// OnDialect, when set, is called with the dialect the input is read
+	// with, sniffed or not.
+	OnDialect func(Dialect)
+
+	// Comments are prefixes of comment lines, which are skipped unless they
+	// continue a quoted field.
+	Comments []string
+	// Footer drops the records at the end of the input having a field that
+	// matches it, such as a row of totals; FooterRows drops that many
+	// records at the end. Neither drops the header.
+	Footer     *regexp.Regexp
+	FooterRows int
+
+	// ExpectColumns, when set, fails the input with ErrColumnCount on the
+	// first record, the header included, without that many fields.
+	ExpectColumns int
+	// MinRows and MaxRows, when set, fail the input with ErrRowCount at its
+	// end if it has fewer data rows, and as soon as it has more.
+	MinRows, MaxRows int
+
+	// Workers, above 1, parses the input on that many goroutines, see
+	// parallelReader. It is ignored with Separator, SplitPattern,
+	// LazyQuotes and Lenient, which need the sequential readers.
+	Workers int
+
+	// Raw asks for a RawReader. It is ignored unless the input is read as it
+	// is: with Comments, Footer, FooterRows, a Quote other than '"', no
+	// header and the options that take another reader than encoding/csv or
+	// check the shape of the input, Read is all there is.
+	Raw bool
+}
+
+// DefaultMaxRecordLines is the default for Options.MaxRecordLines.
+const DefaultMaxRecordLines = 100
+
+// DefaultMaxRecordSize is the record size limit the tools use unless told
+// otherwise with -max-record-size.
+const DefaultMaxRecordSize = 64 << 20
+
+// DefaultBufferSize is the default for Options.BufferSize.
+const DefaultBufferSize = 256 << 10
+
+// NewReader returns a reader over r that accepts a variable number of fields
+// per record. Without Options.Lenient or Options.MaxRecordSize it is a plain
+// *csv.Reader.
+func NewReader(r io.Reader, opts Options) Reader {
+	if opts.Comma == 0 {
+		opts.Comma = ','
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultBufferSize
+	}
+	separated := opts.Separator != "" || opts.SplitPattern != nil
+	parallel := opts.Workers > 1 && !separated && !opts.LazyQuotes && !opts.Lenient
+	var limit *sizeLimit
+	if opts.MaxRecordSize > 0 {
+		limit = &sizeLimit{r: r, max: opts.MaxRecordSize + int64(opts.BufferSize)}
+		// The parallel reader reads far ahead and bounds records itself.
+		if !parallel {
+			r = limit
+		}
+	}
+	var raw *recorder
+	if opts.Raw && rawable(opts) {
+		raw = &recorder{r: r}
+		r = raw
+	}
+	// csv.NewReader keeps a *bufio.Reader that is large enough as it is.
+	in := bufio.NewReaderSize(r, opts.BufferSize)
+	if opts.Sniff {
+		size := opts.SniffSize
+		if size <= 0 {
+			size = DefaultSniffSize
+		}
+		// A short sample at the end of the input is all there is; other
+		// errors surface on the first Read.
+		sample, _ := in.Peek(min(size, opts.BufferSize))
+		if len(opts.Comments) > 0 {
+			sample = dropComments(sample, opts.Comments)
+		}
+		guess := Sniff(sample, opts.Comma)
+		if separated {
+			guess.Header = sniffHeader(sniffSeparated(sample, opts))
+		} else if !opts.FixedComma {
+			opts.Comma = guess.Comma
+		}
+		if opts.Quote == 0 {
+			opts.Quote = guess.Quote
+		}
+		if opts.Header == HeaderGuess && !guess.Header {
+			opts.Header = HeaderAbsent
+		}
+	}
+	if opts.OnDialect != nil {
+		quote := opts.Quote
+		if quote == 0 {
+			quote = '"'
+		}
+		d := Dialect{Comma: opts.Comma, Quote: quote, Header: opts.Header != HeaderAbsent, Separator: opts.Separator}
+		if opts.SplitPattern != nil {
+			d.Separator = opts.SplitPattern.String()
+		}
+		opts.OnDialect(d)
+	}
+	if raw != nil {
+		if (opts.Quote == 0 || opts.Quote == '"') && opts.Header != HeaderAbsent {
+			csvReader := csv.NewReader(in)
+			csvReader.Comma = opts.Comma
+			csvReader.LazyQuotes = opts.LazyQuotes
+			csvReader.ReuseRecord = opts.ReuseRecord
+			csvReader.FieldsPerRecord = -1
+			return &rawReader{csv: csvReader, rec: raw, dialect: Dialect{Comma: opts.Comma, Quote: '"', Header: true},
+				limit: limit, max: opts.MaxRecordSize}
+		}
+		// Sniffed quotes are swapped below.
+		raw.off, raw.buf = true, nil
+	}
+	if opts.Quote != 0 && opts.Quote != '"' {
+		in = bufio.NewReaderSize(&swapQuotes{r: in, quote: byte(opts.Quote)}, opts.BufferSize)
+	}
+	var comments *commentFilter
+	if len(opts.Comments) > 0 {
+		comments = &commentFilter{in: in, comments: opts.Comments}
+		in = bufio.NewReaderSize(comments, opts.BufferSize)
+	}
+
+	var reader Reader
+	if separated {
+		reader = newSepReader(in, opts)
+	} else if parallel {
+		reader = newParallelReader(in, opts)
+	} else if !opts.Lenient {
+		csvReader := csv.NewReader(in)
+		csvReader.Comma = opts.Comma
+		csvReader.LazyQuotes = opts.LazyQuotes
+		csvReader.ReuseRecord = opts.ReuseRecord
+		csvReader.FieldsPerRecord = -1
+		reader = csvReader
+	} else {
+		if opts.MaxRecordLines <= 0 {
+			opts.MaxRecordLines = DefaultMaxRecordLines
+		}
+		reader = &lenientReader{opts: opts, in: in}
+	}
+	if comments != nil {
+		reader = &commentOffsets{Reader: reader, filter: comments}
+	}
+	if limit != nil {
+		reader = &limitedReader{Reader: reader, limit: limit, max: opts.MaxRecordSize}
+	}
+	if opts.Quote != 0 && opts.Quote != '"' {
+		reader = &swappedReader{Reader: reader, quote: byte(opts.Quote)}
+	}
+	if opts.Footer != nil || opts.FooterRows > 0 {
+		reader = &skipReader{Reader: reader, footer: opts.Footer, footerRows: opts.FooterRows, header: opts.Header != HeaderAbsent}
+	}
+	if opts.Header == HeaderAbsent {
+		reader = &headerless{Reader: reader}
+	}
+	if opts.ExpectColumns > 0 {
+		reader = &widthReader{Reader: reader, want: opts.ExpectColumns}
+	}
+	if opts.MinRows > 0 || opts.MaxRows > 0 {
+		reader = &countReader{Reader: reader, min: opts.MinRows, max: opts.MaxRows}
+	}
+	return reader
+}
+
+// lenientReader splits the input into lines itself so that it can retry a
+// damaged record with a different strategy and restart on the next line.
+type lenientReader struct {
+	opts    Options
+	in      *bufio.Reader
+	pending []string // lines read ahead but not consumed yet
+	line    int      // number of lines consumed
+	offset  int64    // bytes consumed
+	width   int      // field count of the first record
+	eof     bool
+}
+
+func (l *lenientReader) InputOffset() int64 { return l.offset }
+
+// nextLine returns line i (0-based) of the lookahead, reading more input as
+// needed. ok is false at the end of input.
+func (l *lenientReader) nextLine(i int) (string, bool, error) {
+	for len(l.pending) <= i {
+		if l.eof {
+			return "", false, nil
+		}
+		s, err := l.in.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			l.eof = true
+			if s == "" {
+				return "", false, nil
+			}
+		} else if err != nil {
+			return "", false, err
+		}
+		l.pending = append(l.pending, s)
+	}
+	return l.pending[i], true, nil
+}
+
+// consume drops the first n lookahead lines.
+func (l *lenientReader) consume(n int) {
+	for _, s := range l.pending[:n] {
+		l.offset += int64(len(s))
+	}
+	l.pending = l.pending[n:]
+	l.line += n
+}
+
+func (l *lenientReader) Read() ([]string, error) {
+	for {
+		first, ok, err := l.nextLine(0)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, io.EOF
+		}
+		if strings.TrimRight(first, "\r\n") == "" {
+			// Blank lines are skipped, as encoding/csv does.
+			l.consume(1)
+			continue
+		}
+
+		// Gather lines until the quotes balance, which is where a well formed
+		// record ends.
+		var buf strings.Builder
+		n, quotes := 0, 0
+		balanced := false
+		for n < l.opts.MaxRecordLines {
+			s, ok, err := l.nextLine(n)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			buf.WriteString(s)
+			n++
+			if quotes += strings.Count(s, `"`); quotes%2 == 0 {
+				balanced = true
+				break
+			}
+		}
+		startLine := l.line + 1
+
+		if balanced {
+			if record, err := l.parse(buf.String(), false); err == nil {
+				l.consume(n)
+				return l.checkWidth(record, startLine), nil
+			}
+			// Only trust lazy quoting within a single line; a damaged record
+			// spanning several lines is better re-synchronized below.
+			if record, err := l.parse(buf.String(), true); err == nil && n == 1 {
+				l.recover(startLine, "stray quote, parsed leniently")
+				l.consume(n)
+				return l.checkWidth(record, startLine), nil
+			}
+		}
+
+		// The quote never closed, or the lines it spans do not form one record:
+		// treat only the first line as a record with literal quotes and
+		// re-synchronize on the next line.
+		record := splitLiteral(strings.TrimRight(first, "\r\n"), l.opts.Comma)
+		l.recover(startLine, "unbalanced quote, re-synchronized on the next line")
+		l.consume(1)
+		return l.checkWidth(record, startLine), nil
+	}
+}
+
+// parse parses exactly one record from text.
+func (l *lenientReader) parse(text string, lazy bool) ([]string, error) {
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = l.opts.Comma
+	reader.LazyQuotes = lazy || l.opts.LazyQuotes
+	reader.FieldsPerRecord = -1
+	record, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := reader.Read(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("more than one record in %q", text)
+	}
+	return record, nil
+}
+
+func (l *lenientReader) checkWidth(record []string, line int) []string {
+	if l.width == 0 {
+		l.width = len(record)
+	} else if len(record) != l.width {
+		l.recover(line, fmt.Sprintf("ragged row with %d fields, expected %d", len(record), l.width))
+	}
+	return record
+}
+
+func (l *lenientReader) recover(line int, reason string) {
+	if l.opts.OnRecover != nil {
+		l.opts.OnRecover(Recovery{Line: line, Reason: reason})
+	}
+}
+
+// splitLiteral splits line on comma without any quote handling, except that
+// a field wrapped in a pair of quotes loses them.
+func splitLiteral(line string, comma rune) []string {
+	fields := strings.Split(line, string(comma))
+	for i, f := range fields {
+		if len(f) >= 2 && f[0] == '"' && f[len(f)-1] == '"' {
+			fields[i] = strings.ReplaceAll(f[1:len(f)-1], `""`, `"`)
+		}
+	}
+	return fields
+}
+
+// Compile-time check that the standard reader satisfies Reader.
+var _ Reader = (*csv.Reader)(nil)
@@ -0,0 +1,33 @@
+package csvio
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ExcelSafe returns field defused for spreadsheets opening the CSV: control
+// characters other than tab and line breaks are dropped, and a field
+// starting with "=", "+", "-", "@", a tab or a carriage return, which Excel
+// and its kin would evaluate as a formula, gets a leading "'" so that it is
+// shown as text. Numbers such as "-12.5" are kept as they are.
+func ExcelSafe(field string) string {
+	field = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, field)
+	if field == "" {
+		return field
+	}
+	switch field[0] {
+	case '+', '-':
+		if _, err := strconv.ParseFloat(field, 64); err == nil {
+			return field
+		}
+	case '=', '@', '\t', '\r':
+	default:
+		return field
+	}
+	return "'" + field
+}
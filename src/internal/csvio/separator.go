@@ -0,0 +1,238 @@
+package csvio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// sepReader reads records whose fields are separated by a string, such as
+// "||", or by the matches of a regexp, which encoding/csv can't do. With a
+// separator, fields may be quoted as in RFC 4180; split on a regexp, lines
+// are records and a field wrapped in a pair of quotes merely loses them.
+type sepReader struct {
+	opts    Options
+	sep     string
+	pattern *regexp.Regexp
+	in      *bufio.Reader
+	pending []string // lines read ahead but not consumed yet
+	line    int      // number of lines consumed
+	offset  int64    // bytes consumed
+	eof     bool
+	record  []string
+}
+
+func newSepReader(in *bufio.Reader, opts Options) *sepReader {
+	return &sepReader{opts: opts, sep: opts.Separator, pattern: opts.SplitPattern, in: in}
+}
+
+func (s *sepReader) InputOffset() int64 { return s.offset }
+
+// nextLine returns line i (0-based) of the lookahead, reading more input as
+// needed. ok is false at the end of input.
+func (s *sepReader) nextLine(i int) (string, bool, error) {
+	for len(s.pending) <= i {
+		if s.eof {
+			return "", false, nil
+		}
+		line, err := s.in.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			s.eof = true
+			if line == "" {
+				return "", false, nil
+			}
+		} else if err != nil {
+			return "", false, err
+		}
+		s.pending = append(s.pending, line)
+	}
+	return s.pending[i], true, nil
+}
+
+// consume drops the first n lookahead lines.
+func (s *sepReader) consume(n int) {
+	for _, line := range s.pending[:n] {
+		s.offset += int64(len(line))
+	}
+	s.pending = s.pending[n:]
+	s.line += n
+}
+
+func (s *sepReader) Read() ([]string, error) {
+	for {
+		first, ok, err := s.nextLine(0)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, io.EOF
+		}
+		text := strings.TrimRight(first, "\r\n")
+		if text == "" {
+			// Blank lines are skipped, as encoding/csv does.
+			s.consume(1)
+			continue
+		}
+		if s.pattern != nil {
+			s.consume(1)
+			return s.fields(unquote(s.pattern.Split(text, -1))), nil
+		}
+		fields, n, err := s.split()
+		if err == nil {
+			s.consume(n)
+			if s.opts.ReuseRecord {
+				s.record = fields
+			}
+			return fields, nil
+		}
+		if !s.opts.Lenient {
+			return nil, err
+		}
+		// As lenientReader does, take the first line with literal quotes and
+		// re-synchronize on the next one.
+		if s.opts.OnRecover != nil {
+			s.opts.OnRecover(Recovery{Line: s.line + 1, Reason: "unbalanced quote, re-synchronized on the next line"})
+		}
+		s.consume(1)
+		return s.fields(unquote(strings.Split(text, s.sep))), nil
+	}
+}
+
+// fields returns fields, in the record of the previous call with
+// Options.ReuseRecord.
+func (s *sepReader) fields(fields []string) []string {
+	if !s.opts.ReuseRecord {
+		return fields
+	}
+	s.record = append(s.record[:0], fields...)
+	return s.record
+}
+
+// split parses the record starting on the first lookahead line and returns
+// its fields, in the record of the previous call with Options.ReuseRecord,
+// and the number of lines it spans.
+func (s *sepReader) split() ([]string, int, error) {
+	start := s.line + 1
+	parseError := func(n int, err error) error {
+		return &csv.ParseError{StartLine: start, Line: start + n - 1, Err: err}
+	}
+	first, _, _ := s.nextLine(0)
+	rest := strings.TrimRight(first, "\r\n")
+	n := 1
+	fields := s.record[:0]
+	for {
+		if !strings.HasPrefix(rest, `"`) {
+			field, tail, more := strings.Cut(rest, s.sep)
+			if !s.opts.LazyQuotes && strings.Contains(field, `"`) {
+				return nil, 0, parseError(n, csv.ErrBareQuote)
+			}
+			fields = append(fields, field)
+			if !more {
+				return fields, n, nil
+			}
+			rest = tail
+			continue
+		}
+		var b strings.Builder
+		rest = rest[1:]
+		for {
+			i := strings.IndexByte(rest, '"')
+			if i < 0 {
+				// The field goes on on the next line.
+				maxLines := s.opts.MaxRecordLines
+				if maxLines <= 0 {
+					maxLines = DefaultMaxRecordLines
+				}
+				line, ok, err := s.nextLine(n)
+				if err != nil {
+					return nil, 0, err
+				}
+				if !ok || s.opts.Lenient && n >= maxLines {
+					return nil, 0, parseError(n, csv.ErrQuote)
+				}
+				b.WriteString(rest)
+				b.WriteByte('\n')
+				rest = strings.TrimRight(line, "\r\n")
+				n++
+				continue
+			}
+			b.WriteString(rest[:i])
+			rest = rest[i+1:]
+			if strings.HasPrefix(rest, `"`) {
+				b.WriteByte('"')
+				rest = rest[1:]
+				continue
+			}
+			break
+		}
+		// Only a separator or the end of the line may follow the closing
+		// quote; with LazyQuotes, anything else is part of the field.
+		tail, after, more := strings.Cut(rest, s.sep)
+		if tail != "" {
+			if !s.opts.LazyQuotes {
+				return nil, 0, parseError(n, csv.ErrQuote)
+			}
+			b.WriteString(tail)
+		}
+		fields = append(fields, b.String())
+		if !more {
+			return fields, n, nil
+		}
+		rest = after
+	}
+}
+
+// unquote strips a pair of quotes from the fields wrapped in them, as
+// splitLiteral does.
+func unquote(fields []string) []string {
+	for i, f := range fields {
+		if len(f) >= 2 && f[0] == '"' && f[len(f)-1] == '"' {
+			fields[i] = strings.ReplaceAll(f[1:len(f)-1], `""`, `"`)
+		}
+	}
+	return fields
+}
+
+// SeparatorFlags binds -separator and -separator-regexp, for inputs whose
+// fields are not separated by a single character.
+type SeparatorFlags struct {
+	Separator string
+	Pattern   string
+	pattern   *regexp.Regexp
+}
+
+// Register adds the flags to fs.
+func (f *SeparatorFlags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Separator, "separator", "", `field separator of the inputs of several characters, e.g. "||"; replaces the delimiter`)
+	fs.StringVar(&f.Pattern, "separator-regexp", "", `regexp matching the field separators of the inputs, e.g. "\t +"; lines are records, quotes are not special`)
+}
+
+// Load checks the flags.
+func (f *SeparatorFlags) Load() error {
+	if f.Separator != "" && f.Pattern != "" {
+		return fmt.Errorf("-separator and -separator-regexp are mutually exclusive")
+	}
+	if strings.ContainsAny(f.Separator, "\"\r\n") {
+		return fmt.Errorf("-separator must not contain quotes or line breaks, got %q", f.Separator)
+	}
+	if f.Pattern != "" {
+		var err error
+		if f.pattern, err = regexp.Compile(f.Pattern); err != nil {
+			return fmt.Errorf("invalid -separator-regexp: %w", err)
+		}
+		if f.pattern.MatchString("") {
+			return fmt.Errorf("-separator-regexp %q matches the empty string", f.Pattern)
+		}
+	}
+	return nil
+}
+
+// Apply copies the flags into opts.
+func (f *SeparatorFlags) Apply(opts *Options) {
+	opts.Separator, opts.SplitPattern = f.Separator, f.pattern
+}
@@ -0,0 +1,199 @@
+package csvio
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// skipReader drops trailing footer records. Footer
+// candidates are held back until a record follows that isn't one, so
+// InputOffset reports the end of the last record returned rather than of
+// the last one read.
+type skipReader struct {
+	Reader
+	footer     *regexp.Regexp
+	footerRows int
+	header     bool         // the first record is a header and never a footer
+	held       []heldRecord // footer candidates
+	ready      []heldRecord // records released from held
+	offset     int64
+	err        error
+}
+
+type heldRecord struct {
+	record []string
+	end    int64
+}
+
+func (s *skipReader) InputOffset() int64 { return s.offset }
+
+func (s *skipReader) Read() ([]string, error) {
+	for {
+		if len(s.ready) > 0 {
+			next := s.ready[0]
+			s.ready = s.ready[1:]
+			s.offset = next.end
+			return next.record, nil
+		}
+		if s.err != nil {
+			return nil, s.err
+		}
+		record, err := s.Reader.Read()
+		if err != nil {
+			// What is held at the end is the footer.
+			s.held, s.err = nil, err
+			continue
+		}
+		end := s.Reader.InputOffset()
+		if s.header || s.footer == nil && s.footerRows == 0 {
+			s.header = false
+			s.offset = end
+			return record, nil
+		}
+		s.held = append(s.held, heldRecord{slices.Clone(record), end})
+		switch {
+		case s.footer != nil && !s.matches(record):
+			s.ready, s.held = append(s.ready, s.held...), s.held[:0]
+		case s.footer == nil && len(s.held) > s.footerRows:
+			s.ready, s.held = append(s.ready, s.held[0]), s.held[1:]
+		}
+	}
+}
+
+// matches reports whether a field of record matches the footer pattern.
+func (s *skipReader) matches(record []string) bool {
+	return slices.ContainsFunc(record, s.footer.MatchString)
+}
+
+// SkipFlags binds -comment, -footer-match and -footer-rows, which drop
+// lines that aren't data.
+type SkipFlags struct {
+	Comment     string
+	FooterMatch string
+	FooterRows  int
+	footer      *regexp.Regexp
+}
+
+// Register adds the flags to fs.
+func (f *SkipFlags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Comment, "comment", "", `comma separated prefixes of comment lines to skip, e.g. "#,//"`)
+	fs.StringVar(&f.FooterMatch, "footer-match", "", `drop the trailing rows having a cell that matches this regexp, e.g. "^(?i)total"`)
+	fs.IntVar(&f.FooterRows, "footer-rows", 0, "drop this many rows at the end of every input")
+}
+
+// Load checks the flags.
+func (f *SkipFlags) Load() error {
+	if f.FooterRows < 0 {
+		return fmt.Errorf("-footer-rows must not be negative, got %d", f.FooterRows)
+	}
+	if f.FooterRows > 0 && f.FooterMatch != "" {
+		return fmt.Errorf("-footer-rows and -footer-match are mutually exclusive")
+	}
+	if f.FooterMatch != "" {
+		var err error
+		if f.footer, err = regexp.Compile(f.FooterMatch); err != nil {
+			return fmt.Errorf("invalid -footer-match: %w", err)
+		}
+	}
+	return nil
+}
+
+// Apply copies the flags into opts.
+func (f *SkipFlags) Apply(opts *Options) {
+	opts.Comments = nil
+	for _, prefix := range strings.Split(f.Comment, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			opts.Comments = append(opts.Comments, prefix)
+		}
+	}
+	opts.Footer, opts.FooterRows = f.footer, f.FooterRows
+}
+
+// commentFilter drops comment lines from the input, other than those
+// inside a quoted field. It remembers where it dropped them so that input
+// offsets can be mapped back.
+type commentFilter struct {
+	in       *bufio.Reader
+	comments []string
+	pending  []byte
+	err      error
+	inQuote  bool
+	read     int64  // bytes passed on
+	drops    []drop // in the order of at
+}
+
+// drop records that dropped bytes of comments in total were dropped up to
+// offset at of the filtered input.
+type drop struct {
+	at, dropped int64
+}
+
+func (c *commentFilter) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		line, err := c.in.ReadBytes('\n')
+		c.err = err
+		if len(line) == 0 {
+			continue
+		}
+		if !c.inQuote && c.comment(line) {
+			var dropped int64
+			if len(c.drops) > 0 {
+				dropped = c.drops[len(c.drops)-1].dropped
+			}
+			c.drops = append(c.drops, drop{at: c.read, dropped: dropped + int64(len(line))})
+			continue
+		}
+		if bytes.Count(line, []byte{'"'})%2 == 1 {
+			c.inQuote = !c.inQuote
+		}
+		c.pending = line
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	c.read += int64(n)
+	return n, nil
+}
+
+func (c *commentFilter) comment(line []byte) bool {
+	return slices.ContainsFunc(c.comments, func(prefix string) bool { return bytes.HasPrefix(line, []byte(prefix)) })
+}
+
+// offset maps an offset of the filtered input to one of the input. A record
+// ending at offset is preceded by the comments dropped before it.
+func (c *commentFilter) offset(offset int64) int64 {
+	i := sort.Search(len(c.drops), func(i int) bool { return c.drops[i].at >= offset })
+	if i == 0 {
+		return offset
+	}
+	return offset + c.drops[i-1].dropped
+}
+
+// commentOffsets reports the input offsets of a reader over a commentFilter.
+type commentOffsets struct {
+	Reader
+	filter *commentFilter
+}
+
+func (c *commentOffsets) InputOffset() int64 {
+	return c.filter.offset(c.Reader.InputOffset())
+}
+
+// dropComments returns sample without its comment lines, for Sniff.
+func dropComments(sample []byte, comments []string) []byte {
+	var out []byte
+	for line := range bytes.Lines(sample) {
+		if !(&commentFilter{comments: comments}).comment(line) {
+			out = append(out, line...)
+		}
+	}
+	return out
+}
@@ -0,0 +1,385 @@
+package csvio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultSniffSize is how much of the input Sniff looks at by default.
+const DefaultSniffSize = 64 << 10
+
+// sniffRows is the number of records the header guess compares.
+const sniffRows = 20
+
+// Delimiters are the delimiters Sniff chooses from, most likely first.
+var Delimiters = []rune{',', ';', '\t', '|', ':'}
+
+// Dialect is the layout Sniff guesses for an input. Separator, which Sniff
+// leaves empty, is the separator or split pattern used instead of Comma.
+type Dialect struct {
+	Comma     rune
+	Quote     rune
+	Header    bool
+	Separator string
+}
+
+func (d Dialect) String() string {
+	if d.Separator != "" {
+		return fmt.Sprintf("separator %q, quote %q, header %t", d.Separator, d.Quote, d.Header)
+	}
+	return fmt.Sprintf("delimiter %q, quote %q, header %t", d.Comma, d.Quote, d.Header)
+}
+
+// Sniff guesses the dialect of sample, the start of an input, as Python's
+// csv.Sniffer does. The delimiter is the candidate splitting the most
+// records into the same number of fields; hint, e.g. the delimiter implied
+// by the file extension, wins near ties and is kept when no candidate splits
+// anything. The quote is the one of '"' and '\” found more often next to
+// delimiters, '"' if neither is. There is a header unless the first record
+// looks like the others: a column of numbers or dates whose first cell is
+// of the same kind counts against it.
+func Sniff(sample []byte, hint rune) Dialect {
+	if hint == 0 {
+		hint = ','
+	}
+	// The last line is likely cut off.
+	if i := bytes.LastIndexByte(sample, '\n'); i >= 0 && i < len(sample)-1 {
+		sample = sample[:i+1]
+	}
+	candidates := Delimiters
+	if !slices.Contains(candidates, hint) {
+		candidates = append([]rune{hint}, candidates...)
+	}
+	d := Dialect{Comma: hint, Quote: sniffQuote(sample, candidates), Header: true}
+
+	best := 0.0
+	scores := make(map[rune]float64, len(candidates))
+	for _, c := range candidates {
+		scores[c] = consistency(sniffRecords(sample, c, d.Quote, 0))
+		best = max(best, scores[c])
+	}
+	if best > 0 && scores[hint] < 0.9*best {
+		for _, c := range candidates {
+			if scores[c] >= 0.9*best {
+				d.Comma = c
+				break
+			}
+		}
+	}
+	d.Header = sniffHeader(sniffRecords(sample, d.Comma, d.Quote, sniffRows+1))
+	return d
+}
+
+// sniffQuote returns the quote character found more often at the edges of
+// fields.
+func sniffQuote(sample []byte, delimiters []rune) rune {
+	edge := func(b byte) bool {
+		return b == '\n' || b == '\r' || b == ' ' || slices.Contains(delimiters, rune(b))
+	}
+	count := func(q byte) int {
+		n := 0
+		for i, b := range sample {
+			if b != q {
+				continue
+			}
+			if i == 0 || edge(sample[i-1]) || i == len(sample)-1 || edge(sample[i+1]) {
+				n++
+			}
+		}
+		return n
+	}
+	if count('\'') > count('"') {
+		return '\''
+	}
+	return '"'
+}
+
+// sniffRecords parses up to limit records of sample, all if limit is 0.
+func sniffRecords(sample []byte, comma, quote rune, limit int) [][]string {
+	var r io.Reader = bytes.NewReader(sample)
+	if quote != '"' {
+		r = &swapQuotes{r: r, quote: byte(quote)}
+	}
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	var records [][]string
+	for limit == 0 || len(records) < limit {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil
+		}
+		if quote != '"' {
+			swapFields(record, byte(quote))
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// sniffSeparated parses the records of sample for the header guess when
+// fields are separated by Options.Separator or Options.SplitPattern.
+func sniffSeparated(sample []byte, opts Options) [][]string {
+	if i := bytes.LastIndexByte(sample, '\n'); i >= 0 {
+		sample = sample[:i+1]
+	}
+	opts.Lenient, opts.LazyQuotes, opts.ReuseRecord, opts.OnRecover = true, true, false, nil
+	reader := newSepReader(bufio.NewReader(bytes.NewReader(sample)), opts)
+	var records [][]string
+	for len(records) <= sniffRows {
+		record, err := reader.Read()
+		if err != nil {
+			break
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// consistency is the share of records having the most common number of
+// fields, or 0 if that number is 1.
+func consistency(records [][]string) float64 {
+	counts := make(map[int]int)
+	mode := 0
+	for _, record := range records {
+		counts[len(record)]++
+		if counts[len(record)] > counts[mode] || counts[len(record)] == counts[mode] && len(record) > mode {
+			mode = len(record)
+		}
+	}
+	if mode < 2 {
+		return 0
+	}
+	return float64(counts[mode]) / float64(len(records))
+}
+
+// sniffHeader votes on whether the first record is a header by comparing
+// it with the columns of the records after it. Only columns of numbers or
+// dates vote: against a header if their first cell is of the same kind, for
+// one otherwise. Text columns say nothing, as names look like any other
+// text, so the first record is a header unless typed columns say it isn't.
+func sniffHeader(records [][]string) bool {
+	if len(records) < 2 {
+		return true
+	}
+	header, rows := records[0], records[1:]
+	votes := 0
+	for col, name := range header {
+		kind := ""
+		for _, row := range rows {
+			if col >= len(row) || row[col] == "" {
+				continue
+			}
+			k := cellKind(row[col])
+			if kind == "" {
+				kind = k
+			} else if k != kind {
+				kind = ""
+				break
+			}
+		}
+		switch {
+		case kind == "" || kind == "text":
+		case cellKind(name) == kind:
+			votes--
+		default:
+			votes++
+		}
+	}
+	return votes >= 0
+}
+
+// datePattern matches dates such as 2024-01-31, 31/01/2024 or 1.2.24,
+// optionally followed by a time.
+var datePattern = regexp.MustCompile(`^\d{1,4}[-/.]\d{1,2}[-/.]\d{1,4}([ T]\S+)?$`)
+
+// cellKind is "number", "date" or "text".
+func cellKind(s string) string {
+	s = strings.TrimSpace(s)
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return "number"
+	}
+	if datePattern.MatchString(s) {
+		return "date"
+	}
+	return "text"
+}
+
+// swapQuotes exchanges quote and '"' in the bytes it reads, so that
+// encoding/csv can parse input quoted with another character.
+type swapQuotes struct {
+	r     io.Reader
+	quote byte
+}
+
+func (s *swapQuotes) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	for i, b := range p[:n] {
+		switch b {
+		case s.quote:
+			p[i] = '"'
+		case '"':
+			p[i] = s.quote
+		}
+	}
+	return n, err
+}
+
+// swapFields undoes swapQuotes in the fields of a record.
+func swapFields(record []string, quote byte) {
+	for i, f := range record {
+		if strings.IndexByte(f, quote) >= 0 || strings.IndexByte(f, '"') >= 0 {
+			record[i] = strings.Map(func(r rune) rune {
+				switch r {
+				case rune(quote):
+					return '"'
+				case '"':
+					return rune(quote)
+				}
+				return r
+			}, f)
+		}
+	}
+}
+
+// swappedReader undoes swapQuotes in the records it reads.
+type swappedReader struct {
+	Reader
+	quote byte
+}
+
+func (s *swappedReader) Read() ([]string, error) {
+	record, err := s.Reader.Read()
+	swapFields(record, s.quote)
+	return record, err
+}
+
+// headerless returns a generated header, column_1 to column_<n>, before the
+// records of an input without one.
+type headerless struct {
+	Reader
+	first []string
+	done  bool
+}
+
+// InputOffset is 0 until the first record is returned, as the generated
+// header takes no input.
+func (h *headerless) InputOffset() int64 {
+	if h.first != nil {
+		return 0
+	}
+	return h.Reader.InputOffset()
+}
+
+func (h *headerless) Read() ([]string, error) {
+	if h.first != nil {
+		first := h.first
+		h.first = nil
+		return first, nil
+	}
+	if h.done {
+		return h.Reader.Read()
+	}
+	h.done = true
+	record, err := h.Reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	h.first = slices.Clone(record)
+	names := make([]string, len(record))
+	for i := range names {
+		names[i] = "column_" + strconv.Itoa(i+1)
+	}
+	return names, nil
+}
+
+// Presence says whether an input has a header row.
+type Presence int
+
+const (
+	// HeaderPresent takes the first row as the header, the default.
+	HeaderPresent Presence = iota
+	// HeaderGuess sniffs for a header when Options.Sniff is set, and
+	// otherwise assumes one.
+	HeaderGuess
+	HeaderAbsent
+)
+
+func (p *Presence) String() string {
+	switch *p {
+	case HeaderGuess:
+		return "auto"
+	case HeaderAbsent:
+		return "no"
+	}
+	return "yes"
+}
+
+func (p *Presence) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "auto":
+		*p = HeaderGuess
+	case "yes", "true":
+		*p = HeaderPresent
+	case "no", "false":
+		*p = HeaderAbsent
+	default:
+		return fmt.Errorf("want auto, yes or no, got %q", s)
+	}
+	return nil
+}
+
+// SniffFlags binds -sniff, -header-row and -input-quote, which the tools
+// reading CSV share.
+type SniffFlags struct {
+	Sniff  bool
+	Header Presence
+	Quote  string
+	quote  rune
+}
+
+// Register adds the flags to fs.
+func (f *SniffFlags) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.Sniff, "sniff", true, "guess the delimiter and quote character of every input from its start; explicit settings win")
+	fs.Var(&f.Header, "header-row", "whether inputs have a header row: yes, no (columns are then named column_1, column_2, ...) or auto to guess it")
+	fs.StringVar(&f.Quote, "input-quote", "", `quote character of the inputs (default sniffed, or '"')`)
+}
+
+// Load checks the flags.
+func (f *SniffFlags) Load() error {
+	if f.Quote != "" && (len(f.Quote) != 1 || f.Quote[0] >= utf8.RuneSelf) {
+		return fmt.Errorf("-input-quote must be a single ASCII character, got %q", f.Quote)
+	}
+	if f.Quote != "" {
+		f.quote = rune(f.Quote[0])
+	}
+	return nil
+}
+
+// Apply copies the flags into opts.
+func (f *SniffFlags) Apply(opts *Options) {
+	opts.Sniff, opts.Header, opts.Quote = f.Sniff, f.Header, f.quote
+}
+
+// Continue sets opts to read on in an input already read with d, e.g. from
+// a checkpoint: no sniffing, no header row and no row count bounds, which
+// hold for whole inputs.
+func (d Dialect) Continue(opts *Options) {
+	opts.Comma, opts.Quote, opts.FixedComma = d.Comma, d.Quote, true
+	opts.Sniff, opts.Header = false, HeaderPresent
+	opts.MinRows, opts.MaxRows = 0, 0
+}
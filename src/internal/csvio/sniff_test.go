@@ -0,0 +1,64 @@
+package csvio
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSniffHeader(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		input  string
+		header bool
+	}{
+		{"all text", "name,city\nJohn,Rome\nMary,Oslo\n", true},
+		{"text of one length", "code,city\nAB,Rome\nCD,Oslo\n", true},
+		{"named numbers", "id,amount\n1,2.5\n2,3.5\n", true},
+		{"named dates", "day,note\n2024-01-31,a\n2024-02-29,b\n", true},
+		{"numbers", "1,2.5\n2,3.5\n3,4.5\n", false},
+		{"dates and text", "2024-01-31,a\n2024-02-29,b\n", false},
+		{"single row", "name,city\n", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Sniff([]byte(test.input), ',').Header; got != test.header {
+				t.Errorf("Sniff(%q).Header = %t, want %t", test.input, got, test.header)
+			}
+		})
+	}
+}
+
+func readAll(t *testing.T, input string, opts Options) [][]string {
+	t.Helper()
+	r := NewReader(strings.NewReader(input), opts)
+	var records [][]string
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return records
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, slices.Clone(record))
+	}
+}
+
+// TestReaderHeader checks that sniffing keeps the header row unless asked
+// to guess it.
+func TestReaderHeader(t *testing.T) {
+	const input = "1,2\n3,4\n"
+	if got := readAll(t, input, Options{Sniff: true}); !slices.Equal(got[0], []string{"1", "2"}) {
+		t.Errorf("header = %q, want the first row", got[0])
+	}
+	got := readAll(t, input, Options{Sniff: true, Header: HeaderGuess})
+	if !slices.Equal(got[0], []string{"column_1", "column_2"}) || len(got) != 3 {
+		t.Errorf("records = %q, want a generated header and both rows", got)
+	}
+	got = readAll(t, "name,city\nJohn,Rome\nMary,Oslo\n", Options{Sniff: true, Header: HeaderGuess})
+	if !slices.Equal(got[0], []string{"name", "city"}) || len(got) != 3 {
+		t.Errorf("records = %q, want the header and two rows", got)
+	}
+}
@@ -0,0 +1,271 @@
+package csvio
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Quoting says which fields a Writer wraps in quotes.
+type Quoting string
+
+const (
+	// QuoteMinimal quotes only fields that need it, like encoding/csv.
+	QuoteMinimal Quoting = "minimal"
+	// QuoteAll quotes every field.
+	QuoteAll Quoting = "all"
+	// QuoteNonNumeric quotes every field that is not a number.
+	QuoteNonNumeric Quoting = "non-numeric"
+	// QuoteNone never quotes; fields that would need quotes are an error.
+	QuoteNone Quoting = "none"
+)
+
+// String implements flag.Value.
+func (q *Quoting) String() string {
+	if *q == "" {
+		return string(QuoteMinimal)
+	}
+	return string(*q)
+}
+
+// Set implements flag.Value.
+func (q *Quoting) Set(s string) error {
+	switch Quoting(s) {
+	case QuoteMinimal, QuoteAll, QuoteNonNumeric, QuoteNone:
+		*q = Quoting(s)
+		return nil
+	}
+	return fmt.Errorf("unknown quoting %q (want minimal, all, non-numeric or none)", s)
+}
+
+// WriterOptions configures NewWriter.
+type WriterOptions struct {
+	// Comma is the field delimiter; zero means ','.
+	Comma rune
+	// Quote is the quote character; zero means '"'.
+	Quote rune
+	// Quoting selects which fields are quoted; empty means QuoteMinimal.
+	Quoting Quoting
+	// CRLF ends records with \r\n instead of \n.
+	CRLF bool
+	// NoFinalNewline leaves the line ending off the last record.
+	NoFinalNewline bool
+	// ExcelSafe writes every field through ExcelSafe, for output opened in
+	// spreadsheets.
+	ExcelSafe bool
+}
+
+// Writer writes CSV records with the configured quoting and line endings.
+// Like csv.Writer it buffers output and remembers the first error.
+type Writer struct {
+	opts WriterOptions
+	w    *bufio.Writer
+	err  error
+}
+
+// NewWriter returns a Writer over w.
+func NewWriter(w io.Writer, opts WriterOptions) *Writer {
+	if opts.Comma == 0 {
+		opts.Comma = ','
+	}
+	if opts.Quote == 0 {
+		opts.Quote = '"'
+	}
+	if opts.Quoting == "" {
+		opts.Quoting = QuoteMinimal
+	}
+	if opts.NoFinalNewline {
+		w = &tailWriter{w: w}
+	}
+	return &Writer{opts: opts, w: bufio.NewWriter(w)}
+}
+
+// Write writes a single record. Records are buffered; call Flush when done.
+func (w *Writer) Write(record []string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.opts.Comma == w.opts.Quote || w.opts.Comma == '\r' || w.opts.Comma == '\n' {
+		return w.fail(fmt.Errorf("invalid delimiter %q for quote %q", w.opts.Comma, w.opts.Quote))
+	}
+	for i, field := range record {
+		if i > 0 {
+			if _, err := w.w.WriteRune(w.opts.Comma); err != nil {
+				return w.fail(err)
+			}
+		}
+		if err := w.writeField(field); err != nil {
+			return w.fail(err)
+		}
+	}
+	lineEnd := "\n"
+	if w.opts.CRLF {
+		lineEnd = "\r\n"
+	}
+	if _, err := w.w.WriteString(lineEnd); err != nil {
+		return w.fail(err)
+	}
+	return nil
+}
+
+func (w *Writer) writeField(field string) error {
+	if w.opts.ExcelSafe {
+		field = ExcelSafe(field)
+	}
+	quote := false
+	switch w.opts.Quoting {
+	case QuoteAll:
+		quote = true
+	case QuoteNonNumeric:
+		_, err := strconv.ParseFloat(field, 64)
+		quote = err != nil || w.needsQuotes(field)
+	case QuoteNone:
+		if w.needsQuotes(field) {
+			return fmt.Errorf("field %q needs quoting but quoting is none", field)
+		}
+	default:
+		quote = w.needsQuotes(field)
+	}
+	if !quote {
+		_, err := w.w.WriteString(field)
+		return err
+	}
+
+	if _, err := w.w.WriteRune(w.opts.Quote); err != nil {
+		return err
+	}
+	for _, r := range field {
+		var err error
+		switch {
+		case r == w.opts.Quote:
+			if _, err = w.w.WriteRune(r); err == nil {
+				_, err = w.w.WriteRune(r)
+			}
+		case r == '\r' && w.opts.CRLF:
+			// Line breaks inside fields follow the record line ending.
+		case r == '\n' && w.opts.CRLF:
+			_, err = w.w.WriteString("\r\n")
+		default:
+			_, err = w.w.WriteRune(r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.w.WriteRune(w.opts.Quote)
+	return err
+}
+
+// needsQuotes mirrors encoding/csv: fields with the delimiter, the quote
+// character, a line break or a leading space need quotes, as does a lone \.
+func (w *Writer) needsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+	if field == `\.` {
+		return true
+	}
+	if strings.ContainsRune(field, w.opts.Comma) || strings.ContainsRune(field, w.opts.Quote) ||
+		strings.ContainsAny(field, "\r\n") {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(field)
+	return unicode.IsSpace(r)
+}
+
+// WriteRaw writes the fields of prefix followed by a record as it was read
+// by a RawReader, which must be in the dialect of w, adding the line ending
+// it lacks at the end of the input. The record is copied even with
+// ExcelSafe.
+func (w *Writer) WriteRaw(prefix []string, raw []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	for _, field := range prefix {
+		if err := w.writeField(field); err != nil {
+			return w.fail(err)
+		}
+		if _, err := w.w.WriteRune(w.opts.Comma); err != nil {
+			return w.fail(err)
+		}
+	}
+	if _, err := w.w.Write(raw); err != nil {
+		return w.fail(err)
+	}
+	if !bytes.HasSuffix(raw, []byte{'\n'}) {
+		if err := w.w.WriteByte('\n'); err != nil {
+			return w.fail(err)
+		}
+	}
+	return nil
+}
+
+// WriteAll writes records and flushes.
+func (w *Writer) WriteAll(records [][]string) error {
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Flush writes buffered records to the underlying writer.
+func (w *Writer) Flush() {
+	if err := w.w.Flush(); err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+// Error reports any error from a previous Write or Flush.
+func (w *Writer) Error() error {
+	return w.err
+}
+
+func (w *Writer) fail(err error) error {
+	if w.err == nil {
+		w.err = err
+	}
+	return err
+}
+
+// tailWriter holds back a trailing line ending until more data follows, so
+// the line ending of the last record is never written.
+type tailWriter struct {
+	w       io.Writer
+	pending []byte
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	// p is written as it is after the held back line ending, rather than
+	// copied behind it on every write.
+	if len(t.pending) > 0 && len(p) > 0 && !(len(t.pending) == 1 && t.pending[0] == '\r' && p[0] == '\n') {
+		if _, err := t.w.Write(t.pending); err != nil {
+			return 0, err
+		}
+		t.pending = t.pending[:0]
+	}
+	data := p
+	if len(t.pending) > 0 {
+		data = append(t.pending, p...)
+	}
+	keep := 0
+	switch {
+	case bytes.HasSuffix(data, []byte("\r\n")):
+		keep = 2
+	case bytes.HasSuffix(data, []byte("\n")), bytes.HasSuffix(data, []byte("\r")):
+		// A lone \r may be the first half of a \r\n split across writes.
+		keep = 1
+	}
+	if _, err := t.w.Write(data[:len(data)-keep]); err != nil {
+		return 0, err
+	}
+	t.pending = append(t.pending[:0], data[len(data)-keep:]...)
+	return len(p), nil
+}
@@ -0,0 +1,275 @@
+// Package csvw reads and writes W3C CSV on the Web metadata documents
+// (https://www.w3.org/TR/tabular-metadata/). A document describes the
+// dialect and columns of one CSV file, or of several in a table group; the
+// columns are turned into a table schema so typing and validation work as
+// for Frictionless descriptors.
+package csvw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"csvtools/src/internal/tableschema"
+)
+
+// Context is the @context of CSVW metadata.
+const Context = "http://www.w3.org/ns/csvw"
+
+// Metadata is a metadata document: a single table, or a group of Tables.
+type Metadata struct {
+	Context any `json:"@context"`
+	Table
+	Tables []Table `json:"tables,omitempty"`
+}
+
+// Table describes one CSV file. Dialect and TableSchema, when missing, are
+// inherited from the group.
+type Table struct {
+	URL         string       `json:"url,omitempty"`
+	Dialect     *Dialect     `json:"dialect,omitempty"`
+	TableSchema *TableSchema `json:"tableSchema,omitempty"`
+}
+
+// Dialect is how a CSV file is laid out. Properties not listed here, such
+// as encoding, are ignored.
+type Dialect struct {
+	Delimiter      string `json:"delimiter,omitempty"`
+	Header         *bool  `json:"header,omitempty"`
+	HeaderRowCount *int   `json:"headerRowCount,omitempty"`
+	SkipRows       int    `json:"skipRows,omitempty"`
+}
+
+// TableSchema lists the columns of a table in order.
+type TableSchema struct {
+	Columns    []Column          `json:"columns"`
+	PrimaryKey tableschema.Names `json:"primaryKey,omitempty"`
+	Null       Strings           `json:"null,omitempty"`
+}
+
+// Column describes one column. Titles are the header names it may have;
+// Name identifies it elsewhere in the document, e.g. in primaryKey.
+type Column struct {
+	Name     string    `json:"name,omitempty"`
+	Titles   Strings   `json:"titles,omitempty"`
+	Datatype *Datatype `json:"datatype,omitempty"`
+	Required bool      `json:"required,omitempty"`
+	Null     Strings   `json:"null,omitempty"`
+	Virtual  bool      `json:"virtual,omitempty"`
+}
+
+// Datatype is a column's datatype, given either as its base name or as an
+// object.
+type Datatype struct {
+	Base         string `json:"base,omitempty"`
+	Format       any    `json:"format,omitempty"`
+	Length       *int   `json:"length,omitempty"`
+	MinLength    *int   `json:"minLength,omitempty"`
+	MaxLength    *int   `json:"maxLength,omitempty"`
+	Minimum      any    `json:"minimum,omitempty"`
+	Maximum      any    `json:"maximum,omitempty"`
+	MinInclusive any    `json:"minInclusive,omitempty"`
+	MaxInclusive any    `json:"maxInclusive,omitempty"`
+	MinExclusive any    `json:"minExclusive,omitempty"`
+	MaxExclusive any    `json:"maxExclusive,omitempty"`
+}
+
+func (d *Datatype) UnmarshalJSON(data []byte) error {
+	var base string
+	if err := json.Unmarshal(data, &base); err == nil {
+		*d = Datatype{Base: base}
+		return nil
+	}
+	type plain Datatype
+	return json.Unmarshal(data, (*plain)(d))
+}
+
+// Strings is a list of strings that may be given as a single string, as
+// titles and null can. Titles keyed by language are merged.
+type Strings []string
+
+func (s *Strings) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*s = Strings{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err == nil {
+		*s = many
+		return nil
+	}
+	var languages map[string]Strings
+	if err := json.Unmarshal(data, &languages); err != nil {
+		return fmt.Errorf("want a string, a list of strings or an object of them by language")
+	}
+	*s = nil
+	for _, language := range slices.Sorted(maps.Keys(languages)) {
+		*s = append(*s, languages[language]...)
+	}
+	return nil
+}
+
+// IsMetadata reports whether data looks like CSVW metadata rather than a
+// Frictionless descriptor: it has an @context or a tableSchema.
+func IsMetadata(data []byte) bool {
+	var probe map[string]json.RawMessage
+	if json.Unmarshal(data, &probe) != nil {
+		return false
+	}
+	_, context := probe["@context"]
+	_, schema := probe["tableSchema"]
+	_, tables := probe["tables"]
+	return context || schema || tables
+}
+
+// Read reads the metadata document at path.
+func Read(path string) (*Metadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSVW metadata %s: %w", path, err)
+	}
+	var m Metadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse CSVW metadata %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Lookup returns the description of the table at url, matched by file
+// name; a single table document without a url describes any url. Group
+// level dialects and schemas are filled in. It returns nil if the document
+// doesn't describe url.
+func (m *Metadata) Lookup(url string) *Table {
+	if len(m.Tables) == 0 {
+		if m.TableSchema == nil && m.Dialect == nil || m.URL != "" && !sameFile(m.URL, url) {
+			return nil
+		}
+		t := m.Table
+		return &t
+	}
+	for _, t := range m.Tables {
+		if !sameFile(t.URL, url) {
+			continue
+		}
+		if t.Dialect == nil {
+			t.Dialect = m.Dialect
+		}
+		if t.TableSchema == nil {
+			t.TableSchema = m.TableSchema
+		}
+		return &t
+	}
+	return nil
+}
+
+func sameFile(a, b string) bool {
+	return path.Base(filepath.ToSlash(a)) == path.Base(filepath.ToSlash(b))
+}
+
+// Find looks for the metadata of the local CSV file at csvPath: the sidecar
+// <csvPath>-metadata.json, then csv-metadata.json in its directory. It
+// returns the table and the document's path, or a nil table if there is
+// none.
+func Find(csvPath string) (*Table, string, error) {
+	for _, candidate := range []string{csvPath + "-metadata.json", filepath.Join(filepath.Dir(csvPath), "csv-metadata.json")} {
+		// The sidecar of a CSV file with a long name can't exist, and
+		// looking for it fails with a name too long.
+		if len(filepath.Base(candidate)) > 255 {
+			continue
+		}
+		if _, err := os.Stat(candidate); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, "", err
+		}
+		m, err := Read(candidate)
+		if err != nil {
+			return nil, "", err
+		}
+		if t := m.Lookup(csvPath); t != nil {
+			return t, candidate, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// Comma returns the field delimiter of the dialect, or 0 if it has none.
+func (d *Dialect) Comma() (rune, error) {
+	if d == nil || d.Delimiter == "" {
+		return 0, nil
+	}
+	r, size := utf8.DecodeRuneInString(d.Delimiter)
+	if size != len(d.Delimiter) {
+		return 0, fmt.Errorf("delimiter %q is not a single character", d.Delimiter)
+	}
+	return r, nil
+}
+
+// HeaderRows returns the number of header rows, 1 by default.
+func (d *Dialect) HeaderRows() int {
+	switch {
+	case d == nil:
+		return 1
+	case d.HeaderRowCount != nil:
+		return *d.HeaderRowCount
+	case d.Header != nil && !*d.Header:
+		return 0
+	}
+	return 1
+}
+
+// Names returns the header of the table's columns, for files without a
+// header row: each column's first title, or its name.
+func (t *Table) Names() []string {
+	if t.TableSchema == nil {
+		return nil
+	}
+	var names []string
+	for _, c := range t.TableSchema.Columns {
+		if !c.Virtual {
+			names = append(names, c.header(len(names)))
+		}
+	}
+	return names
+}
+
+// header returns the name the column has in the header row.
+func (c *Column) header(i int) string {
+	switch {
+	case len(c.Titles) > 0:
+		return c.Titles[0]
+	case c.Name != "":
+		return c.Name
+	}
+	return fmt.Sprintf("_col.%d", i+1)
+}
+
+// nameOf returns a column name for header, percent-encoding the bytes
+// names may not hold as the spec asks.
+func nameOf(header string) string {
+	var b strings.Builder
+	for i := 0; i < len(header); i++ {
+		c := header[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '.':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	name := b.String()
+	if strings.HasPrefix(name, "_") {
+		name = "%5F" + name[1:]
+	}
+	return name
+}
@@ -0,0 +1,282 @@
+package csvw
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/tableschema"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// datatypes maps CSVW base datatypes to table schema types. Integer types
+// with a sign restriction carry it as a bound.
+var datatypes = map[string]struct {
+	typ      string
+	min, max *float64
+}{
+	"string": {typ: "string"}, "normalizedString": {typ: "string"}, "token": {typ: "string"},
+	"language": {typ: "string"}, "Name": {typ: "string"}, "NMTOKEN": {typ: "string"},
+	"anyURI": {typ: "string"}, "QName": {typ: "string"}, "xml": {typ: "string"},
+	"html": {typ: "string"}, "anyAtomicType": {typ: "string"}, "base64Binary": {typ: "string"},
+	"hexBinary": {typ: "string"},
+	"integer":   {typ: "integer"}, "int": {typ: "integer"}, "long": {typ: "integer"},
+	"short": {typ: "integer"}, "byte": {typ: "integer"},
+	"nonNegativeInteger": {typ: "integer", min: bound(0)}, "positiveInteger": {typ: "integer", min: bound(1)},
+	"nonPositiveInteger": {typ: "integer", max: bound(0)}, "negativeInteger": {typ: "integer", max: bound(-1)},
+	"unsignedLong": {typ: "integer", min: bound(0)}, "unsignedInt": {typ: "integer", min: bound(0)},
+	"unsignedShort": {typ: "integer", min: bound(0)}, "unsignedByte": {typ: "integer", min: bound(0)},
+	"decimal": {typ: "number"}, "double": {typ: "number"}, "float": {typ: "number"}, "number": {typ: "number"},
+	"boolean": {typ: "boolean"},
+	"date":    {typ: "date"}, "time": {typ: "time"},
+	"datetime": {typ: "datetime"}, "dateTime": {typ: "datetime"}, "dateTimeStamp": {typ: "datetime"},
+	"gYear": {typ: "year"}, "gYearMonth": {typ: "yearmonth"},
+	"duration": {typ: "duration"}, "dayTimeDuration": {typ: "duration"}, "yearMonthDuration": {typ: "duration"},
+	"json": {typ: "any"},
+}
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+// Schema returns the table schema of the table's columns, matched against
+// the header by their first title or else their name. Number formats are
+// ignored; date formats and boolean formats like "Y|N" are kept.
+func (t *Table) Schema() (*tableschema.Schema, error) {
+	if t.TableSchema == nil || len(t.TableSchema.Columns) == 0 {
+		return nil, fmt.Errorf("no columns")
+	}
+	s := &tableschema.Schema{MissingValues: t.TableSchema.Null}
+	names := make(map[string]string)
+	for _, c := range t.TableSchema.Columns {
+		if c.Virtual {
+			continue
+		}
+		f, err := c.field(len(s.Fields))
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", c.header(len(s.Fields)), err)
+		}
+		names[nameOf(f.Name)] = f.Name
+		if c.Name != "" {
+			names[c.Name] = f.Name
+		}
+		s.Fields = append(s.Fields, f)
+	}
+	for _, name := range t.TableSchema.PrimaryKey {
+		header, ok := names[name]
+		if !ok {
+			return nil, fmt.Errorf("primary key column %s is not a column", name)
+		}
+		s.PrimaryKey = append(s.PrimaryKey, header)
+	}
+	if err := s.Check(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (c *Column) field(i int) (tableschema.Field, error) {
+	f := tableschema.Field{Name: c.header(i), Type: "string", MissingValues: c.Null}
+	var constraints tableschema.Constraints
+	constraints.Required = c.Required
+	if d := c.Datatype; d != nil {
+		base := d.Base
+		if base == "" {
+			base = "string"
+		}
+		dt, ok := datatypes[base]
+		if !ok {
+			return f, fmt.Errorf("unknown datatype %q", base)
+		}
+		if d.MinExclusive != nil || d.MaxExclusive != nil {
+			return f, fmt.Errorf("minExclusive and maxExclusive are not supported")
+		}
+		f.Type = dt.typ
+		format, _ := d.Format.(string)
+		switch dt.typ {
+		case "string":
+			constraints.Pattern = format
+		case "boolean":
+			if yes, no, ok := strings.Cut(format, "|"); ok {
+				f.TrueValues, f.FalseValues = []string{yes}, []string{no}
+			}
+		case "date", "time", "datetime":
+			f.Format = strftime(format)
+			if format == "" && dt.typ == "datetime" {
+				// xsd:dateTime leaves the zone optional.
+				f.Format = "any"
+			}
+		}
+		if dt.min != nil {
+			constraints.Minimum = *dt.min
+		}
+		if dt.max != nil {
+			constraints.Maximum = *dt.max
+		}
+		for _, v := range []any{d.Minimum, d.MinInclusive} {
+			if v != nil {
+				constraints.Minimum = v
+			}
+		}
+		for _, v := range []any{d.Maximum, d.MaxInclusive} {
+			if v != nil {
+				constraints.Maximum = v
+			}
+		}
+		constraints.MinLength, constraints.MaxLength = d.MinLength, d.MaxLength
+		if d.Length != nil {
+			constraints.MinLength, constraints.MaxLength = d.Length, d.Length
+		}
+	}
+	if constraints.Required || constraints.Pattern != "" || constraints.Minimum != nil || constraints.Maximum != nil ||
+		constraints.MinLength != nil || constraints.MaxLength != nil {
+		f.Constraints = &constraints
+	}
+	return f, nil
+}
+
+// uts35 maps the date field symbols of CSVW formats, which follow Unicode
+// TR35, to strftime directives, longest first.
+var uts35 = []struct{ symbol, directive string }{
+	{"yyyy", "%Y"}, {"yy", "%y"}, {"MMMM", "%B"}, {"MMM", "%b"}, {"MM", "%m"}, {"dd", "%d"},
+	{"HH", "%H"}, {"hh", "%I"}, {"mm", "%M"}, {"ss", "%S"}, {"SSSSSS", "%f"}, {"a", "%p"},
+	{"XXX", "%z"}, {"xxx", "%z"}, {"X", "%z"},
+}
+
+// strftime converts a TR35 date format; "" stays the default format. Text
+// in single quotes is literal.
+func strftime(format string) string {
+	var b strings.Builder
+	for format != "" {
+		if format[0] == '\'' {
+			literal, rest, _ := strings.Cut(format[1:], "'")
+			b.WriteString(strings.ReplaceAll(literal, "%", "%%"))
+			format = rest
+			continue
+		}
+		matched := false
+		for _, u := range uts35 {
+			if strings.HasPrefix(format, u.symbol) {
+				b.WriteString(u.directive)
+				format = format[len(u.symbol):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			if format[0] == '%' {
+				b.WriteByte('%')
+			}
+			b.WriteByte(format[0])
+			format = format[1:]
+		}
+	}
+	return b.String()
+}
+
+// tr35 converts a strftime format back; default and any formats are "".
+func tr35(format string) string {
+	if format == "" || format == "default" || format == "any" {
+		return ""
+	}
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		directive := "%" + string(format[i])
+		symbol := directive
+		for _, u := range uts35 {
+			if u.directive == directive {
+				symbol = u.symbol
+				break
+			}
+		}
+		if directive == "%%" {
+			symbol = "%"
+		}
+		b.WriteString(symbol)
+	}
+	return b.String()
+}
+
+// bases maps table schema types back to CSVW datatypes.
+var bases = map[string]string{
+	"string": "string", "integer": "integer", "number": "number", "boolean": "boolean",
+	"date": "date", "time": "time", "datetime": "datetime", "year": "gYear",
+	"yearmonth": "gYearMonth", "duration": "duration", "object": "json", "array": "json",
+	"geojson": "json", "geopoint": "string", "any": "string",
+}
+
+// Describe returns the metadata of a CSV file at url holding a table of
+// schema, with a header row and comma delimiters. Columns keep the fields of
+// base, if any, as tableschema.Describe does; enum and unique constraints
+// have no CSVW equivalent and are dropped.
+func Describe(url string, schema *arrow.Schema, base *tableschema.Schema) *Metadata {
+	ts := tableschema.Describe(schema, base)
+	m := &Metadata{Context: Context, Table: Table{URL: url, TableSchema: &TableSchema{Null: ts.MissingValues}}}
+	for _, f := range ts.Fields {
+		c := Column{Name: nameOf(f.Name), Titles: Strings{f.Name}, Null: f.MissingValues}
+		typ := f.Type
+		if typ == "" {
+			typ = "string"
+		}
+		d := &Datatype{Base: bases[typ]}
+		switch typ {
+		case "date", "time", "datetime":
+			if format := tr35(f.Format); format != "" {
+				d.Format = format
+			}
+		case "boolean":
+			if len(f.TrueValues) == 1 && len(f.FalseValues) == 1 {
+				d.Format = f.TrueValues[0] + "|" + f.FalseValues[0]
+			}
+		}
+		if k := f.Constraints; k != nil {
+			c.Required = k.Required
+			d.Minimum, d.Maximum = k.Minimum, k.Maximum
+			d.MinLength, d.MaxLength = k.MinLength, k.MaxLength
+			if k.Pattern != "" && d.Base == "string" {
+				d.Format = k.Pattern
+			}
+		}
+		c.Datatype = d
+		m.TableSchema.Columns = append(m.TableSchema.Columns, c)
+	}
+	for _, name := range ts.PrimaryKey {
+		m.TableSchema.PrimaryKey = append(m.TableSchema.PrimaryKey, nameOf(ts.Field(name).Name))
+	}
+	return m
+}
+
+// MarshalJSON writes a datatype with nothing but a base as its name.
+func (d *Datatype) MarshalJSON() ([]byte, error) {
+	type plain Datatype
+	if d.Format == nil && d.Length == nil && d.MinLength == nil && d.MaxLength == nil && d.Minimum == nil && d.Maximum == nil &&
+		d.MinInclusive == nil && d.MaxInclusive == nil && d.MinExclusive == nil && d.MaxExclusive == nil {
+		return json.Marshal(d.Base)
+	}
+	return json.Marshal((*plain)(d))
+}
+
+// Write writes m as indented JSON.
+func (m *Metadata) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(m)
+}
+
+// NewSink returns a sink writing the metadata of every table to
+// <dir>/<table>.csv-metadata.json, the sidecar of <table>.csv in dir. base
+// is as for tableschema.NewSink.
+func NewSink(dir string, base func(table string) *tableschema.Schema, policy atomicfile.Policy) *tableschema.Sink {
+	return tableschema.NewDescriptorSink(dir, ".csv-metadata.json", func(name string, schema *arrow.Schema) tableschema.Descriptor {
+		return Describe(name+".csv", schema, base(name))
+	}, policy)
+}
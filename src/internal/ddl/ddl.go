@@ -0,0 +1,125 @@
+// Package ddl renders the CREATE TABLE statements of loaded tables, through
+// templates where given, so that house standards such as STRICT tables,
+// WITHOUT ROWID or extra audit columns apply to generated schemas.
+package ddl
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"csvtools/src/internal/sqlitedb"
+)
+
+// Table is a generated table, as templates see it.
+type Table struct {
+	// Name is the table name and Quoted the name quoted as an identifier.
+	Name    string
+	Quoted  string
+	Columns []Column
+}
+
+// Column is a column of a generated table.
+type Column struct {
+	Name   string
+	Quoted string
+	// Type is the SQL type, e.g. TEXT.
+	Type string
+}
+
+// NewTable returns table name with columns, all TEXT but those types names.
+func NewTable(name string, columns []string, types map[string]string) Table {
+	t := Table{Name: name, Quoted: sqlitedb.Quote(name)}
+	for _, c := range columns {
+		typ := types[c]
+		if typ == "" {
+			typ = "TEXT"
+		}
+		t.Columns = append(t.Columns, Column{Name: c, Quoted: sqlitedb.Quote(c), Type: typ})
+	}
+	return t
+}
+
+// Definitions returns the column definitions of the generated statement,
+// one per line and comma separated, for templates to wrap.
+func (t Table) Definitions() string {
+	defs := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		defs[i] = "\t" + c.Quoted + " " + c.Type
+	}
+	return strings.Join(defs, ",\n")
+}
+
+// Statement returns the generated statement, which creates the table
+// unless it exists.
+func (t Table) Statement() string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n%s\n)", t.Quoted, t.Definitions())
+}
+
+// Templates is a flag.Value collecting "-ddl-template file", the template
+// of every table, and "-ddl-template table=file", of one table. Templates
+// are text/template files executed with a Table, e.g.
+//
+//	CREATE TABLE IF NOT EXISTS {{.Quoted}} (
+//	{{.Definitions}},
+//		loaded_by TEXT NOT NULL DEFAULT 'etl'
+//	) STRICT
+//
+// and may quote names with the quote function.
+type Templates struct {
+	all    *template.Template
+	tables map[string]*template.Template // by lower case table name
+	specs  []string
+}
+
+func (t *Templates) String() string {
+	if t == nil {
+		return ""
+	}
+	return strings.Join(t.specs, ",")
+}
+
+func (t *Templates) Set(s string) error {
+	table, path, ok := strings.Cut(s, "=")
+	if !ok {
+		table, path = "", s
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read DDL template: %w", err)
+	}
+	tmpl, err := template.New(path).Option("missingkey=error").
+		Funcs(template.FuncMap{"quote": sqlitedb.Quote}).Parse(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid DDL template: %w", err)
+	}
+	t.specs = append(t.specs, s)
+	if table == "" {
+		t.all = tmpl
+		return nil
+	}
+	if t.tables == nil {
+		t.tables = make(map[string]*template.Template)
+	}
+	// SQLite ignores the case of table names.
+	t.tables[strings.ToLower(table)] = tmpl
+	return nil
+}
+
+// Render returns the statement creating table: its template's, or else the
+// generated one.
+func (t *Templates) Render(table Table) (string, error) {
+	tmpl := t.tables[strings.ToLower(table.Name)]
+	if tmpl == nil {
+		tmpl = t.all
+	}
+	if tmpl == nil {
+		return table.Statement(), nil
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, table); err != nil {
+		return "", fmt.Errorf("DDL template of table %s: %w", table.Name, err)
+	}
+	return strings.TrimRight(strings.TrimSpace(b.String()), ";"), nil
+}
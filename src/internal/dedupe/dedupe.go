@@ -0,0 +1,267 @@
+// Package dedupe checks that the key columns of loaded rows are unique,
+// whether or not the database enforces it, and reports or sets aside the
+// rows repeating a key.
+package dedupe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"csvtools/src/internal/csvio"
+)
+
+// ErrDuplicate is returned by Check.Row under PolicyError.
+var ErrDuplicate = errors.New("duplicate key")
+
+// Keys is a flag.Value of the key columns per table: "id" sets the key of
+// every table, "orders:order_id,line_no" the key of table orders. It may be
+// repeated.
+type Keys map[string][]string
+
+func (k *Keys) String() string {
+	var parts []string
+	for table, cols := range *k {
+		part := strings.Join(cols, ",")
+		if table != "" {
+			part = table + ":" + part
+		}
+		parts = append(parts, part)
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, " ")
+}
+
+func (k *Keys) Set(s string) error {
+	table, cols := "", s
+	if t, c, ok := strings.Cut(s, ":"); ok {
+		table, cols = strings.TrimSpace(t), c
+	}
+	var key []string
+	for _, col := range strings.Split(cols, ",") {
+		if col = strings.TrimSpace(col); col != "" {
+			key = append(key, col)
+		}
+	}
+	if len(key) == 0 {
+		return fmt.Errorf("no key columns in %q", s)
+	}
+	if *k == nil {
+		*k = make(Keys)
+	}
+	(*k)[strings.ToLower(table)] = key
+	return nil
+}
+
+// For returns the key columns of table, or nil if it has none.
+func (k Keys) For(table string) []string {
+	if key, ok := k[strings.ToLower(table)]; ok {
+		return key
+	}
+	return k[""]
+}
+
+// Policy says what happens to a row repeating a key.
+type Policy string
+
+const (
+	// PolicyReport loads the row and counts it.
+	PolicyReport Policy = "report"
+	// PolicySkip drops the row and counts it.
+	PolicySkip Policy = "skip"
+	// PolicyError fails the file.
+	PolicyError Policy = "error"
+)
+
+func (p *Policy) String() string {
+	if *p == "" {
+		return string(PolicyReport)
+	}
+	return string(*p)
+}
+
+func (p *Policy) Set(s string) error {
+	switch Policy(s) {
+	case PolicyReport, PolicySkip, PolicyError:
+		*p = Policy(s)
+		return nil
+	}
+	return fmt.Errorf("unknown duplicate policy %q (want report, skip or error)", s)
+}
+
+// Tracker remembers the keys seen per table during a run, so that files
+// merged into one table are checked against each other.
+type Tracker struct {
+	Keys   Keys
+	Policy Policy
+	// Dir, when set, receives the duplicate rows of every file as
+	// <dir>/<file>.duplicates.csv.
+	Dir string
+
+	seen map[string]map[string]int // row 0 for keys loaded by earlier runs
+}
+
+// Check checks the rows of one file. Its keys count as seen once it is
+// closed after loading the file, so that a failed attempt can be retried.
+type Check struct {
+	tracker *Tracker
+	table   string
+	columns []int
+	seen    map[string]int
+	file    map[string]int
+	// Duplicates counts the rows repeating a key.
+	Duplicates int
+
+	source string
+	header []string
+	out    *os.File
+	writer *csvio.Writer
+}
+
+// File returns the check of a file loaded into table with header, or nil if
+// the table has no key. path names the file in the duplicates file.
+func (t *Tracker) File(table, path string, header []string) (*Check, error) {
+	key := t.Keys.For(table)
+	if len(key) == 0 {
+		return nil, nil
+	}
+	c := &Check{tracker: t, table: table, file: make(map[string]int), source: path, header: header}
+	for _, col := range key {
+		i := slices.IndexFunc(header, func(h string) bool { return strings.EqualFold(h, col) })
+		if i < 0 {
+			return nil, fmt.Errorf("key column %s is not a column of %s", col, table)
+		}
+		c.columns = append(c.columns, i)
+	}
+	if t.seen == nil {
+		t.seen = make(map[string]map[string]int)
+	}
+	c.seen = t.seen[table]
+	return c, nil
+}
+
+// Seeded reports whether the keys of table are known, from an earlier file
+// of the run or from Existing.
+func (c *Check) Seeded() bool {
+	return c.seen != nil
+}
+
+// Existing adds the key of a row already in the table, with the key columns
+// in the order of the key.
+func (c *Check) Existing(values []string) {
+	if c.seen == nil {
+		c.seen = make(map[string]int)
+		c.tracker.seen[c.table] = c.seen
+	}
+	c.seen[strings.Join(values, "\x00")] = 0
+}
+
+// Columns returns the key columns of the file's header.
+func (c *Check) Columns() []string {
+	cols := make([]string, len(c.columns))
+	for n, i := range c.columns {
+		cols[n] = c.header[i]
+	}
+	return cols
+}
+
+// Row checks the key of record, data row number row of the file. It returns
+// false if the row is to be dropped.
+func (c *Check) Row(record []string, row int) (bool, error) {
+	var b strings.Builder
+	for n, i := range c.columns {
+		if n > 0 {
+			b.WriteByte(0)
+		}
+		if i < len(record) {
+			b.WriteString(record[i])
+		}
+	}
+	key := b.String()
+	first, dup := c.file[key]
+	if !dup {
+		first, dup = c.seen[key]
+	}
+	if !dup {
+		c.file[key] = row
+		return true, nil
+	}
+	c.Duplicates++
+	if c.tracker.Policy == PolicyError {
+		where := fmt.Sprintf("first seen in row %d", first)
+		if first == 0 {
+			where = "already in table " + c.table
+		}
+		return false, fmt.Errorf("%w %s in row %d, %s", ErrDuplicate, c.describe(record), row, where)
+	}
+	if err := c.write(record, row); err != nil {
+		return false, err
+	}
+	return c.tracker.Policy != PolicySkip, nil
+}
+
+// describe formats the key of record as col=value pairs.
+func (c *Check) describe(record []string) string {
+	var parts []string
+	for _, i := range c.columns {
+		v := ""
+		if i < len(record) {
+			v = record[i]
+		}
+		parts = append(parts, c.header[i]+"="+strconv.Quote(v))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// write appends record to the duplicates file, creating it with the
+// header and a row column first.
+func (c *Check) write(record []string, row int) error {
+	if c.tracker.Dir == "" {
+		return nil
+	}
+	if c.writer == nil {
+		if err := os.MkdirAll(c.tracker.Dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", c.tracker.Dir, err)
+		}
+		path := c.Path()
+		out, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", path, err)
+		}
+		c.out, c.writer = out, csvio.NewWriter(out, csvio.WriterOptions{})
+		if err := c.writer.Write(append([]string{"_row_number"}, c.header...)); err != nil {
+			return err
+		}
+	}
+	return c.writer.Write(append([]string{strconv.Itoa(row)}, record...))
+}
+
+// Path is where the duplicate rows of the file go.
+func (c *Check) Path() string {
+	name := strings.TrimSuffix(filepath.Base(c.source), filepath.Ext(c.source))
+	return filepath.Join(c.tracker.Dir, name+".duplicates.csv")
+}
+
+// Close closes the duplicates file and, after the file was loaded, adds its
+// keys to those seen in the table.
+func (c *Check) Close(loaded bool) error {
+	var err error
+	if c.writer != nil {
+		c.writer.Flush()
+		err = errors.Join(c.writer.Error(), c.out.Close())
+	}
+	if loaded {
+		if c.seen == nil {
+			c.seen = make(map[string]int, len(c.file))
+			c.tracker.seen[c.table] = c.seen
+		}
+		for key, row := range c.file {
+			c.seen[key] = row
+		}
+	}
+	return err
+}
@@ -0,0 +1,380 @@
+// Package discover finds the data files the converters should process in a
+// source directory.
+package discover
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// File is a data file found in a source directory.
+type File struct {
+	// Path is the full path of the file.
+	Path string
+	// Name is the file name without its extension, used for sheet and table names.
+	Name string
+	// Ext is the matched extension without the dot, in lower case.
+	Ext string
+	// Delimiter is the field delimiter for files with this extension.
+	Delimiter rune
+	// FixedDelimiter is set when the delimiter was given rather than implied
+	// by the extension, so it is not to be second-guessed by sniffing.
+	FixedDelimiter bool
+	// Size and ModTime are taken from the file (the symlink target for links).
+	Size    int64
+	ModTime time.Time
+	// Sheet and Table, if set, override Name as the sheet or table name.
+	Sheet string
+	Table string
+	// Source, if set, is what Path was extracted from, e.g. book.xlsx[Sales]
+	// for a sheet of a workbook, for lineage and messages.
+	Source string
+}
+
+// Origin returns Source, or Path for files read as they are.
+func (f File) Origin() string {
+	if f.Source != "" {
+		return f.Source
+	}
+	return f.Path
+}
+
+// Extension is a file extension to pick up and the delimiter its files use.
+// Fixed is set when the delimiter was given, as in "txt:|".
+type Extension struct {
+	Name      string
+	Delimiter rune
+	Fixed     bool
+}
+
+// DefaultDelimiters are the delimiters assumed for well known extensions.
+var DefaultDelimiters = map[string]rune{
+	"csv": ',',
+	"tsv": '\t',
+	"tab": '\t',
+	"psv": '|',
+	"txt": '\t',
+}
+
+// Extensions is a flag.Value parsing "-ext csv,tsv,txt:|": a comma separated
+// list of extensions, each optionally followed by ":" and its delimiter
+// ("\t" or "tab" for tabs). Unknown extensions default to ','.
+type Extensions []Extension
+
+// DefaultExtensions picks up .csv files only.
+var DefaultExtensions = Extensions{{Name: "csv", Delimiter: ','}}
+
+func (e *Extensions) String() string {
+	parts := make([]string, len(*e))
+	for i, ext := range *e {
+		parts[i] = ext.Name
+	}
+	return strings.Join(parts, ",")
+}
+
+func (e *Extensions) Set(s string) error {
+	var out Extensions
+	for _, part := range strings.Split(s, ",") {
+		name, delim, hasDelim := strings.Cut(strings.TrimSpace(part), ":")
+		name = strings.ToLower(strings.TrimPrefix(name, "."))
+		if name == "" {
+			return fmt.Errorf("empty extension in %q", s)
+		}
+		ext := Extension{Name: name, Delimiter: ','}
+		if d, ok := DefaultDelimiters[name]; ok {
+			ext.Delimiter = d
+		}
+		if hasDelim {
+			r, err := ParseDelimiter(delim)
+			if err != nil {
+				return err
+			}
+			ext.Delimiter, ext.Fixed = r, true
+		}
+		out = append(out, ext)
+	}
+	*e = out
+	return nil
+}
+
+// ParseDelimiter parses a single character delimiter, accepting "\t" and
+// "tab" for tabs.
+func ParseDelimiter(s string) (rune, error) {
+	switch s {
+	case `\t`, "tab":
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 || size != len(s) {
+		return 0, fmt.Errorf("delimiter must be a single character, got %q", s)
+	}
+	return r, nil
+}
+
+// Lookup returns the extension matching name, ignoring case, if any. Names
+// may have several dots, so extensions such as "csv.gz" match too; the
+// longest matching extension wins.
+func (e Extensions) Lookup(name string) (Extension, bool) {
+	lower := strings.ToLower(name)
+	var found Extension
+	for _, candidate := range e {
+		if len(candidate.Name) > len(found.Name) && len(lower) > len(candidate.Name)+1 &&
+			strings.HasSuffix(lower, "."+candidate.Name) {
+			found = candidate
+		}
+	}
+	return found, found.Name != ""
+}
+
+// Options selects the files Find returns.
+type Options struct {
+	// Extensions to pick up; empty means DefaultExtensions.
+	Extensions Extensions
+	// Exclude holds filepath.Match patterns for file names to skip.
+	Exclude []string
+	// MinSize and MaxSize bound the file size in bytes; zero means no bound.
+	MinSize int64
+	MaxSize int64
+	// NewerThan skips files modified longer ago than this; zero means no limit.
+	NewerThan time.Duration
+	// Recursive also searches subdirectories.
+	Recursive bool
+	// FollowSymlinks picks up symlinked files, and with Recursive descends
+	// into symlinked directories. Otherwise symlinks are skipped.
+	FollowSymlinks bool
+	// Confine skips symlinks whose target lies outside the searched directory.
+	Confine bool
+	// Order sorts the files; the zero value sorts by name.
+	Order Order
+	// OrderFile lists file paths relative to the searched directory, one
+	// per line, in the order wanted with Order "manifest".
+	OrderFile string
+	// Manifest, if set, is a file listing the files to process instead of
+	// searching a directory; see ReadManifest.
+	Manifest string
+	// OnSkip, if set, is called for every symlink or directory that is not
+	// followed, with the reason.
+	OnSkip func(path, reason string)
+}
+
+// Register adds the file discovery flags, -ext, -exclude, -order and so on, to fs.
+func (o *Options) Register(fs *flag.FlagSet) {
+	fs.Var(&o.Extensions, "ext", "comma separated file extensions to pick up, each optionally with :delimiter (e.g. csv,tsv,txt:|)")
+	fs.Func("exclude", "skip files whose name matches this glob, e.g. \"*_backup.csv\" (repeatable)", func(s string) error {
+		if _, err := filepath.Match(s, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %q: %w", s, err)
+		}
+		o.Exclude = append(o.Exclude, s)
+		return nil
+	})
+	fs.Func("min-size", "skip files smaller than this size, e.g. 1KB", func(s string) (err error) {
+		o.MinSize, err = ParseSize(s)
+		return err
+	})
+	fs.Func("max-size", "skip files larger than this size, e.g. 500MB", func(s string) (err error) {
+		o.MaxSize, err = ParseSize(s)
+		return err
+	})
+	fs.DurationVar(&o.NewerThan, "newer-than", 0, "skip files modified longer ago than this, e.g. 24h")
+	fs.BoolVar(&o.Recursive, "recursive", false, "also search subdirectories")
+	fs.BoolVar(&o.FollowSymlinks, "follow-symlinks", false, "pick up symlinked files and descend into symlinked directories")
+	fs.BoolVar(&o.Confine, "confine", false, "skip symlinks pointing outside the source directory")
+	fs.Var(&o.Order, "order", "file processing order: name, mtime, size or manifest, optionally :desc (default name)")
+	fs.StringVar(&o.Manifest, "manifest", "", "text or YAML file listing the files to process, with optional sheet, table and delimiter per file")
+	fs.StringVar(&o.OrderFile, "order-file", "", "file listing the files in the wanted order, one per line, for -order manifest")
+}
+
+// ParseSize parses a byte size such as "512", "10KB", "1.5MB" or "2GB".
+// Units are powers of 1024.
+func ParseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		factor float64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	factor := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper = strings.TrimSpace(strings.TrimSuffix(upper, u.suffix))
+			factor = u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(upper, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * factor), nil
+}
+
+// excluded reports whether info is filtered out by the options.
+func (o Options) excluded(info fs.FileInfo, now time.Time) bool {
+	for _, pattern := range o.Exclude {
+		if ok, _ := filepath.Match(pattern, info.Name()); ok {
+			return true
+		}
+	}
+	if o.MinSize > 0 && info.Size() < o.MinSize {
+		return true
+	}
+	if o.MaxSize > 0 && info.Size() > o.MaxSize {
+		return true
+	}
+	return o.NewerThan > 0 && now.Sub(info.ModTime()) > o.NewerThan
+}
+
+// Find lists the files in dir matching opts, sorted by opts.Order.
+// Directories reached twice, e.g. through a symlink cycle, are only searched
+// once. With opts.Manifest, dir is ignored and the listed files are returned
+// in manifest order unless opts.Order is set.
+func Find(dir string, opts Options) ([]File, error) {
+	if len(opts.Extensions) == 0 {
+		opts.Extensions = DefaultExtensions
+	}
+	if opts.Manifest != "" {
+		return fromManifest(opts.Manifest, opts)
+	}
+	root, err := realPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	w := walker{opts: opts, root: root, now: time.Now(), visited: map[string]bool{root: true}}
+	if err := w.walk(dir); err != nil {
+		return nil, err
+	}
+	if err := opts.Order.sort(dir, w.files, opts.OrderFile); err != nil {
+		return nil, err
+	}
+	return w.files, nil
+}
+
+// Resolve joins name to root and returns the resulting path, refusing names
+// that escape root, also through symlinks. Use it for paths supplied by
+// untrusted callers.
+func Resolve(root, name string) (string, error) {
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("path %q escapes %s", name, root)
+	}
+	path := filepath.Join(root, name)
+	realRoot, err := realPath(root)
+	if err != nil {
+		return "", err
+	}
+	target, err := realPath(path)
+	if err != nil {
+		return "", err
+	}
+	if !within(realRoot, target) {
+		return "", fmt.Errorf("path %q escapes %s", name, root)
+	}
+	return path, nil
+}
+
+type walker struct {
+	opts    Options
+	root    string
+	now     time.Time
+	visited map[string]bool
+	files   []File
+}
+
+func (w *walker) walk(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if info, err = w.followLink(path); err != nil || info == nil {
+				if err != nil {
+					w.skip(path, err.Error())
+				}
+				continue
+			}
+		}
+		if info.IsDir() {
+			if !w.opts.Recursive {
+				continue
+			}
+			real, err := realPath(path)
+			if err != nil {
+				return err
+			}
+			if w.visited[real] {
+				w.skip(path, "directory already searched (symlink cycle?)")
+				continue
+			}
+			w.visited[real] = true
+			if err := w.walk(path); err != nil {
+				return err
+			}
+			continue
+		}
+		ext, ok := w.opts.Extensions.Lookup(entry.Name())
+		if !ok || w.opts.excluded(info, w.now) {
+			continue
+		}
+		w.files = append(w.files, File{
+			Path:           path,
+			Name:           entry.Name()[:len(entry.Name())-len(ext.Name)-1],
+			Ext:            ext.Name,
+			Delimiter:      ext.Delimiter,
+			FixedDelimiter: ext.Fixed,
+			Size:           info.Size(),
+			ModTime:        info.ModTime(),
+		})
+	}
+	return nil
+}
+
+// followLink returns the info of the symlink target, or nil if the link is
+// not followed.
+func (w *walker) followLink(path string) (fs.FileInfo, error) {
+	if !w.opts.FollowSymlinks {
+		if _, ok := w.opts.Extensions.Lookup(path); ok || w.opts.Recursive {
+			w.skip(path, "symlink not followed (use -follow-symlinks)")
+		}
+		return nil, nil
+	}
+	target, err := realPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("broken symlink: %w", err)
+	}
+	if w.opts.Confine && !within(w.root, target) {
+		return nil, fmt.Errorf("symlink target %s is outside %s", target, w.root)
+	}
+	return os.Stat(target)
+}
+
+func (w *walker) skip(path, reason string) {
+	if w.opts.OnSkip != nil {
+		w.opts.OnSkip(path, reason)
+	}
+}
+
+// realPath returns the absolute path of path with all symlinks resolved.
+func realPath(path string) (string, error) {
+	real, err := evalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(real)
+}
+
+// within reports whether path is root or lies below it.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && filepath.IsLocal(rel)
+}
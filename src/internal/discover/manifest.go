@@ -0,0 +1,147 @@
+package discover
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestEntry is a file listed in a manifest, with optional overrides.
+type ManifestEntry struct {
+	// Path is absolute or relative to the manifest's directory.
+	Path      string `yaml:"path"`
+	Sheet     string `yaml:"sheet"`
+	Table     string `yaml:"table"`
+	Delimiter string `yaml:"delimiter"`
+}
+
+// ReadManifest reads a manifest. Files ending in .yaml or .yml hold a list of
+// entries, either at the top level or under "files":
+//
+//	files:
+//	  - path: sales/2024.csv
+//	    sheet: Sales 2024
+//	    table: sales_2024
+//	    delimiter: ";"
+//
+// Other files list one path per line; blank lines and lines starting with #
+// are ignored.
+func ReadManifest(path string) ([]ManifestEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", path, err)
+	}
+	var entries []ManifestEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		entries, err = decodeManifest(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+		}
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, ManifestEntry{Path: line})
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read manifest %s: %w", path, err)
+		}
+	}
+	for i, entry := range entries {
+		if entry.Path == "" {
+			return nil, fmt.Errorf("manifest %s: entry %d has no path", path, i+1)
+		}
+	}
+	return entries, nil
+}
+
+func decodeManifest(data []byte) ([]ManifestEntry, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	if len(node.Content) == 0 {
+		return nil, nil
+	}
+	var doc struct {
+		Files []ManifestEntry `yaml:"files"`
+	}
+	target := any(&doc)
+	if node.Content[0].Kind == yaml.SequenceNode {
+		target = &doc.Files
+	}
+	// Decode strictly so that misspelled overrides are reported.
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(target); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return doc.Files, nil
+}
+
+// fromManifest returns the files listed in the manifest at path, in the
+// order listed. Files must exist; extension filters don't apply to them.
+func fromManifest(path string, opts Options) ([]File, error) {
+	entries, err := ReadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Dir(path)
+	files := make([]File, 0, len(entries))
+	for _, entry := range entries {
+		filePath := filepath.FromSlash(entry.Path)
+		if !filepath.IsAbs(filePath) {
+			filePath = filepath.Join(base, filePath)
+		}
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("manifest %s: %w", path, err)
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("manifest %s: %s is a directory", path, entry.Path)
+		}
+		name := filepath.Base(filePath)
+		ext, ok := opts.Extensions.Lookup(name)
+		if !ok {
+			ext.Name = strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+			ext.Delimiter = ','
+			if d, known := DefaultDelimiters[ext.Name]; known {
+				ext.Delimiter = d
+			}
+		}
+		if entry.Delimiter != "" {
+			if ext.Delimiter, err = ParseDelimiter(entry.Delimiter); err != nil {
+				return nil, fmt.Errorf("manifest %s: %s: %w", path, entry.Path, err)
+			}
+			ext.Fixed = true
+		}
+		files = append(files, File{
+			Path:           filePath,
+			Name:           strings.TrimSuffix(name[:len(name)-len(ext.Name)], "."),
+			Ext:            ext.Name,
+			Delimiter:      ext.Delimiter,
+			FixedDelimiter: ext.Fixed,
+			Size:           info.Size(),
+			ModTime:        info.ModTime(),
+			Sheet:          entry.Sheet,
+			Table:          entry.Table,
+		})
+	}
+	if opts.Order.Key != "" {
+		if err := opts.Order.sort(base, files, opts.OrderFile); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,148 @@
+package discover
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Order is a flag.Value parsing "-order mtime:desc": the key files are
+// sorted by, name, mtime, size or manifest, and an optional direction.
+type Order struct {
+	Key  string
+	Desc bool
+}
+
+func (o *Order) String() string {
+	if o.Key == "" {
+		return ""
+	}
+	if o.Desc {
+		return o.Key + ":desc"
+	}
+	return o.Key
+}
+
+func (o *Order) Set(s string) error {
+	key, dir, _ := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+	switch key {
+	case "name", "mtime", "size", "manifest":
+	default:
+		return fmt.Errorf("unknown order %q (want name, mtime, size or manifest)", key)
+	}
+	switch dir {
+	case "", "asc":
+		o.Desc = false
+	case "desc":
+		o.Desc = true
+	default:
+		return fmt.Errorf("unknown order direction %q (want asc or desc)", dir)
+	}
+	o.Key = key
+	return nil
+}
+
+// sort orders files found in dir. Ties, and files missing from the manifest,
+// are ordered by their path relative to dir, so the result does not depend
+// on the platform's directory order.
+func (o Order) sort(dir string, files []File, orderFile string) error {
+	rank := map[string]int{}
+	if o.Key == "manifest" {
+		if orderFile == "" {
+			return fmt.Errorf("-order manifest needs -order-file")
+		}
+		entries, err := readOrderFile(orderFile)
+		if err != nil {
+			return err
+		}
+		for i, entry := range entries {
+			rank[entry] = i
+		}
+		known := make(map[string]bool, len(files))
+		for _, f := range files {
+			known[relative(dir, f.Path)] = true
+		}
+		for _, entry := range entries {
+			if !known[entry] {
+				return fmt.Errorf("%s lists %s, which was not found in %s", orderFile, entry, dir)
+			}
+		}
+	}
+	slices.SortStableFunc(files, func(a, b File) int {
+		relA, relB := relative(dir, a.Path), relative(dir, b.Path)
+		c := 0
+		switch o.Key {
+		case "mtime":
+			c = a.ModTime.Compare(b.ModTime)
+		case "size":
+			c = compare(a.Size, b.Size)
+		case "manifest":
+			rankA, listedA := rank[relA]
+			rankB, listedB := rank[relB]
+			switch {
+			case listedA && listedB:
+				c = rankA - rankB
+			case listedA:
+				return -1
+			case listedB:
+				return 1
+			}
+		}
+		if c == 0 {
+			c = strings.Compare(relA, relB)
+		}
+		if o.Desc {
+			return -c
+		}
+		return c
+	})
+	return nil
+}
+
+func compare(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// relative returns path relative to dir with forward slashes, as written in
+// order files.
+func relative(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// readOrderFile reads file paths, one per line; blank lines and lines
+// starting with # are ignored.
+func readOrderFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open order file %s: %w", path, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	var entries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, filepath.ToSlash(filepath.Clean(line)))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read order file %s: %w", path, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package discover
+
+import "path/filepath"
+
+func evalSymlinks(path string) (string, error) {
+	return filepath.EvalSymlinks(path)
+}
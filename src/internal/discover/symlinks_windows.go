@@ -0,0 +1,20 @@
+//go:build windows
+
+package discover
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+)
+
+// evalSymlinks is filepath.EvalSymlinks, which fails on some volumes
+// Windows can't resolve the final path of, such as mapped network drives,
+// UNC shares and RAM disks. Those paths are taken as they are.
+func evalSymlinks(path string) (string, error) {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return filepath.Clean(path), nil
+	}
+	return real, err
+}
@@ -0,0 +1,61 @@
+//go:build windows
+
+package discover
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEvalSymlinksUNC checks that a UNC path Windows can't resolve is taken
+// as it is, or reported as missing, but never fails otherwise.
+func TestEvalSymlinksUNC(t *testing.T) {
+	path := `\\127.0.0.1\csvtools-no-such-share\dir\..\data.csv`
+	got, err := evalSymlinks(path)
+	switch {
+	case err == nil && got != filepath.Clean(path):
+		t.Errorf("evalSymlinks(%q) = %q, want %q", path, got, filepath.Clean(path))
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		t.Errorf("evalSymlinks(%q) failed: %v", path, err)
+	}
+}
+
+// TestEvalSymlinksAdminShare resolves a temp file through the administrative
+// share of its drive, where that share is enabled.
+func TestEvalSymlinksAdminShare(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "data.csv")
+	if err := os.WriteFile(file, []byte("a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	volume := filepath.VolumeName(file)
+	if len(volume) != 2 || volume[1] != ':' {
+		t.Skipf("%s is not on a drive letter", file)
+	}
+	unc := `\\localhost\` + volume[:1] + `$` + strings.TrimPrefix(file, volume)
+	want, err := os.Stat(unc)
+	if err != nil {
+		t.Skipf("administrative share not available: %v", err)
+	}
+	got, err := evalSymlinks(unc)
+	if err != nil {
+		t.Fatalf("evalSymlinks(%q): %v", unc, err)
+	}
+	info, err := os.Stat(got)
+	if err != nil {
+		t.Fatalf("evalSymlinks(%q) = %q: %v", unc, got, err)
+	}
+	if !os.SameFile(info, want) {
+		t.Errorf("evalSymlinks(%q) = %q, another file", unc, got)
+	}
+}
+
+func TestEvalSymlinksMissing(t *testing.T) {
+	if _, err := evalSymlinks(filepath.Join(t.TempDir(), "missing.csv")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("evalSymlinks of a missing file = %v, want fs.ErrNotExist", err)
+	}
+}
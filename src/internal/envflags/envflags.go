@@ -0,0 +1,196 @@
+// Package envflags lets every command line flag be set from the environment,
+// optionally loaded from a .env file, for jobs that are configured through
+// their container environment. Flags given on the command line win.
+package envflags
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Prefix starts the environment variable of every flag: -retry-delay is
+// read from CSVTOOLS_RETRY_DELAY.
+const Prefix = "CSVTOOLS_"
+
+// Name returns the environment variable for flag name under prefix.
+func Name(prefix, flagName string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Parse registers -env-file on fs, parses args and then sets every flag that
+// was not given on the command line from the first of the prefixed variables
+// that is set. Variables from the .env file (-env-file or CSVTOOLS_ENV_FILE)
+// never override the real environment.
+func Parse(fs *flag.FlagSet, args []string, prefixes ...string) error {
+	envFile := fs.String("env-file", "", "load environment variables from this .env file (also "+Prefix+"ENV_FILE)")
+	configDir := fs.String("config-dir", "", "read flags from a mounted directory with one file per flag (also "+Prefix+"CONFIG_DIR)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *envFile == "" {
+		*envFile = os.Getenv(Prefix + "ENV_FILE")
+	}
+	if *envFile != "" {
+		if err := LoadDotEnv(*envFile); err != nil {
+			return err
+		}
+	}
+	if *configDir == "" {
+		*configDir = os.Getenv(Prefix + "CONFIG_DIR")
+	}
+	if *configDir != "" {
+		if err := LoadConfigDir(*configDir); err != nil {
+			return err
+		}
+	}
+
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || given[f.Name] || f.Name == "env-file" || f.Name == "config-dir" {
+			return
+		}
+		for _, prefix := range prefixes {
+			name := Name(prefix, f.Name)
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				continue
+			}
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %w", value, name, setErr)
+			}
+			return
+		}
+	})
+	return err
+}
+
+// LoadConfigDir reads a directory as mounted from a Kubernetes ConfigMap or
+// Secret: every file holds the value of the flag it is named after
+// ("retry-delay", or "grep-i" for a csvtools subcommand), or of the variable
+// it is named after ("CSVTOOLS_RETRY_DELAY"). Like LoadDotEnv it never
+// overrides variables that are already set. Hidden files are skipped.
+func LoadConfigDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read config directory %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to read config %s: %w", path, err)
+		}
+		if info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read config %s: %w", path, err)
+		}
+		key := name
+		if !strings.HasPrefix(key, Prefix) {
+			key = Name(Prefix, name)
+		}
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, strings.TrimRight(string(data), "\r\n")); err != nil {
+			return fmt.Errorf("failed to apply config %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// LoadDotEnv sets the variables in a .env file that are not already set.
+// Lines are KEY=VALUE, optionally prefixed with "export"; values may be
+// single quoted (literal) or double quoted (with \n, \" and \\ escapes), and
+// lines starting with # are comments.
+func LoadDotEnv(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("env file %s does not exist", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open env file %s: %w", path, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+		key, value, ok := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("env file %s line %d: expected KEY=VALUE", path, line)
+		}
+		value, err := unquote(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("env file %s line %d: %w", path, line, err)
+		}
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("env file %s line %d: %w", path, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read env file %s: %w", path, err)
+	}
+	return nil
+}
+
+func unquote(value string) (string, error) {
+	if value == "" || (value[0] != '\'' && value[0] != '"') {
+		// Unquoted values may end in a comment.
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		return value, nil
+	}
+	end := -1
+	for i := 1; i < len(value); i++ {
+		if value[0] == '"' && value[i] == '\\' {
+			i++
+			continue
+		}
+		if value[i] == value[0] {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return "", fmt.Errorf("unterminated quoted value %s", value)
+	}
+	if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected text after quoted value %s", value)
+	}
+	if value[0] == '\'' {
+		return value[1:end], nil
+	}
+	s, err := strconv.Unquote(value[:end+1])
+	if err != nil {
+		return "", fmt.Errorf("invalid quoted value %s", value)
+	}
+	return s, nil
+}
@@ -0,0 +1,22 @@
+// Package exitcode defines the process exit codes shared by all csvtools
+// binaries, so that schedulers such as Kubernetes Jobs can tell a bad
+// configuration from a failed or partially failed run.
+package exitcode
+
+const (
+	// OK means every file was processed, or there was nothing to do.
+	OK = 0
+	// Failure means the run failed and produced no output.
+	Failure = 1
+	// Usage means the flags, environment or configuration are invalid;
+	// retrying without changing them will not help.
+	Usage = 2
+	// Partial means output was written but some input files failed.
+	Partial = 3
+	// Busy means another run held the destination; retrying later can
+	// succeed.
+	Busy = 4
+	// Interrupted means the run was stopped by SIGINT or SIGTERM and its
+	// output was discarded.
+	Interrupted = 130
+)
@@ -0,0 +1,326 @@
+// Package flatjson turns JSON into CSV: a JSON array of records, or JSON
+// Lines with a record per line, becomes a row per record, with nested
+// objects flattened into columns such as address.city.
+package flatjson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"csvtools/src/internal/csvio"
+)
+
+// Extensions are the file extensions read as JSON.
+var Extensions = []string{"json", "jsonl", "ndjson"}
+
+// IsJSON reports whether name has one of Extensions.
+func IsJSON(name string) bool {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	for _, e := range Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Array handling modes.
+const (
+	// ArraysJSON keeps an array in one column as JSON text.
+	ArraysJSON = "json"
+	// ArraysIndex flattens every element into a column of its own, e.g.
+	// tags.0 and tags.1.
+	ArraysIndex = "index"
+	// ArraysJoin joins the elements of an array of scalars with commas into
+	// one column; other arrays are kept as JSON text.
+	ArraysJoin = "join"
+)
+
+// Options control how records are flattened.
+type Options struct {
+	// Separator joins the keys of nested objects; empty means ".".
+	Separator string
+	// Arrays is one of ArraysJSON (the default), ArraysIndex or ArraysJoin.
+	Arrays string
+}
+
+// Validate checks Arrays.
+func (o Options) Validate() error {
+	switch o.Arrays {
+	case "", ArraysJSON, ArraysIndex, ArraysJoin:
+		return nil
+	}
+	return fmt.Errorf("invalid array handling %q (want json, index or join)", o.Arrays)
+}
+
+// WriteCSV writes the records of the JSON in r to w as CSV with a header
+// row. Columns are the flattened keys in the order they first appear; a
+// record without a key leaves its column empty, null is empty too, and a
+// record that isn't an object goes into a column called "value". r is read
+// twice, first for the columns.
+func (o Options) WriteCSV(w io.Writer, r io.ReadSeeker) error {
+	var columns []string
+	index := make(map[string]int)
+	err := o.records(r, func(row []field) error {
+		for _, f := range row {
+			if _, ok := index[f.key]; !ok {
+				index[f.key] = len(columns)
+				columns = append(columns, f.key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	cw := csvio.NewWriter(w, csvio.WriterOptions{})
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	err = o.records(r, func(row []field) error {
+		clear(record)
+		for _, f := range row {
+			record[index[f.key]] = f.value
+		}
+		return cw.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// field is a flattened key and its value.
+type field struct {
+	key, value string
+}
+
+// member is a key of an object; objects are decoded as []member to keep
+// their keys in order.
+type member struct {
+	key   string
+	value any
+}
+
+// records calls fn with every flattened record of the JSON in r: the
+// elements of a top-level array, or every top-level value otherwise.
+func (o Options) records(r io.Reader, fn func([]field) error) error {
+	br := bufio.NewReader(r)
+	// A byte order mark isn't JSON.
+	if bom, _ := br.Peek(3); bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		_, _ = br.Discard(3)
+	}
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var row []field
+	n := 0
+	emit := func(v any) error {
+		n++
+		row = o.flatten(row[:0], "", v)
+		if err := fn(row); err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+		return nil
+	}
+	if tok == json.Delim('[') {
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return fmt.Errorf("record %d: %w", n+1, err)
+			}
+			v, err := decode(dec, tok)
+			if err != nil {
+				return fmt.Errorf("record %d: %w", n+1, err)
+			}
+			if err := emit(v); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			return fmt.Errorf("unexpected data after the top-level array")
+		}
+		return nil
+	}
+	for {
+		v, err := decode(dec, tok)
+		if err != nil {
+			return fmt.Errorf("record %d: %w", n+1, err)
+		}
+		if err := emit(v); err != nil {
+			return err
+		}
+		if tok, err = dec.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("record %d: %w", n+1, err)
+		}
+	}
+}
+
+// decode reads the value starting with tok: []member for an object, []any
+// for an array, or a scalar.
+func decode(dec *json.Decoder, tok json.Token) (any, error) {
+	switch tok {
+	case json.Delim('{'):
+		var obj []member
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decode(dec, tok)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, member{key: key.(string), value: v})
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []any{}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decode(dec, tok)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err := dec.Token()
+		return arr, err
+	case json.Delim('}'), json.Delim(']'):
+		return nil, fmt.Errorf("unexpected %v", tok)
+	}
+	return tok, nil
+}
+
+func (o Options) join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	sep := o.Separator
+	if sep == "" {
+		sep = "."
+	}
+	return prefix + sep + key
+}
+
+// flatten appends the fields of v under key to row.
+func (o Options) flatten(row []field, key string, v any) []field {
+	switch v := v.(type) {
+	case []member:
+		for _, m := range v {
+			row = o.flatten(row, o.join(key, m.key), m.value)
+		}
+		return row
+	case []any:
+		if key == "" {
+			key = "value"
+		}
+		switch o.Arrays {
+		case ArraysIndex:
+			for i, e := range v {
+				row = o.flatten(row, o.join(key, strconv.Itoa(i)), e)
+			}
+			return row
+		case ArraysJoin:
+			parts := make([]string, len(v))
+			for i, e := range v {
+				switch e.(type) {
+				case []member, []any:
+					return append(row, field{key: key, value: encode(v)})
+				}
+				parts[i] = scalar(e)
+			}
+			return append(row, field{key: key, value: strings.Join(parts, ",")})
+		}
+		return append(row, field{key: key, value: encode(v)})
+	}
+	if key == "" {
+		key = "value"
+	}
+	return append(row, field{key: key, value: scalar(v)})
+}
+
+// scalar formats a string, number, bool or null as a cell.
+func scalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// encode formats a decoded value as compact JSON, keys in their order.
+func encode(v any) string {
+	var buf bytes.Buffer
+	encodeTo(&buf, v)
+	return buf.String()
+}
+
+func encodeTo(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case []member:
+		buf.WriteByte('{')
+		for i, m := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(m.key)
+			buf.Write(key)
+			buf.WriteByte(':')
+			encodeTo(buf, m.value)
+		}
+		buf.WriteByte('}')
+	case []any:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			encodeTo(buf, e)
+		}
+		buf.WriteByte(']')
+	case nil:
+		buf.WriteString("null")
+	case json.Number:
+		buf.WriteString(v.String())
+	default:
+		b, _ := json.Marshal(v)
+		buf.Write(b)
+	}
+}
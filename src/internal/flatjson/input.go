@@ -0,0 +1,97 @@
+package flatjson
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"csvtools/src/internal/discover"
+)
+
+// InputFlags binds -json, -json-separator and -json-arrays, which read JSON
+// files as inputs besides CSV files.
+type InputFlags struct {
+	Enabled bool
+	Options
+}
+
+// Register adds the flags to fs.
+func (f *InputFlags) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.Enabled, "json", false, "also read .json, .jsonl and .ndjson files, with a column per flattened key")
+	fs.StringVar(&f.Separator, "json-separator", ".", "joins the keys of nested JSON objects into column names")
+	f.Arrays = ArraysJSON
+	fs.Func("json-arrays", "how to flatten JSON arrays: json (keep as JSON text), index (a column per element) or join (comma separated) (default json)", func(s string) error {
+		f.Arrays = s
+		return f.Validate()
+	})
+}
+
+// Apply adds the JSON extensions to the files discovery picks up.
+func (f *InputFlags) Apply(discovery *discover.Options) {
+	if !f.Enabled {
+		return
+	}
+	exts := discovery.Extensions
+	if len(exts) == 0 {
+		exts = discover.DefaultExtensions
+	}
+	exts = slices.Clone(exts)
+	for _, name := range Extensions {
+		if !slices.ContainsFunc(exts, func(e discover.Extension) bool { return e.Name == name }) {
+			exts = append(exts, discover.Extension{Name: name, Delimiter: ','})
+		}
+	}
+	discovery.Extensions = exts
+}
+
+// Expand replaces the JSON files among files with their records converted
+// to CSV in dir. The converted files keep the JSON file's Path in Source.
+// Other files are kept as they are.
+func (f *InputFlags) Expand(files []discover.File, dir string) ([]discover.File, error) {
+	if !f.Enabled {
+		return files, nil
+	}
+	out := make([]discover.File, len(files))
+	for i, file := range files {
+		out[i] = file
+		if !slices.Contains(Extensions, file.Ext) {
+			continue
+		}
+		converted, err := f.convert(file, dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JSON file %s: %w", file.Path, err)
+		}
+		out[i] = converted
+	}
+	return out, nil
+}
+
+func (f *InputFlags) convert(file discover.File, dir string) (discover.File, error) {
+	in, err := os.Open(file.Path)
+	if err != nil {
+		return file, err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	csvFile, err := os.CreateTemp(dir, "json-*.csv")
+	if err != nil {
+		return file, err
+	}
+	err = f.WriteCSV(csvFile, in)
+	if cerr := csvFile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return file, err
+	}
+	converted := file
+	converted.Path, converted.Ext = csvFile.Name(), "csv"
+	converted.Delimiter, converted.FixedDelimiter = ',', true
+	converted.Source = file.Path
+	if info, err := os.Stat(csvFile.Name()); err == nil {
+		converted.Size = info.Size()
+	}
+	return converted, nil
+}
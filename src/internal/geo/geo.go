@@ -0,0 +1,97 @@
+// Package geo parses and checks coordinates and encodes them as geohashes,
+// for CSVs feeding mapping tools.
+package geo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse splits a "lat,long" composite, also separated by ";", "/" or blanks
+// and optionally in parentheses or brackets, into its numbers. lonFirst
+// reads "long,lat" instead, as GeoJSON and WKT order them. The coordinates
+// are checked with Check.
+func Parse(s string, lonFirst bool) (lat, lon float64, err error) {
+	s = strings.Trim(strings.TrimSpace(s), "()[]")
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == '/' || r == ' ' || r == '\t'
+	})
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("%q is not a pair of coordinates", s)
+	}
+	a, errA := strconv.ParseFloat(parts[0], 64)
+	b, errB := strconv.ParseFloat(parts[1], 64)
+	if errA != nil || errB != nil {
+		return 0, 0, fmt.Errorf("%q is not a pair of coordinates", s)
+	}
+	lat, lon = a, b
+	if lonFirst {
+		lat, lon = b, a
+	}
+	return lat, lon, Check(lat, lon)
+}
+
+// ParsePair parses a latitude and a longitude held in two cells, checking
+// them with Check.
+func ParsePair(latCell, lonCell string) (lat, lon float64, err error) {
+	if lat, err = strconv.ParseFloat(strings.TrimSpace(latCell), 64); err != nil {
+		return 0, 0, fmt.Errorf("latitude %q is not a number", latCell)
+	}
+	if lon, err = strconv.ParseFloat(strings.TrimSpace(lonCell), 64); err != nil {
+		return 0, 0, fmt.Errorf("longitude %q is not a number", lonCell)
+	}
+	return lat, lon, Check(lat, lon)
+}
+
+// Check reports a latitude outside -90 to 90 or a longitude outside -180 to
+// 180, which are often swapped or scaled coordinates.
+func Check(lat, lon float64) error {
+	if !(lat >= -90 && lat <= 90) {
+		return fmt.Errorf("latitude %v is out of range -90 to 90", lat)
+	}
+	if !(lon >= -180 && lon <= 180) {
+		return fmt.Errorf("longitude %v is out of range -180 to 180", lon)
+	}
+	return nil
+}
+
+// MaxPrecision is the longest geohash Geohash makes, about 4 cm across.
+const MaxPrecision = 12
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Geohash returns the geohash of a point with precision characters, 1 to
+// MaxPrecision: a cell of about 5000 km for 1, 150 m for 7 and 5 m for 9.
+func Geohash(lat, lon float64, precision int) string {
+	precision = min(max(precision, 1), MaxPrecision)
+	latRange, lonRange := [2]float64{-90, 90}, [2]float64{-180, 180}
+	hash := make([]byte, 0, precision)
+	even := true
+	bits, ch := 0, 0
+	for len(hash) < precision {
+		r, v := &latRange, lat
+		if even {
+			r, v = &lonRange, lon
+		}
+		mid := (r[0] + r[1]) / 2
+		ch <<= 1
+		if v >= mid {
+			ch |= 1
+			r[0] = mid
+		} else {
+			r[1] = mid
+		}
+		even = !even
+		if bits++; bits == 5 {
+			hash = append(hash, base32[ch])
+			bits, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// Format writes a coordinate without trailing zeros.
+func Format(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
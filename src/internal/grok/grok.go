@@ -0,0 +1,209 @@
+// Package grok compiles regular expressions that may refer to named
+// patterns as %{NAME} or %{NAME:field}, as Logstash grok does, and matches
+// lines against them into fields. Patterns are RE2 syntax, so the built-in
+// ones are simplified where grok relies on lookarounds.
+package grok
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Builtin are the patterns every Library knows.
+var Builtin = map[string]string{
+	"USERNAME":          `[a-zA-Z0-9._-]+`,
+	"USER":              `%{USERNAME}`,
+	"EMAILLOCALPART":    "[a-zA-Z0-9!#$%&'*+/=?^_`{|}~-]+(?:\\.[a-zA-Z0-9!#$%&'*+/=?^_`{|}~-]+)*",
+	"EMAILADDRESS":      `%{EMAILLOCALPART}@%{HOSTNAME}`,
+	"INT":               `[+-]?[0-9]+`,
+	"BASE10NUM":         `[+-]?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+)`,
+	"NUMBER":            `%{BASE10NUM}`,
+	"BASE16NUM":         `[+-]?(?:0x)?[0-9A-Fa-f]+`,
+	"POSINT":            `\b[1-9][0-9]*\b`,
+	"NONNEGINT":         `\b[0-9]+\b`,
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"QUOTEDSTRING":      `"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`,
+	"QS":                `%{QUOTEDSTRING}`,
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"MAC":               `(?:[A-Fa-f0-9]{2}[:-]){5}[A-Fa-f0-9]{2}`,
+	"IPV4":              `(?:(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])`,
+	"IPV6":              `(?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}|(?:[0-9A-Fa-f]{1,4}:){0,6}(?:[0-9A-Fa-f]{1,4})?::(?:[0-9A-Fa-f]{1,4}:){0,6}[0-9A-Fa-f]{0,4}`,
+	"IP":                `%{IPV6}|%{IPV4}`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?`,
+	"IPORHOST":          `%{IP}|%{HOSTNAME}`,
+	"HOSTPORT":          `%{IPORHOST}:%{POSINT}`,
+	"UNIXPATH":          `(?:/[\w%!$@:.,+~-]*)+`,
+	"WINPATH":           `(?:[A-Za-z]+:|\\)(?:\\[^\\?*]*)+`,
+	"PATH":              `%{UNIXPATH}|%{WINPATH}`,
+	"URIPROTO":          `[A-Za-z][A-Za-z0-9+.-]+`,
+	"URIHOST":           `%{IPORHOST}(?::%{POSINT})?`,
+	"URIPATH":           `(?:/[A-Za-z0-9$.+!*'(){},~:;=@#%&_\-]*)+`,
+	"URIPARAM":          `\?[A-Za-z0-9$.+!*'|(){},~@#%&/=:;_?\-\[\]<>]*`,
+	"URIPATHPARAM":      `%{URIPATH}(?:%{URIPARAM})?`,
+	"URI":               `%{URIPROTO}://(?:%{USER}(?::[^@]*)?@)?(?:%{URIHOST})?(?:%{URIPATHPARAM})?`,
+	"MONTH":             `\b(?:[Jj]an(?:uary)?|[Ff]eb(?:ruary)?|[Mm]ar(?:ch)?|[Aa]pr(?:il)?|[Mm]ay|[Jj]un(?:e)?|[Jj]ul(?:y)?|[Aa]ug(?:ust)?|[Ss]ep(?:t(?:ember)?)?|[Oo]ct(?:ober)?|[Nn]ov(?:ember)?|[Dd]ec(?:ember)?)\b`,
+	"MONTHNUM":          `0?[1-9]|1[0-2]`,
+	"MONTHDAY":          `0[1-9]|[12][0-9]|3[01]|[1-9]`,
+	"DAY":               `Mon(?:day)?|Tue(?:sday)?|Wed(?:nesday)?|Thu(?:rsday)?|Fri(?:day)?|Sat(?:urday)?|Sun(?:day)?`,
+	"YEAR":              `(?:[0-9]{2}){1,2}`,
+	"HOUR":              `2[0123]|[01]?[0-9]`,
+	"MINUTE":            `[0-5][0-9]`,
+	"SECOND":            `(?:[0-5]?[0-9]|60)(?:[:.,][0-9]+)?`,
+	"TIME":              `%{HOUR}:%{MINUTE}(?::%{SECOND})?`,
+	"DATE_US":           `%{MONTHNUM}[/-]%{MONTHDAY}[/-]%{YEAR}`,
+	"DATE_EU":           `%{MONTHDAY}[./-]%{MONTHNUM}[./-]%{YEAR}`,
+	"DATE":              `%{DATE_US}|%{DATE_EU}`,
+	"DATESTAMP":         `%{DATE}[- ]%{TIME}`,
+	"ISO8601_TIMEZONE":  `Z|[+-]%{HOUR}(?::?%{MINUTE})`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?(?:%{ISO8601_TIMEZONE})?`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} %{INT}`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +%{MONTHDAY} %{TIME}`,
+	"PROG":              `[\x21-\x5a\x5c\x5e-\x7e]+`,
+	"SYSLOGPROG":        `%{PROG:program}(?:\[%{POSINT:pid}\])?`,
+	"SYSLOGHOST":        `%{IPORHOST}`,
+	"SYSLOGBASE":        `%{SYSLOGTIMESTAMP:timestamp} (?:%{SYSLOGHOST:logsource} )?%{SYSLOGPROG}:`,
+	"LOGLEVEL":          `(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|fatal|severe|emerg(?:ency)?|alert)`,
+	"HTTPDUSER":         `%{EMAILADDRESS}|%{USER}`,
+	"COMMONAPACHELOG":   `%{IPORHOST:clientip} %{HTTPDUSER:ident} %{USER:auth} \[%{HTTPDATE:timestamp}\] "(?:%{WORD:verb} %{NOTSPACE:request}(?: HTTP/%{NUMBER:httpversion})?|%{DATA:rawrequest})" %{NUMBER:response} (?:%{NUMBER:bytes}|-)`,
+	"COMBINEDAPACHELOG": `%{COMMONAPACHELOG} %{QS:referrer} %{QS:agent}`,
+}
+
+// Library holds pattern definitions on top of Builtin.
+type Library map[string]string
+
+// Load adds the definitions in path, one "NAME regexp" per line; blank
+// lines and lines starting with # are skipped.
+func (l Library) Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, def, ok := strings.Cut(line, " ")
+		if !ok || !validName.MatchString(name) {
+			return fmt.Errorf("%s:%d: want NAME regexp", path, n)
+		}
+		l[name] = strings.TrimSpace(def)
+	}
+	return scanner.Err()
+}
+
+func (l Library) lookup(name string) (string, bool) {
+	if def, ok := l[name]; ok {
+		return def, true
+	}
+	def, ok := Builtin[name]
+	return def, ok
+}
+
+var (
+	validName = regexp.MustCompile(`^\w+$`)
+	// reference is %{NAME}, %{NAME:field} or %{NAME:field:type}; the type,
+	// grok's int or float, is accepted and ignored.
+	reference = regexp.MustCompile(`%\{(\w+)(?::([^:}]+))?(?::\w+)?\}`)
+)
+
+// maxDepth bounds how deeply patterns may refer to each other, which also
+// stops patterns that refer to themselves.
+const maxDepth = 32
+
+// Pattern is a compiled expression.
+type Pattern struct {
+	re *regexp.Regexp
+	// names are the field names of the subexpressions, "" for unnamed ones.
+	names []string
+}
+
+// Compile expands the pattern references in expr and compiles it. Fields
+// are the %{NAME:field} references and the named groups (?P<field>...).
+func (l Library) Compile(expr string) (*Pattern, error) {
+	var fields []string
+	expanded, err := l.expand(expr, &fields, 0)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, err
+	}
+	p := &Pattern{re: re, names: slices.Clone(re.SubexpNames())}
+	for i, name := range p.names {
+		var n int
+		if _, err := fmt.Sscanf(name, "__f%d", &n); err == nil && n < len(fields) {
+			p.names[i] = fields[n]
+		}
+	}
+	return p, nil
+}
+
+func (l Library) expand(expr string, fields *[]string, depth int) (string, error) {
+	if depth > maxDepth {
+		return "", fmt.Errorf("patterns nested deeper than %d, do they refer to themselves?", maxDepth)
+	}
+	var err error
+	out := reference.ReplaceAllStringFunc(expr, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		m := reference.FindStringSubmatch(ref)
+		def, ok := l.lookup(m[1])
+		if !ok {
+			err = fmt.Errorf("unknown pattern %%{%s}", m[1])
+			return ""
+		}
+		group := "(?:"
+		if m[2] != "" {
+			group = fmt.Sprintf("(?P<__f%d>", len(*fields))
+			*fields = append(*fields, m[2])
+		}
+		var inner string
+		inner, err = l.expand(def, fields, depth+1)
+		return group + inner + ")"
+	})
+	return out, err
+}
+
+// Fields returns the distinct field names of p in order.
+func (p *Pattern) Fields() []string {
+	var fields []string
+	seen := make(map[string]bool)
+	for _, name := range p.names {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// Match matches s and calls set with every field that matched, in the
+// order of the expression, so a field named twice may be set twice.
+func (p *Pattern) Match(s string, set func(field, value string)) bool {
+	m := p.re.FindStringSubmatchIndex(s)
+	if m == nil {
+		return false
+	}
+	for i, name := range p.names {
+		if name == "" || m[2*i] < 0 {
+			continue
+		}
+		set(name, s[m[2*i]:m[2*i+1]])
+	}
+	return true
+}
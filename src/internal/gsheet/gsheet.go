@@ -0,0 +1,280 @@
+// Package gsheet reads the tabs of a Google Sheets spreadsheet as CSV
+// through the Sheets API v4, for sources given as gsheet://<spreadsheet-id>.
+package gsheet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"csvtools/src/internal/csvio"
+	"csvtools/src/internal/discover"
+)
+
+// Prefix starts every spreadsheet location.
+const Prefix = "gsheet://"
+
+// DefaultEndpoint is the Sheets API.
+const DefaultEndpoint = "https://sheets.googleapis.com"
+
+// IsRef reports whether s names a spreadsheet rather than a local path.
+func IsRef(s string) bool {
+	return strings.HasPrefix(s, Prefix)
+}
+
+// Ref is a parsed gsheet://<spreadsheet-id>?tabs=Sales,Customers location.
+type Ref struct {
+	ID string
+	// Tabs are the titles of the tabs to read; empty reads every visible tab.
+	Tabs []string
+	// Endpoint overrides DefaultEndpoint, from ?endpoint=.
+	Endpoint string
+}
+
+// ParseRef parses a spreadsheet location. The id may also be given as the
+// spreadsheet's URL path, e.g. gsheet://docs.google.com/spreadsheets/d/<id>/edit.
+func ParseRef(raw string) (Ref, error) {
+	rest, ok := strings.CutPrefix(raw, Prefix)
+	if !ok {
+		return Ref{}, fmt.Errorf("%s: not a %s location", raw, Prefix)
+	}
+	id, query, _ := strings.Cut(rest, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return Ref{}, fmt.Errorf("%s: %w", raw, err)
+	}
+	if _, after, found := strings.Cut(id, "/d/"); found {
+		id, _, _ = strings.Cut(after, "/")
+	}
+	id = strings.Trim(id, "/")
+	if id == "" || strings.Contains(id, "/") {
+		return Ref{}, fmt.Errorf("%s: missing spreadsheet id", raw)
+	}
+	ref := Ref{ID: id, Endpoint: values.Get("endpoint")}
+	for _, tab := range strings.Split(values.Get("tabs"), ",") {
+		if tab = strings.TrimSpace(tab); tab != "" {
+			ref.Tabs = append(ref.Tabs, tab)
+		}
+	}
+	return ref, nil
+}
+
+// Location returns where tab was read from, for lineage and messages.
+func (r Ref) Location(tab string) string {
+	return Prefix + r.ID + "[" + tab + "]"
+}
+
+// Tab is a tab (sheet) of a spreadsheet.
+type Tab struct {
+	Title  string
+	Hidden bool
+}
+
+// Client calls the Sheets API. Requests are authorized with Token, an OAuth
+// access token, or else with APIKey, which only reaches spreadsheets shared
+// with anyone who has the link.
+type Client struct {
+	HTTP     *http.Client
+	Endpoint string
+	Token    string
+	APIKey   string
+}
+
+// NewClient returns a client for ref, with credentials from
+// GOOGLE_OAUTH_ACCESS_TOKEN (e.g. from gcloud auth print-access-token) or
+// GOOGLE_API_KEY.
+func NewClient(ref Ref) *Client {
+	endpoint := ref.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	return &Client{
+		HTTP:     http.DefaultClient,
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Token:    os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"),
+		APIKey:   os.Getenv("GOOGLE_API_KEY"),
+	}
+}
+
+// Tabs lists the tabs of spreadsheet id in their order.
+func (c *Client) Tabs(ctx context.Context, id string) ([]Tab, error) {
+	var resp struct {
+		Sheets []struct {
+			Properties struct {
+				Title  string `json:"title"`
+				Hidden bool   `json:"hidden"`
+			} `json:"properties"`
+		} `json:"sheets"`
+	}
+	query := url.Values{"fields": {"sheets.properties(title,hidden)"}}
+	if err := c.get(ctx, "/v4/spreadsheets/"+url.PathEscape(id), query, &resp); err != nil {
+		return nil, err
+	}
+	tabs := make([]Tab, len(resp.Sheets))
+	for i, s := range resp.Sheets {
+		tabs[i] = Tab{Title: s.Properties.Title, Hidden: s.Properties.Hidden}
+	}
+	return tabs, nil
+}
+
+// Values returns the cells of tab as the spreadsheet shows them. Trailing
+// empty cells and rows are not returned by the API.
+func (c *Client) Values(ctx context.Context, id, tab string) ([][]string, error) {
+	var resp struct {
+		Values [][]any `json:"values"`
+	}
+	// A quoted tab title is a range covering the whole tab.
+	rng := "'" + strings.ReplaceAll(tab, "'", "''") + "'"
+	query := url.Values{"majorDimension": {"ROWS"}, "valueRenderOption": {"FORMATTED_VALUE"}}
+	if err := c.get(ctx, "/v4/spreadsheets/"+url.PathEscape(id)+"/values/"+url.PathEscape(rng), query, &resp); err != nil {
+		return nil, err
+	}
+	rows := make([][]string, len(resp.Values))
+	for i, row := range resp.Values {
+		rows[i] = make([]string, len(row))
+		for j, cell := range row {
+			if s, ok := cell.(string); ok {
+				rows[i][j] = s
+			} else if cell != nil {
+				rows[i][j] = fmt.Sprint(cell)
+			}
+		}
+	}
+	return rows, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, v any) error {
+	if c.Token == "" && c.APIKey != "" {
+		query.Set("key", c.APIKey)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Endpoint+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		msg := resp.Status
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Message != "" {
+			msg += ": " + apiErr.Error.Message
+		}
+		if (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) && c.Token == "" && c.APIKey == "" {
+			msg += " (set GOOGLE_OAUTH_ACCESS_TOKEN or GOOGLE_API_KEY)"
+		}
+		return fmt.Errorf("sheets API: %s", msg)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Selected returns the tabs of tabs that ref reads, in the order of the
+// spreadsheet. Tabs named in ref must exist; they may be hidden.
+func (r Ref) Selected(tabs []Tab) ([]Tab, error) {
+	if len(r.Tabs) == 0 {
+		var visible []Tab
+		for _, t := range tabs {
+			if !t.Hidden {
+				visible = append(visible, t)
+			}
+		}
+		return visible, nil
+	}
+	var selected []Tab
+	for _, name := range r.Tabs {
+		found := false
+		for _, t := range tabs {
+			if t.Title == name {
+				selected, found = append(selected, t), true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("spreadsheet %s has no tab %q", r.ID, name)
+		}
+	}
+	return selected, nil
+}
+
+// WriteCSV writes rows as CSV, padded to the width of the header row.
+func WriteCSV(w io.Writer, rows [][]string) error {
+	cw := csvio.NewWriter(w, csvio.WriterOptions{})
+	for i, row := range rows {
+		for i > 0 && len(row) < len(rows[0]) {
+			row = append(row, "")
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Files snapshots the selected tabs of the spreadsheet at raw into CSV files
+// in dir, one per tab named after it, with the tab's Location as Source.
+func Files(ctx context.Context, raw, dir string) ([]discover.File, error) {
+	ref, err := ParseRef(raw)
+	if err != nil {
+		return nil, err
+	}
+	client := NewClient(ref)
+	all, err := client.Tabs(ctx, ref.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spreadsheet %s: %w", ref.ID, err)
+	}
+	tabs, err := ref.Selected(all)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]discover.File, 0, len(tabs))
+	for _, tab := range tabs {
+		rows, err := client.Values(ctx, ref.ID, tab.Title)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", ref.Location(tab.Title), err)
+		}
+		csvFile, err := os.CreateTemp(dir, "gsheet-*.csv")
+		if err != nil {
+			return nil, err
+		}
+		err = WriteCSV(csvFile, rows)
+		if cerr := csvFile.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", ref.Location(tab.Title), err)
+		}
+		file := discover.File{
+			Path:           csvFile.Name(),
+			Name:           tab.Title,
+			Ext:            "csv",
+			Delimiter:      ',',
+			FixedDelimiter: true,
+			ModTime:        time.Now(),
+			Source:         ref.Location(tab.Title),
+		}
+		if info, err := os.Stat(file.Path); err == nil {
+			file.Size = info.Size()
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
@@ -0,0 +1,202 @@
+// Package headers normalizes CSV header names so that every converter turns
+// the same upstream header into the same sheet column or table column.
+package headers
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Normalizer rewrites header names. The zero value leaves names untouched.
+type Normalizer struct {
+	// StripUnits removes trailing unit annotations like "Weight (kg)" or "Price [EUR]".
+	StripUnits bool
+	// Lower lowercases names.
+	Lower bool
+	// Snake converts names to snake_case; it implies Lower.
+	Snake bool
+	// Renames maps a header (as found in the file, or after the steps above)
+	// to the exact name to use instead.
+	Renames map[string]string
+	// Translations maps lowercased source headers, e.g. of a German vendor
+	// file, to the names of the target schema. They are looked up before the
+	// steps above and, failing that, after them.
+	Translations map[string]string
+}
+
+var unitsPattern = regexp.MustCompile(`\s*[(\[][^)\]]*[)\]]\s*$`)
+
+// Enabled reports whether the normalizer changes anything.
+func (n Normalizer) Enabled() bool {
+	return n.StripUnits || n.Lower || n.Snake || len(n.Renames) > 0 || len(n.Translations) > 0
+}
+
+// Name normalizes a single header name. An explicit rename of the original
+// name wins; otherwise the name is translated, the normalization steps run in
+// the order strip units, lowercase, snake_case and the result may itself be
+// translated, if the original wasn't, and renamed. Surrounding blanks are
+// trimmed only if the normalizer is Enabled.
+func (n Normalizer) Name(name string) string {
+	if !n.Enabled() {
+		return name
+	}
+	if to, ok := n.Renames[name]; ok {
+		return to
+	}
+	out := strings.TrimSpace(name)
+	to, translated := n.Translations[strings.ToLower(out)]
+	if translated {
+		out = to
+	}
+	if n.StripUnits {
+		out = unitsPattern.ReplaceAllString(out, "")
+	}
+	if n.Snake {
+		out = SnakeCase(out)
+	} else if n.Lower {
+		out = strings.ToLower(out)
+	}
+	if to, ok := n.Translations[strings.ToLower(out)]; ok && !translated {
+		out = to
+	}
+	if to, ok := n.Renames[out]; ok {
+		return to
+	}
+	return out
+}
+
+// Apply returns a normalized copy of names.
+func (n Normalizer) Apply(names []string) []string {
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = n.Name(name)
+	}
+	return out
+}
+
+// SnakeCase turns "Order Date", "orderDate" and "order-date" into "order_date".
+func SnakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	pendingSep := false
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			pendingSep = b.Len() > 0
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 && b.Len() > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				pendingSep = true
+			}
+		}
+		if pendingSep {
+			b.WriteByte('_')
+			pendingSep = false
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// LoadRenames reads a rename map file: a CSV with the original header name
+// in the first column and the new name in the second. A first row of
+// "from,to" is treated as a header and skipped.
+func LoadRenames(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rename map %s: %w", path, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	renames := make(map[string]string)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rename map %s: %w", path, err)
+		}
+		if line == 1 && len(record) == 2 && strings.EqualFold(record[0], "from") && strings.EqualFold(record[1], "to") {
+			continue
+		}
+		if len(record) != 2 {
+			return nil, fmt.Errorf("rename map %s line %d: expected 2 columns, got %d", path, line, len(record))
+		}
+		renames[record[0]] = record[1]
+	}
+	return renames, nil
+}
+
+// Flags binds the header flags shared by all converters.
+type Flags struct {
+	normalize  string
+	renameMap  string
+	dictionary string
+	locale     string
+	policy     Policy
+}
+
+// Register adds -normalize-headers, -rename-headers, -translate-headers,
+// -header-locale and -header-policy to fs.
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.normalize, "normalize-headers", "", "comma separated header normalizations: lower, snake, strip-units")
+	fs.StringVar(&f.renameMap, "rename-headers", "", "CSV file mapping original header names to new ones (from,to)")
+	fs.StringVar(&f.dictionary, "translate-headers", "", "CSV or JSON dictionary translating header names into the target schema, optionally per locale")
+	fs.StringVar(&f.locale, "header-locale", "", "use only this locale of the -translate-headers dictionary, e.g. de")
+	fs.Var(&f.policy, "header-policy", "blank or repeated header names: rename, error or keep")
+}
+
+// Policy returns the policy for blank and repeated header names.
+func (f *Flags) Policy() Policy {
+	return f.policy
+}
+
+// Normalizer builds the Normalizer described by the parsed flags.
+func (f *Flags) Normalizer() (Normalizer, error) {
+	var n Normalizer
+	for _, step := range strings.Split(f.normalize, ",") {
+		switch strings.TrimSpace(step) {
+		case "":
+		case "lower":
+			n.Lower = true
+		case "snake":
+			n.Snake = true
+		case "strip-units":
+			n.StripUnits = true
+		default:
+			return n, fmt.Errorf("unknown header normalization %q", step)
+		}
+	}
+	if f.renameMap != "" {
+		renames, err := LoadRenames(f.renameMap)
+		if err != nil {
+			return n, err
+		}
+		n.Renames = renames
+	}
+	if f.locale != "" && f.dictionary == "" {
+		return n, fmt.Errorf("-header-locale needs -translate-headers")
+	}
+	if f.dictionary != "" {
+		translations, err := LoadTranslations(f.dictionary, f.locale)
+		if err != nil {
+			return n, err
+		}
+		n.Translations = translations
+	}
+	return n, nil
+}
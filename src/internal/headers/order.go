@@ -0,0 +1,110 @@
+package headers
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ColumnOrder binds -column-order and -column-schema, which decide the order
+// of the output columns: as in the source (preserve), sorted by name
+// (sorted), or as declared in a schema file (schema).
+type ColumnOrder struct {
+	Mode       string
+	SchemaFile string
+	schema     []string
+}
+
+// Register adds -column-order and -column-schema to fs.
+func (c *ColumnOrder) Register(fs *flag.FlagSet) {
+	fs.StringVar(&c.Mode, "column-order", "preserve", "order of the output columns: preserve, sorted or schema")
+	fs.StringVar(&c.SchemaFile, "column-schema", "", "file listing the column names in order, one per line, for -column-order schema")
+}
+
+// Load checks the mode and reads the schema file.
+func (c *ColumnOrder) Load() error {
+	switch c.Mode {
+	case "", "preserve", "sorted":
+		if c.SchemaFile != "" {
+			return fmt.Errorf("-column-schema needs -column-order schema")
+		}
+		return nil
+	case "schema":
+	default:
+		return fmt.Errorf("unknown column order %q (want preserve, sorted or schema)", c.Mode)
+	}
+	if c.SchemaFile == "" {
+		return fmt.Errorf("-column-order schema needs -column-schema")
+	}
+	f, err := os.Open(c.SchemaFile)
+	if err != nil {
+		return fmt.Errorf("failed to open column schema %s: %w", c.SchemaFile, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	c.schema = nil
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		c.schema = append(c.schema, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read column schema %s: %w", c.SchemaFile, err)
+	}
+	return nil
+}
+
+// Permutation returns, for every output column, the index of the source
+// column in names, or nil to keep the source order. Sorting ignores case and
+// keeps the source order of equal names. A schema puts the columns it lists
+// first, in its order and matched ignoring case, followed by the columns it
+// doesn't list in source order; listed columns a file lacks are skipped.
+func (c ColumnOrder) Permutation(names []string) []int {
+	if c.Mode == "" || c.Mode == "preserve" {
+		return nil
+	}
+	perm := make([]int, len(names))
+	for i := range perm {
+		perm[i] = i
+	}
+	switch c.Mode {
+	case "sorted":
+		slices.SortStableFunc(perm, func(a, b int) int {
+			return strings.Compare(strings.ToLower(names[a]), strings.ToLower(names[b]))
+		})
+	case "schema":
+		rank := func(i int) int {
+			r := slices.IndexFunc(c.schema, func(s string) bool { return strings.EqualFold(s, names[i]) })
+			if r < 0 {
+				return len(c.schema)
+			}
+			return r
+		}
+		slices.SortStableFunc(perm, func(a, b int) int {
+			return rank(a) - rank(b)
+		})
+	}
+	return perm
+}
+
+// Reorder returns record in the order of perm; cells missing from a short
+// record are empty. A nil perm returns record as is.
+func Reorder(record []string, perm []int) []string {
+	if perm == nil {
+		return record
+	}
+	out := make([]string, len(perm))
+	for i, j := range perm {
+		if j < len(record) {
+			out[i] = record[j]
+		}
+	}
+	return out
+}
@@ -0,0 +1,101 @@
+package headers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Policy decides what happens to blank and repeated header names.
+type Policy string
+
+const (
+	// PolicyRename names blank headers "column_<position>" and suffixes
+	// repeated ones with "_2", "_3", ...
+	PolicyRename Policy = "rename"
+	// PolicyError fails with a message listing the blank and repeated names.
+	PolicyError Policy = "error"
+	// PolicyKeep leaves the header untouched.
+	PolicyKeep Policy = "keep"
+)
+
+// String implements flag.Value.
+func (p *Policy) String() string {
+	if *p == "" {
+		return string(PolicyRename)
+	}
+	return string(*p)
+}
+
+// Set implements flag.Value.
+func (p *Policy) Set(s string) error {
+	switch Policy(s) {
+	case PolicyRename, PolicyError, PolicyKeep:
+		*p = Policy(s)
+		return nil
+	}
+	return fmt.Errorf("unknown header policy %q (want rename, error or keep)", s)
+}
+
+// Fix applies the policy to names and returns the resulting header. The zero
+// Policy behaves like PolicyRename.
+func (p Policy) Fix(names []string) ([]string, error) {
+	return p.fix(names, func(s string) string { return s })
+}
+
+// FixFold is like Fix but treats names differing only in case as repeated,
+// as SQL databases do for column names.
+func (p Policy) FixFold(names []string) ([]string, error) {
+	return p.fix(names, strings.ToLower)
+}
+
+func (p Policy) fix(names []string, key func(string) string) ([]string, error) {
+	if p == PolicyKeep {
+		return names, nil
+	}
+	if p == PolicyError {
+		var problems []string
+		seen := make(map[string]int, len(names))
+		for i, name := range names {
+			if strings.TrimSpace(name) == "" {
+				problems = append(problems, fmt.Sprintf("column %d is blank", i+1))
+				continue
+			}
+			if first, ok := seen[key(name)]; ok {
+				problems = append(problems, fmt.Sprintf("column %d repeats %q from column %d", i+1, name, first+1))
+				continue
+			}
+			seen[key(name)] = i
+		}
+		if len(problems) > 0 {
+			return nil, fmt.Errorf("invalid header: %s", strings.Join(problems, "; "))
+		}
+		return names, nil
+	}
+
+	out := make([]string, len(names))
+	taken := make(map[string]bool, len(names)) // every name in the header, so suffixes don't collide
+	for i, name := range names {
+		if strings.TrimSpace(name) == "" {
+			name = "column_" + strconv.Itoa(i+1)
+		}
+		taken[key(name)] = true
+		out[i] = name
+	}
+	used := make(map[string]bool, len(names))
+	for i, name := range out {
+		if !used[key(name)] {
+			used[key(name)] = true
+			continue
+		}
+		for n := 2; ; n++ {
+			candidate := name + "_" + strconv.Itoa(n)
+			if !used[key(candidate)] && !taken[key(candidate)] {
+				out[i] = candidate
+				used[key(candidate)] = true
+				break
+			}
+		}
+	}
+	return out, nil
+}
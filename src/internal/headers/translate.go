@@ -0,0 +1,130 @@
+package headers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// LoadTranslations reads a header dictionary translating vendor header names
+// into the names of the target schema, keyed by the lowercased source name.
+//
+// A JSON dictionary is either flat, {"Kundennummer": "customer_id"}, or holds
+// one such object per locale, {"de": {...}, "fr": {...}}. A CSV dictionary has
+// the source name in the first column and the target name in the second, with
+// an optional header row "from,to"; a header row "locale,from,to" adds a
+// locale column. With locale set only entries of that locale (and entries
+// without one) are used; otherwise all locales are merged and a name
+// translated differently by two locales is an error. Source names match
+// ignoring case and surrounding space.
+func LoadTranslations(path, locale string) (map[string]string, error) {
+	var entries []translation
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		entries, err = readJSONTranslations(path)
+	} else {
+		entries, err = readCSVTranslations(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	localized, known := false, false
+	translations := make(map[string]string)
+	for _, e := range entries {
+		localized = localized || e.locale != ""
+		known = known || strings.EqualFold(e.locale, locale)
+		if locale != "" && e.locale != "" && !strings.EqualFold(e.locale, locale) {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(e.from))
+		if to, ok := translations[key]; ok && to != e.to {
+			return nil, fmt.Errorf("header dictionary %s translates %q to both %q and %q", path, e.from, to, e.to)
+		}
+		translations[key] = e.to
+	}
+	if locale != "" && localized && !known {
+		return nil, fmt.Errorf("header dictionary %s has no locale %q", path, locale)
+	}
+	return translations, nil
+}
+
+type translation struct {
+	locale, from, to string
+}
+
+func readJSONTranslations(path string) ([]translation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header dictionary %s: %w", path, err)
+	}
+	var flat map[string]string
+	if err := json.Unmarshal(data, &flat); err == nil {
+		entries := make([]translation, 0, len(flat))
+		for from, to := range flat {
+			entries = append(entries, translation{from: from, to: to})
+		}
+		return entries, nil
+	}
+	var locales map[string]map[string]string
+	if err := json.Unmarshal(data, &locales); err != nil {
+		return nil, fmt.Errorf("header dictionary %s: want an object of names or of locales: %w", path, err)
+	}
+	var entries []translation
+	// Sorted so that a conflict is always reported the same way.
+	for _, locale := range slices.Sorted(maps.Keys(locales)) {
+		for from, to := range locales[locale] {
+			entries = append(entries, translation{locale: locale, from: from, to: to})
+		}
+	}
+	return entries, nil
+}
+
+func readCSVTranslations(path string) ([]translation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open header dictionary %s: %w", path, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	width := 2
+	var entries []translation
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read header dictionary %s: %w", path, err)
+		}
+		if line == 1 {
+			names := strings.ToLower(strings.Join(record, ","))
+			if names == "locale,from,to" {
+				width = 3
+				continue
+			}
+			if names == "from,to" {
+				continue
+			}
+		}
+		if len(record) != width {
+			return nil, fmt.Errorf("header dictionary %s line %d: expected %d columns, got %d", path, line, width, len(record))
+		}
+		if width == 3 {
+			entries = append(entries, translation{locale: strings.TrimSpace(record[0]), from: record[1], to: record[2]})
+		} else {
+			entries = append(entries, translation{from: record[0], to: record[1]})
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,58 @@
+// Package health implements a file based heartbeat for running in containers:
+// long-running commands touch a heartbeat file as they make progress and
+// "csvtools healthcheck" fails once the file is stale, which orchestrators can
+// use as an exec liveness probe.
+package health
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultMaxAge is how old a heartbeat may be before the check fails.
+const DefaultMaxAge = 5 * time.Minute
+
+// Heartbeat records progress in a file. The zero value (no path) does nothing.
+type Heartbeat struct {
+	Path string
+}
+
+// Beat writes the current time to the heartbeat file.
+func (h Heartbeat) Beat() error {
+	if h.Path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.Path), 0o755); err != nil {
+		return fmt.Errorf("failed to create heartbeat directory: %w", err)
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	if err := os.WriteFile(h.Path, []byte(now+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to write heartbeat %s: %w", h.Path, err)
+	}
+	return nil
+}
+
+// Check returns an error unless the heartbeat file at path was written less
+// than maxAge ago.
+func Check(path string, maxAge time.Duration) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("no heartbeat at %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read heartbeat %s: %w", path, err)
+	}
+	last, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("invalid heartbeat in %s: %w", path, err)
+	}
+	if age := time.Since(last); age > maxAge {
+		return fmt.Errorf("last heartbeat %s ago, more than %s", age.Round(time.Second), maxAge)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+// Package jsonschema writes JSON Schema (https://json-schema.org, draft
+// 2020-12) documents describing the rows of output tables as the json://
+// sink writes them, one object per row, so that consumers of the JSON lines
+// get a contract with the data.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/tableschema"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// Draft is the JSON Schema version documents are written in.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Document describes the objects of a table. Every column is a required
+// property, as the json:// sink writes empty cells as null; columns that
+// may be empty take null besides their type.
+type Document struct {
+	Schema               string     `json:"$schema"`
+	Title                string     `json:"title"`
+	Type                 string     `json:"type"`
+	Properties           Properties `json:"properties"`
+	Required             []string   `json:"required"`
+	AdditionalProperties bool       `json:"additionalProperties"`
+}
+
+// Properties are the properties of a Document, kept in column order.
+type Properties []Property
+
+// Property describes a column.
+type Property struct {
+	Name        string `json:"-"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Type is a JSON type name, or a list of them.
+	Type      any    `json:"type"`
+	Format    string `json:"format,omitempty"`
+	MinLength *int   `json:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Minimum   any    `json:"minimum,omitempty"`
+	Maximum   any    `json:"maximum,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+	Enum      []any  `json:"enum,omitempty"`
+}
+
+func (p Properties) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, prop := range p {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(prop.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(prop)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// formats maps table schema types and string formats to JSON Schema
+// formats. Dates only match theirs in the default layout.
+var formats = map[string]string{
+	"date": "date", "time": "time", "datetime": "date-time", "duration": "duration",
+	"email": "email", "uri": "uri", "uuid": "uuid",
+}
+
+// Describe returns the document of table title with schema. Columns with a
+// field in base also take its title, description and constraints.
+func Describe(title string, schema *arrow.Schema, base *tableschema.Schema) *Document {
+	d := &Document{Schema: Draft, Title: title, Type: "object", Required: []string{}}
+	for i, f := range tableschema.Describe(schema, base).Fields {
+		typ := jsonType(schema.Field(i).Type)
+		p := Property{Name: f.Name, Title: f.Title, Description: f.Description}
+		switch {
+		case f.Format == "" || f.Format == "default":
+			p.Format = formats[f.Type]
+		case f.Type == "" || f.Type == "string":
+			p.Format = formats[f.Format]
+		}
+		nullable := true
+		if k := f.Constraints; k != nil {
+			nullable = !k.Required
+			if typ == "string" {
+				p.MinLength, p.MaxLength = k.MinLength, k.MaxLength
+				if k.Pattern != "" {
+					// Table schema patterns match whole values.
+					p.Pattern = "^(?:" + k.Pattern + ")$"
+				}
+			}
+			if typ == "integer" || typ == "number" {
+				p.Minimum, p.Maximum = number(k.Minimum), number(k.Maximum)
+			}
+			for _, v := range k.Enum {
+				if value, ok := enumValue(typ, v); ok {
+					p.Enum = append(p.Enum, value)
+				}
+			}
+			if len(p.Enum) > 0 && nullable {
+				p.Enum = append(p.Enum, nil)
+			}
+		}
+		p.Type = typ
+		if nullable {
+			p.Type = []string{typ, "null"}
+		}
+		d.Properties = append(d.Properties, p)
+		d.Required = append(d.Required, f.Name)
+	}
+	return d
+}
+
+// jsonType returns the JSON type the json:// sink writes a column of t as.
+func jsonType(t arrow.DataType) string {
+	switch t.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64, arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64:
+		return "integer"
+	case arrow.FLOAT32, arrow.FLOAT64:
+		return "number"
+	case arrow.BOOL:
+		return "boolean"
+	}
+	return "string"
+}
+
+// number returns a numeric bound, or nil for bounds of other types, such as
+// dates, which JSON Schema can't express.
+func number(v any) any {
+	if f, ok := v.(float64); ok {
+		return f
+	}
+	return nil
+}
+
+// enumValue returns the allowed cell v as a value of JSON type typ.
+func enumValue(typ, v string) (any, bool) {
+	switch typ {
+	case "integer":
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	case "number":
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	case "boolean":
+		b, err := strconv.ParseBool(v)
+		return b, err == nil
+	}
+	return v, true
+}
+
+// Write writes d as indented JSON.
+func (d *Document) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(d)
+}
+
+// NewSink returns a sink writing the document of every table to
+// <dir>/<table>.jsonschema.json. base is as for tableschema.NewSink.
+func NewSink(dir string, base func(table string) *tableschema.Schema, policy atomicfile.Policy) *tableschema.Sink {
+	return tableschema.NewDescriptorSink(dir, ".jsonschema.json", func(name string, schema *arrow.Schema) tableschema.Descriptor {
+		return Describe(name, schema, base(name))
+	}, policy)
+}
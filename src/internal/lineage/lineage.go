@@ -0,0 +1,95 @@
+// Package lineage adds audit columns recording where every loaded row came
+// from: its row number in the source file, the file, and when it was loaded.
+package lineage
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The lineage column names. They start with an underscore so they don't
+// clash with the columns of the data.
+const (
+	RowNumber  = "_row_number"
+	SourceFile = "_source_file"
+	LoadedAt   = "_loaded_at"
+)
+
+var all = []string{RowNumber, SourceFile, LoadedAt}
+
+// Columns is a flag.Value parsing "-lineage row_number,source_file" into the
+// lineage columns to add, in the order given. "all" adds all three; the
+// leading underscore is optional.
+type Columns []string
+
+func (c *Columns) String() string {
+	return strings.Join(*c, ",")
+}
+
+func (c *Columns) Set(s string) error {
+	cols, err := Parse(strings.Split(s, ","))
+	if err != nil {
+		return err
+	}
+	*c = cols
+	return nil
+}
+
+// Parse checks and canonicalizes a list of lineage column names.
+func Parse(names []string) (Columns, error) {
+	var cols Columns
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		expanded := []string{name}
+		if name == "all" {
+			expanded = all
+		}
+		for _, name := range expanded {
+			if !strings.HasPrefix(name, "_") {
+				name = "_" + name
+			}
+			if !slices.Contains(all, name) {
+				return nil, fmt.Errorf("unknown lineage column %q (want row_number, source_file, loaded_at or all)", strings.TrimPrefix(name, "_"))
+			}
+			if !slices.Contains(cols, name) {
+				cols = append(cols, name)
+			}
+		}
+	}
+	return cols, nil
+}
+
+// Clash returns the first lineage column that header already has, if any.
+func (c Columns) Clash(header []string) (string, bool) {
+	for _, name := range c {
+		if slices.ContainsFunc(header, func(h string) bool { return strings.EqualFold(h, name) }) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Timestamp formats the load time, taken once per run so that every row of
+// a run carries the same value, as RFC 3339 in UTC.
+func Timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Append appends the lineage cells of data row number row (1-based, the
+// header not counted) of file to dst.
+func (c Columns) Append(dst []string, file string, row int64, loadedAt string) []string {
+	for _, name := range c {
+		switch name {
+		case RowNumber:
+			dst = append(dst, strconv.FormatInt(row, 10))
+		case SourceFile:
+			dst = append(dst, file)
+		case LoadedAt:
+			dst = append(dst, loadedAt)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,207 @@
+// Package naming names sheets and tables with templates instead of after
+// their files, so e.g. "sales_emea_2024-03.csv" and "sales_emea_2024-04.csv"
+// can both load into an "emea" table. Templates use text/template and see
+// the file's name, path and modification time, the named groups a regular
+// expression captures from its name, and cells of its content:
+//
+//	{{.Captures.region}}_{{.Captures.month}}
+//	{{.ModTime.Format "2006_01"}}
+//	{{cell "B1"}} or {{value "region"}}
+package naming
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"csvtools/src/internal/csvio"
+	"csvtools/src/internal/discover"
+)
+
+// Flags holds the naming flags.
+type Flags struct {
+	Template string
+	Pattern  string
+}
+
+// Register adds -name-template and -name-pattern to fs; what is "sheet" or
+// "table".
+func (f *Flags) Register(fs *flag.FlagSet, what string) {
+	fs.StringVar(&f.Template, "name-template", "", "text/template naming every "+what+` instead of its file, e.g. "{{.Captures.region}}_{{.ModTime.Format \"2006_01\"}}" or "{{value \"region\"}}"`)
+	fs.StringVar(&f.Pattern, "name-pattern", "", "regular expression matched against file names, its named groups becoming .Captures of -name-template, e.g. "+`"^sales_(?P<region>[a-z]+)_(?P<month>\d{4}-\d{2})$"`)
+}
+
+// Namer returns the Namer the flags describe, or nil without a template.
+func (f *Flags) Namer() (*Namer, error) {
+	if f.Template == "" {
+		if f.Pattern != "" {
+			return nil, errors.New("-name-pattern needs -name-template")
+		}
+		return nil, nil
+	}
+	return New(f.Template, f.Pattern)
+}
+
+// Namer names files with a template.
+type Namer struct {
+	tmpl    *template.Template
+	pattern *regexp.Regexp
+}
+
+// File is what a template sees of a file.
+type File struct {
+	// Name is the file name without its extension, Ext the extension
+	// without the dot, Dir the directory of the file and Path its path.
+	Name, Ext, Dir, Path string
+	// ModTime is when the file was last modified.
+	ModTime time.Time
+	// Captures holds the groups of the pattern matched against Name, by
+	// name and by number; the whole match is "0".
+	Captures map[string]string
+}
+
+// New returns a Namer using the template text. pattern, if set, must match
+// the names of the files named.
+func New(text, pattern string) (*Namer, error) {
+	n := &Namer{}
+	var err error
+	if n.tmpl, err = template.New("name").Option("missingkey=error").Funcs(funcs(nil)).Parse(text); err != nil {
+		return nil, fmt.Errorf("invalid name template: %w", err)
+	}
+	if pattern != "" {
+		if n.pattern, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid name pattern: %w", err)
+		}
+	}
+	return n, nil
+}
+
+// Name returns the name of src. head returns up to its first n records, the
+// header first, for templates reading cells; it is only called if they do.
+func (n *Namer) Name(src discover.File, head func(n int) ([][]string, error)) (string, error) {
+	f := File{Name: src.Name, Ext: src.Ext, Dir: filepath.Dir(src.Path), Path: src.Origin(), ModTime: src.ModTime, Captures: map[string]string{}}
+	if n.pattern != nil {
+		m := n.pattern.FindStringSubmatch(src.Name)
+		if m == nil {
+			return "", fmt.Errorf("%s does not match the name pattern %s", src.Name, n.pattern)
+		}
+		for i, group := range n.pattern.SubexpNames() {
+			f.Captures[strconv.Itoa(i)] = m[i]
+			if group != "" {
+				f.Captures[group] = m[i]
+			}
+		}
+	}
+	tmpl, err := n.tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Funcs(funcs(&rows{head: head})).Execute(&b, f); err != nil {
+		return "", fmt.Errorf("failed to name %s: %w", src.Origin(), err)
+	}
+	name := strings.TrimSpace(b.String())
+	if name == "" {
+		return "", fmt.Errorf("the name template gives %s an empty name", src.Origin())
+	}
+	return name, nil
+}
+
+// rows reads the start of a file as the template asks for it.
+type rows struct {
+	head    func(n int) ([][]string, error)
+	records [][]string
+	read    int
+}
+
+func (r *rows) get(n int) ([][]string, error) {
+	if n > r.read {
+		var err error
+		if r.records, err = r.head(n); err != nil {
+			return nil, err
+		}
+		r.read = n
+	}
+	return r.records, nil
+}
+
+// funcs returns the template functions reading cells from r.
+func funcs(r *rows) template.FuncMap {
+	return template.FuncMap{
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+		"trim":  strings.TrimSpace,
+		// cell returns the cell at an A1 reference, row 1 being the header.
+		"cell": func(ref string) (string, error) {
+			col, row, err := parseRef(ref)
+			if err != nil {
+				return "", err
+			}
+			records, err := r.get(row)
+			if err != nil {
+				return "", err
+			}
+			if row > len(records) || col >= len(records[row-1]) {
+				return "", nil
+			}
+			return records[row-1][col], nil
+		},
+		// value returns the cell of the named column in the first data row.
+		"value": func(column string) (string, error) {
+			records, err := r.get(2)
+			if err != nil {
+				return "", err
+			}
+			if len(records) == 0 {
+				return "", nil
+			}
+			for i, name := range records[0] {
+				if strings.EqualFold(strings.TrimSpace(name), column) {
+					if len(records) < 2 || i >= len(records[1]) {
+						return "", nil
+					}
+					return records[1][i], nil
+				}
+			}
+			return "", fmt.Errorf("no column %s", column)
+		},
+	}
+}
+
+var refPattern = regexp.MustCompile(`^([A-Za-z]{1,3})([1-9][0-9]*)$`)
+
+// parseRef returns the 0-based column and 1-based row of an A1 reference.
+func parseRef(ref string) (col, row int, err error) {
+	m := refPattern.FindStringSubmatch(strings.TrimSpace(ref))
+	if m == nil {
+		return 0, 0, fmt.Errorf("invalid cell reference %q, want e.g. B2", ref)
+	}
+	for _, c := range strings.ToUpper(m[1]) {
+		col = col*26 + int(c-'A'+1)
+	}
+	row, _ = strconv.Atoi(m[2])
+	return col - 1, row, nil
+}
+
+// Head reads up to the first n records of r, for Namer.Name.
+func Head(r csvio.Reader, n int) ([][]string, error) {
+	var records [][]string
+	for len(records) < n {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, append([]string(nil), record...))
+	}
+	return records, nil
+}
@@ -0,0 +1,421 @@
+// Package oci pushes files to an OCI registry as an ORAS artifact: an image
+// manifest with an empty config and a layer per file, titled with the file
+// name as oras pull expects, so data bundles are distributed from the same
+// registries as binaries. It speaks the registry API of the OCI distribution
+// spec directly, with token or basic authentication.
+package oci
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Media types of the manifest and its parts.
+const (
+	ManifestType = "application/vnd.oci.image.manifest.v1+json"
+	EmptyType    = "application/vnd.oci.empty.v1+json"
+	// ArtifactType marks the artifacts csvtools pushes.
+	ArtifactType = "application/vnd.csvtools.bundle.v1"
+)
+
+// Annotations csvtools sets, besides the caller's.
+const (
+	AnnotationTitle   = "org.opencontainers.image.title"
+	AnnotationCreated = "org.opencontainers.image.created"
+	AnnotationSource  = "org.opencontainers.image.source"
+	AnnotationRunID   = "dev.csvtools.run_id"
+	AnnotationSHA256  = "dev.csvtools.sha256"
+)
+
+// empty is the content of the empty config, "{}".
+var empty = []byte("{}")
+
+// Reference names the artifact to push: registry/repository:tag.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+func (r Reference) String() string {
+	return r.Registry + "/" + r.Repository + ":" + r.Tag
+}
+
+// ParseReference parses "registry/repository[:tag]", optionally prefixed
+// with oci://. The tag defaults to latest.
+func ParseReference(s string) (Reference, error) {
+	s = strings.TrimPrefix(s, "oci://")
+	registry, repository, ok := strings.Cut(s, "/")
+	if !ok || registry == "" || repository == "" {
+		return Reference{}, fmt.Errorf("invalid reference %q: want registry/repository:tag", s)
+	}
+	if strings.Contains(repository, "@") {
+		return Reference{}, fmt.Errorf("invalid reference %q: pushes need a tag, not a digest", s)
+	}
+	ref := Reference{Registry: registry, Repository: repository, Tag: "latest"}
+	// A colon after the last slash starts the tag.
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		ref.Repository, ref.Tag = repository[:i], repository[i+1:]
+	}
+	if ref.Tag == "" || ref.Repository != strings.ToLower(ref.Repository) {
+		return Reference{}, fmt.Errorf("invalid reference %q: repositories are lower case and tags not empty", s)
+	}
+	return ref, nil
+}
+
+// Descriptor points at a blob.
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Data        []byte            `json:"data,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Manifest is an OCI image manifest describing an artifact.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// mediaTypes maps file extensions to the media types of their layers.
+var mediaTypes = map[string]string{
+	".xlsx":    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".db":      "application/vnd.sqlite3",
+	".sqlite":  "application/vnd.sqlite3",
+	".parquet": "application/vnd.apache.parquet",
+	".csv":     "text/csv",
+	".json":    "application/json",
+	".jsonl":   "application/jsonl",
+	".sql":     "application/sql",
+	".gz":      "application/gzip",
+	".zst":     "application/zstd",
+	".sha256":  "text/plain",
+}
+
+// MediaType returns the media type of a layer holding the file at path.
+func MediaType(path string) string {
+	if t, ok := mediaTypes[strings.ToLower(filepath.Ext(path))]; ok {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// Client pushes to registries. Without a username, the credentials docker
+// login stored for the registry are used, if any.
+type Client struct {
+	HTTP *http.Client
+	// PlainHTTP talks to the registry without TLS, e.g. a local one.
+	PlainHTTP bool
+	Username  string
+	Password  string
+
+	auth string // Authorization header value
+}
+
+// Push uploads files as the layers of an artifact tagged ref, with
+// annotations on the manifest, and returns the manifest's digest. Every
+// layer is annotated with its file name and SHA-256.
+func (c *Client) Push(ctx context.Context, ref Reference, files []string, annotations map[string]string) (string, error) {
+	if c.HTTP == nil {
+		c.HTTP = http.DefaultClient
+	}
+	if err := c.authorize(ctx, ref); err != nil {
+		return "", err
+	}
+	config := Descriptor{MediaType: EmptyType, Digest: digest(empty), Size: int64(len(empty)), Data: empty}
+	if err := c.uploadBlob(ctx, ref, config.Digest, config.Size, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(empty)), nil
+	}); err != nil {
+		return "", err
+	}
+	manifest := Manifest{SchemaVersion: 2, MediaType: ManifestType, ArtifactType: ArtifactType, Config: config, Layers: []Descriptor{}, Annotations: annotations}
+	for _, path := range files {
+		layer, err := describeFile(path)
+		if err != nil {
+			return "", err
+		}
+		err = c.uploadBlob(ctx, ref, layer.Digest, layer.Size, func() (io.ReadCloser, error) {
+			return os.Open(path)
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to upload %s: %w", path, err)
+		}
+		manifest.Layers = append(manifest.Layers, layer)
+	}
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+	req, err := c.request(ctx, http.MethodPut, ref, "/manifests/"+ref.Tag, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", ManifestType)
+	req.ContentLength = int64(len(body))
+	if _, err := c.do(req, http.StatusCreated); err != nil {
+		return "", fmt.Errorf("failed to push manifest: %w", err)
+	}
+	return digest(body), nil
+}
+
+// describeFile returns the layer descriptor of the file at path.
+func describeFile(path string) (Descriptor, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	hash := sha256.New()
+	n, err := io.Copy(hash, f)
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	return Descriptor{MediaType: MediaType(path), Digest: "sha256:" + sum, Size: n, Annotations: map[string]string{
+		AnnotationTitle:  filepath.Base(path),
+		AnnotationSHA256: sum,
+	}}, nil
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// uploadBlob uploads a blob in one request, unless the registry has it.
+func (c *Client) uploadBlob(ctx context.Context, ref Reference, dgst string, size int64, open func() (io.ReadCloser, error)) error {
+	req, err := c.request(ctx, http.MethodHead, ref, "/blobs/"+dgst, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := c.do(req, http.StatusOK); err == nil {
+		return nil
+	}
+	if req, err = c.request(ctx, http.MethodPost, ref, "/blobs/uploads/", nil); err != nil {
+		return err
+	}
+	resp, err := c.do(req, http.StatusAccepted)
+	if err != nil {
+		return fmt.Errorf("failed to start upload: %w", err)
+	}
+	location, err := req.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid upload location: %w", err)
+	}
+	query := location.Query()
+	query.Set("digest", dgst)
+	location.RawQuery = query.Encode()
+	body, err := open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPut, location.String(), body); err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if _, err := c.do(req, http.StatusCreated); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Client) baseURL(ref Reference) string {
+	scheme := "https"
+	if c.PlainHTTP {
+		scheme = "http"
+	}
+	return scheme + "://" + ref.Registry + "/v2/"
+}
+
+func (c *Client) request(ctx context.Context, method string, ref Reference, path string, body io.Reader) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, method, c.baseURL(ref)+ref.Repository+path, body)
+}
+
+// do sends req and fails unless the registry answers with status. The
+// response body is drained and closed.
+func (c *Client) do(req *http.Request, status int) (*http.Response, error) {
+	if c.auth != "" {
+		req.Header.Set("Authorization", c.auth)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != status {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s %s: %s %s", req.Method, req.URL.Redacted(), resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp, nil
+}
+
+// authorize answers the registry's challenge, if it makes one, with basic
+// credentials or a bearer token allowing pushes to the repository.
+func (c *Client) authorize(ctx context.Context, ref Reference) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL(ref), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach registry %s: %w", ref.Registry, err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil
+	}
+	user, password := c.Username, c.Password
+	if user == "" {
+		user, password = DockerCredentials(ref.Registry)
+	}
+	scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if user == "" {
+			return fmt.Errorf("registry %s needs credentials", ref.Registry)
+		}
+		c.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+		return nil
+	case "bearer":
+		token, err := c.token(ctx, params, "repository:"+ref.Repository+":pull,push", user, password)
+		if err != nil {
+			return fmt.Errorf("failed to authenticate with %s: %w", ref.Registry, err)
+		}
+		c.auth = "Bearer " + token
+		return nil
+	}
+	return fmt.Errorf("registry %s asks for unsupported authentication %q", ref.Registry, scheme)
+}
+
+// token fetches a bearer token for scope from the challenge's realm.
+func (c *Client) token(ctx context.Context, params map[string]string, scope, user, password string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Scheme == "" {
+		return "", fmt.Errorf("invalid token realm %q", params["realm"])
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request: %s", resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	if body.Token == "" {
+		body.Token = body.AccessToken
+	}
+	if body.Token == "" {
+		return "", fmt.Errorf("token response without a token")
+	}
+	return body.Token, nil
+}
+
+// parseChallenge splits a WWW-Authenticate header such as
+// `Bearer realm="https://auth.example.com/token",service="registry"`.
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				params[key] = value[1:]
+				break
+			}
+			params[key], rest = value[1:end+1], value[end+2:]
+		} else {
+			params[key], rest, _ = strings.Cut(value, ",")
+		}
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return scheme, params
+}
+
+// DockerCredentials returns the username and password docker login stored
+// for registry in $DOCKER_CONFIG/config.json or ~/.docker/config.json, if
+// any. Credential helpers are not consulted.
+func DockerCredentials(registry string) (string, string) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", ""
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return "", ""
+	}
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if json.Unmarshal(data, &config) != nil {
+		return "", ""
+	}
+	for _, key := range []string{registry, "https://" + registry, "http://" + registry} {
+		if entry, ok := config.Auths[key]; ok && entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return "", ""
+			}
+			user, password, _ := strings.Cut(string(decoded), ":")
+			return user, password
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,193 @@
+// Package retry runs operations with exponential backoff and jitter so that
+// transient IO and database failures do not fail a whole file immediately.
+package retry
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"time"
+
+	"csvtools/src/internal/csvio"
+)
+
+// Policy describes how many times an operation is attempted and how long to
+// wait between attempts.
+type Policy struct {
+	// Attempts is the total number of tries, including the first one.
+	// Values below 1 are treated as 1.
+	Attempts int
+	// BaseDelay is the wait before the second attempt; it doubles afterwards.
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between attempts. Zero means the cap is
+	// maxBackoff.
+	MaxDelay time.Duration
+	// OnRetry, when set, is called before sleeping ahead of the next attempt.
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+// DefaultPolicy is used by the CLIs when no retry flags are given.
+var DefaultPolicy = Policy{
+	Attempts:  3,
+	BaseDelay: 500 * time.Millisecond,
+	MaxDelay:  30 * time.Second,
+}
+
+type permanentError struct {
+	err error
+}
+
+func (p *permanentError) Error() string { return p.err.Error() }
+func (p *permanentError) Unwrap() error { return p.err }
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err should stop the retry loop right away:
+// errors wrapped with Permanent, missing files, permission problems and
+// CSV parse errors will not go away by trying again.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	if errors.As(err, &p) {
+		return true
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return true
+	}
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) || errors.Is(err, csvio.ErrRecordTooLarge) ||
+		errors.Is(err, csvio.ErrColumnCount) || errors.Is(err, csvio.ErrRowCount) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Do calls fn until it succeeds, returns a permanent error, the attempts are
+// exhausted, or ctx is done. The last error is returned.
+func (p Policy) Do(ctx context.Context, fn func() error) error {
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || IsPermanent(err) || attempt >= attempts {
+			return err
+		}
+		delay := p.Backoff(attempt)
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, delay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// maxBackoff caps the wait between attempts of policies without MaxDelay,
+// so that doubling the delay can't overflow.
+const maxBackoff = 24 * time.Hour
+
+// Backoff returns the wait after the given (1-based) failed attempt: the
+// base delay doubled per attempt, capped at MaxDelay, with "equal jitter"
+// applied so that concurrent runs do not retry in lock-step: a random wait
+// between half the delay and all of it.
+func (p Policy) Backoff(attempt int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	ceiling := p.MaxDelay
+	if ceiling <= 0 {
+		ceiling = maxBackoff
+	}
+	delay := min(p.BaseDelay, ceiling)
+	for i := 1; i < attempt && delay < ceiling; i++ {
+		delay = min(delay*2, ceiling)
+	}
+	// Keep at least half of the computed delay so backoff still grows.
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// Quarantine moves the file at path into dir (created when missing) so a
+// file that kept failing is set aside instead of being picked up again on
+// the next run. It returns the new location.
+func Quarantine(path, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory %s: %w", dir, err)
+	}
+	target := filepath.Join(dir, filepath.Base(path))
+	if _, err := os.Stat(target); err == nil {
+		target = filepath.Join(dir, fmt.Sprintf("%d_%s", time.Now().Unix(), filepath.Base(path)))
+	}
+	err := os.Rename(path, target)
+	if err != nil && crossDevice(err) {
+		err = moveAcross(path, target)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to quarantine %s: %w", path, err)
+	}
+	return target, nil
+}
+
+// moveAcross moves the file at path to target on another filesystem, where
+// it can't be renamed: it copies it to a temp file next to target, syncs and
+// renames that, and only then removes path.
+func moveAcross(path, target string) (err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.CreateTemp(filepath.Dir(target), ".quarantine-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = out.Close()
+			_ = os.Remove(out.Name())
+		}
+	}()
+	if _, err = io.Copy(out, in); err != nil {
+		return err
+	}
+	if err = out.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(out.Name(), target); err != nil {
+		return err
+	}
+	_ = in.Close()
+	if err := os.Remove(path); err != nil {
+		// The copy is in place; leaving both would quarantine it twice.
+		_ = os.Remove(target)
+		return err
+	}
+	return nil
+}
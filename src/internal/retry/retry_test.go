@@ -0,0 +1,86 @@
+package retry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	for _, p := range []Policy{
+		{BaseDelay: time.Second, MaxDelay: 30 * time.Second},
+		{BaseDelay: time.Second},
+		{BaseDelay: 48 * time.Hour},
+	} {
+		ceiling := p.MaxDelay
+		if ceiling == 0 {
+			ceiling = maxBackoff
+		}
+		for _, attempt := range []int{1, 2, 10, 64, 1000} {
+			delay := min(p.BaseDelay<<min(attempt-1, 62), ceiling)
+			if attempt > 40 {
+				delay = ceiling
+			}
+			got := p.Backoff(attempt)
+			if got < delay/2 || got > delay {
+				t.Errorf("%+v: Backoff(%d) = %s, want between %s and %s", p, attempt, got, delay/2, delay)
+			}
+		}
+	}
+}
+
+func TestMoveAcross(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "in.csv")
+	if err := os.WriteFile(path, []byte("a,b\n1,2\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "quarantine", "in.csv")
+	if err := os.Mkdir(filepath.Dir(target), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveAcross(path, target); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s is still there: %v", path, err)
+	}
+	data, err := os.ReadFile(target)
+	if err != nil || string(data) != "a,b\n1,2\n" {
+		t.Errorf("%s holds %q (%v)", target, data, err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(target))
+	if len(entries) != 1 {
+		t.Errorf("quarantine holds %d files, want 1", len(entries))
+	}
+}
+
+// TestQuarantineAcrossFilesystems quarantines a file from the temp
+// directory into /dev/shm, which is another filesystem on most Linux hosts.
+func TestQuarantineAcrossFilesystems(t *testing.T) {
+	shm, err := os.MkdirTemp("/dev/shm", "quarantine-")
+	if err != nil {
+		t.Skip("no /dev/shm:", err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(shm)
+	})
+	path := filepath.Join(t.TempDir(), "in.csv")
+	if err := os.WriteFile(path, []byte("a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(path, filepath.Join(shm, "probe")); err == nil {
+		t.Skip("/dev/shm is on the same filesystem as the temp directory")
+	}
+	target, err := Quarantine(path, shm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s is still there: %v", path, err)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "a\n" {
+		t.Errorf("%s holds %q (%v)", target, data, err)
+	}
+}
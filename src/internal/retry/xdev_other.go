@@ -0,0 +1,14 @@
+//go:build !windows
+
+package retry
+
+import (
+	"errors"
+	"syscall"
+)
+
+// crossDevice reports whether a rename failed because source and target are
+// on different filesystems.
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
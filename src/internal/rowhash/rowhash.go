@@ -0,0 +1,70 @@
+// Package rowhash fingerprints rows with a stable hash of some of their
+// cells, to dedupe rows and tell changed ones apart across deliveries. The
+// hash only depends on the cells' values and order, so any tool computing it
+// the same way gets the same fingerprint: every cell is fed to the hash as
+// its length in bytes, a big-endian uint32, followed by its UTF-8 bytes, and
+// the sum is written in lower case hex.
+package rowhash
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// Column is the default name of the fingerprint column. It starts with an
+// underscore, like the lineage columns, so it doesn't clash with the data.
+const Column = "_row_hash"
+
+// Algorithms are the hashes New accepts. sha256 is the default; xxhash
+// (XXH64) is much faster but not meant to resist deliberate collisions.
+var Algorithms = []string{"sha256", "sha1", "md5", "xxhash"}
+
+// Hasher hashes rows. It is not safe for concurrent use.
+type Hasher struct {
+	h   hash.Hash
+	buf []byte
+	sum []byte
+}
+
+// New returns a Hasher using algorithm, one of Algorithms; "" is sha256.
+func New(algorithm string) (*Hasher, error) {
+	var h hash.Hash
+	switch strings.ToLower(algorithm) {
+	case "", "sha256":
+		h = sha256.New()
+	case "sha1":
+		h = sha1.New()
+	case "md5":
+		h = md5.New()
+	case "xxhash", "xxh64":
+		h = xxhash.New()
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q (want %s)", algorithm, strings.Join(Algorithms, ", "))
+	}
+	return &Hasher{h: h}, nil
+}
+
+// Sum returns the fingerprint of the cells of record at idx, in that order.
+// Cells past the end of a short record count as empty.
+func (r *Hasher) Sum(record []string, idx []int) string {
+	r.h.Reset()
+	for _, i := range idx {
+		cell := ""
+		if i < len(record) {
+			cell = record[i]
+		}
+		r.buf = binary.BigEndian.AppendUint32(r.buf[:0], uint32(len(cell)))
+		r.buf = append(r.buf, cell...)
+		_, _ = r.h.Write(r.buf)
+	}
+	r.sum = r.h.Sum(r.sum[:0])
+	return hex.EncodeToString(r.sum)
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package runlock
+
+import (
+	"os"
+	"syscall"
+)
+
+// errBusy is ERROR_SHARING_VIOLATION.
+var errBusy = syscall.Errno(32)
+
+// openLocked opens the file at path without sharing it, so that other
+// processes fail to open it with errBusy until it is closed.
+func openLocked(path string) (*os.File, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
@@ -0,0 +1,94 @@
+// Package runlock keeps two runs from writing to the same destination at
+// once, which would corrupt a shared SQLite database or have one workbook
+// replace the other. A run holds an advisory lock on a lock file in the
+// destination until it exits; the operating system releases it when the
+// process dies, so a crashed run never leaves a stale lock behind.
+package runlock
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Name is the lock file of a destination directory.
+const Name = ".csvtools.lock"
+
+// pollInterval is how often a waiting run tries the lock again.
+const pollInterval = 250 * time.Millisecond
+
+// ErrLocked is returned when another run holds the lock.
+var ErrLocked = errors.New("another run is in progress")
+
+// Flags binds -wait.
+type Flags struct {
+	Wait time.Duration
+}
+
+// Register adds the flag to fs.
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.DurationVar(&f.Wait, "wait", 0, "wait this long, e.g. 10m, for another run writing to the same destination to finish (default fail at once)")
+}
+
+// Lock is a held lock.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire takes the lock file at path, creating it and its directory if
+// needed, and records holder, e.g. the run ID, in it for the error of the
+// runs that find it taken. It waits up to wait for another run to release
+// the lock; past that, the error wraps ErrLocked. The lock is released with
+// the Lock, so keep it until done, e.g. with a deferred Release.
+func Acquire(path, holder string, wait time.Duration) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory of lock %s: %w", path, err)
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		f, err := openLocked(path)
+		if err == nil {
+			l := &Lock{f: f}
+			l.record(holder)
+			return l, nil
+		}
+		if !errors.Is(err, errBusy) {
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s is locked%s", ErrLocked, path, describe(path))
+		}
+		time.Sleep(min(pollInterval, max(time.Until(deadline), time.Millisecond)))
+	}
+}
+
+// record writes holder into the lock file. It is informational only, so
+// errors are ignored.
+func (l *Lock) record(holder string) {
+	host, _ := os.Hostname()
+	_ = l.f.Truncate(0)
+	_, _ = l.f.WriteAt([]byte(fmt.Sprintf("%s pid %d on %s since %s\n", holder, os.Getpid(), host, time.Now().UTC().Format(time.RFC3339))), 0)
+}
+
+// describe returns who holds the lock at path, as recorded, for an error.
+func describe(path string) string {
+	b, err := os.ReadFile(path)
+	if s := strings.TrimSpace(string(b)); err == nil && s != "" {
+		return " (run " + s + ")"
+	}
+	return ""
+}
+
+// Release releases the lock. The file stays, as removing it would let a
+// run waiting on the old file and one creating a new file both hold "the"
+// lock. It is safe on a nil Lock.
+func (l *Lock) Release() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
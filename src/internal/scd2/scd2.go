@@ -0,0 +1,160 @@
+// Package scd2 loads periodic snapshots into history tables, as type 2
+// slowly changing dimensions: every version of a row is kept, valid from the
+// load that inserted it until the load that found it changed or gone, so the
+// table holds the whole history instead of the latest snapshot.
+package scd2
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"csvtools/src/internal/bizkey"
+	"csvtools/src/internal/rowhash"
+	"csvtools/src/internal/sqlitedb"
+)
+
+// The columns added to history tables. A version is valid from ValidFrom
+// until ValidTo, which is NULL for the current version of a key; Current is
+// 1 for current versions and 0 for closed ones.
+const (
+	ValidFrom = "_valid_from"
+	ValidTo   = "_valid_to"
+	Current   = "_is_current"
+)
+
+// Columns are the history columns, in the order they are added.
+var Columns = []string{ValidFrom, ValidTo, Current}
+
+// Counts are the outcomes of the rows of a snapshot.
+type Counts struct {
+	// New rows have a key without a current version; Changed ones closed
+	// the current version of their key; Unchanged ones were left alone.
+	New, Changed, Unchanged int
+	// Closed counts the current versions whose key the snapshot lacked.
+	Closed int
+}
+
+// version is the current version of a key.
+type version struct {
+	rowid int64
+	sum   string
+	seen  bool
+}
+
+// Load applies one snapshot to a history table.
+type Load struct {
+	tx      *sql.Tx
+	table   string
+	now     string
+	key     *bizkey.Key
+	all     []int
+	hasher  *rowhash.Hasher
+	current map[string]*version
+	Counts  Counts
+}
+
+// Begin starts loading a snapshot into table, whose data columns are
+// columns, keyed on the key columns, at time now: the time versions are
+// valid from or to. It reads the current version of every key.
+func Begin(tx *sql.Tx, table string, columns, key []string, now string) (*Load, error) {
+	l := &Load{tx: tx, table: table, now: now, current: make(map[string]*version)}
+	var err error
+	if l.key, err = bizkey.New(columns, key); err != nil {
+		return nil, err
+	}
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = "CAST(" + sqlitedb.Quote(c) + " AS TEXT)"
+		l.all = append(l.all, i)
+	}
+	if l.hasher, err = rowhash.New("sha256"); err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT rowid, %s FROM %s WHERE %s = 1", strings.Join(quoted, ", "), sqlitedb.Quote(table), sqlitedb.Quote(Current))
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the current versions of %s: %w", table, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns)+1)
+	for i := range values {
+		dest[i+1] = &values[i]
+	}
+	cells := make([]string, len(columns))
+	for rows.Next() {
+		var v version
+		dest[0] = &v.rowid
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to read the current versions of %s: %w", table, err)
+		}
+		for i, value := range values {
+			cells[i] = value.String
+		}
+		v.sum = l.hasher.Sum(cells, l.all)
+		l.current[l.key.Of(cells)] = &v
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the current versions of %s: %w", table, err)
+	}
+	return l, nil
+}
+
+// Row takes a row of the snapshot, its cells in the order of the columns,
+// and reports whether a new version is to be inserted: for a new key or
+// changed cells, in which case the current version is closed first. A key
+// repeated within the snapshot is an error.
+func (l *Load) Row(cells []string) (bool, error) {
+	k := l.key.Of(cells)
+	sum := l.hasher.Sum(cells, l.all)
+	v, ok := l.current[k]
+	switch {
+	case ok && v.seen:
+		return false, fmt.Errorf("business key %s appears more than once in the snapshot", l.key)
+	case !ok:
+		l.current[k] = &version{rowid: -1, sum: sum, seen: true}
+		l.Counts.New++
+		return true, nil
+	}
+	v.seen = true
+	if v.sum == sum {
+		l.Counts.Unchanged++
+		return false, nil
+	}
+	if err := l.close(v.rowid); err != nil {
+		return false, err
+	}
+	l.Counts.Changed++
+	return true, nil
+}
+
+// Values returns the history cells of a version inserted by this load.
+func (l *Load) Values() []any {
+	return []any{l.now, nil, 1}
+}
+
+// Finish closes the current versions of the keys the snapshot lacked, as
+// they were deleted at the source.
+func (l *Load) Finish() error {
+	for _, v := range l.current {
+		if v.seen || v.rowid < 0 {
+			continue
+		}
+		if err := l.close(v.rowid); err != nil {
+			return err
+		}
+		l.Counts.Closed++
+	}
+	return nil
+}
+
+func (l *Load) close(rowid int64) error {
+	query := fmt.Sprintf("UPDATE %s SET %s = ?, %s = 0 WHERE rowid = ?", sqlitedb.Quote(l.table), sqlitedb.Quote(ValidTo), sqlitedb.Quote(Current))
+	if _, err := l.tx.Exec(query, l.now, rowid); err != nil {
+		return fmt.Errorf("failed to close a version of %s: %w", l.table, err)
+	}
+	return nil
+}
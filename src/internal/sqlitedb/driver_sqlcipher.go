@@ -0,0 +1,11 @@
+//go:build sqlcipher
+
+package sqlitedb
+
+import (
+	// SQLCipher bundles its own SQLite and registers as "sqlite3" too, so it
+	// replaces github.com/mattn/go-sqlite3 in this build.
+	_ "github.com/mutecomm/go-sqlcipher/v4"
+)
+
+const encryption = true
@@ -0,0 +1,9 @@
+//go:build !sqlcipher
+
+package sqlitedb
+
+import (
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+const encryption = false
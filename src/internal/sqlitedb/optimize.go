@@ -0,0 +1,39 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// ValidPageSize reports whether SQLite takes n as a page size: a power of
+// two from 512 to 65536.
+func ValidPageSize(n int) bool {
+	return n >= 512 && n <= 65536 && n&(n-1) == 0
+}
+
+// Optimize readies a loaded database for readers: ANALYZE gathers the
+// statistics the query planner chooses indexes with, and VACUUM rebuilds the
+// file without the free pages and fragmentation a load leaves behind, with
+// pages of pageSize bytes unless 0. The rollback journal replaces a WAL, so
+// the file can be read without a -wal file next to it.
+func Optimize(ctx context.Context, db *sql.DB, pageSize int) error {
+	// page_size only applies to the VACUUM of the same connection.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	statements := []string{"ANALYZE", "PRAGMA journal_mode = DELETE"}
+	if pageSize != 0 {
+		statements = append(statements, fmt.Sprintf("PRAGMA page_size = %d", pageSize))
+	}
+	for _, statement := range append(statements, "VACUUM") {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("%s failed: %w", statement, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package sqlitedb
+
+func driverPath(path string) string {
+	return path
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package sqlitedb
+
+import "strings"
+
+// driverPath returns path without the \\?\ prefix of Windows extended-length
+// paths, whose '?' the driver would take for the start of its options.
+func driverPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, `\\?\UNC\`); ok {
+		return `\\` + rest
+	}
+	return strings.TrimPrefix(path, `\\?\`)
+}
@@ -0,0 +1,37 @@
+//go:build windows
+
+package sqlitedb
+
+import "testing"
+
+func TestDriverPath(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{`C:\data\out.db`, `C:\data\out.db`},
+		{`\\?\C:\data\out.db`, `C:\data\out.db`},
+		{`\\?\UNC\server\share\out.db`, `\\server\share\out.db`},
+		{`\\server\share\out.db`, `\\server\share\out.db`},
+		{`out.db`, `out.db`},
+	}
+	for _, tt := range tests {
+		if got := driverPath(tt.path); got != tt.want {
+			t.Errorf("driverPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestOpenExtendedLengthPath opens a database under a \\?\ path, whose '?'
+// the driver would otherwise take for the start of its options.
+func TestOpenExtendedLengthPath(t *testing.T) {
+	db, err := Open(`\\?\`+t.TempDir()+`\out.db`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	if _, err := db.Exec(`CREATE TABLE t (a TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,75 @@
+// Package sqlitedb opens the SQLite databases to_sqlite writes, optionally
+// encrypted with SQLCipher.
+package sqlitedb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrNoCipher is returned for a passphrase when the binary was built without
+// SQLCipher.
+var ErrNoCipher = errors.New("encrypted databases need a binary built with -tags sqlcipher")
+
+// Encryption reports whether this binary can open SQLCipher databases.
+func Encryption() bool {
+	return encryption
+}
+
+// Open opens (or creates) the database at path. With a passphrase the
+// database is an SQLCipher database keyed with it; a wrong passphrase, or an
+// unencrypted database, fails here rather than on the first statement.
+func Open(path, passphrase string) (*sql.DB, error) {
+	// The driver takes what follows a '?' as connection options.
+	path = driverPath(path)
+	if strings.ContainsRune(path, '?') {
+		return nil, fmt.Errorf("database path %s must not contain '?'", path)
+	}
+	if passphrase == "" {
+		return sql.Open("sqlite3", path)
+	}
+	if !encryption {
+		return nil, ErrNoCipher
+	}
+	// The driver runs PRAGMA key = "<_pragma_key>" before anything reads the
+	// file; a double quote is escaped by doubling it.
+	key := url.QueryEscape(strings.ReplaceAll(passphrase, `"`, `""`))
+	db, err := sql.Open("sqlite3", path+"?_pragma_key="+key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("SELECT count(*) FROM sqlite_master"); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to open encrypted database %s (wrong passphrase?): %w", path, err)
+	}
+	return db, nil
+}
+
+// Quote quotes name as an identifier so that any table or column name, such
+// as "order date" or "日付", can be used as is. Every identifier that goes into
+// generated SQL must pass through Quote, as names come from untrusted headers
+// and file names: double quotes in name are doubled, so nothing can end the
+// identifier early, and NUL bytes, at which SQLite would cut the statement
+// short, are replaced as by Name.
+func Quote(name string) string {
+	return `"` + strings.ReplaceAll(Name(name), `"`, `""`) + `"`
+}
+
+// NULReplacement stands in for NUL bytes in names.
+const NULReplacement = "\uFFFD"
+
+// Name returns name as SQLite stores it, with NUL bytes replaced by
+// NULReplacement. Callers resolving clashing names must compare the names
+// Name returns, as "a\x00b" and "a\uFFFDb" end up as the same column.
+func Name(name string) string {
+	return strings.ReplaceAll(name, "\x00", NULReplacement)
+}
+
+// Reserved reports whether SQLite refuses name for a table of its own: names
+// starting with "sqlite_" belong to SQLite, even quoted.
+func Reserved(name string) bool {
+	return len(name) >= 7 && strings.EqualFold(name[:7], "sqlite_")
+}
@@ -0,0 +1,121 @@
+package sqlitedb
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+// hostileNames are header values an untrusted upload might carry, with the
+// names SQLite must end up with: Quote only replaces NUL bytes.
+var hostileNames = []struct {
+	name, want string
+}{
+	{`"); DROP TABLE victim--`, `"); DROP TABLE victim--`},
+	{`a"b`, `a"b`},
+	{`"`, `"`},
+	{`""`, `""`},
+	{"nul\x00byte", "nul\uFFFDbyte"},
+	{"x; DELETE FROM victim;", "x; DELETE FROM victim;"},
+	{"-- comment", "-- comment"},
+	{"/* open comment", "/* open comment"},
+	{"order date", "order date"},
+	{"日付", "日付"},
+	{"Größe (kg)", "Größe (kg)"},
+	{"emoji 📦", "emoji 📦"},
+	{"'single'", "'single'"},
+	{"[bracket]", "[bracket]"},
+	{"`tick`", "`tick`"},
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"plain", `"plain"`},
+		{`"); DROP TABLE victim--`, `"""); DROP TABLE victim--"`},
+		{`a"b`, `"a""b"`},
+		{"nul\x00byte", "\"nul\uFFFDbyte\""},
+		{"x;y", `"x;y"`},
+		{"a--b", `"a--b"`},
+		{"日付", `"日付"`},
+		{"", `""`},
+	}
+	for _, tt := range tests {
+		if got := Quote(tt.name); got != tt.want {
+			t.Errorf("Quote(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// memoryDB opens an in-memory database on a single connection, as every
+// connection to :memory: has a database of its own.
+func memoryDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := Open(":memory:", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+// TestQuoteHostileNames creates tables and columns named after hostile
+// headers and checks that they are created under exactly those names, that
+// rows go into them, and that no other statement ran.
+func TestQuoteHostileNames(t *testing.T) {
+	db := memoryDB(t)
+	if _, err := db.Exec(`CREATE TABLE victim (id INTEGER); INSERT INTO victim VALUES (1)`); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range hostileNames {
+		table := "t " + tt.name
+		create := "CREATE TABLE " + Quote(table) + " (" + Quote(tt.name) + " TEXT)"
+		if _, err := db.Exec(create); err != nil {
+			t.Fatalf("%s: %v", create, err)
+		}
+		insert := "INSERT INTO " + Quote(table) + " (" + Quote(tt.name) + ") VALUES (?)"
+		if _, err := db.Exec(insert, "value"); err != nil {
+			t.Fatalf("%s: %v", insert, err)
+		}
+
+		var gotTable string
+		wantTable := "t " + tt.want
+		if err := db.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?`, wantTable).Scan(&gotTable); err != nil {
+			t.Errorf("table %q: %v", wantTable, err)
+		}
+		var column string
+		if err := db.QueryRow(`SELECT name FROM pragma_table_info(?)`, wantTable).Scan(&column); err != nil {
+			t.Fatalf("columns of %q: %v", wantTable, err)
+		}
+		if column != tt.want {
+			t.Errorf("column of %q = %q, want %q", tt.name, column, tt.want)
+		}
+		var value string
+		query := "SELECT " + Quote(tt.name) + " FROM " + Quote(table)
+		if err := db.QueryRow(query).Scan(&value); err != nil || value != "value" {
+			t.Errorf("%s = %q, %v", query, value, err)
+		}
+	}
+	var rows int
+	if err := db.QueryRow(`SELECT count(*) FROM victim`).Scan(&rows); err != nil || rows != 1 {
+		t.Errorf("victim has %d rows (%v), want 1", rows, err)
+	}
+}
+
+func TestReserved(t *testing.T) {
+	for name, want := range map[string]bool{"sqlite_master": true, "SQLite_x": true, "sqlite": false, "my_sqlite_x": false} {
+		if got := Reserved(name); got != want {
+			t.Errorf("Reserved(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestOpenRejectsOptions(t *testing.T) {
+	if _, err := Open("db.sqlite?mode=ro", ""); err == nil || !strings.Contains(err.Error(), "'?'") {
+		t.Errorf("Open with '?' = %v, want an error", err)
+	}
+}
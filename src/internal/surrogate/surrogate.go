@@ -0,0 +1,152 @@
+// Package surrogate generates surrogate keys for loaded rows, as most source
+// files have no usable primary key of their own: sequential integers that
+// continue after the largest key already in the table, or UUIDs.
+package surrogate
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind is the kind of keys generated.
+type Kind string
+
+const (
+	// Sequence numbers the rows of a table 1, 2, 3 and so on, appends
+	// continuing after the largest key loaded before.
+	Sequence Kind = "sequence"
+	// UUID gives every row a random (version 4) UUID.
+	UUID Kind = "uuid"
+	// UUID7 gives every row a time-ordered (version 7) UUID, which keeps
+	// indexes on the key compact.
+	UUID7 Kind = "uuid7"
+)
+
+func (k *Kind) String() string {
+	return string(*k)
+}
+
+func (k *Kind) Set(s string) error {
+	switch kind := Kind(strings.ToLower(strings.TrimSpace(s))); kind {
+	case Sequence, UUID, UUID7:
+		*k = kind
+		return nil
+	}
+	return fmt.Errorf("unknown surrogate key type %q (want sequence, uuid or uuid7)", s)
+}
+
+// SQLType is the column type of keys of kind k.
+func (k Kind) SQLType() string {
+	if k == Sequence {
+		return "INTEGER"
+	}
+	return "TEXT"
+}
+
+// Columns is a flag.Value of the surrogate key column per table, like
+// dedupe.Keys: "sk" adds column sk to every table, "orders:order_sk" names
+// the column of table orders. It may be repeated.
+type Columns map[string]string
+
+func (c *Columns) String() string {
+	var parts []string
+	for table, column := range *c {
+		if table != "" {
+			column = table + ":" + column
+		}
+		parts = append(parts, column)
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, " ")
+}
+
+func (c *Columns) Set(s string) error {
+	table, column := "", s
+	if t, col, ok := strings.Cut(s, ":"); ok {
+		table, column = strings.TrimSpace(t), col
+	}
+	if column = strings.TrimSpace(column); column == "" {
+		return fmt.Errorf("no surrogate key column in %q", s)
+	}
+	if *c == nil {
+		*c = make(Columns)
+	}
+	(*c)[strings.ToLower(table)] = column
+	return nil
+}
+
+// Flags holds the surrogate key flags.
+type Flags struct {
+	Columns Columns
+	Kind    Kind
+}
+
+// Register adds -surrogate-key and -surrogate-key-type to fs.
+func (f *Flags) Register(fs *flag.FlagSet) {
+	f.Kind = Sequence
+	fs.Var(&f.Columns, "surrogate-key", "Add a generated key column first in every table, e.g. sk, or orders:order_sk for one table (repeatable)")
+	fs.Var(&f.Kind, "surrogate-key-type", "Keys of -surrogate-key: sequence (continuing after the largest key in the table), uuid or uuid7")
+}
+
+// For returns the surrogate key column of table, or "" if it has none.
+func (f *Flags) For(table string) string {
+	if column, ok := f.Columns[strings.ToLower(table)]; ok {
+		return column
+	}
+	return f.Columns[""]
+}
+
+// Generator hands out the keys of one load into a table.
+type Generator struct {
+	kind Kind
+	last int64
+}
+
+// Start returns a generator of keys of kind k; sequences continue after
+// last, the largest key in the table or 0.
+func (k Kind) Start(last int64) *Generator {
+	return &Generator{kind: k, last: last}
+}
+
+// Next returns the next key.
+func (g *Generator) Next() string {
+	switch g.kind {
+	case UUID:
+		return NewUUID()
+	case UUID7:
+		return NewUUID7(time.Now())
+	}
+	g.last++
+	return strconv.FormatInt(g.last, 10)
+}
+
+// NewUUID returns a random (version 4) UUID.
+func NewUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return format(b, 0x40)
+}
+
+// NewUUID7 returns a version 7 UUID: the Unix time of t in milliseconds
+// followed by random bits, so keys sort in the order they were made.
+func NewUUID7(t time.Time) string {
+	var b [16]byte
+	_, _ = rand.Read(b[6:])
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(t.UnixMilli()))
+	copy(b[:6], ms[2:])
+	return format(b, 0x70)
+}
+
+// format sets the version and variant bits of b and formats it.
+func format(b [16]byte, version byte) string {
+	b[6] = b[6]&0x0f | version
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
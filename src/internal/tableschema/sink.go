@@ -0,0 +1,88 @@
+package tableschema
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"csvtools/src/internal/atomicfile"
+	"csvtools/src/internal/columnar"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// Descriptor is a document describing a table.
+type Descriptor interface {
+	Write(w io.Writer) error
+}
+
+// DescribeFunc returns the descriptor of table name with schema. name is
+// the table name as used in file names.
+type DescribeFunc func(name string, schema *arrow.Schema) Descriptor
+
+// Sink is a connector.Sink writing the descriptor of every table to
+// <dir>/<table><suffix> instead of its rows. Added to a Fanout it describes
+// the tables the other sinks write.
+type Sink struct {
+	dir      string
+	suffix   string
+	describe DescribeFunc
+	policy   atomicfile.Policy
+	files    []*atomicfile.File
+}
+
+// NewSink returns a Sink writing table schemas to <dir>/<table>.schema.json.
+// base returns the schema a table's input was read with, or nil; see
+// Describe.
+func NewSink(dir string, base func(table string) *Schema, policy atomicfile.Policy) *Sink {
+	return NewDescriptorSink(dir, ".schema.json", func(name string, schema *arrow.Schema) Descriptor {
+		return Describe(schema, base(name))
+	}, policy)
+}
+
+// NewDescriptorSink returns a Sink writing the descriptors of describe.
+func NewDescriptorSink(dir, suffix string, describe DescribeFunc, policy atomicfile.Policy) *Sink {
+	return &Sink{dir: dir, suffix: suffix, describe: describe, policy: policy}
+}
+
+func (s *Sink) Table(name string, schema *arrow.Schema) (columnar.Writer, error) {
+	name = strings.NewReplacer("/", "_", `\`, "_").Replace(name)
+	path := filepath.Join(s.dir, name+s.suffix)
+	if err := atomicfile.Check(path, s.policy); err != nil {
+		return nil, err
+	}
+	f, err := atomicfile.Create(path, s.policy)
+	if err != nil {
+		return nil, err
+	}
+	s.files = append(s.files, f)
+	if err := s.describe(name, schema).Write(f); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return discard{}, nil
+}
+
+func (s *Sink) Commit() error {
+	for _, f := range s.files {
+		if err := f.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sink) Close() error {
+	var errs []error
+	for _, f := range s.files {
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// discard is a columnar.Writer ignoring the rows.
+type discard struct{}
+
+func (discard) Write(arrow.RecordBatch) error { return nil }
+func (discard) Close() error                  { return nil }
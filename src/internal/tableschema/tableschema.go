@@ -0,0 +1,227 @@
+// Package tableschema reads and writes Frictionless Data Table Schema
+// descriptors (https://specs.frictionlessdata.io/table-schema/), so typing
+// and validation rules can be shared with other open-data tools instead of
+// being restated in csvtools' own formats.
+package tableschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// Schema is a table schema descriptor. Properties csvtools doesn't use, such
+// as foreignKeys, are ignored when reading.
+type Schema struct {
+	Fields        []Field  `json:"fields"`
+	PrimaryKey    Names    `json:"primaryKey,omitempty"`
+	MissingValues []string `json:"missingValues,omitempty"`
+}
+
+// Field describes one column.
+type Field struct {
+	Name        string   `json:"name"`
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	Format      string   `json:"format,omitempty"`
+	TrueValues  []string `json:"trueValues,omitempty"`
+	FalseValues []string `json:"falseValues,omitempty"`
+	// MissingValues, as in version 2 of the spec, replaces the schema's
+	// missing values for this field.
+	MissingValues []string     `json:"missingValues,omitempty"`
+	Constraints   *Constraints `json:"constraints,omitempty"`
+}
+
+// Constraints are the rules the values of a field must follow. Minimum and
+// Maximum are numbers for numeric fields and strings, such as dates,
+// otherwise.
+type Constraints struct {
+	Required  bool     `json:"required,omitempty"`
+	Unique    bool     `json:"unique,omitempty"`
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	Minimum   any      `json:"minimum,omitempty"`
+	Maximum   any      `json:"maximum,omitempty"`
+	Pattern   string   `json:"pattern,omitempty"`
+	Enum      []string `json:"enum,omitempty"`
+}
+
+// Names is a list of field names that may be given as a single string, as
+// primaryKey can.
+type Names []string
+
+func (n *Names) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*n = Names{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("want a field name or a list of them")
+	}
+	*n = many
+	return nil
+}
+
+// Types of fields. Fields without a type are strings.
+var types = map[string]arrow.DataType{
+	"string":    arrow.BinaryTypes.String,
+	"integer":   arrow.PrimitiveTypes.Int64,
+	"number":    arrow.PrimitiveTypes.Float64,
+	"boolean":   arrow.FixedWidthTypes.Boolean,
+	"date":      arrow.BinaryTypes.String,
+	"time":      arrow.BinaryTypes.String,
+	"datetime":  arrow.BinaryTypes.String,
+	"year":      arrow.PrimitiveTypes.Int64,
+	"yearmonth": arrow.BinaryTypes.String,
+	"duration":  arrow.BinaryTypes.String,
+	"object":    arrow.BinaryTypes.String,
+	"array":     arrow.BinaryTypes.String,
+	"geopoint":  arrow.BinaryTypes.String,
+	"geojson":   arrow.BinaryTypes.String,
+	"any":       arrow.BinaryTypes.String,
+}
+
+// Read reads and checks the descriptor at path.
+func Read(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table schema %s: %w", path, err)
+	}
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse table schema %s: %w", path, err)
+	}
+	if err := s.Check(); err != nil {
+		return nil, fmt.Errorf("table schema %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// Check checks that s is complete: every field has a name and a known type,
+// patterns compile and the primary key names fields.
+func (s *Schema) Check() error {
+	if len(s.Fields) == 0 {
+		return fmt.Errorf("no fields")
+	}
+	for i, f := range s.Fields {
+		if f.Name == "" {
+			return fmt.Errorf("field %d has no name", i+1)
+		}
+		if _, ok := types[f.typ()]; !ok {
+			return fmt.Errorf("field %s: unknown type %q", f.Name, f.Type)
+		}
+		if f.Constraints != nil {
+			if err := f.Constraints.check(); err != nil {
+				return fmt.Errorf("field %s: %w", f.Name, err)
+			}
+		}
+	}
+	for _, name := range s.PrimaryKey {
+		if s.Field(name) == nil {
+			return fmt.Errorf("primary key field %s is not a field", name)
+		}
+	}
+	return nil
+}
+
+// Field returns the field named name, ignoring case, or nil.
+func (s *Schema) Field(name string) *Field {
+	for i := range s.Fields {
+		if strings.EqualFold(s.Fields[i].Name, name) {
+			return &s.Fields[i]
+		}
+	}
+	return nil
+}
+
+// missing reports whether cell of field f stands for a missing value; by
+// default only the empty cell does.
+func (s *Schema) missing(f *Field, cell string) bool {
+	values := f.MissingValues
+	if values == nil {
+		values = s.MissingValues
+	}
+	if values == nil {
+		return cell == ""
+	}
+	return slices.Contains(values, cell)
+}
+
+// Types returns the column type of every field, keyed by name, for
+// columnar.CSVOptions.
+func (s *Schema) Types() map[string]arrow.DataType {
+	m := make(map[string]arrow.DataType, len(s.Fields))
+	for _, f := range s.Fields {
+		m[f.Name] = types[f.typ()]
+	}
+	return m
+}
+
+func (f *Field) typ() string {
+	if f.Type == "" {
+		return "string"
+	}
+	return f.Type
+}
+
+// Describe returns the descriptor of a table of schema. Columns with a field
+// in base keep that field, with its constraints and formats; the others get
+// the type of their column. Missing values are written as empty cells and
+// booleans as true and false, as the validator leaves them, so those
+// properties of base are dropped.
+func Describe(schema *arrow.Schema, base *Schema) *Schema {
+	s := &Schema{}
+	for _, col := range schema.Fields() {
+		if base != nil {
+			if f := base.Field(col.Name); f != nil {
+				field := *f
+				field.Name = col.Name
+				field.MissingValues, field.TrueValues, field.FalseValues = nil, nil, nil
+				s.Fields = append(s.Fields, field)
+				continue
+			}
+		}
+		s.Fields = append(s.Fields, Field{Name: col.Name, Type: typeName(col.Type)})
+	}
+	if base != nil {
+		for _, name := range base.PrimaryKey {
+			if s.Field(name) == nil {
+				return s
+			}
+		}
+		s.PrimaryKey = base.PrimaryKey
+	}
+	return s
+}
+
+func typeName(t arrow.DataType) string {
+	switch t.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64, arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64:
+		return "integer"
+	case arrow.FLOAT16, arrow.FLOAT32, arrow.FLOAT64, arrow.DECIMAL128, arrow.DECIMAL256:
+		return "number"
+	case arrow.BOOL:
+		return "boolean"
+	case arrow.DATE32, arrow.DATE64:
+		return "date"
+	case arrow.TIMESTAMP:
+		return "datetime"
+	}
+	return "string"
+}
+
+// Write writes s as indented JSON.
+func (s *Schema) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
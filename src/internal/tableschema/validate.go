@@ -0,0 +1,367 @@
+package tableschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"csvtools/src/internal/xlsx"
+)
+
+// Problem is a cell breaking its field's type or constraints. Column is the
+// index of the cell in the row and Value the cell as read.
+type Problem struct {
+	Column  int
+	Value   string
+	Message string
+}
+
+// Validator checks the rows of one table against a schema.
+type Validator struct {
+	schema *Schema
+	fields []*rule // per column; nil for columns without a field
+	key    []int
+	keys   map[string]bool
+}
+
+// rule is a field prepared for checking.
+type rule struct {
+	*Field
+	re         *regexp.Regexp
+	layout     string // for date, time and datetime fields; "" for format any
+	min, max   *float64
+	minT, maxT *time.Time
+	seen       map[string]bool
+}
+
+// NewValidator matches header against the fields of s, ignoring case. A
+// required or primary key field missing from header is an error; columns
+// without a field aren't checked.
+func (s *Schema) NewValidator(header []string) (*Validator, error) {
+	v := &Validator{schema: s, fields: make([]*rule, len(header))}
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		col := slices.IndexFunc(header, func(h string) bool { return strings.EqualFold(h, f.Name) })
+		if col < 0 {
+			if f.Constraints != nil && f.Constraints.Required || slices.ContainsFunc(s.PrimaryKey, func(k string) bool { return strings.EqualFold(k, f.Name) }) {
+				return nil, fmt.Errorf("missing required column %s", f.Name)
+			}
+			continue
+		}
+		r, err := newRule(f)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		v.fields[col] = r
+	}
+	for _, name := range s.PrimaryKey {
+		v.key = append(v.key, slices.IndexFunc(header, func(h string) bool { return strings.EqualFold(h, name) }))
+	}
+	if v.key != nil {
+		v.keys = make(map[string]bool)
+	}
+	return v, nil
+}
+
+// check checks the parts of a constraint that don't depend on the field's
+// type.
+func (c *Constraints) check() error {
+	if c.Pattern != "" {
+		if _, err := regexp.Compile(c.Pattern); err != nil {
+			return fmt.Errorf("pattern: %w", err)
+		}
+	}
+	return nil
+}
+
+func newRule(f *Field) (*rule, error) {
+	r := &rule{Field: f}
+	switch f.typ() {
+	case "date":
+		r.layout = layout(f.Format, "2006-01-02")
+	case "time":
+		r.layout = layout(f.Format, "15:04:05")
+	case "datetime":
+		r.layout = layout(f.Format, time.RFC3339)
+	}
+	c := f.Constraints
+	if c == nil {
+		return r, nil
+	}
+	if c.Pattern != "" {
+		r.re = regexp.MustCompile("^(?:" + c.Pattern + ")$")
+	}
+	if c.Unique {
+		r.seen = make(map[string]bool)
+	}
+	for _, bound := range []struct {
+		value any
+		num   **float64
+		t     **time.Time
+	}{{c.Minimum, &r.min, &r.minT}, {c.Maximum, &r.max, &r.maxT}} {
+		if bound.value == nil {
+			continue
+		}
+		switch f.typ() {
+		case "integer", "number", "year":
+			n, err := number(bound.value)
+			if err != nil {
+				return nil, err
+			}
+			*bound.num = &n
+		case "date", "time", "datetime":
+			s, _ := bound.value.(string)
+			t, ok := r.parseTime(s)
+			if !ok {
+				return nil, fmt.Errorf("bound %v is not a %s", bound.value, f.typ())
+			}
+			*bound.t = &t
+		default:
+			return nil, fmt.Errorf("minimum and maximum don't apply to type %s", f.typ())
+		}
+	}
+	return r, nil
+}
+
+func number(v any) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case string:
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("bound %v is not a number", v)
+}
+
+// strftime maps the strftime directives of date formats to Go layouts.
+var strftime = strings.NewReplacer(
+	"%Y", "2006", "%y", "06", "%m", "01", "%d", "02", "%b", "Jan", "%B", "January",
+	"%H", "15", "%I", "03", "%M", "04", "%S", "05", "%p", "PM", "%z", "-0700", "%Z", "MST",
+	"%f", "000000", "%%", "%",
+)
+
+// layout returns the Go layout of a date format: def for "default", "" for
+// "any", otherwise the strftime pattern converted.
+func layout(format, def string) string {
+	switch format {
+	case "", "default":
+		return def
+	case "any":
+		return ""
+	}
+	return strftime.Replace(format)
+}
+
+func (r *rule) parseTime(cell string) (time.Time, bool) {
+	if r.layout == "" {
+		return xlsx.ParseDate(cell)
+	}
+	t, err := time.Parse(r.layout, cell)
+	return t, err == nil
+}
+
+var (
+	yearMonthPattern = regexp.MustCompile(`^[0-9]{4}-(0[1-9]|1[0-2])$`)
+	durationPattern  = regexp.MustCompile(`^P(?:[0-9]+(?:\.[0-9]+)?[YMWD])*(?:T(?:[0-9]+(?:\.[0-9]+)?[HMS])+)?$`)
+)
+
+// Row checks record and returns its problems. Missing values are replaced
+// by empty cells and booleans are written as true or false, so the record
+// can be typed with Types afterwards. A cell of the wrong type is emptied,
+// as it can't be typed.
+func (v *Validator) Row(record []string) []Problem {
+	var problems []Problem
+	for col, r := range v.fields {
+		if r == nil || col >= len(record) {
+			if r != nil && r.Constraints != nil && r.Constraints.Required {
+				problems = append(problems, Problem{Column: col, Message: "value is required"})
+			}
+			continue
+		}
+		if v.schema.missing(r.Field, record[col]) {
+			record[col] = ""
+		}
+		cell := record[col]
+		if cell == "" {
+			if r.Constraints != nil && r.Constraints.Required {
+				problems = append(problems, Problem{Column: col, Message: "value is required"})
+			}
+			continue
+		}
+		value, problem := r.check(cell)
+		if problem != "" {
+			if value == "" {
+				record[col] = ""
+			}
+			problems = append(problems, Problem{Column: col, Value: cell, Message: problem})
+			continue
+		}
+		record[col] = value
+	}
+	if v.key != nil {
+		parts := make([]string, len(v.key))
+		for i, col := range v.key {
+			if col < len(record) {
+				parts[i] = record[col]
+			}
+		}
+		key := strings.Join(parts, "\x00")
+		if v.keys[key] {
+			problems = append(problems, Problem{Column: v.key[0], Value: parts[0], Message: fmt.Sprintf("primary key %s is not unique", strings.Join(parts, ", "))})
+		}
+		v.keys[key] = true
+	}
+	return problems
+}
+
+// check returns cell as it should be typed, and what is wrong with it. On a
+// type error the returned value is "".
+func (r *rule) check(cell string) (string, string) {
+	typ := r.typ()
+	var t time.Time
+	switch typ {
+	case "integer", "year":
+		if _, err := strconv.ParseInt(cell, 10, 64); err != nil || typ == "year" && len(cell) != 4 {
+			return "", fmt.Sprintf("%q is not %s %s", cell, article(typ), typ)
+		}
+	case "number":
+		if _, err := strconv.ParseFloat(cell, 64); err != nil {
+			return "", fmt.Sprintf("%q is not a number", cell)
+		}
+	case "boolean":
+		switch {
+		case slices.Contains(values(r.TrueValues, "true", "True", "TRUE", "1"), cell):
+			cell = "true"
+		case slices.Contains(values(r.FalseValues, "false", "False", "FALSE", "0"), cell):
+			cell = "false"
+		default:
+			return "", fmt.Sprintf("%q is not a boolean", cell)
+		}
+	case "date", "time", "datetime":
+		var ok bool
+		if t, ok = r.parseTime(cell); !ok {
+			return "", fmt.Sprintf("%q is not a %s", cell, typ)
+		}
+	case "yearmonth":
+		if !yearMonthPattern.MatchString(cell) {
+			return "", fmt.Sprintf("%q is not a year and month", cell)
+		}
+	case "duration":
+		if cell == "P" || cell == "PT" || !durationPattern.MatchString(cell) || strings.HasSuffix(cell, "T") {
+			return "", fmt.Sprintf("%q is not an ISO 8601 duration", cell)
+		}
+	case "object", "geojson":
+		var o map[string]any
+		if json.Unmarshal([]byte(cell), &o) != nil {
+			return "", fmt.Sprintf("%q is not a JSON object", cell)
+		}
+	case "array":
+		var a []any
+		if json.Unmarshal([]byte(cell), &a) != nil {
+			return "", fmt.Sprintf("%q is not a JSON array", cell)
+		}
+	case "geopoint":
+		if !geopoint(cell, r.Format) {
+			return "", fmt.Sprintf("%q is not a geopoint", cell)
+		}
+	}
+	if problem := r.constrain(cell, t); problem != "" {
+		return cell, problem
+	}
+	return cell, ""
+}
+
+// constrain checks the constraints of a cell of the right type; t is its
+// value for date, time and datetime fields.
+func (r *rule) constrain(cell string, t time.Time) string {
+	c := r.Constraints
+	if c == nil {
+		return ""
+	}
+	if r.re != nil && !r.re.MatchString(cell) {
+		return fmt.Sprintf("%q does not match %s", cell, c.Pattern)
+	}
+	if len(c.Enum) > 0 && !slices.Contains(c.Enum, cell) {
+		return fmt.Sprintf("%q is not one of %s", cell, strings.Join(c.Enum, ", "))
+	}
+	if n := utf8.RuneCountInString(cell); c.MinLength != nil && n < *c.MinLength {
+		return fmt.Sprintf("%q is shorter than %d", cell, *c.MinLength)
+	} else if c.MaxLength != nil && n > *c.MaxLength {
+		return fmt.Sprintf("%q is longer than %d", cell, *c.MaxLength)
+	}
+	if r.min != nil || r.max != nil {
+		n, _ := strconv.ParseFloat(cell, 64)
+		if r.min != nil && n < *r.min {
+			return fmt.Sprintf("%s is below %s", cell, strconv.FormatFloat(*r.min, 'f', -1, 64))
+		}
+		if r.max != nil && n > *r.max {
+			return fmt.Sprintf("%s is above %s", cell, strconv.FormatFloat(*r.max, 'f', -1, 64))
+		}
+	}
+	if r.minT != nil && t.Before(*r.minT) {
+		return fmt.Sprintf("%s is before %v", cell, c.Minimum)
+	}
+	if r.maxT != nil && t.After(*r.maxT) {
+		return fmt.Sprintf("%s is after %v", cell, c.Maximum)
+	}
+	if r.seen != nil {
+		if r.seen[cell] {
+			return fmt.Sprintf("%q is not unique", cell)
+		}
+		r.seen[cell] = true
+	}
+	return ""
+}
+
+func values(given []string, def ...string) []string {
+	if given != nil {
+		return given
+	}
+	return def
+}
+
+func article(typ string) string {
+	if typ == "integer" {
+		return "an"
+	}
+	return "a"
+}
+
+// geopoint reports whether cell is a point in format: "lon, lat" by
+// default, "[lon, lat]" for array and {"lon": .., "lat": ..} for object.
+func geopoint(cell, format string) bool {
+	var lon, lat float64
+	switch format {
+	case "array":
+		var p []float64
+		if json.Unmarshal([]byte(cell), &p) != nil || len(p) != 2 {
+			return false
+		}
+		lon, lat = p[0], p[1]
+	case "object":
+		var p struct {
+			Lon *float64 `json:"lon"`
+			Lat *float64 `json:"lat"`
+		}
+		if json.Unmarshal([]byte(cell), &p) != nil || p.Lon == nil || p.Lat == nil {
+			return false
+		}
+		lon, lat = *p.Lon, *p.Lat
+	default:
+		x, y, ok := strings.Cut(cell, ",")
+		var err1, err2 error
+		lon, err1 = strconv.ParseFloat(strings.TrimSpace(x), 64)
+		lat, err2 = strconv.ParseFloat(strings.TrimSpace(y), 64)
+		if !ok || err1 != nil || err2 != nil {
+			return false
+		}
+	}
+	return lon >= -180 && lon <= 180 && lat >= -90 && lat <= 90
+}
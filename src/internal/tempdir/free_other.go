@@ -0,0 +1,9 @@
+//go:build !(darwin || dragonfly || freebsd || linux || windows)
+
+package tempdir
+
+import "errors"
+
+func freeSpace(string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,149 @@
+// Package tempdir gives every run a private directory for its temp and spill
+// files, such as the streamed sheets of large workbooks, SQLite's temp store
+// and spilled transposes, under -tmp-dir. The directory is removed when the
+// run ends, whether it succeeds or fails; one left behind by a killed run is
+// removed by the next run using the same -tmp-dir.
+package tempdir
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"csvtools/src/internal/discover"
+	"csvtools/src/internal/runlock"
+)
+
+// prefix starts the names of run directories.
+const prefix = "csvtools-run-"
+
+// sweepAge is how old a directory left behind must be to be removed, so that
+// one a starting run has created but not locked yet is spared.
+const sweepAge = time.Minute
+
+// ErrLowSpace is returned when a directory has less free space than
+// -min-free.
+var ErrLowSpace = errors.New("not enough free disk space")
+
+// Flags binds -tmp-dir and -min-free.
+type Flags struct {
+	Dir     string
+	MinFree int64
+}
+
+// Register adds the flags to fs.
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Dir, "tmp-dir", "", "directory for temp and spill files, e.g. on a larger volume (default the system temp dir)")
+	fs.Func("min-free", "fail before starting unless the temp and output directories have this much free space, e.g. 2GB", func(s string) (err error) {
+		f.MinFree, err = discover.ParseSize(s)
+		return err
+	})
+}
+
+// Dir is the temp directory of a run.
+type Dir struct {
+	Path string
+	lock *runlock.Lock
+}
+
+// Open creates the temp directory of run runID and makes it the process's
+// temp directory, through TMPDIR and its Windows and SQLite counterparts, so
+// that libraries writing temp files use it too. It fails with ErrLowSpace
+// if the space left is below -min-free.
+func (f *Flags) Open(runID string) (*Dir, error) {
+	base := f.Dir
+	if base == "" {
+		base = os.TempDir()
+	}
+	if err := os.MkdirAll(base, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create temp directory %s: %w", base, err)
+	}
+	if err := f.Check(base); err != nil {
+		return nil, err
+	}
+	sweep(base)
+	path, err := os.MkdirTemp(base, prefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	// The lock tells sweep the directory is in use.
+	lock, err := runlock.Acquire(filepath.Join(path, runlock.Name), runID, 0)
+	if err != nil {
+		_ = os.RemoveAll(path)
+		return nil, err
+	}
+	for _, name := range []string{"TMPDIR", "TMP", "TEMP", "SQLITE_TMPDIR"} {
+		_ = os.Setenv(name, path)
+	}
+	return &Dir{Path: path, lock: lock}, nil
+}
+
+// Remove removes the directory and all it holds. It is safe on a nil Dir.
+func (d *Dir) Remove() error {
+	if d == nil {
+		return nil
+	}
+	_ = d.lock.Release()
+	if err := os.RemoveAll(d.Path); err != nil {
+		return fmt.Errorf("failed to remove temp directory: %w", err)
+	}
+	return nil
+}
+
+// Check fails with ErrLowSpace if the volume of dir, or of its closest
+// existing parent, has less than -min-free left. Without -min-free, or
+// where free space can't be told, it passes.
+func (f *Flags) Check(dir string) error {
+	if f.MinFree <= 0 {
+		return nil
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	free, err := freeSpace(dir)
+	if err != nil {
+		return nil
+	}
+	if free < f.MinFree {
+		return fmt.Errorf("%w in %s: %s left, -min-free is %s", ErrLowSpace, dir, FormatSize(free), FormatSize(f.MinFree))
+	}
+	return nil
+}
+
+// sweep removes the run directories in base whose runs are gone, which is
+// when their lock can be taken.
+func sweep(base string) {
+	dirs, _ := filepath.Glob(filepath.Join(base, prefix+"*"))
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() || time.Since(info.ModTime()) < sweepAge {
+			continue
+		}
+		lock, err := runlock.Acquire(filepath.Join(dir, runlock.Name), "sweep", 0)
+		if err != nil {
+			continue
+		}
+		_ = lock.Release()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// FormatSize formats n bytes for messages, e.g. "1.5GB".
+func FormatSize(n int64) string {
+	const unit = 1 << 10
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,37 @@
+package throttle
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+const (
+	ioprioWhoThread = 1 // IOPRIO_WHO_PROCESS, which takes a thread ID
+	ioprioIdle      = 3 << 13
+)
+
+// renice lowers the CPU priority and sets the idle IO class. On Linux both
+// are per thread, so every thread of the process is changed; the threads the
+// runtime starts later inherit them.
+func renice() error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, niceness); err != nil {
+			errs = append(errs, err)
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoThread, uintptr(tid), ioprioIdle); errno != 0 {
+			errs = append(errs, errno)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package throttle
+
+import "errors"
+
+func renice() error {
+	return errors.New("not supported on this platform")
+}
@@ -0,0 +1,11 @@
+//go:build unix && !linux
+
+package throttle
+
+import "syscall"
+
+// renice lowers the CPU priority of the process. There is no portable IO
+// priority, so that is all.
+func renice() error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, 0, niceness)
+}
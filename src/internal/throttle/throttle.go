@@ -0,0 +1,119 @@
+// Package throttle keeps runs on shared hosts from starving co-located
+// services: it limits the bandwidth the tools read their inputs with and
+// lowers their CPU and IO priority.
+package throttle
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"csvtools/src/internal/discover"
+)
+
+// niceness is the CPU priority of -nice, as for nice(1).
+const niceness = 10
+
+// Limiter is a token bucket of bytes shared by all the readers of a run, so
+// that the limit holds for the run as a whole. A nil Limiter doesn't limit.
+type Limiter struct {
+	rate  float64 // bytes per second
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a limiter of bytesPerSecond, or nil for 0.
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	rate := float64(bytesPerSecond)
+	// A tenth of a second of bandwidth, so the rate is smooth, but at least
+	// a read buffer.
+	burst := max(rate/10, 64<<10)
+	return &Limiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Wait takes n bytes from the bucket, sleeping while it is in debt.
+func (l *Limiter) Wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.burst)
+	l.last = now
+	l.tokens -= float64(n)
+	debt := l.tokens
+	l.mu.Unlock()
+	if debt < 0 {
+		time.Sleep(time.Duration(-debt / l.rate * float64(time.Second)))
+	}
+}
+
+// Reader returns r reading at most at the rate of l.
+func (l *Limiter) Reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &reader{r: r, limiter: l}
+}
+
+type reader struct {
+	r       io.Reader
+	limiter *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > int(r.limiter.burst) {
+		p = p[:int(r.limiter.burst)]
+	}
+	n, err := r.r.Read(p)
+	r.limiter.Wait(n)
+	return n, err
+}
+
+// ParseRate parses a bandwidth such as "50MB/s" or "512KB"; the "/s" is
+// optional.
+func ParseRate(s string) (int64, error) {
+	n, err := discover.ParseSize(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return n, nil
+}
+
+// Flags binds -max-throughput and -nice.
+type Flags struct {
+	MaxThroughput int64
+	Nice          bool
+}
+
+// Register adds the flags to fs.
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.Func("max-throughput", "read the inputs at most this fast, e.g. 50MB/s (default unlimited)", func(s string) (err error) {
+		f.MaxThroughput, err = ParseRate(s)
+		return err
+	})
+	fs.BoolVar(&f.Nice, "nice", false, "run with low CPU and idle IO priority, leaving the disk to other services")
+}
+
+// Apply lowers the priority of the process with -nice and returns the
+// limiter of -max-throughput, which is nil without it. An error lowering the
+// priority is not fatal: the limiter is returned along with it.
+func (f *Flags) Apply() (*Limiter, error) {
+	limiter := NewLimiter(f.MaxThroughput)
+	if !f.Nice {
+		return limiter, nil
+	}
+	if err := renice(); err != nil {
+		return limiter, fmt.Errorf("failed to lower priority: %w", err)
+	}
+	return limiter, nil
+}
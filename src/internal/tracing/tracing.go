@@ -0,0 +1,137 @@
+// Package tracing instruments the tools with OpenTelemetry spans, exported
+// over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set. The exporter is configured by
+// the standard OTEL_* variables; without an endpoint spans cost nothing.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"csvtools/src/internal/version"
+)
+
+// Enabled reports whether the environment configures an OTLP endpoint.
+func Enabled() bool {
+	if os.Getenv("OTEL_SDK_DISABLED") == "true" {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Setup installs the tracer provider of service and returns the function
+// flushing the spans, to be called before exiting. Without an endpoint it
+// installs nothing and the returned function does nothing.
+//
+// A TRACEPARENT variable, as set by orchestrators starting the tool from a
+// traced job, makes the spans children of that trace.
+func Setup(ctx context.Context, service string) (func(context.Context) error, error) {
+	if !Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			attribute.String("service.name", service),
+			attribute.String("service.version", version.Revision()),
+		),
+		// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES win over the above.
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+	)
+	if err != nil && !errors.Is(err, resource.ErrPartialResource) {
+		return nil, fmt.Errorf("failed to describe the service: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// Parent returns ctx carrying the remote span of the TRACEPARENT variable,
+// if set.
+func Parent(ctx context.Context) context.Context {
+	carrier := propagation.MapCarrier{"traceparent": os.Getenv("TRACEPARENT")}
+	if state := os.Getenv("TRACESTATE"); state != "" {
+		carrier["tracestate"] = state
+	}
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
+
+// Start starts a span named name as a child of the span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer("csvtools").Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends span, marking it failed with err unless err is nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Phases adds up the time spent in the interleaved phases of streaming an
+// input, such as parsing, every transform and writing, which would need a
+// span per row otherwise. Finish reports every phase as a child span
+// starting with the parent and lasting the phase's total time. Nothing is
+// measured unless the parent span is recording.
+type Phases struct {
+	ctx   context.Context
+	start time.Time
+	names []string
+	total []time.Duration
+}
+
+// NewPhases returns the phases of the span in ctx. Add takes the index of a
+// name.
+func NewPhases(ctx context.Context, names ...string) *Phases {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return &Phases{}
+	}
+	return &Phases{ctx: ctx, start: time.Now(), names: names, total: make([]time.Duration, len(names))}
+}
+
+// Now returns the current time, or the zero time when not measuring.
+func (p *Phases) Now() time.Time {
+	if p.ctx == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// Add adds the time since start, a time returned by Now, to phase i.
+func (p *Phases) Add(i int, start time.Time) {
+	if p.ctx != nil {
+		p.total[i] += time.Since(start)
+	}
+}
+
+// Finish reports the phases.
+func (p *Phases) Finish() {
+	if p.ctx == nil {
+		return
+	}
+	for i, name := range p.names {
+		_, span := otel.Tracer("csvtools").Start(p.ctx, name,
+			trace.WithTimestamp(p.start), trace.WithAttributes(attribute.Bool("csvtools.cumulative", true)))
+		span.End(trace.WithTimestamp(p.start.Add(p.total[i])))
+	}
+}
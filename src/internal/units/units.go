@@ -0,0 +1,134 @@
+// Package units converts numbers between units of the same kind, such as
+// bytes to megabytes, cents to currency units, ounces to grams or degrees
+// Fahrenheit to Celsius, so reports show friendly values without formulas.
+package units
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// unit is a unit of a kind: a value v in it is v*scale+offset in the base
+// unit of the kind. Only temperatures have offsets.
+type unit struct {
+	kind   string
+	scale  float64
+	offset float64
+}
+
+// units maps lower case unit names and their aliases to units.
+var units = map[string]unit{}
+
+func define(kind string, scale, offset float64, names ...string) {
+	for _, name := range names {
+		units[name] = unit{kind: kind, scale: scale, offset: offset}
+	}
+}
+
+func init() {
+	// Data sizes: decimal prefixes are powers of 1000, binary ones of 1024.
+	define("data", 1, 0, "b", "byte", "bytes")
+	define("data", 1e3, 0, "kb", "kilobytes")
+	define("data", 1e6, 0, "mb", "megabytes")
+	define("data", 1e9, 0, "gb", "gigabytes")
+	define("data", 1e12, 0, "tb", "terabytes")
+	define("data", 1<<10, 0, "kib")
+	define("data", 1<<20, 0, "mib")
+	define("data", 1<<30, 0, "gib")
+	define("data", 1<<40, 0, "tib")
+	// Money: minor units such as cents to whole currency units.
+	define("money", 0.01, 0, "cents", "cent", "minor")
+	define("money", 1, 0, "currency", "major")
+	// Mass, in grams.
+	define("mass", 0.001, 0, "mg")
+	define("mass", 1, 0, "g", "grams")
+	define("mass", 1e3, 0, "kg", "kilograms")
+	define("mass", 1e6, 0, "t", "tonnes")
+	define("mass", 28.349523125, 0, "oz", "ounces")
+	define("mass", 453.59237, 0, "lb", "lbs", "pounds")
+	// Length, in metres.
+	define("length", 0.001, 0, "mm")
+	define("length", 0.01, 0, "cm")
+	define("length", 1, 0, "m", "metres", "meters")
+	define("length", 1e3, 0, "km")
+	define("length", 0.0254, 0, "in", "inches")
+	define("length", 0.3048, 0, "ft", "feet")
+	define("length", 0.9144, 0, "yd", "yards")
+	define("length", 1609.344, 0, "mi", "miles")
+	// Volume, in litres.
+	define("volume", 0.001, 0, "ml")
+	define("volume", 1, 0, "l", "litres", "liters")
+	define("volume", 3.785411784, 0, "gal", "gallons")
+	define("volume", 0.0295735295625, 0, "floz")
+	// Time, in seconds.
+	define("time", 0.001, 0, "ms")
+	define("time", 1, 0, "s", "seconds")
+	define("time", 60, 0, "min", "minutes")
+	define("time", 3600, 0, "h", "hours")
+	define("time", 86400, 0, "d", "days")
+	// Temperature, in kelvin.
+	define("temperature", 1, 0, "k", "kelvin")
+	define("temperature", 1, 273.15, "c", "celsius")
+	define("temperature", 5.0/9, 459.67*5/9, "f", "fahrenheit")
+}
+
+// Names lists the unit names, sorted.
+func Names() []string {
+	names := make([]string, 0, len(units))
+	for name := range units {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Conversion converts values from one unit to another.
+type Conversion struct {
+	from, to unit
+	// Decimals rounds converted values to that many decimals; negative
+	// values round to 6 and drop trailing zeros.
+	Decimals int
+}
+
+// New returns the conversion from unit from to unit to, both named as in
+// Names, ignoring case.
+func New(from, to string) (*Conversion, error) {
+	f, ok := units[strings.ToLower(strings.TrimSpace(from))]
+	if !ok {
+		return nil, fmt.Errorf("unknown unit %q", from)
+	}
+	t, ok := units[strings.ToLower(strings.TrimSpace(to))]
+	if !ok {
+		return nil, fmt.Errorf("unknown unit %q", to)
+	}
+	if f.kind != t.kind {
+		return nil, fmt.Errorf("can't convert %s (%s) to %s (%s)", from, f.kind, to, t.kind)
+	}
+	return &Conversion{from: f, to: t, Decimals: -1}, nil
+}
+
+// Value converts v.
+func (c *Conversion) Value(v float64) float64 {
+	return (v*c.from.scale + c.from.offset - c.to.offset) / c.to.scale
+}
+
+// Cell converts a cell holding a number, reporting false for one that
+// doesn't.
+func (c *Conversion) Cell(cell string) (string, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(cell), 64)
+	if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+		return cell, false
+	}
+	v = c.Value(v)
+	if c.Decimals >= 0 {
+		return strconv.FormatFloat(v, 'f', c.Decimals, 64), true
+	}
+	v = math.Round(v*1e6) / 1e6
+	if v == 0 {
+		v = 0 // no -0
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64), true
+}
@@ -0,0 +1,41 @@
+// Package version reports which commit of csvtools a binary was built from.
+package version
+
+import "runtime/debug"
+
+// Commit is set at build time with
+//
+//	-ldflags "-X csvtools/src/internal/version.Commit=$(git rev-parse HEAD)"
+//
+// which is needed for binaries built from a file list (go build
+// src/cmd/to_xlsx.go), as the go command only stamps VCS information into
+// packages built from a directory.
+var Commit string
+
+// Revision returns the git SHA csvtools was built from, with a "-dirty"
+// suffix for uncommitted changes, or "unknown".
+func Revision() string {
+	if Commit != "" {
+		return Commit
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	revision, dirty := "", false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			dirty = s.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "unknown"
+	}
+	if dirty {
+		revision += "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,155 @@
+package xlsx
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Formats is a flag.Value collecting "-format amount:#,##0.00;date:yyyy-mm-dd".
+// The flag may be repeated. Excel formats may themselves contain ";" and ":",
+// so a ";" only starts a new entry if the text before the next ":" names a
+// column of the sheet; see Columns.
+type Formats []string
+
+func (f *Formats) String() string {
+	return strings.Join(*f, ";")
+}
+
+func (f *Formats) Set(s string) error {
+	if !strings.Contains(s, ":") {
+		return fmt.Errorf("expected column:format, got %q", s)
+	}
+	*f = append(*f, s)
+	return nil
+}
+
+// Column is the number format of one sheet column.
+type Column struct {
+	// Format is the Excel number format code.
+	Format string
+	// Date is set for date and time formats; cells are then parsed as dates.
+	Date bool
+	// Style is the excelize style applying the format.
+	Style int
+}
+
+// Columns resolves the formats against the header of a sheet and registers
+// a style per format in file. Columns are named as in the header (after
+// normalization) or by 1-based index. Sheets combined from different files
+// have different headers, so an entry naming a column the header lacks is
+// skipped, along with the segments after it up to the next column of the
+// header, and its name returned in missing.
+func (f Formats) Columns(file *excelize.File, header []string) (columns map[int]*Column, missing []string, err error) {
+	columns = make(map[int]*Column)
+	styles := make(map[string]int)
+	for _, spec := range f {
+		var current *Column
+		for _, segment := range strings.Split(spec, ";") {
+			name, format, ok := strings.Cut(segment, ":")
+			idx := columnIndex(header, strings.TrimSpace(name))
+			switch {
+			case ok && idx >= 0:
+				current = &Column{Format: format}
+				columns[idx] = current
+			case current != nil:
+				current.Format += ";" + segment
+			case ok:
+				missing = append(missing, strings.TrimSpace(name))
+			}
+		}
+	}
+	for _, c := range columns {
+		c.Date = isDateFormat(c.Format)
+		style, ok := styles[c.Format]
+		if !ok {
+			format := c.Format
+			var err error
+			if style, err = file.NewStyle(&excelize.Style{CustomNumFmt: &format}); err != nil {
+				return nil, nil, fmt.Errorf("invalid number format %q: %w", c.Format, err)
+			}
+			styles[c.Format] = style
+		}
+		c.Style = style
+	}
+	return columns, missing, nil
+}
+
+// Names returns the columns the entries of f start with, which every run
+// must find in at least one sheet.
+func (f Formats) Names() []string {
+	var names []string
+	for _, spec := range f {
+		name, _, _ := strings.Cut(spec, ":")
+		names = append(names, strings.TrimSpace(name))
+	}
+	return names
+}
+
+func columnIndex(header []string, name string) int {
+	for i, h := range header {
+		if h == name {
+			return i
+		}
+	}
+	if n, err := strconv.Atoi(name); err == nil && n >= 1 && n <= len(header) {
+		return n - 1
+	}
+	return -1
+}
+
+// literalText matches the parts of a format code that are not format
+// characters: quoted text, [colors/locales] and escaped characters.
+var literalText = regexp.MustCompile(`"[^"]*"|\[[^\]]*\]|\\.`)
+
+// isDateFormat reports whether a format code formats dates or times, i.e.
+// uses y, d, h or s outside literal text ("m" alone is ambiguous).
+func isDateFormat(format string) bool {
+	return strings.ContainsAny(strings.ToLower(literalText.ReplaceAllString(format, "")), "ydhs")
+}
+
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	time.RFC3339Nano,
+}
+
+// ParseDate parses cell as an ISO date, a date and time, or RFC 3339.
+func ParseDate(cell string) (time.Time, bool) {
+	cell = strings.TrimSpace(cell)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, cell); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Value converts cell for a formatted column: a time.Time for date formats
+// and a float64 for number formats. ok is false if the cell does not parse,
+// in which case it is kept as text.
+func (c *Column) Value(cell string) (value any, ok bool) {
+	cell = strings.TrimSpace(cell)
+	if c.Date {
+		if t, ok := ParseDate(cell); ok {
+			return t, true
+		}
+		return nil, false
+	}
+	if !looseNumber.MatchString(cell) {
+		return nil, false
+	}
+	f, err := strconv.ParseFloat(cell, 64)
+	return f, err == nil
+}
+
+// looseNumber accepts decimal numbers including leading zeros, which an
+// explicit number format is asked to display anyway.
+var looseNumber = regexp.MustCompile(`^[-+]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
@@ -0,0 +1,163 @@
+package xlsx
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"csvtools/src/internal/csvio"
+	"csvtools/src/internal/discover"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// InputFlags binds -xlsx and -sheets, which read workbooks as inputs besides
+// CSV files: every selected sheet is loaded as if it were a CSV file whose
+// first row is the header.
+type InputFlags struct {
+	Enabled bool
+	// Sheets holds case-insensitive filepath.Match patterns for the sheet
+	// names to read; empty reads every visible sheet.
+	Sheets []string
+}
+
+// Register adds the flags to fs.
+func (f *InputFlags) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.Enabled, "xlsx", false, "also read the sheets of .xlsx workbooks found among the inputs")
+	fs.Func("sheets", "comma separated names or patterns (e.g. Sales*) of the workbook sheets to read (default every visible sheet)", func(s string) error {
+		for _, p := range strings.Split(s, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				if _, err := filepath.Match(p, ""); err != nil {
+					return fmt.Errorf("invalid sheet pattern %q: %w", p, err)
+				}
+				f.Sheets = append(f.Sheets, strings.ToLower(p))
+			}
+		}
+		return nil
+	})
+}
+
+// Apply adds the xlsx extension to the files discovery picks up.
+func (f *InputFlags) Apply(discovery *discover.Options) {
+	if !f.Enabled {
+		return
+	}
+	exts := discovery.Extensions
+	if len(exts) == 0 {
+		exts = discover.DefaultExtensions
+	}
+	if !slices.ContainsFunc(exts, func(e discover.Extension) bool { return e.Name == "xlsx" }) {
+		discovery.Extensions = append(slices.Clone(exts), discover.Extension{Name: "xlsx", Delimiter: ','})
+	}
+}
+
+// Expand replaces the workbooks among files with a file per selected sheet,
+// extracted as CSV into dir and named <workbook>_<sheet>. The extracted
+// files keep the workbook's Path in Source. Other files are kept as they
+// are.
+func (f *InputFlags) Expand(files []discover.File, dir string) ([]discover.File, error) {
+	if !f.Enabled {
+		return files, nil
+	}
+	var out []discover.File
+	for _, file := range files {
+		if file.Ext != "xlsx" {
+			out = append(out, file)
+			continue
+		}
+		sheets, err := f.extract(file, dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read workbook %s: %w", file.Path, err)
+		}
+		out = append(out, sheets...)
+	}
+	return out, nil
+}
+
+func (f *InputFlags) selected(book *excelize.File, sheet string) bool {
+	if len(f.Sheets) == 0 {
+		visible, err := book.GetSheetVisible(sheet)
+		return err == nil && visible
+	}
+	for _, p := range f.Sheets {
+		if ok, _ := filepath.Match(p, strings.ToLower(sheet)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *InputFlags) extract(file discover.File, dir string) ([]discover.File, error) {
+	book, err := excelize.OpenFile(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = book.Close()
+	}()
+	var out []discover.File
+	for _, sheet := range book.GetSheetList() {
+		if !f.selected(book, sheet) {
+			continue
+		}
+		csvFile, err := os.CreateTemp(dir, "sheet-*.csv")
+		if err != nil {
+			return nil, err
+		}
+		err = writeSheet(book, sheet, csvFile)
+		if cerr := csvFile.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sheet %s: %w", sheet, err)
+		}
+		extracted := file
+		extracted.Path, extracted.Ext = csvFile.Name(), "csv"
+		extracted.Delimiter, extracted.FixedDelimiter = ',', true
+		extracted.Source = file.Path + "[" + sheet + "]"
+		if info, err := os.Stat(csvFile.Name()); err == nil {
+			extracted.Size = info.Size()
+		}
+		extracted.Name = file.Name + "_" + sheet
+		out = append(out, extracted)
+	}
+	return out, nil
+}
+
+// writeSheet writes the rows of sheet as CSV, formatted as Excel shows
+// them. Rows are padded to the header, as trailing empty cells are not
+// stored.
+func writeSheet(book *excelize.File, sheet string, out *os.File) error {
+	rows, err := book.Rows(sheet)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	w := csvio.NewWriter(out, csvio.WriterOptions{})
+	width := -1
+	for rows.Next() {
+		cells, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		if width < 0 {
+			width = len(cells)
+		}
+		for len(cells) < width {
+			cells = append(cells, "")
+		}
+		if err := w.Write(cells); err != nil {
+			return err
+		}
+	}
+	if err := rows.Error(); err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
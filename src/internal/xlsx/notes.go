@@ -0,0 +1,103 @@
+package xlsx
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Note is a comment to attach to a cell of the generated workbook.
+type Note struct {
+	// Sheet is the sheet name; empty or "*" means every sheet.
+	Sheet string
+	// Target is a column name, whose header cell gets the note, or a cell
+	// reference such as "B7".
+	Target string
+	Text   string
+}
+
+func (n Note) allSheets() bool {
+	return n.Sheet == "" || n.Sheet == "*"
+}
+
+// LoadNotes reads a notes sidecar: a CSV with sheet, target and comment
+// columns, or just target and comment for notes on every sheet. A first row
+// naming these columns is treated as a header and skipped.
+func LoadNotes(path string) ([]Note, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open notes %s: %w", path, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	var notes []Note
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read notes %s: %w", path, err)
+		}
+		if line == 1 && strings.EqualFold(record[len(record)-1], "comment") {
+			continue
+		}
+		switch len(record) {
+		case 2:
+			notes = append(notes, Note{Target: record[0], Text: record[1]})
+		case 3:
+			notes = append(notes, Note{Sheet: record[0], Target: record[1], Text: record[2]})
+		default:
+			return nil, fmt.Errorf("notes %s line %d: expected 2 or 3 columns, got %d", path, line, len(record))
+		}
+	}
+	return notes, nil
+}
+
+// AddNotes attaches the notes that apply to sheet, whose header row is
+// header. A column name matches before a cell reference. Notes for every
+// sheet naming a column the sheet does not have are skipped; any other
+// unresolvable target is an error.
+func AddNotes(f *excelize.File, sheet string, header []string, notes []Note, author string) error {
+	for _, note := range notes {
+		if !note.allSheets() && note.Sheet != sheet {
+			continue
+		}
+		cell := ""
+		for i, name := range header {
+			if name == note.Target {
+				cell, _ = excelize.CoordinatesToCellName(i+1, 1)
+				break
+			}
+		}
+		if cell == "" {
+			if _, _, err := excelize.CellNameToCoordinates(note.Target); err == nil {
+				cell = strings.ToUpper(note.Target)
+			}
+		}
+		if cell == "" {
+			if note.allSheets() {
+				continue
+			}
+			return fmt.Errorf("note target %q is neither a column of sheet %s nor a cell", note.Target, sheet)
+		}
+		err := f.AddComment(sheet, excelize.Comment{
+			Cell:      cell,
+			Author:    author,
+			Paragraph: []excelize.RichTextRun{{Text: note.Text}},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add note to %s!%s: %w", sheet, cell, err)
+		}
+	}
+	return nil
+}
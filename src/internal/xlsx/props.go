@@ -0,0 +1,100 @@
+package xlsx
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Properties are the document properties written into a workbook.
+type Properties struct {
+	Title       string
+	Subject     string
+	Author      string
+	Company     string
+	Keywords    string
+	Description string
+	// Custom holds custom properties by name; to_xlsx adds its own, such as
+	// the source directory and run ID.
+	Custom Custom
+}
+
+// Register adds the -title, -subject, -author, -company, -keywords,
+// -description and -property flags to fs.
+func (p *Properties) Register(fs *flag.FlagSet) {
+	fs.StringVar(&p.Title, "title", "", "workbook title property")
+	fs.StringVar(&p.Subject, "subject", "", "workbook subject property")
+	fs.StringVar(&p.Author, "author", "", "workbook author property")
+	fs.StringVar(&p.Company, "company", "", "workbook company property")
+	fs.StringVar(&p.Keywords, "keywords", "", "workbook keywords property")
+	fs.StringVar(&p.Description, "description", "", "workbook description property")
+	fs.Var(&p.Custom, "property", "custom workbook property as name=value (repeatable)")
+}
+
+// Custom is a flag.Value collecting "-property name=value".
+type Custom map[string]string
+
+func (c *Custom) String() string {
+	var parts []string
+	for name, value := range *c {
+		parts = append(parts, name+"="+value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (c *Custom) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	if *c == nil {
+		*c = make(Custom)
+	}
+	(*c)[strings.TrimSpace(name)] = value
+	return nil
+}
+
+// Apply writes the properties into f and stamps it as created and modified
+// now. Empty properties are left as they are.
+func (p Properties) Apply(f *excelize.File) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	err := f.SetDocProps(&excelize.DocProperties{
+		Created:     now,
+		Modified:    now,
+		Title:       p.Title,
+		Subject:     p.Subject,
+		Creator:     p.Author,
+		Keywords:    p.Keywords,
+		Description: p.Description,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set document properties: %w", err)
+	}
+	if p.Company != "" {
+		// SetAppProps replaces all application properties, so keep the others.
+		app, err := f.GetAppProps()
+		if err != nil {
+			return fmt.Errorf("failed to read application properties: %w", err)
+		}
+		app.Company = p.Company
+		if err := f.SetAppProps(app); err != nil {
+			return fmt.Errorf("failed to set company property: %w", err)
+		}
+	}
+	names := make([]string, 0, len(p.Custom))
+	for name := range p.Custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := f.SetCustomProps(excelize.CustomProperty{Name: name, Value: p.Custom[name]}); err != nil {
+			return fmt.Errorf("failed to set custom property %s: %w", name, err)
+		}
+	}
+	return nil
+}
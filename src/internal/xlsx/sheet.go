@@ -0,0 +1,107 @@
+package xlsx
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/unicode/norm"
+)
+
+// SheetNames turns file names into valid, unique sheet names. Excel limits
+// names to 31 UTF-16 code units, forbids : \ / ? * [ ] and leading or
+// trailing apostrophes, and compares names case-insensitively.
+type SheetNames struct {
+	taken map[string]bool
+}
+
+// Name returns the sheet name for a file name and reserves it. Names are
+// NFC normalized first, since macOS stores file names decomposed, and cut on
+// character boundaries. Clashes get a " (2)", " (3)", ... suffix.
+func (s *SheetNames) Name(file string) string {
+	if s.taken == nil {
+		s.taken = make(map[string]bool)
+	}
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]`, r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, norm.NFC.String(file))
+	name = strings.Trim(name, "'")
+	if name == "" {
+		name = "Sheet"
+	}
+	candidate := truncateUTF16(name, excelize.MaxSheetNameLength)
+	for n := 2; s.taken[strings.ToLower(candidate)]; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		candidate = truncateUTF16(name, excelize.MaxSheetNameLength-len(suffix)) + suffix
+	}
+	s.taken[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// Taken reports whether a sheet name has been handed out.
+func (s *SheetNames) Taken(name string) bool {
+	return s.taken[strings.ToLower(name)]
+}
+
+// truncateUTF16 cuts s to at most limit UTF-16 code units without splitting
+// a character.
+func truncateUTF16(s string, limit int) string {
+	units := 0
+	for i, r := range s {
+		units += utf16.RuneLen(r)
+		if units > limit {
+			return strings.TrimRight(s[:i], "'")
+		}
+	}
+	return s
+}
+
+// Direction is the layout of a sheet: "ltr", "rtl", or "auto" to lay out a
+// sheet right to left if its header is mostly in a right-to-left script.
+type Direction string
+
+func (d *Direction) String() string {
+	return string(*d)
+}
+
+func (d *Direction) Set(s string) error {
+	switch Direction(strings.ToLower(s)) {
+	case "ltr", "rtl", "auto":
+		*d = Direction(strings.ToLower(s))
+		return nil
+	}
+	return fmt.Errorf("unknown direction %q (want ltr, rtl or auto)", s)
+}
+
+// Apply sets the layout of sheet given its header row.
+func (d Direction) Apply(f *excelize.File, sheet string, header []string) error {
+	rtl := d == "rtl" || d == "auto" && rightToLeft(header)
+	if !rtl {
+		return nil
+	}
+	return f.SetSheetView(sheet, -1, &excelize.ViewOptions{RightToLeft: &rtl})
+}
+
+var rtlScripts = []*unicode.RangeTable{unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana, unicode.Nko}
+
+// rightToLeft reports whether most letters of cells are in a right-to-left script.
+func rightToLeft(cells []string) bool {
+	letters, rtl := 0, 0
+	for _, cell := range cells {
+		for _, r := range cell {
+			if !unicode.IsLetter(r) {
+				continue
+			}
+			letters++
+			if unicode.In(r, rtlScripts...) {
+				rtl++
+			}
+		}
+	}
+	return rtl*2 > letters
+}
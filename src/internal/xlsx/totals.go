@@ -0,0 +1,241 @@
+// Package xlsx holds the spreadsheet features of to_xlsx that go beyond
+// copying cells: totals rows, number formats and the like.
+package xlsx
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Aggregate is a function of a totals row.
+type Aggregate string
+
+const (
+	Sum   Aggregate = "sum"
+	Avg   Aggregate = "avg"
+	Count Aggregate = "count"
+	Min   Aggregate = "min"
+	Max   Aggregate = "max"
+)
+
+// subtotal maps an aggregate to its SUBTOTAL function number. The 10x
+// variants ignore rows hidden by a filter as well as nested subtotals.
+var subtotal = map[Aggregate]int{Sum: 109, Avg: 101, Count: 102, Min: 105, Max: 104}
+
+var labels = map[Aggregate]string{Sum: "Total", Avg: "Average", Count: "Count", Min: "Min", Max: "Max"}
+
+// Aggregates is a flag.Value parsing "-totals sum,avg,count".
+type Aggregates []Aggregate
+
+func (a *Aggregates) String() string {
+	parts := make([]string, len(*a))
+	for i, agg := range *a {
+		parts[i] = string(agg)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (a *Aggregates) Set(s string) error {
+	var out Aggregates
+	for _, part := range strings.Split(s, ",") {
+		agg := Aggregate(strings.ToLower(strings.TrimSpace(part)))
+		if _, ok := subtotal[agg]; !ok {
+			return fmt.Errorf("unknown totals function %q (want sum, avg, count, min or max)", part)
+		}
+		out = append(out, agg)
+	}
+	*a = out
+	return nil
+}
+
+var numberPattern = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// Number parses a cell that is plainly a decimal number, such as "12",
+// "-3.50" or "1e3". Codes with leading zeros like "007", and spellings such
+// as "Inf" or "0x1F", are not numbers so that they are kept as text.
+func Number(cell string) (float64, bool) {
+	if !numberPattern.MatchString(cell) {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(cell, 64)
+	return f, err == nil
+}
+
+// keyPattern matches the headers of key-like columns, such as "id",
+// "customer_id", "orderId", "Key" or "zip code", whose sums mean nothing.
+var keyPattern = regexp.MustCompile(`(?i)(^|[ _.-])(id|key|code|no|nr|number|zip)$|[a-z0-9](Id|ID|Key|Code|No|Nr)$`)
+
+// KeyLike reports whether a column named header holds keys rather than
+// quantities, so that it gets no totals unless asked for.
+func KeyLike(header string) bool {
+	return keyPattern.MatchString(strings.TrimSpace(header))
+}
+
+// Totals collects per column statistics while a sheet is written and appends
+// one row per aggregate below the data. Use one Totals per sheet.
+type Totals struct {
+	Aggregates Aggregates
+	// Formulas writes live SUBTOTAL formulas instead of computed values.
+	Formulas bool
+	// NumFmt holds the number format per column index, applied to the totals too.
+	NumFmt map[int]string
+	// Header names the columns of the sheet. Columns, if set, names the
+	// columns to total, ignoring case; otherwise every numeric column but
+	// the KeyLike ones is totalled.
+	Header  []string
+	Columns []string
+
+	columns []columnStats
+}
+
+type columnStats struct {
+	count      int
+	sum        float64
+	min, max   float64
+	nonNumeric bool
+}
+
+// Enabled reports whether any totals rows were requested.
+func (t *Totals) Enabled() bool {
+	return len(t.Aggregates) > 0
+}
+
+// Observe adds a data row to the statistics.
+func (t *Totals) Observe(record []string) {
+	for len(t.columns) < len(record) {
+		t.columns = append(t.columns, columnStats{})
+	}
+	for i, cell := range record {
+		c := &t.columns[i]
+		if cell == "" {
+			continue
+		}
+		f, ok := Number(cell)
+		if !ok {
+			c.nonNumeric = true
+			continue
+		}
+		if c.count == 0 || f < c.min {
+			c.min = f
+		}
+		if c.count == 0 || f > c.max {
+			c.max = f
+		}
+		c.count++
+		c.sum += f
+	}
+}
+
+// numeric reports whether column i only holds numbers.
+func (t *Totals) numeric(i int) bool {
+	return i < len(t.columns) && t.columns[i].count > 0 && !t.columns[i].nonNumeric
+}
+
+// totalled reports whether column i gets totals: it only holds numbers and
+// is one of Columns or, without them, not KeyLike.
+func (t *Totals) totalled(i int) bool {
+	if !t.numeric(i) {
+		return false
+	}
+	name := ""
+	if i < len(t.Header) {
+		name = t.Header[i]
+	}
+	if len(t.Columns) > 0 {
+		return slices.ContainsFunc(t.Columns, func(c string) bool { return strings.EqualFold(strings.TrimSpace(c), strings.TrimSpace(name)) })
+	}
+	return !KeyLike(name)
+}
+
+// labelColumn returns the index of the column the labels of the totals rows
+// go into: the first one without totals, or the one after the last column
+// if all have them.
+func (t *Totals) labelColumn() int {
+	width := max(len(t.columns), len(t.Header))
+	for i := range width {
+		if !t.totalled(i) {
+			return i
+		}
+	}
+	return width
+}
+
+// Write appends the totals rows to sheet after the data in rows firstRow to
+// lastRow, in bold. Each row is labelled, e.g. "Total", in labelColumn.
+func (t *Totals) Write(f *excelize.File, sheet string, firstRow, lastRow int) error {
+	if !t.Enabled() || lastRow < firstRow {
+		return nil
+	}
+	bold, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	boldFormatted := make(map[int]int)
+	for i, format := range t.NumFmt {
+		if t.totalled(i) {
+			if boldFormatted[i], err = f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}, CustomNumFmt: &format}); err != nil {
+				return err
+			}
+		}
+	}
+	label := t.labelColumn()
+	for n, agg := range t.Aggregates {
+		row := lastRow + 1 + n
+		cell, _ := excelize.CoordinatesToCellName(label+1, row)
+		if err := f.SetCellStr(sheet, cell, labels[agg]); err != nil {
+			return err
+		}
+		for i := range t.columns {
+			if !t.totalled(i) {
+				continue
+			}
+			cell, _ := excelize.CoordinatesToCellName(i+1, row)
+			if t.Formulas {
+				from, _ := excelize.CoordinatesToCellName(i+1, firstRow)
+				to, _ := excelize.CoordinatesToCellName(i+1, lastRow)
+				formula := fmt.Sprintf("SUBTOTAL(%d,%s:%s)", subtotal[agg], from, to)
+				if err := f.SetCellFormula(sheet, cell, formula); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := f.SetCellValue(sheet, cell, t.columns[i].value(agg)); err != nil {
+				return err
+			}
+		}
+		last, _ := excelize.CoordinatesToCellName(max(len(t.columns), label+1), row)
+		first, _ := excelize.CoordinatesToCellName(1, row)
+		if err := f.SetCellStyle(sheet, first, last, bold); err != nil {
+			return err
+		}
+		for i, style := range boldFormatted {
+			if agg == Count {
+				continue
+			}
+			cell, _ := excelize.CoordinatesToCellName(i+1, row)
+			if err := f.SetCellStyle(sheet, cell, cell, style); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c columnStats) value(agg Aggregate) float64 {
+	switch agg {
+	case Avg:
+		return c.sum / float64(c.count)
+	case Count:
+		return float64(c.count)
+	case Min:
+		return c.min
+	case Max:
+		return c.max
+	}
+	return c.sum
+}
@@ -0,0 +1,99 @@
+package xmlpath
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"csvtools/src/internal/discover"
+)
+
+// InputFlags binds -xml, -xml-record and -xml-field, which read XML files
+// as inputs besides CSV files.
+type InputFlags struct {
+	Enabled bool
+	Options
+}
+
+// Register adds the flags to fs.
+func (f *InputFlags) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.Enabled, "xml", false, "also read .xml files, with a row per record element")
+	fs.Func("xml-record", "path of the XML record elements, e.g. //item or /feed/entry (default "+DefaultRecord+", the children of the root)", func(s string) error {
+		f.Record = s
+		return f.Validate()
+	})
+	fs.Func("xml-field", "a column of the XML records as name=path relative to the record, e.g. id=@id or city=address/city (repeatable; default every attribute and leaf element)", func(s string) error {
+		field, err := ParseField(s)
+		if err != nil {
+			return err
+		}
+		f.Fields = append(f.Fields, field)
+		return nil
+	})
+}
+
+// Apply adds the xml extension to the files discovery picks up.
+func (f *InputFlags) Apply(discovery *discover.Options) {
+	if !f.Enabled {
+		return
+	}
+	exts := discovery.Extensions
+	if len(exts) == 0 {
+		exts = discover.DefaultExtensions
+	}
+	if !slices.ContainsFunc(exts, func(e discover.Extension) bool { return e.Name == "xml" }) {
+		discovery.Extensions = append(slices.Clone(exts), discover.Extension{Name: "xml", Delimiter: ','})
+	}
+}
+
+// Expand replaces the XML files among files with their records converted
+// to CSV in dir. The converted files keep the XML file's Path in Source.
+// Other files are kept as they are.
+func (f *InputFlags) Expand(files []discover.File, dir string) ([]discover.File, error) {
+	if !f.Enabled {
+		return files, nil
+	}
+	out := make([]discover.File, len(files))
+	for i, file := range files {
+		out[i] = file
+		if file.Ext != "xml" {
+			continue
+		}
+		converted, err := f.convert(file, dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read XML file %s: %w", file.Path, err)
+		}
+		out[i] = converted
+	}
+	return out, nil
+}
+
+func (f *InputFlags) convert(file discover.File, dir string) (discover.File, error) {
+	in, err := os.Open(file.Path)
+	if err != nil {
+		return file, err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	csvFile, err := os.CreateTemp(dir, "xml-*.csv")
+	if err != nil {
+		return file, err
+	}
+	err = f.WriteCSV(csvFile, in)
+	if cerr := csvFile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return file, err
+	}
+	converted := file
+	converted.Path, converted.Ext = csvFile.Name(), "csv"
+	converted.Delimiter, converted.FixedDelimiter = ',', true
+	converted.Source = file.Path
+	if info, err := os.Stat(csvFile.Name()); err == nil {
+		converted.Size = info.Size()
+	}
+	return converted, nil
+}
@@ -0,0 +1,391 @@
+// Package xmlpath turns XML into CSV: the elements a record path selects
+// become rows, and field paths relative to them become columns. Paths are a
+// subset of XPath: steps separated by / or //, each an element name, *, .,
+// @attribute or text(), optionally with predicates [n], [@a], [@a='v'],
+// [child], [child='v'] and [.='v']. Names match local names, so namespace
+// prefixes are ignored.
+package xmlpath
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// kind is what a step selects.
+type kind int
+
+const (
+	element kind = iota
+	self
+	attribute
+	text
+)
+
+// step is one step of a path.
+type step struct {
+	// descendant is set for steps after //, which search all descendants
+	// rather than the children.
+	descendant bool
+	kind       kind
+	// name is the element or attribute name, or "*".
+	name  string
+	preds []predicate
+}
+
+// predicate filters the nodes a step selects: by position if pos is set,
+// else by an attribute (attr set), a child element or, for ".", the node
+// itself, and its value if hasValue is set.
+type predicate struct {
+	pos      int
+	attr     bool
+	name     string
+	value    string
+	hasValue bool
+}
+
+// Path is a parsed path.
+type Path struct {
+	raw      string
+	absolute bool
+	steps    []step
+}
+
+func (p Path) String() string { return p.raw }
+
+// Parse parses a path.
+func Parse(raw string) (Path, error) {
+	p := Path{raw: raw}
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return p, fmt.Errorf("empty path")
+	}
+	p.absolute = strings.HasPrefix(s, "/")
+	descendant := false
+	for s != "" {
+		switch {
+		case strings.HasPrefix(s, "//"):
+			descendant, s = true, s[2:]
+			continue
+		case strings.HasPrefix(s, "/"):
+			s = s[1:]
+			continue
+		}
+		end := stepEnd(s)
+		st, err := parseStep(s[:end])
+		if err != nil {
+			return p, fmt.Errorf("invalid path %q: %w", raw, err)
+		}
+		st.descendant = descendant
+		p.steps = append(p.steps, st)
+		descendant, s = false, s[end:]
+	}
+	if len(p.steps) == 0 {
+		return p, fmt.Errorf("invalid path %q: no steps", raw)
+	}
+	for i, st := range p.steps[:len(p.steps)-1] {
+		if st.kind == attribute || st.kind == text {
+			return p, fmt.Errorf("invalid path %q: step %d must be the last", raw, i+1)
+		}
+	}
+	return p, nil
+}
+
+// stepEnd returns the end of the step s starts with: the next / outside
+// brackets and quotes.
+func stepEnd(s string) int {
+	depth, quote := 0, byte(0)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '/' && depth == 0:
+			return i
+		}
+	}
+	return len(s)
+}
+
+func parseStep(s string) (step, error) {
+	var st step
+	test, preds, _ := strings.Cut(s, "[")
+	switch test = strings.TrimSpace(test); {
+	case test == ".":
+		st.kind = self
+	case test == "text()":
+		st.kind = text
+	case strings.HasPrefix(test, "@"):
+		st.kind, st.name = attribute, localName(test[1:])
+	default:
+		st.kind, st.name = element, localName(test)
+	}
+	if st.kind != text && st.kind != self && !validName(st.name) {
+		return st, fmt.Errorf("invalid step %q", s)
+	}
+	if preds == "" {
+		return st, nil
+	}
+	if st.kind != element {
+		return st, fmt.Errorf("predicates only apply to elements, in %q", s)
+	}
+	for _, p := range strings.Split(strings.TrimSuffix(preds, "]"), "][") {
+		pred, err := parsePredicate(strings.TrimSpace(p))
+		if err != nil {
+			return st, err
+		}
+		st.preds = append(st.preds, pred)
+	}
+	return st, nil
+}
+
+func parsePredicate(s string) (predicate, error) {
+	var p predicate
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 {
+			return p, fmt.Errorf("invalid position [%s]", s)
+		}
+		p.pos = n
+		return p, nil
+	}
+	name, value, hasValue := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if p.attr = strings.HasPrefix(name, "@"); p.attr {
+		name = name[1:]
+	}
+	p.name = localName(name)
+	if p.name != "." && (!validName(p.name) || p.name == "*") {
+		return p, fmt.Errorf("invalid predicate [%s]", s)
+	}
+	if hasValue {
+		value = strings.TrimSpace(value)
+		if len(value) < 2 || (value[0] != '\'' && value[0] != '"') || value[len(value)-1] != value[0] {
+			return p, fmt.Errorf("invalid predicate [%s]: the value must be quoted", s)
+		}
+		p.value, p.hasValue = value[1:len(value)-1], true
+	}
+	return p, nil
+}
+
+// localName drops a namespace prefix.
+func localName(name string) string {
+	if _, local, ok := strings.Cut(name, ":"); ok {
+		return local
+	}
+	return name
+}
+
+func validName(name string) bool {
+	return name == "*" || (name != "" && !strings.ContainsAny(name, " \t[]()@='\"/"))
+}
+
+// frame is an open element while streaming.
+type frame struct {
+	name  string
+	attrs []xml.Attr
+}
+
+// matches reports whether the open elements in stack, outermost first,
+// are selected by the path as a record path. Relative paths match at any
+// depth.
+func (p Path) matches(stack []frame) bool {
+	steps := p.steps
+	if !p.absolute {
+		steps = append([]step{}, steps...)
+		steps[0].descendant = true
+	}
+	return matchSteps(steps, stack)
+}
+
+func matchSteps(steps []step, stack []frame) bool {
+	if len(steps) == 0 {
+		return len(stack) == 0
+	}
+	if len(stack) == 0 {
+		return false
+	}
+	st, top := steps[len(steps)-1], stack[len(stack)-1]
+	if st.name != "*" && st.name != top.name {
+		return false
+	}
+	for _, pred := range st.preds {
+		if !pred.attr || !pred.matchAttr(top.attrs) {
+			return false
+		}
+	}
+	rest, parents := steps[:len(steps)-1], stack[:len(stack)-1]
+	if !st.descendant {
+		return matchSteps(rest, parents)
+	}
+	for i := len(parents); i >= 0; i-- {
+		if matchSteps(rest, parents[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordPath checks that p can select records while streaming: elements
+// only, filtered by attributes.
+func (p Path) recordPath() error {
+	for _, st := range p.steps {
+		if st.kind != element {
+			return fmt.Errorf("record path %q must select elements", p.raw)
+		}
+		for _, pred := range st.preds {
+			if !pred.attr {
+				return fmt.Errorf("record path %q: only attribute predicates are supported", p.raw)
+			}
+		}
+	}
+	return nil
+}
+
+func (pred predicate) matchAttr(attrs []xml.Attr) bool {
+	for _, a := range attrs {
+		if a.Name.Local == pred.name {
+			return !pred.hasValue || a.Value == pred.value
+		}
+	}
+	return false
+}
+
+// node is an element read into memory.
+type node struct {
+	name  string
+	attrs []xml.Attr
+	// content holds the element's text as strings and its child elements
+	// as *node, in document order.
+	content []any
+}
+
+func (n *node) children() []*node {
+	var kids []*node
+	for _, c := range n.content {
+		if kid, ok := c.(*node); ok {
+			kids = append(kids, kid)
+		}
+	}
+	return kids
+}
+
+// value returns the text of n and its descendants.
+func (n *node) value() string {
+	var b strings.Builder
+	n.writeValue(&b)
+	return strings.TrimSpace(b.String())
+}
+
+func (n *node) writeValue(b *strings.Builder) {
+	for _, c := range n.content {
+		switch c := c.(type) {
+		case string:
+			b.WriteString(c)
+		case *node:
+			c.writeValue(b)
+		}
+	}
+}
+
+func (n *node) descendants(out []*node) []*node {
+	for _, kid := range n.children() {
+		out = append(out, kid)
+		out = kid.descendants(out)
+	}
+	return out
+}
+
+// eval returns the values p selects relative to record.
+func (p Path) eval(record *node) []string {
+	nodes := []*node{record}
+	for _, st := range p.steps {
+		switch st.kind {
+		case self:
+			continue
+		case attribute:
+			var values []string
+			for _, n := range nodes {
+				for _, a := range n.attrs {
+					if st.name == "*" || a.Name.Local == st.name {
+						values = append(values, a.Value)
+					}
+				}
+			}
+			return values
+		case text:
+			var values []string
+			for _, n := range nodes {
+				var b strings.Builder
+				for _, c := range n.content {
+					if s, ok := c.(string); ok {
+						b.WriteString(s)
+					}
+				}
+				if s := strings.TrimSpace(b.String()); s != "" {
+					values = append(values, s)
+				}
+			}
+			return values
+		}
+		var next []*node
+		for _, n := range nodes {
+			candidates := n.children()
+			if st.descendant {
+				candidates = n.descendants(nil)
+			}
+			var matched []*node
+			for _, c := range candidates {
+				if st.name == "*" || c.name == st.name {
+					matched = append(matched, c)
+				}
+			}
+			next = append(next, st.filter(matched)...)
+		}
+		nodes = next
+	}
+	values := make([]string, len(nodes))
+	for i, n := range nodes {
+		values[i] = n.value()
+	}
+	return values
+}
+
+// filter applies the predicates of st to the nodes it matched.
+func (st step) filter(nodes []*node) []*node {
+	for _, pred := range st.preds {
+		var kept []*node
+		for i, n := range nodes {
+			switch {
+			case pred.pos > 0:
+				if i+1 == pred.pos {
+					kept = append(kept, n)
+				}
+			case pred.attr:
+				if pred.matchAttr(n.attrs) {
+					kept = append(kept, n)
+				}
+			case pred.name == ".":
+				if !pred.hasValue || n.value() == pred.value {
+					kept = append(kept, n)
+				}
+			default:
+				for _, kid := range n.children() {
+					if kid.name == pred.name && (!pred.hasValue || kid.value() == pred.value) {
+						kept = append(kept, n)
+						break
+					}
+				}
+			}
+		}
+		nodes = kept
+	}
+	return nodes
+}
@@ -0,0 +1,223 @@
+package xmlpath
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"csvtools/src/internal/csvio"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// DefaultRecord selects the children of the root element, e.g. the item
+// elements of <items><item/><item/></items>.
+const DefaultRecord = "/*/*"
+
+// Field is a column and the path selecting its value relative to a record.
+type Field struct {
+	Name string
+	Path Path
+}
+
+// ParseField parses "name=path", e.g. "price=amount/@value".
+func ParseField(s string) (Field, error) {
+	name, raw, ok := strings.Cut(s, "=")
+	if name = strings.TrimSpace(name); !ok || name == "" {
+		return Field{}, fmt.Errorf("invalid field %q (want name=path)", s)
+	}
+	path, err := Parse(raw)
+	if err != nil {
+		return Field{}, err
+	}
+	return Field{Name: name, Path: path}, nil
+}
+
+// Options say which elements are records and what their columns are.
+type Options struct {
+	// Record is the path of the record elements; empty means DefaultRecord.
+	Record string
+	// Fields are the columns; without any, every record has a column per
+	// attribute and per element without child elements, named by its path
+	// below the record with "." between names, e.g. address.city.
+	Fields []Field
+}
+
+func (o Options) recordPath() (Path, error) {
+	raw := o.Record
+	if raw == "" {
+		raw = DefaultRecord
+	}
+	p, err := Parse(raw)
+	if err != nil {
+		return p, err
+	}
+	return p, p.recordPath()
+}
+
+// Validate checks the record path.
+func (o Options) Validate() error {
+	_, err := o.recordPath()
+	return err
+}
+
+// WriteCSV writes the records of the XML in r to w as CSV with a header
+// row. A field selecting several values joins them with commas. Without
+// Fields, columns are in the order they first appear and r is read twice,
+// first for the columns.
+func (o Options) WriteCSV(w io.Writer, r io.ReadSeeker) error {
+	record, err := o.recordPath()
+	if err != nil {
+		return err
+	}
+	cw := csvio.NewWriter(w, csvio.WriterOptions{})
+	if len(o.Fields) > 0 {
+		header := make([]string, len(o.Fields))
+		for i, f := range o.Fields {
+			header[i] = f.Name
+		}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		row := make([]string, len(o.Fields))
+		err = records(r, record, func(n *node) error {
+			for i, f := range o.Fields {
+				row[i] = strings.Join(f.Path.eval(n), ",")
+			}
+			return cw.Write(row)
+		})
+	} else {
+		err = writeAll(cw, r, record)
+	}
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeAll writes every attribute and leaf element of the records.
+func writeAll(cw *csvio.Writer, r io.ReadSeeker, record Path) error {
+	var columns []string
+	index := make(map[string]int)
+	err := records(r, record, func(n *node) error {
+		for _, f := range leaves(nil, "", n) {
+			if _, ok := index[f.key]; !ok {
+				index[f.key] = len(columns)
+				columns = append(columns, f.key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	row := make([]string, len(columns))
+	return records(r, record, func(n *node) error {
+		clear(row)
+		for _, f := range leaves(nil, "", n) {
+			if i := index[f.key]; row[i] == "" {
+				row[i] = f.value
+			} else {
+				row[i] += "," + f.value
+			}
+		}
+		return cw.Write(row)
+	})
+}
+
+// field is a column name and value of a record.
+type field struct {
+	key, value string
+}
+
+// leaves appends the attributes and leaf elements below n to out.
+func leaves(out []field, prefix string, n *node) []field {
+	for _, a := range n.attrs {
+		if a.Name.Space != "xmlns" && a.Name.Local != "xmlns" {
+			out = append(out, field{key: prefix + a.Name.Local, value: a.Value})
+		}
+	}
+	for _, kid := range n.children() {
+		if len(kid.children()) == 0 {
+			out = append(out, field{key: prefix + kid.name, value: kid.value()})
+			if len(kid.attrs) == 0 {
+				continue
+			}
+		}
+		out = leaves(out, prefix+kid.name+".", kid)
+	}
+	return out
+}
+
+// records calls fn with every element of the XML in r that record selects.
+// Records aren't searched for further records.
+func records(r io.Reader, record Path, fn func(*node) error) error {
+	dec := xml.NewDecoder(r)
+	dec.CharsetReader = func(label string, in io.Reader) (io.Reader, error) {
+		enc, err := htmlindex.Get(label)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported encoding %q", label)
+		}
+		return enc.NewDecoder().Reader(in), nil
+	}
+	var stack []frame
+	n := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, frame{name: t.Name.Local, attrs: t.Attr})
+			if !record.matches(stack) {
+				continue
+			}
+			n++
+			rec, err := readNode(dec, t)
+			if err != nil {
+				return fmt.Errorf("record %d: %w", n, err)
+			}
+			stack = stack[:len(stack)-1]
+			if err := fn(rec); err != nil {
+				return fmt.Errorf("record %d: %w", n, err)
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+// readNode reads the element start opens, up to its end.
+func readNode(dec *xml.Decoder, start xml.StartElement) (*node, error) {
+	n := &node{name: start.Name.Local, attrs: start.Attr}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			kid, err := readNode(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			n.content = append(n.content, kid)
+		case xml.CharData:
+			n.content = append(n.content, string(t))
+		case xml.EndElement:
+			return n, nil
+		}
+	}
+}